@@ -5,11 +5,15 @@
 // Package definition provides basic Enterprise feature definitions.
 package definition
 
+import (
+	"context"
+)
+
 // CmdBuilder provides a builder for Enterprise commands.
 type CmdBuilder interface {
 }
 
 // Executor describes a command interface.
 type Executor interface {
-	Execute() error
+	Execute(ctx context.Context) error
 }
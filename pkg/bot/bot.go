@@ -183,7 +183,7 @@ func (a *App) setupChannels(assistant connection.Assistant, workspace config.Wor
 
 		a.dblabMu.RUnlock()
 		dbLabInstance.SetCfg(channel.DBLabParams)
-		assistant.AddChannel(channel.ChannelID, channel.Project, dbLabInstance)
+		assistant.AddChannel(channel, dbLabInstance)
 	}
 
 	return nil
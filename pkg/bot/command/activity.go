@@ -44,7 +44,7 @@ func NewActivityCmd(cmd *platform.Command, msg *models.Message, db *pgxpool.Pool
 }
 
 // Execute runs the activity command.
-func (c *ActivityCmd) Execute() error {
+func (c *ActivityCmd) Execute(ctx context.Context) error {
 	const truncateLength = 100
 
 	query := fmt.Sprintf(`select
@@ -62,7 +62,7 @@ where state in ('active', 'idle in transaction', 'disabled') and pid <> pg_backe
 	tableString := &strings.Builder{}
 	tableString.WriteString(ActivityCaption)
 
-	activity, err := querier.DBQuery(context.TODO(), c.db, query)
+	activity, err := querier.DBQuery(ctx, c.db, query)
 	if err != nil {
 		return errors.Wrap(err, "failed to make query")
 	}
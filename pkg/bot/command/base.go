@@ -5,8 +5,40 @@
 // Package command provides assistant commands.
 package command
 
+import (
+	"strings"
+	"unicode"
+)
+
 const PlanSize = 400
 
 const SeparatorPlan = "\n[...SKIP...]\n"
 
 const CutText = "_(The text in the preview above has been cut)_"
+
+// DryRunFlag defines the flag of commands which run queries in transactions which are always rolled back.
+const DryRunFlag = "--dry-run"
+
+// MsgDryRun describes the result of a dry run.
+const MsgDryRun = "_The query has been executed in a transaction which has been rolled back, the database has not been changed._"
+
+// splitDryRunFlag separates the dry-run flag from a query, e.g. "--dry-run delete from t".
+func splitDryRunFlag(query string) (bool, string) {
+	trimmed := strings.TrimSpace(query)
+
+	// Double hyphens could be substituted with a dash automatically on macOS.
+	for _, flag := range []string{DryRunFlag, "—dry-run"} {
+		if !strings.HasPrefix(trimmed, flag) {
+			continue
+		}
+
+		rest := trimmed[len(flag):]
+		if rest != "" && !unicode.IsSpace(rune(rest[0])) {
+			continue
+		}
+
+		return true, strings.TrimSpace(rest)
+	}
+
+	return false, query
+}
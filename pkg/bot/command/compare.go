@@ -0,0 +1,70 @@
+/*
+2020 © Postgres.ai
+*/
+
+package command
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+
+	"gitlab.com/postgres-ai/joe/pkg/connection"
+	"gitlab.com/postgres-ai/joe/pkg/models"
+	"gitlab.com/postgres-ai/joe/pkg/pgexplain"
+	"gitlab.com/postgres-ai/joe/pkg/services/platform"
+	"gitlab.com/postgres-ai/joe/pkg/util/text"
+)
+
+// MsgCompareOptionReq describes a compare error.
+const MsgCompareOptionReq = "Use `explain` at least twice in the session to compare execution plans, then run `compare`"
+
+// Compare shows a diff between the last two explains of the session.
+func Compare(msgSvc connection.Messenger, command *platform.Command, msg *models.Message, history []*pgexplain.Explain) error {
+	const minExplains = 2
+
+	if len(history) < minExplains {
+		return errors.New(MsgCompareOptionReq)
+	}
+
+	before, after := history[len(history)-2], history[len(history)-1]
+
+	diff := pgexplain.Compare(before, after)
+	diffText := diff.Render()
+	command.Response = diffText
+
+	shapeText := "The plan shape is the same"
+	if diff.HasShapeChanges() {
+		shapeText = "The plan shape has changed"
+	}
+
+	diffPreview, isTruncated := text.CutText(diffText, PlanSize, SeparatorPlan)
+
+	msg.AppendText(fmt.Sprintf("*Plan diff (previous → last explain):*\n%s\n```%s```", shapeText, diffPreview))
+
+	if err := msgSvc.UpdateText(msg); err != nil {
+		log.Err("Show the plan diff:", err)
+		return err
+	}
+
+	fileDiffPermalink, err := msgSvc.AddArtifact("plan-diff", diffText, msg.ChannelID, msg.MessageID)
+	if err != nil {
+		log.Err("File upload failed:", err)
+		return err
+	}
+
+	detailsText := ""
+	if isTruncated {
+		detailsText = " " + CutText
+	}
+
+	msg.AppendText(fmt.Sprintf("<%s|Full plan diff>%s", fileDiffPermalink, detailsText))
+
+	if err := msgSvc.UpdateText(msg); err != nil {
+		log.Err("File: ", err)
+		return err
+	}
+
+	return nil
+}
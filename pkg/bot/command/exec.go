@@ -7,12 +7,13 @@ package command
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 	"gitlab.com/postgres-ai/database-lab/pkg/log"
 
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
 	"gitlab.com/postgres-ai/joe/pkg/connection"
 	"gitlab.com/postgres-ai/joe/pkg/models"
 	"gitlab.com/postgres-ai/joe/pkg/services/platform"
@@ -20,34 +21,87 @@ import (
 )
 
 // MsgExecOptionReq describes an exec error.
-const MsgExecOptionReq = "Use `exec` to run query, e.g. `exec drop index some_index_name`"
+const MsgExecOptionReq = "Use `exec` to run query, e.g. `exec drop index some_index_name`. " +
+	"Add `" + DryRunFlag + "` to run the query in a transaction which is rolled back, e.g. `exec " + DryRunFlag + " delete from t`"
+
+// MsgDryRunTransactionControl describes an error of dry runs containing transaction control statements.
+const MsgDryRunTransactionControl = "Transaction control statements (e.g. `COMMIT` or `SAVEPOINT`) " +
+	"cannot be used with `" + DryRunFlag + "`, the query is run in a transaction which is rolled back"
+
+// MsgTransactionControl describes an error of queries containing transaction control statements in a begun transaction.
+const MsgTransactionControl = "Transaction control statements (e.g. `COMMIT` or `SAVEPOINT`) cannot be used " +
+	"in the transaction begun by `begin`. Use `commit` or `rollback` to finish it"
+
+// MsgSettingSaved describes a setting saved in the session.
+const MsgSettingSaved = "_The setting has been saved in the session, it is applied to all queries of the session. " +
+	"Use `settings` to see the session settings._"
+
+// execResultArtifact defines the name of the artifact with the full result of a query.
+const execResultArtifact = "exec-result.csv"
 
 // ExecCmd defines the exec command.
 type ExecCmd struct {
 	command   *platform.Command
 	message   *models.Message
-	db        *pgxpool.Pool
+	db        querier.DB
 	messenger connection.Messenger
+	limits    querier.TableLimits
+	settings  *querier.SessionSettings
+
+	settingLimits *querier.SessionLimits
 }
 
 // NewExec return a new exec command.
-func NewExec(command *platform.Command, msg *models.Message, db *pgxpool.Pool, messengerSvc connection.Messenger) *ExecCmd {
+// Rows returned by the query are rendered within the limits, the full result is uploaded as a CSV file.
+// SET and RESET commands are recorded in the session settings, limited settings cannot be set above their maximums
+// by any statement of the query.
+func NewExec(command *platform.Command, msg *models.Message, db querier.DB, messengerSvc connection.Messenger,
+	limits querier.TableLimits, settings *querier.SessionSettings, settingLimits *querier.SessionLimits) *ExecCmd {
 	return &ExecCmd{
-		command:   command,
-		message:   msg,
-		db:        db,
-		messenger: messengerSvc,
+		command:       command,
+		message:       msg,
+		db:            db,
+		messenger:     messengerSvc,
+		limits:        limits,
+		settings:      settings,
+		settingLimits: settingLimits,
 	}
 }
 
 // Execute runs the exec command.
-func (cmd ExecCmd) Execute() error {
-	if cmd.command.Query == "" {
+func (cmd ExecCmd) Execute(ctx context.Context) error {
+	dryRun, query := splitDryRunFlag(cmd.command.Query)
+	if query == "" {
 		return errors.New(MsgExecOptionReq)
 	}
 
+	cmd.command.Query = query
+
+	// Several statements are run in the transaction, so it must not be finished by any of them.
+	if _, inTransaction := cmd.db.(*querier.Transaction); dryRun || inTransaction {
+		for _, statement := range querier.SplitStatements(query) {
+			if !querier.IsTransactionControl(statement) {
+				continue
+			}
+
+			if inTransaction {
+				return errors.New(MsgTransactionControl)
+			}
+
+			return errors.New(MsgDryRunTransactionControl)
+		}
+	}
+
+	settingCommand, isSettingCommand := querier.ParseSettingCommand(query)
+
+	if cmd.settingLimits != nil {
+		if err := cmd.settingLimits.CheckQuery(query); err != nil {
+			return err
+		}
+	}
+
 	start := time.Now()
-	_, err := cmd.db.Exec(context.TODO(), cmd.command.Query)
+	execResult, err := cmd.exec(ctx, query, dryRun)
 	elapsed := time.Since(start)
 	if err != nil {
 		log.Err("Exec:", err)
@@ -56,6 +110,25 @@ func (cmd ExecCmd) Execute() error {
 
 	duration := util.DurationToString(elapsed)
 	result := fmt.Sprintf("The query has been executed. Duration: %s", duration)
+
+	if dryRun {
+		result += "\n" + MsgDryRun
+	}
+
+	if isSettingCommand && !dryRun && cmd.settings != nil {
+		cmd.settings.Apply(settingCommand)
+		result += "\n" + MsgSettingSaved
+	}
+
+	if execResult != nil {
+		resultText, err := cmd.renderResult(execResult)
+		if err != nil {
+			return err
+		}
+
+		result += "\n" + resultText
+	}
+
 	cmd.command.Response = result
 
 	cmd.message.AppendText(result)
@@ -66,3 +139,69 @@ func (cmd ExecCmd) Execute() error {
 
 	return nil
 }
+
+// renderResult renders rows returned by the query within the limits and uploads the full result.
+func (cmd ExecCmd) renderResult(execResult *querier.ExecResult) (string, error) {
+	resultCSV, err := querier.RenderCSV(execResult.Table)
+	if err != nil {
+		return "", err
+	}
+
+	permalink, err := cmd.messenger.AddArtifact(execResultArtifact, resultCSV, cmd.message.ChannelID, cmd.message.MessageID)
+	if err != nil {
+		log.Err("File upload failed:", err)
+		return "", err
+	}
+
+	table, isCut := querier.LimitTable(execResult.Table, cmd.limits)
+
+	tableString := &strings.Builder{}
+	tableString.WriteString(fmt.Sprintf("*Result (%d rows):*\n", execResult.RowCount))
+	querier.RenderTable(tableString, table)
+
+	if isCut {
+		tableString.WriteString("\n" + CutText)
+	}
+
+	resultLink := fmt.Sprintf("\n<%s|Full result (CSV)>", permalink)
+	if execResult.RowCount > querier.MaxExecResultRows {
+		resultLink += fmt.Sprintf(", the first %d rows", querier.MaxExecResultRows)
+	}
+
+	tableString.WriteString(resultLink)
+
+	return tableString.String(), nil
+}
+
+// exec runs the query, in a transaction which is rolled back for dry runs.
+// It returns rows of the last statement returning them, e.g. for SELECT or SHOW.
+func (cmd ExecCmd) exec(ctx context.Context, query string, dryRun bool) (*querier.ExecResult, error) {
+	conn, err := cmd.db.Acquire(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to acquire a connection")
+	}
+
+	defer conn.Release()
+
+	// Limits are applied again right after the query, settings changed in a transaction are kept until it ends.
+	if cmd.settingLimits != nil {
+		defer cmd.settingLimits.Enforce(context.Background(), conn.Conn())
+	}
+
+	if !dryRun {
+		return querier.DBExecWithResult(ctx, conn, query)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start a transaction")
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			log.Err("Failed to roll back a transaction:", err)
+		}
+	}()
+
+	return querier.DBExecWithResult(ctx, tx, query)
+}
@@ -5,11 +5,15 @@
 package command
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode"
 
-	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
 	"gitlab.com/postgres-ai/database-lab/pkg/log"
 
@@ -24,73 +28,342 @@ import (
 // MsgExplainOptionReq describes an explain error.
 const MsgExplainOptionReq = "Use `explain` to see the query's plan, e.g. `explain select 1`"
 
+// Artifact names of plan visualizations.
+const (
+	flameGraphArtifact = "plan-flamegraph.svg"
+	planHTMLArtifact   = "plan.html"
+	planRunsArtifact   = "plan-runs-json"
+)
+
+// RepeatFlag defines the flag of the explain command which runs a query several times in one session.
+const RepeatFlag = "--repeat"
+
+// maxExplainRepeats limits the number of runs of a query.
+const maxExplainRepeats = 10
+
 // Query Explain prefixes.
 const (
-	queryExplain        = "EXPLAIN (FORMAT TEXT) "
-	queryExplainAnalyze = "EXPLAIN (ANALYZE, COSTS, VERBOSE, BUFFERS, FORMAT JSON) "
+	queryExplain            = "EXPLAIN (FORMAT TEXT) "
+	queryExplainJSON        = "EXPLAIN (FORMAT JSON) "
+	queryExplainVerboseJSON = "EXPLAIN (VERBOSE, FORMAT JSON) "
 )
 
-// Explain runs an explain query.
-func Explain(msgSvc connection.Messenger, command *platform.Command, msg *models.Message,
-	explainConfig pgexplain.ExplainConfig, db *pgxpool.Pool) error {
+// Explain runs an explain query and returns the processed result.
+// The query may start with flags and EXPLAIN options, e.g. "--dry-run --repeat 3 (timing off, settings) delete from t".
+// The query is executed in a transaction which is rolled back if dryRun is set or the flag is given,
+// repeated runs are always rolled back unless the query is a plain SELECT.
+// Values of query parameters can be given in the trailing comment, e.g. "select * from t where id = $1 -- params: 42".
+// Literals and identifiers are anonymized if the anonymizer is given.
+func Explain(ctx context.Context, msgSvc connection.Messenger, command *platform.Command, msg *models.Message,
+	explainConfig pgexplain.ExplainConfig, db querier.DB, anonymizer *pgexplain.Anonymizer, dryRun bool) (*pgexplain.Explain, error) {
+	flags, query, err := splitExplainFlags(command.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRun = dryRun || flags.dryRun
+
+	options, query, err := pgexplain.SplitExplainOptions(query)
+	if err != nil {
+		return nil, err
+	}
+
+	command.Query = query
+
 	if command.Query == "" {
-		return errors.New(MsgExplainOptionReq)
+		return nil, errors.New(MsgExplainOptionReq)
+	}
+
+	// Repeated runs of statements which may modify data are rolled back, so every run sees the same data.
+	if flags.repeat > 1 && !querier.IsSelect(command.Query) {
+		dryRun = true
+		flags.dryRun = true
 	}
 
-	cmd := NewPlan(command, msg, db, msgSvc)
-	msgInitText, err := cmd.explainWithoutExecution(context.TODO())
+	if len(options) > 0 {
+		serverVersion, err := serverVersionNum(ctx, db)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the server version")
+		}
+
+		if err := options.Validate(serverVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := openQuerySession(ctx, db, command.Query)
 	if err != nil {
-		return errors.Wrap(err, "failed to run explain without execution")
+		return nil, err
 	}
 
-	// Explain analyze request and processing.
-	explainAnalyze, err := querier.DBQueryWithResponse(db, queryExplainAnalyze+command.Query)
+	// The session is cleaned up even if the command has been stopped.
+	defer session.close(context.Background())
+
+	settings, err := listSessionSettings(ctx, session.conn)
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "failed to get session settings")
+	}
+
+	cmd := NewPlan(command, msg, db, msgSvc, anonymizer)
+	cmd.session = session
+
+	msgInitText, err := cmd.explainWithoutExecution(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to run explain without execution")
+	}
+
+	// Explain analyze requests and processing.
+	runs, plansJSON, err := explainAnalyzeRuns(ctx, session, options.AnalyzeCommand(),
+		flags.repeat, dryRun, explainConfig, anonymizer)
+	if err != nil {
+		return nil, err
+	}
+
+	// The last run is shown, its data is the most likely to be cached.
+	explain := runs[len(runs)-1]
+	command.PlanExecJSON = plansJSON[len(plansJSON)-1]
+
+	msg.SetText(msgInitText)
+
+	if dryRun && (flags.dryRun || querier.IsDML(command.Query)) {
+		msg.AppendText(MsgDryRun)
+	}
+
+	title := "Plan with execution"
+	if len(options) > 0 {
+		title += fmt.Sprintf(" (%s)", options)
 	}
 
-	command.PlanExecJSON = explainAnalyze
+	if session.parameterized() && session.planCacheMode {
+		title += ", custom plan"
+	}
+
+	if len(runs) > 1 {
+		title += fmt.Sprintf(", run %d of %d", len(runs), len(runs))
+	}
+
+	if err := showExplain(msgSvc, command, msg, explain, title, settings); err != nil {
+		return nil, err
+	}
+
+	if len(runs) > 1 {
+		if err := showRuns(msgSvc, command, msg, runs, plansJSON); err != nil {
+			return nil, err
+		}
+	}
+
+	return explain, nil
+}
+
+// explainAnalyzeRuns executes the query the given number of times in one session and processes the plans.
+// Parameterized queries are executed with custom plans.
+func explainAnalyzeRuns(ctx context.Context, session *querySession, analyzeCommand string, repeat int, dryRun bool,
+	explainConfig pgexplain.ExplainConfig, anonymizer *pgexplain.Anonymizer) ([]*pgexplain.Explain, []string, error) {
+	runs := make([]*pgexplain.Explain, 0, repeat)
+	plansJSON := make([]string, 0, repeat)
+
+	for i := 0; i < repeat; i++ {
+		explainAnalyze, err := session.explain(ctx, analyzeCommand, planCacheModeCustom, dryRun)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		explainAnalyze, err = anonymizer.PlanJSON(explainAnalyze)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to anonymize the plan")
+		}
+
+		explain, err := pgexplain.NewExplain(explainAnalyze, explainConfig)
+		if err != nil {
+			log.Err("Explain parsing: ", err)
+
+			return nil, nil, err
+		}
+
+		runs = append(runs, explain)
+		plansJSON = append(plansJSON, explainAnalyze)
+	}
 
-	// Visualization.
-	explain, err := pgexplain.NewExplain(explainAnalyze, explainConfig)
+	return runs, plansJSON, nil
+}
+
+// showRuns posts timing and buffers of repeated runs and uploads their plans.
+func showRuns(msgSvc connection.Messenger, command *platform.Command, msg *models.Message,
+	runs []*pgexplain.Explain, plansJSON []string) error {
+	runsJSON, err := combinePlansJSON(plansJSON)
+	if err != nil {
+		log.Err("Combine plans: ", err)
+		return err
+	}
+
+	runsPermalink, err := msgSvc.AddArtifact(planRunsArtifact, runsJSON, msg.ChannelID, msg.MessageID)
 	if err != nil {
-		log.Err("Explain parsing: ", err)
+		log.Err("File upload failed:", err)
+		return err
+	}
+
+	runsText := pgexplain.RenderRuns(runs)
+	command.Stats += "\n" + runsText
 
+	msg.AppendText(fmt.Sprintf("*Repeated runs (the first one is cold, the others are warm):*\n```%s```\n<%s|Plans of all runs>",
+		runsText, runsPermalink))
+
+	if err := msgSvc.UpdateText(msg); err != nil {
+		log.Err("Show runs: ", err)
 		return err
 	}
 
+	return nil
+}
+
+// combinePlansJSON joins JSON plans of several runs into one JSON array.
+func combinePlansJSON(plansJSON []string) (string, error) {
+	combined := make([]json.RawMessage, 0, len(plansJSON))
+
+	for _, planJSON := range plansJSON {
+		var plans []json.RawMessage
+
+		if err := json.Unmarshal([]byte(planJSON), &plans); err != nil {
+			return "", errors.Wrap(err, "failed to parse a plan")
+		}
+
+		combined = append(combined, plans...)
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(combined); err != nil {
+		return "", errors.Wrap(err, "failed to encode plans")
+	}
+
+	return buf.String(), nil
+}
+
+// explainFlags defines flags of the explain command.
+type explainFlags struct {
+	dryRun bool
+	repeat int
+}
+
+// splitExplainFlags separates flags of the explain command from a query, e.g. "--dry-run --repeat 3 select 1".
+func splitExplainFlags(query string) (explainFlags, string, error) {
+	flags := explainFlags{repeat: 1}
+
+	for {
+		if dryRun, rest := splitDryRunFlag(query); dryRun {
+			flags.dryRun = true
+			query = rest
+
+			continue
+		}
+
+		repeat, rest, err := splitRepeatFlag(query)
+		if err != nil {
+			return explainFlags{}, "", err
+		}
+
+		if repeat == 0 {
+			return flags, query, nil
+		}
+
+		flags.repeat = repeat
+		query = rest
+	}
+}
+
+// splitRepeatFlag separates the repeat flag from a query, e.g. "--repeat 3 select 1" or "--repeat=3 select 1".
+// Zero is returned if the query does not start with the flag.
+func splitRepeatFlag(query string) (int, string, error) {
+	trimmed := strings.TrimSpace(query)
+
+	// Double hyphens could be substituted with a dash automatically on macOS.
+	for _, flag := range []string{RepeatFlag, "—repeat"} {
+		if !strings.HasPrefix(trimmed, flag) {
+			continue
+		}
+
+		rest := trimmed[len(flag):]
+		if rest == "" || (rest[0] != '=' && !unicode.IsSpace(rune(rest[0]))) {
+			continue
+		}
+
+		value := strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+		end := strings.IndexFunc(value, unicode.IsSpace)
+		if end < 0 {
+			end = len(value)
+		}
+
+		repeat, err := strconv.Atoi(value[:end])
+		if err != nil || repeat < 1 || repeat > maxExplainRepeats {
+			return 0, "", errors.Errorf("the number of runs must be from 1 to %d, e.g. `%s 3`", maxExplainRepeats, RepeatFlag)
+		}
+
+		return repeat, strings.TrimSpace(value[end:]), nil
+	}
+
+	return 0, query, nil
+}
+
+// showExplain posts the processed plan with artifacts, recommendations and the summary.
+// Settings changed in the session are added to the summary.
+func showExplain(msgSvc connection.Messenger, command *platform.Command, msg *models.Message,
+	explain *pgexplain.Explain, title string, settings []querier.Setting) error {
 	planText := explain.RenderPlanText()
 	command.PlanExecText = planText
+	command.PlanFingerprint = explain.Fingerprint()
 
 	planExecPreview, isTruncated := text.CutText(planText, PlanSize, SeparatorPlan)
 
-	msg.SetText(msgInitText)
-	msg.AppendText(fmt.Sprintf("*Plan with execution:*\n```%s```", planExecPreview))
+	msg.AppendText(fmt.Sprintf("*%s:*\n```%s```", title, planExecPreview))
 
-	if err = msgSvc.UpdateText(msg); err != nil {
-		log.Err("Show the plan with execution:", err)
+	if err := msgSvc.UpdateText(msg); err != nil {
+		log.Err("Show the plan:", err)
 
 		return err
 	}
 
-	if _, err := msgSvc.AddArtifact("plan-json", explainAnalyze, msg.ChannelID, msg.MessageID); err != nil {
+	if command.PlanExecJSON != "" {
+		if _, err := msgSvc.AddArtifact("plan-json", command.PlanExecJSON, msg.ChannelID, msg.MessageID); err != nil {
+			log.Err("File upload failed:", err)
+			return err
+		}
+	}
+
+	filePlanPermalink, err := msgSvc.AddArtifact("plan-text", planText, msg.ChannelID, msg.MessageID)
+	if err != nil {
 		log.Err("File upload failed:", err)
 		return err
 	}
 
-	filePlanPermalink, err := msgSvc.AddArtifact("plan-text", planText, msg.ChannelID, msg.MessageID)
+	fileFlameGraphPermalink, err := msgSvc.AddArtifact(flameGraphArtifact,
+		explain.RenderFlameGraph(pgexplain.FlameGraphTime), msg.ChannelID, msg.MessageID)
 	if err != nil {
 		log.Err("File upload failed:", err)
 		return err
 	}
 
+	planHTML, err := explain.RenderPlanHTML()
+	if err != nil {
+		log.Err("Render HTML plan:", err)
+		return err
+	}
+
+	if _, err := msgSvc.AddArtifact(planHTMLArtifact, planHTML, msg.ChannelID, msg.MessageID); err != nil {
+		log.Err("File upload failed:", err)
+		return err
+	}
+
 	detailsText := ""
 	if isTruncated {
 		detailsText = " " + CutText
 	}
 
-	msg.AppendText(fmt.Sprintf("<%s|Full execution plan>%s \n"+
-		"_Other artifacts are provided in the thread_", filePlanPermalink, detailsText))
+	msg.AppendText(fmt.Sprintf("<%s|Full execution plan>%s, <%s|Flame graph> \n"+
+		"_Other artifacts are provided in the thread_", filePlanPermalink, detailsText, fileFlameGraphPermalink))
 
 	if err = msgSvc.UpdateText(msg); err != nil {
 		log.Err("File: ", err)
@@ -104,17 +377,7 @@ func Explain(msgSvc connection.Messenger, command *platform.Command, msg *models
 		return err
 	}
 
-	recommends := ""
-	if len(tips) == 0 {
-		recommends += ":white_check_mark: Looks good"
-	} else {
-		for _, tip := range tips {
-			recommends += fmt.Sprintf(
-				":exclamation: %s – %s <%s|Show details>\n", tip.Name,
-				tip.Description, tip.DetailsUrl)
-		}
-	}
-
+	recommends := renderRecommendations(tips)
 	command.Recommendations = recommends
 
 	msg.AppendText("*Recommendations:*\n" + recommends)
@@ -124,10 +387,10 @@ func Explain(msgSvc connection.Messenger, command *platform.Command, msg *models
 	}
 
 	// Summary.
-	stats := explain.RenderStats()
+	stats := explain.RenderStats() + renderSessionSettings(settings)
 	command.Stats = stats
 
-	msg.AppendText(fmt.Sprintf("*Summary:*\n```%s```", stats))
+	msg.AppendText(fmt.Sprintf("*Summary:*\n```%s```\n%s", stats, renderFingerprint(command.PlanFingerprint)))
 	if err = msgSvc.UpdateText(msg); err != nil {
 		log.Err("Show summary: ", err)
 		return err
@@ -136,7 +399,72 @@ func Explain(msgSvc connection.Messenger, command *platform.Command, msg *models
 	return nil
 }
 
-func listHypoIndexes(ctx context.Context, db *pgxpool.Pool) ([]string, error) {
+// renderRecommendations renders tips with the plan nodes which triggered them.
+func renderRecommendations(tips []pgexplain.Tip) string {
+	const maxTipNodes = 5
+
+	if len(tips) == 0 {
+		return ":white_check_mark: Looks good"
+	}
+
+	recommends := strings.Builder{}
+
+	for _, tip := range tips {
+		recommends.WriteString(fmt.Sprintf("%s %s – %s", severityIcon(tip.Severity), tip.Name, tip.Description))
+
+		if tip.DetailsUrl != "" {
+			recommends.WriteString(fmt.Sprintf(" <%s|Show details>", tip.DetailsUrl))
+		}
+
+		recommends.WriteString("\n")
+
+		for i, node := range tip.Nodes {
+			if i == maxTipNodes {
+				recommends.WriteString(fmt.Sprintf("    • ...and %d more\n", len(tip.Nodes)-maxTipNodes))
+				break
+			}
+
+			recommends.WriteString(fmt.Sprintf("    • %s\n", node.String()))
+		}
+	}
+
+	return recommends.String()
+}
+
+// renderFingerprint renders the plan fingerprint.
+func renderFingerprint(fingerprint string) string {
+	return fmt.Sprintf("*Plan fingerprint:* `%s`", fingerprint)
+}
+
+func severityIcon(severity string) string {
+	switch severity {
+	case pgexplain.SeverityInfo:
+		return ":information_source:"
+
+	case pgexplain.SeverityCritical:
+		return ":bangbang:"
+	}
+
+	return ":exclamation:"
+}
+
+// rowQuerier defines the interface of pools and connections querying a single row.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// serverVersionNum returns the version of the server, e.g. 130002.
+func serverVersionNum(ctx context.Context, db rowQuerier) (int, error) {
+	var version int
+
+	if err := db.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func listHypoIndexes(ctx context.Context, db querier.DB) ([]string, error) {
 	rows, err := db.Query(ctx, "SELECT indexname FROM hypopg_list_indexes()")
 	if err != nil {
 		return nil, err
@@ -6,24 +6,28 @@ package command
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/jackc/pgconn"
-	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
 
 	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
 	"gitlab.com/postgres-ai/joe/pkg/connection"
 	"gitlab.com/postgres-ai/joe/pkg/models"
+	"gitlab.com/postgres-ai/joe/pkg/pgexplain"
 	"gitlab.com/postgres-ai/joe/pkg/services/platform"
 )
 
 // Hypo sub-commands
 const (
-	hypoCreate = "create"
-	hypoDesc   = "desc"
-	hypoDrop   = "drop"
-	hypoReset  = "reset"
+	hypoCreate  = "create"
+	hypoDesc    = "desc"
+	hypoDrop    = "drop"
+	hypoReset   = "reset"
+	hypoSuggest = "suggest"
 )
 
 // HypoPGCaption contains caption for rendered tables.
@@ -38,12 +42,12 @@ For a quick start, you can use prepared images: https://hub.docker.com/repositor
 type HypoCmd struct {
 	command   *platform.Command
 	message   *models.Message
-	db        *pgxpool.Pool
+	db        querier.DB
 	messenger connection.Messenger
 }
 
 // NewHypo creates a new Hypo command.
-func NewHypo(cmd *platform.Command, msg *models.Message, db *pgxpool.Pool, msgSvc connection.Messenger) *HypoCmd {
+func NewHypo(cmd *platform.Command, msg *models.Message, db querier.DB, msgSvc connection.Messenger) *HypoCmd {
 	return &HypoCmd{
 		command:   cmd,
 		message:   msg,
@@ -53,11 +57,9 @@ func NewHypo(cmd *platform.Command, msg *models.Message, db *pgxpool.Pool, msgSv
 }
 
 // Execute runs the hypo command.
-func (h *HypoCmd) Execute() error {
+func (h *HypoCmd) Execute(ctx context.Context) error {
 	hypoSub, commandTail := h.parseQuery()
 
-	ctx := context.TODO()
-
 	if err := h.initExtension(ctx); err != nil {
 		if pgError, ok := err.(*pgconn.PgError); ok && pgError.Code == querier.SystemPQErrorCodeUndefinedFile {
 			h.message.AppendText(hypoPGExceptionMessage)
@@ -84,6 +86,9 @@ func (h *HypoCmd) Execute() error {
 
 	case hypoReset:
 		return h.reset(ctx)
+
+	case hypoSuggest:
+		return h.suggest(ctx, commandTail)
 	}
 
 	return errors.New("invalid args given for the `hypo` command")
@@ -175,3 +180,188 @@ func (h *HypoCmd) reset(ctx context.Context) error {
 
 	return nil
 }
+
+// indexSuggestion defines a candidate index tested with HypoPG.
+type indexSuggestion struct {
+	candidate pgexplain.IndexCandidate
+	cost      float64
+	size      string
+}
+
+// suggest finds candidate indexes in the plan of the query, tests each of them as a hypothetical index
+// and shows indexes reducing the cost of the query, the most efficient first.
+func (h *HypoCmd) suggest(ctx context.Context, query string) error {
+	if query == "" {
+		return errors.New("query is required, e.g. `hypo suggest select * from orders where customer_id = 42`")
+	}
+
+	session, err := openQuerySession(ctx, h.db, query)
+	if err != nil {
+		return err
+	}
+
+	// The session is closed even if the command has been stopped.
+	defer session.close(context.Background())
+
+	// Existing hypothetical indexes would be taken into account both in the baseline and in plans with candidates.
+	existingIndexes, err := excludeHypoIndexes(ctx, session.conn)
+	if err != nil {
+		return err
+	}
+
+	defer restoreHypoIndexes(session.conn, existingIndexes)
+
+	planJSON, err := session.explain(ctx, queryExplainVerboseJSON, planCacheModeCustom, false)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the plan of the query")
+	}
+
+	plan, err := pgexplain.NewExplain(planJSON, pgexplain.ExplainConfig{})
+	if err != nil {
+		return errors.Wrap(err, "failed to parse the plan of the query")
+	}
+
+	candidates := pgexplain.FindIndexCandidates(&plan.Plan)
+	suggestions := []indexSuggestion{}
+
+	for _, candidate := range candidates {
+		suggestion, err := h.testIndexCandidate(ctx, session, candidate)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			log.Err("Failed to test a candidate index:", err)
+
+			continue
+		}
+
+		if suggestion != nil && suggestion.cost < plan.Plan.TotalCost {
+			suggestions = append(suggestions, *suggestion)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].cost < suggestions[j].cost
+	})
+
+	h.message.AppendText(renderIndexSuggestions(plan.Plan.TotalCost, len(candidates), suggestions))
+
+	if len(existingIndexes) > 0 {
+		h.message.AppendText(fmt.Sprintf("_%d existing hypothetical indexes have not been taken into account, "+
+			"they have been recreated with new IDs._", len(existingIndexes)))
+	}
+
+	if err := h.messenger.UpdateText(h.message); err != nil {
+		return errors.Wrap(err, "failed to publish message")
+	}
+
+	return nil
+}
+
+// excludeHypoIndexes removes hypothetical indexes of the connection and returns their definitions.
+func excludeHypoIndexes(ctx context.Context, conn querier.Conn) ([]string, error) {
+	rows, err := conn.Query(ctx, "select hypopg_get_indexdef(indexrelid) from hypopg_list_indexes()")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list hypothetical indexes")
+	}
+
+	defer rows.Close()
+
+	definitions := []string{}
+
+	for rows.Next() {
+		var definition string
+		if err := rows.Scan(&definition); err != nil {
+			return nil, errors.Wrap(err, "failed to scan a hypothetical index")
+		}
+
+		definitions = append(definitions, definition)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list hypothetical indexes")
+	}
+
+	if len(definitions) == 0 {
+		return definitions, nil
+	}
+
+	if _, err := conn.Exec(ctx, "select hypopg_reset()"); err != nil {
+		return nil, errors.Wrap(err, "failed to reset hypothetical indexes")
+	}
+
+	return definitions, nil
+}
+
+// restoreHypoIndexes recreates hypothetical indexes removed by excludeHypoIndexes, even if the command has been stopped.
+func restoreHypoIndexes(conn querier.Conn, definitions []string) {
+	for _, definition := range definitions {
+		if _, err := conn.Exec(context.Background(), "select hypopg_create_index($1)", definition); err != nil {
+			log.Err("Failed to recreate a hypothetical index:", err)
+		}
+	}
+}
+
+// testIndexCandidate creates the hypothetical index and plans the query again.
+// Nil is returned if the index is not used in the new plan.
+func (h *HypoCmd) testIndexCandidate(ctx context.Context, session *querySession,
+	candidate pgexplain.IndexCandidate) (*indexSuggestion, error) {
+	var (
+		indexID   uint32
+		indexName string
+		indexSize string
+	)
+
+	if err := session.conn.QueryRow(ctx,
+		"select indexrelid, indexname, pg_size_pretty(hypopg_relation_size(indexrelid)) from hypopg_create_index($1)",
+		candidate.Definition()).Scan(&indexID, &indexName, &indexSize); err != nil {
+		return nil, errors.Wrapf(err, "failed to create a hypothetical index %q", candidate.Definition())
+	}
+
+	defer func() {
+		if _, err := session.conn.Exec(context.Background(), "select hypopg_drop_index($1)", indexID); err != nil {
+			log.Err("Failed to drop a hypothetical index:", err)
+		}
+	}()
+
+	planJSON, err := session.explain(ctx, queryExplainJSON, planCacheModeCustom, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to plan the query with a hypothetical index")
+	}
+
+	if !isHypoIndexInvolved(planJSON, []string{indexName}) {
+		return nil, nil
+	}
+
+	plan, err := pgexplain.NewExplain(planJSON, pgexplain.ExplainConfig{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the plan")
+	}
+
+	return &indexSuggestion{candidate: candidate, cost: plan.Plan.TotalCost, size: indexSize}, nil
+}
+
+// renderIndexSuggestions renders ready-to-run statements of suggested indexes.
+func renderIndexSuggestions(queryCost float64, candidates int, suggestions []indexSuggestion) string {
+	sb := &strings.Builder{}
+	sb.WriteString(HypoPGCaption)
+
+	if len(suggestions) == 0 {
+		sb.WriteString(fmt.Sprintf("No indexes reducing the cost of the query (%.2f) found among %d candidates.\n",
+			queryCost, candidates))
+
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("%d of %d candidate indexes reduce the cost of the query (%.2f):\n",
+		len(suggestions), candidates, queryCost))
+
+	for i, suggestion := range suggestions {
+		sb.WriteString(fmt.Sprintf("%d. Cost: %.2f (-%.2f%%), estimated size: %s, found in: %s\n```%s;```\n",
+			i+1, suggestion.cost, (queryCost-suggestion.cost)/queryCost*100, suggestion.size, suggestion.candidate.Source,
+			suggestion.candidate.ConcurrentDefinition()))
+	}
+
+	return sb.String()
+}
@@ -9,13 +9,13 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 	"gitlab.com/postgres-ai/database-lab/pkg/log"
 
 	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
 	"gitlab.com/postgres-ai/joe/pkg/connection"
 	"gitlab.com/postgres-ai/joe/pkg/models"
+	"gitlab.com/postgres-ai/joe/pkg/pgexplain"
 	"gitlab.com/postgres-ai/joe/pkg/services/platform"
 	"gitlab.com/postgres-ai/joe/pkg/util/text"
 )
@@ -23,21 +23,29 @@ import (
 // MsgPlanOptionReq describes an explain without execution error.
 const MsgPlanOptionReq = "Use `plan` to see the query's plan without execution, e.g. `plan select 1`"
 
+// MsgGenericPlanDiffers describes the difference between generic and custom plans of a prepared statement.
+const MsgGenericPlanDiffers = ":warning: The generic plan differs from the custom one. " +
+	"Postgres may switch to the generic plan after several executions of the prepared statement."
+
 // PlanCmd defines the plan command.
 type PlanCmd struct {
-	command   *platform.Command
-	message   *models.Message
-	db        *pgxpool.Pool
-	messenger connection.Messenger
+	command    *platform.Command
+	message    *models.Message
+	db         querier.DB
+	messenger  connection.Messenger
+	anonymizer *pgexplain.Anonymizer
+	session    *querySession
 }
 
 // NewPlan return a new plan command.
-func NewPlan(cmd *platform.Command, msg *models.Message, db *pgxpool.Pool, messengerSvc connection.Messenger) *PlanCmd {
+func NewPlan(cmd *platform.Command, msg *models.Message, db querier.DB, messengerSvc connection.Messenger,
+	anonymizer *pgexplain.Anonymizer) *PlanCmd {
 	return &PlanCmd{
-		command:   cmd,
-		message:   msg,
-		db:        db,
-		messenger: messengerSvc,
+		command:    cmd,
+		message:    msg,
+		db:         db,
+		messenger:  messengerSvc,
+		anonymizer: anonymizer,
 	}
 }
 
@@ -47,38 +55,58 @@ func (cmd PlanCmd) Execute(ctx context.Context) error {
 		return errors.New(MsgPlanOptionReq)
 	}
 
+	session, err := openQuerySession(ctx, cmd.db, cmd.command.Query)
+	if err != nil {
+		return err
+	}
+
+	defer session.close(ctx)
+
+	cmd.session = session
+
 	if _, err := cmd.explainWithoutExecution(ctx); err != nil {
 		return errors.Wrap(err, "failed to run explain without execution")
 	}
 
+	if err := cmd.showFingerprint(); err != nil {
+		return errors.Wrap(err, "failed to show the plan fingerprint")
+	}
+
 	fmt.Println(cmd.message.Text)
 
 	return nil
 }
 
 // explainWithoutExecution runs explain without execution.
+// Parameterized queries get the custom plan, which depends on values of parameters, and the generic one.
 func (cmd *PlanCmd) explainWithoutExecution(ctx context.Context) (string, error) {
 	// Explain request and show.
-	explainResult, err := querier.DBQueryWithResponse(cmd.db, queryExplain+cmd.command.Query)
+	explainResult, err := cmd.session.explain(ctx, queryExplain, planCacheModeCustom, false)
 	if err != nil {
 		return "", err
 	}
 
-	cmd.command.PlanText = explainResult
-	planPreview, isTruncated := text.CutText(explainResult, PlanSize, SeparatorPlan)
-
-	msgInitText := cmd.message.Text
-
 	includeHypoPG := false
 	explainPlanTitle := ""
 
+	if cmd.session.parameterized() && cmd.session.planCacheMode {
+		explainPlanTitle = " (custom plan)"
+	}
+
 	if hypoIndexes, err := listHypoIndexes(ctx, cmd.db); err == nil && len(hypoIndexes) > 0 {
 		if isHypoIndexInvolved(explainResult, hypoIndexes) {
-			explainPlanTitle = " (HypoPG involved :ghost:)"
+			explainPlanTitle += " (HypoPG involved :ghost:)"
 			includeHypoPG = true
 		}
 	}
 
+	explainResult = cmd.anonymizer.PlanText(explainResult)
+
+	cmd.command.PlanText = explainResult
+	planPreview, isTruncated := text.CutText(explainResult, PlanSize, SeparatorPlan)
+
+	msgInitText := cmd.message.Text
+
 	cmd.message.AppendText(fmt.Sprintf("*Plan%s:*\n```%s```", explainPlanTitle, planPreview))
 
 	if err := cmd.messenger.UpdateText(cmd.message); err != nil {
@@ -92,10 +120,20 @@ func (cmd *PlanCmd) explainWithoutExecution(ctx context.Context) (string, error)
 		return "", err
 	}
 
-	if includeHypoPG {
+	if cmd.session.parameterized() && cmd.session.planCacheMode {
+		if err := cmd.showGenericPlan(ctx, explainResult); err != nil {
+			return "", err
+		}
+
+		msgInitText = cmd.message.Text
+	}
+
+	// The plan without hypothetical indexes is not available for prepared statements.
+	if includeHypoPG && !cmd.session.parameterized() {
 		msgInitText = cmd.message.Text
 
 		if explainResultWithoutHypo, err := cmd.runQueryWithoutHypo(ctx); err == nil {
+			explainResultWithoutHypo = cmd.anonymizer.PlanText(explainResultWithoutHypo)
 			planPreview, isTruncated = text.CutText(explainResultWithoutHypo, PlanSize, SeparatorPlan)
 
 			cmd.message.AppendText(fmt.Sprintf("*Plan without HypoPG indexes:*\n```%s```", planPreview))
@@ -131,6 +169,71 @@ func (cmd *PlanCmd) explainWithoutExecution(ctx context.Context) (string, error)
 	return msgInitText, nil
 }
 
+// showGenericPlan shows the generic plan of a parameterized query, which does not depend on values of parameters.
+func (cmd *PlanCmd) showGenericPlan(ctx context.Context, customPlan string) error {
+	genericPlan, err := cmd.session.explain(ctx, queryExplain, planCacheModeGeneric, false)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the generic plan")
+	}
+
+	genericPlan = cmd.anonymizer.PlanText(genericPlan)
+	planPreview, _ := text.CutText(genericPlan, PlanSize, SeparatorPlan)
+
+	cmd.message.AppendText(fmt.Sprintf("*Generic plan:*\n```%s```", planPreview))
+
+	if isPlanShapeChanged(customPlan, genericPlan) {
+		cmd.message.AppendText(MsgGenericPlanDiffers)
+	}
+
+	if err := cmd.messenger.UpdateText(cmd.message); err != nil {
+		log.Err("Show generic plan: ", err)
+		return err
+	}
+
+	if _, err := cmd.messenger.AddArtifact("plan-wo-execution-generic-text", genericPlan,
+		cmd.message.ChannelID, cmd.message.MessageID); err != nil {
+		log.Err("File upload failed:", err)
+		return err
+	}
+
+	return nil
+}
+
+// isPlanShapeChanged compares fingerprints of text plans.
+func isPlanShapeChanged(planText, otherPlanText string) bool {
+	explain, err := pgexplain.ParseExplain(planText, pgexplain.ExplainConfig{})
+	if err != nil {
+		return false
+	}
+
+	otherExplain, err := pgexplain.ParseExplain(otherPlanText, pgexplain.ExplainConfig{})
+	if err != nil {
+		return false
+	}
+
+	return explain.Fingerprint() != otherExplain.Fingerprint()
+}
+
+// showFingerprint shows the fingerprint of the plan shape.
+func (cmd *PlanCmd) showFingerprint() error {
+	explain, err := pgexplain.ParseExplain(cmd.command.PlanText, pgexplain.ExplainConfig{})
+	if err != nil {
+		log.Err("Failed to parse the plan to get a fingerprint:", err)
+		return nil
+	}
+
+	cmd.command.PlanFingerprint = explain.Fingerprint()
+
+	cmd.message.AppendText(renderFingerprint(cmd.command.PlanFingerprint))
+
+	if err := cmd.messenger.UpdateText(cmd.message); err != nil {
+		log.Err("Show the plan fingerprint: ", err)
+		return err
+	}
+
+	return nil
+}
+
 func (cmd *PlanCmd) runQueryWithoutHypo(ctx context.Context) (string, error) {
 	tx, err := cmd.db.Begin(ctx)
 	if err != nil {
@@ -146,7 +249,7 @@ func (cmd *PlanCmd) runQueryWithoutHypo(ctx context.Context) (string, error) {
 		return "", errors.Wrap(err, "failed to disable a hypopg setting")
 	}
 
-	queryWithoutHypo := fmt.Sprintf(`%s %s`, queryExplain, strings.Trim(cmd.command.Query, ";"))
+	queryWithoutHypo := fmt.Sprintf(`%s %s`, queryExplain, strings.Trim(cmd.session.query, ";"))
 
 	rows, err := tx.Query(ctx, queryWithoutHypo)
 	if err != nil {
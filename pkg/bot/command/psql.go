@@ -5,31 +5,26 @@
 package command
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
-	"github.com/pkg/errors"
 	"gitlab.com/postgres-ai/database-lab/pkg/log"
 
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
 	"gitlab.com/postgres-ai/joe/pkg/connection"
 	"gitlab.com/postgres-ai/joe/pkg/models"
 	"gitlab.com/postgres-ai/joe/pkg/services/platform"
-	"gitlab.com/postgres-ai/joe/pkg/transmission"
+	"gitlab.com/postgres-ai/joe/pkg/transmission/pgtransmission"
 	"gitlab.com/postgres-ai/joe/pkg/util/text"
 )
 
-// Transmit transmits to runner a psql command.
-func Transmit(cmd *platform.Command, msg *models.Message, msgSvc connection.Messenger, runner transmission.Runner) error {
-	// See transmission.prepareCommandParam for more comments.
-	if strings.ContainsAny(cmd.Query, "\n;\\ ") {
-		err := errors.New("query should not contain semicolons, new lines, spaces, and excess backslashes")
-		log.Err(err)
-		return err
-	}
-
+// Transmit runs a psql meta-command using catalog queries.
+func Transmit(ctx context.Context, cmd *platform.Command, msg *models.Message, msgSvc connection.Messenger, db querier.DB) error {
 	transmissionCmd := cmd.Command + " " + cmd.Query
 
-	output, err := runner.Run(transmissionCmd)
+	runner := pgtransmission.NewPgTransmitter(db)
+
+	output, err := runner.Run(ctx, transmissionCmd)
 	if err != nil {
 		log.Err(err)
 		return err
@@ -0,0 +1,140 @@
+/*
+2020 © Postgres.ai
+*/
+
+package command
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
+)
+
+// preparedStatementName defines the name of statements prepared for parameterized queries.
+const preparedStatementName = "joe_statement"
+
+// Plan cache modes of prepared statements.
+const (
+	planCacheModeCustom  = "force_custom_plan"
+	planCacheModeGeneric = "force_generic_plan"
+)
+
+// planCacheModeMinVersion defines the first version of Postgres supporting plan_cache_mode.
+const planCacheModeMinVersion = 120000
+
+// querySession runs explain commands of a query on one connection.
+// Parameterized queries, e.g. "select * from t where id = $1 -- params: 42", are run through a prepared statement.
+type querySession struct {
+	conn          querier.Conn
+	query         string
+	statement     *querier.PreparedStatement
+	planCacheMode bool
+	modeChanged   bool
+}
+
+// openQuerySession acquires a connection and prepares the statement if values of query parameters are given.
+func openQuerySession(ctx context.Context, db querier.DB, query string) (*querySession, error) {
+	query, params, err := querier.SplitQueryParams(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return openQuerySessionWithParams(ctx, db, query, params)
+}
+
+// openQuerySessionWithParams acquires a connection and prepares the statement if values of query parameters are given.
+func openQuerySessionWithParams(ctx context.Context, db querier.DB, query string, params []string) (*querySession, error) {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to acquire a connection")
+	}
+
+	session := &querySession{conn: conn, query: query}
+
+	if len(params) == 0 {
+		return session, nil
+	}
+
+	serverVersion, err := serverVersionNum(ctx, conn)
+	if err != nil {
+		conn.Release()
+		return nil, errors.Wrap(err, "failed to get the server version")
+	}
+
+	statement := &querier.PreparedStatement{Name: preparedStatementName, Query: query, Params: params}
+
+	if _, err := conn.Exec(ctx, statement.PrepareCommand()); err != nil {
+		conn.Release()
+		return nil, errors.Wrap(err, "failed to prepare the statement")
+	}
+
+	session.statement = statement
+	session.planCacheMode = serverVersion >= planCacheModeMinVersion
+
+	return session, nil
+}
+
+// parameterized checks if the query is run through a prepared statement.
+func (s *querySession) parameterized() bool {
+	return s.statement != nil
+}
+
+// setParam changes the value of the query parameter, e.g. 1 for $1, given as an SQL literal.
+func (s *querySession) setParam(param int, value string) {
+	s.statement.Params[param-1] = value
+}
+
+// explain runs the explain command of the query, e.g. "EXPLAIN (FORMAT TEXT) ".
+// Prepared statements are planned with the given plan cache mode if the server supports it.
+func (s *querySession) explain(ctx context.Context, explainCommand, planCacheMode string, inRollback bool) (string, error) {
+	query := explainCommand + s.query
+
+	if s.parameterized() {
+		query = explainCommand + s.statement.ExecuteCommand()
+
+		if s.planCacheMode {
+			if _, err := s.conn.Exec(ctx, "SET plan_cache_mode = "+planCacheMode); err != nil {
+				return "", errors.Wrap(err, "failed to set the plan cache mode")
+			}
+
+			s.modeChanged = true
+		}
+	}
+
+	if inRollback {
+		return querier.DBQueryWithResponseInRollback(ctx, s.conn, query)
+	}
+
+	return querier.DBQueryWithResponse(ctx, s.conn, query)
+}
+
+// close removes the prepared statement and returns the connection to the pool.
+func (s *querySession) close(ctx context.Context) {
+	defer s.conn.Release()
+
+	cleanupQueries := []string{}
+
+	if s.parameterized() {
+		cleanupQueries = append(cleanupQueries, s.statement.DeallocateCommand())
+	}
+
+	if s.modeChanged {
+		cleanupQueries = append(cleanupQueries, "RESET plan_cache_mode")
+	}
+
+	for _, query := range cleanupQueries {
+		if _, err := s.conn.Exec(ctx, query); err != nil {
+			log.Err("Failed to clean up the session:", err)
+
+			// The connection is closed, so the pool does not reuse its state.
+			if err := s.conn.Conn().Close(ctx); err != nil {
+				log.Err("Failed to close the connection:", err)
+			}
+
+			return
+		}
+	}
+}
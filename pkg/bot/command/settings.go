@@ -0,0 +1,131 @@
+/*
+2020 © Postgres.ai
+*/
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
+	"gitlab.com/postgres-ai/joe/pkg/connection"
+	"gitlab.com/postgres-ai/joe/pkg/models"
+	"gitlab.com/postgres-ai/joe/pkg/services/platform"
+)
+
+// SettingsCaption contains caption for rendered settings.
+const SettingsCaption = "*Session settings:*\n"
+
+// MsgNoSessionSettings describes how to change settings of a session.
+const MsgNoSessionSettings = "_No settings have been changed in the session. " +
+	"Use `exec set work_mem = '100MB'` to change a setting for all queries of the session, `exec reset work_mem` to reset it._"
+
+// nonDefaultSettingsQuery selects settings with values which differ from the built-in defaults.
+const nonDefaultSettingsQuery = `SELECT name, current_setting(name) AS value, source
+FROM pg_settings
+WHERE source NOT IN ('default', 'override')
+ORDER BY name`
+
+// sessionSettingsQuery selects settings changed in a session.
+const sessionSettingsQuery = `SELECT name, current_setting(name) FROM pg_settings WHERE source = 'session' ORDER BY name`
+
+// SettingsCmd defines the settings command.
+type SettingsCmd struct {
+	command   *platform.Command
+	message   *models.Message
+	db        querier.DB
+	messenger connection.Messenger
+	settings  *querier.SessionSettings
+}
+
+// NewSettings creates a new settings command.
+func NewSettings(cmd *platform.Command, msg *models.Message, db querier.DB, messengerSvc connection.Messenger,
+	settings *querier.SessionSettings) *SettingsCmd {
+	return &SettingsCmd{
+		command:   cmd,
+		message:   msg,
+		db:        db,
+		messenger: messengerSvc,
+		settings:  settings,
+	}
+}
+
+// Execute runs the settings command.
+func (cmd *SettingsCmd) Execute(ctx context.Context) error {
+	text := &strings.Builder{}
+	text.WriteString(SettingsCaption)
+
+	var recorded []querier.Setting
+	if cmd.settings != nil {
+		recorded = cmd.settings.List()
+	}
+
+	if len(recorded) == 0 {
+		text.WriteString(MsgNoSessionSettings + "\n")
+	}
+
+	for _, setting := range recorded {
+		text.WriteString(fmt.Sprintf("• `%s = %s`\n", setting.Name, setting.Value))
+	}
+
+	nonDefaultSettings, err := querier.DBQuery(ctx, cmd.db, nonDefaultSettingsQuery)
+	if err != nil {
+		return errors.Wrap(err, "failed to get settings")
+	}
+
+	text.WriteString("*Effective non-default values:*\n")
+	querier.RenderTable(text, nonDefaultSettings)
+
+	cmd.command.Response = text.String()
+
+	cmd.message.AppendText(text.String())
+	if err := cmd.messenger.UpdateText(cmd.message); err != nil {
+		log.Err("Show settings: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// listSessionSettings returns settings changed in the session of the connection, e.g. by SET.
+func listSessionSettings(ctx context.Context, conn querier.Conn) ([]querier.Setting, error) {
+	rows, err := conn.Query(ctx, sessionSettingsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := []querier.Setting{}
+
+	for rows.Next() {
+		var setting querier.Setting
+		if err := rows.Scan(&setting.Name, &setting.Value); err != nil {
+			return nil, err
+		}
+
+		settings = append(settings, setting)
+	}
+
+	return settings, rows.Err()
+}
+
+// renderSessionSettings renders settings changed in the session for the summary.
+func renderSessionSettings(settings []querier.Setting) string {
+	if len(settings) == 0 {
+		return ""
+	}
+
+	text := &strings.Builder{}
+	text.WriteString("\nSession settings:\n")
+
+	for _, setting := range settings {
+		text.WriteString(fmt.Sprintf("  - %s: %s\n", setting.Name, setting.Value))
+	}
+
+	return text.String()
+}
@@ -0,0 +1,444 @@
+/*
+2020 © Postgres.ai
+*/
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
+	"gitlab.com/postgres-ai/joe/pkg/connection"
+	"gitlab.com/postgres-ai/joe/pkg/models"
+	"gitlab.com/postgres-ai/joe/pkg/pgexplain"
+	"gitlab.com/postgres-ai/joe/pkg/services/platform"
+)
+
+// MsgStabilityOptionReq describes a stability error.
+const MsgStabilityOptionReq = "Use `stability` to check plans of a parameterized query with values sampled from `pg_stats`, " +
+	"e.g. `stability select * from orders where tenant_id = $1`"
+
+// ParamFlag defines the flag of the stability command which chooses the sampled parameter, e.g. "--param 2".
+const ParamFlag = "--param"
+
+// Limits of values sampled from statistics.
+const (
+	maxMostCommonSamples = 5
+	maxHistogramSamples  = 7
+)
+
+// columnStatsQuery selects the most common values and histogram bounds of a column.
+const columnStatsQuery = `SELECT most_common_vals::text::text[], most_common_freqs::float8[], histogram_bounds::text::text[]
+FROM pg_stats
+WHERE ($1 = '' OR schemaname = $1) AND tablename = $2 AND attname = $3
+ORDER BY inherited DESC
+LIMIT 1`
+
+// StabilityCmd defines the stability command, which checks if the plan of a query depends on values of a parameter.
+type StabilityCmd struct {
+	command       *platform.Command
+	message       *models.Message
+	db            querier.DB
+	messenger     connection.Messenger
+	explainConfig pgexplain.ExplainConfig
+	anonymizer    *pgexplain.Anonymizer
+}
+
+// stabilitySample defines a sampled value of the parameter and the plan of the query with the value.
+type stabilitySample struct {
+	value       string
+	source      string
+	histogram   bool
+	explain     *pgexplain.Explain
+	fingerprint string
+}
+
+// NewStability creates a new stability command.
+func NewStability(cmd *platform.Command, msg *models.Message, db querier.DB, messengerSvc connection.Messenger,
+	explainConfig pgexplain.ExplainConfig, anonymizer *pgexplain.Anonymizer) *StabilityCmd {
+	return &StabilityCmd{
+		command:       cmd,
+		message:       msg,
+		db:            db,
+		messenger:     messengerSvc,
+		explainConfig: explainConfig,
+		anonymizer:    anonymizer,
+	}
+}
+
+// Execute runs the stability command.
+// The query may start with the number of the sampled parameter, e.g. "--param 2", the first one is sampled by default.
+// Values of other parameters are given in the trailing comment, e.g. "-- params: 0, 'active'".
+func (cmd *StabilityCmd) Execute(ctx context.Context) error {
+	param, query, err := splitParamFlag(cmd.command.Query)
+	if err != nil {
+		return err
+	}
+
+	query, params, err := querier.SplitQueryParams(query)
+	if err != nil {
+		return err
+	}
+
+	if query == "" {
+		return errors.New(MsgStabilityOptionReq)
+	}
+
+	paramCount := querier.CountParams(query)
+
+	switch {
+	case paramCount == 0:
+		return errors.New("the query has no parameters. " + MsgStabilityOptionReq)
+
+	case param > paramCount:
+		return errors.Errorf("the query has no parameter $%d", param)
+
+	case len(params) == 0 && paramCount > 1:
+		return errors.Errorf("values of %d parameters are required in the trailing comment, e.g. `-- params: 1, 'abc'`, "+
+			"the value of $%d is replaced with samples", paramCount, param)
+
+	case len(params) == 0:
+		params = []string{"NULL"}
+
+	case len(params) != paramCount:
+		return errors.Errorf("the query has %d parameters, but %d values are given", paramCount, len(params))
+	}
+
+	session, err := openQuerySessionWithParams(ctx, cmd.db, query, params)
+	if err != nil {
+		return err
+	}
+
+	// The session is cleaned up even if the command has been stopped.
+	defer session.close(context.Background())
+
+	if !session.planCacheMode {
+		return errors.New("the stability check requires Postgres 12 or newer")
+	}
+
+	column, err := findParamColumn(ctx, session, param, cmd.explainConfig)
+	if err != nil {
+		return err
+	}
+
+	samples, err := sampleColumnValues(ctx, session.conn, column)
+	if err != nil {
+		return errors.Wrap(err, "failed to sample values")
+	}
+
+	if len(samples) == 0 {
+		return errors.Errorf("there are no statistics of %s, run `exec analyze %s` to collect them",
+			cmd.anonymizer.Identifier(column.Relation), cmd.anonymizer.Identifier(column.Relation))
+	}
+
+	for i := range samples {
+		session.setParam(param, querier.QuoteLiteral(samples[i].value))
+
+		planJSON, err := session.explain(ctx, queryExplainJSON, planCacheModeCustom, false)
+		if err != nil {
+			return errors.Wrapf(err, "failed to plan the query with the value %d", i+1)
+		}
+
+		explain, err := pgexplain.NewExplain(planJSON, cmd.explainConfig)
+		if err != nil {
+			log.Err("Explain parsing: ", err)
+			return err
+		}
+
+		explain.Anonymize(cmd.anonymizer)
+
+		samples[i].explain = explain
+		samples[i].fingerprint = explain.Fingerprint()
+	}
+
+	return cmd.showStability(param, column, samples)
+}
+
+// showStability posts plans of sampled values grouped by plan shapes.
+func (cmd *StabilityCmd) showStability(param int, column pgexplain.ParamColumn, samples []stabilitySample) error {
+	labels := planLabels(samples)
+
+	cmd.message.AppendText(fmt.Sprintf("*Plan stability of `$%d` compared with %s (%d values from pg_stats):*\n%s",
+		param, cmd.columnName(column), len(samples), cmd.renderSamples(samples, labels)))
+
+	cmd.message.AppendText(cmd.renderPlanGroups(param, samples, labels))
+
+	if err := cmd.messenger.UpdateText(cmd.message); err != nil {
+		log.Err("Show stability: ", err)
+		return err
+	}
+
+	plans := &strings.Builder{}
+
+	for i, sample := range samples {
+		plans.WriteString(fmt.Sprintf("-- $%d = %s (%s), plan %s\n%s\n",
+			param, cmd.displayValue(i, sample.value), sample.source, labels[sample.fingerprint], sample.explain.RenderPlanText()))
+	}
+
+	if _, err := cmd.messenger.AddArtifact("plan-stability-text", plans.String(), cmd.message.ChannelID,
+		cmd.message.MessageID); err != nil {
+		log.Err("File upload failed:", err)
+		return err
+	}
+
+	return nil
+}
+
+func (cmd *StabilityCmd) renderSamples(samples []stabilitySample, labels map[string]string) string {
+	table := [][]string{{"Value", "Source", "Rows", "Cost", "Plan"}}
+
+	for i, sample := range samples {
+		table = append(table, []string{
+			cmd.displayValue(i, sample.value),
+			sample.source,
+			strconv.FormatUint(sample.explain.Plan.PlanRows, 10),
+			fmt.Sprintf("%.2f", sample.explain.Plan.TotalCost),
+			labels[sample.fingerprint],
+		})
+	}
+
+	tableString := &strings.Builder{}
+	querier.RenderTable(tableString, table)
+
+	return tableString.String()
+}
+
+// renderPlanGroups describes plan shapes and values which lead to them.
+func (cmd *StabilityCmd) renderPlanGroups(param int, samples []stabilitySample, labels map[string]string) string {
+	if len(labels) == 1 {
+		return fmt.Sprintf(":white_check_mark: The plan is stable: all sampled values of `$%d` get the same plan `%s`: %s",
+			param, samples[0].fingerprint, strings.Join(samples[0].explain.RelationScans(), ", "))
+	}
+
+	text := &strings.Builder{}
+	text.WriteString(fmt.Sprintf(":warning: The plan depends on the value of `$%d`: %d different plans.\n*Plans:*\n",
+		param, len(labels)))
+
+	described := map[string]bool{}
+
+	for _, sample := range samples {
+		if described[sample.fingerprint] {
+			continue
+		}
+
+		described[sample.fingerprint] = true
+		count := 0
+
+		for _, other := range samples {
+			if other.fingerprint == sample.fingerprint {
+				count++
+			}
+		}
+
+		text.WriteString(fmt.Sprintf("• %s `%s` (%d of %d values): %s\n", labels[sample.fingerprint], sample.fingerprint,
+			count, len(samples), strings.Join(sample.explain.RelationScans(), ", ")))
+	}
+
+	text.WriteString("*Values:*\n")
+
+	mostCommon := map[string][]string{}
+
+	for i, sample := range samples {
+		if !sample.histogram {
+			label := labels[sample.fingerprint]
+			mostCommon[label] = append(mostCommon[label], fmt.Sprintf("`%s`", cmd.displayValue(i, sample.value)))
+		}
+	}
+
+	for _, label := range sortedLabels(labels) {
+		if values, ok := mostCommon[label]; ok {
+			text.WriteString(fmt.Sprintf("• Most common values with plan %s: %s\n", label, strings.Join(values, ", ")))
+		}
+	}
+
+	// Histogram bounds are sorted, so neighbouring values with the same plan form a range.
+	for start := 0; start < len(samples); {
+		if !samples[start].histogram {
+			start++
+			continue
+		}
+
+		end := start
+		for end+1 < len(samples) && samples[end+1].histogram && samples[end+1].fingerprint == samples[start].fingerprint {
+			end++
+		}
+
+		text.WriteString(fmt.Sprintf("• Range from `%s` to `%s`: plan %s\n", cmd.displayValue(start, samples[start].value),
+			cmd.displayValue(end, samples[end].value), labels[samples[start].fingerprint]))
+
+		start = end + 1
+	}
+
+	return text.String()
+}
+
+// displayValue hides sampled values if the anonymization is enabled.
+func (cmd *StabilityCmd) displayValue(index int, value string) string {
+	if cmd.anonymizer != nil {
+		return fmt.Sprintf("value %d", index+1)
+	}
+
+	return value
+}
+
+func (cmd *StabilityCmd) columnName(column pgexplain.ParamColumn) string {
+	return pgexplain.ParamColumn{
+		Schema:   cmd.anonymizer.Identifier(column.Schema),
+		Relation: cmd.anonymizer.Identifier(column.Relation),
+		Column:   cmd.anonymizer.Identifier(column.Column),
+	}.String()
+}
+
+// findParamColumn finds the column compared with the parameter in the generic plan of the query.
+func findParamColumn(ctx context.Context, session *querySession, param int,
+	explainConfig pgexplain.ExplainConfig) (pgexplain.ParamColumn, error) {
+	planJSON, err := session.explain(ctx, queryExplainVerboseJSON, planCacheModeGeneric, false)
+	if err != nil {
+		return pgexplain.ParamColumn{}, errors.Wrap(err, "failed to get the generic plan")
+	}
+
+	explain, err := pgexplain.NewExplain(planJSON, explainConfig)
+	if err != nil {
+		return pgexplain.ParamColumn{}, errors.Wrap(err, "failed to parse the generic plan")
+	}
+
+	column, ok := explain.FindParamColumn(param)
+	if !ok {
+		return pgexplain.ParamColumn{}, errors.Errorf("cannot find a column compared with `$%d` in conditions of the plan", param)
+	}
+
+	return column, nil
+}
+
+// sampleColumnValues samples the most common values and histogram bounds of the column.
+func sampleColumnValues(ctx context.Context, db rowQuerier, column pgexplain.ParamColumn) ([]stabilitySample, error) {
+	var (
+		mostCommonValues []string
+		mostCommonFreqs  []float64
+		histogramBounds  []string
+	)
+
+	if err := db.QueryRow(ctx, columnStatsQuery, column.Schema, column.Relation, column.Column).
+		Scan(&mostCommonValues, &mostCommonFreqs, &histogramBounds); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	samples := []stabilitySample{}
+
+	for i, value := range mostCommonValues {
+		if i == maxMostCommonSamples {
+			break
+		}
+
+		source := "most common"
+		if i < len(mostCommonFreqs) {
+			source += fmt.Sprintf(", %.2f%%", mostCommonFreqs[i]*100)
+		}
+
+		samples = append(samples, stabilitySample{value: value, source: source})
+	}
+
+	for _, index := range evenlySpacedIndexes(len(histogramBounds), maxHistogramSamples) {
+		samples = append(samples, stabilitySample{
+			value:     histogramBounds[index],
+			source:    fmt.Sprintf("histogram %d/%d", index+1, len(histogramBounds)),
+			histogram: true,
+		})
+	}
+
+	return samples, nil
+}
+
+// evenlySpacedIndexes returns up to limit indexes of a slice including the first and the last ones.
+func evenlySpacedIndexes(length, limit int) []int {
+	if length <= limit {
+		indexes := make([]int, 0, length)
+		for i := 0; i < length; i++ {
+			indexes = append(indexes, i)
+		}
+
+		return indexes
+	}
+
+	indexes := make([]int, 0, limit)
+	for i := 0; i < limit; i++ {
+		indexes = append(indexes, i*(length-1)/(limit-1))
+	}
+
+	return indexes
+}
+
+// planLabels assigns letters to plan fingerprints in the order of their appearance.
+func planLabels(samples []stabilitySample) map[string]string {
+	labels := map[string]string{}
+
+	for _, sample := range samples {
+		if _, ok := labels[sample.fingerprint]; !ok {
+			labels[sample.fingerprint] = planLabel(len(labels))
+		}
+	}
+
+	return labels
+}
+
+func planLabel(index int) string {
+	if index < 26 {
+		return string(rune('A' + index))
+	}
+
+	return strconv.Itoa(index + 1)
+}
+
+func sortedLabels(labels map[string]string) []string {
+	sorted := make([]string, 0, len(labels))
+	for i := 0; i < len(labels); i++ {
+		sorted = append(sorted, planLabel(i))
+	}
+
+	return sorted
+}
+
+// splitParamFlag separates the number of the sampled parameter from a query, e.g. "--param 2 select ...".
+func splitParamFlag(query string) (int, string, error) {
+	trimmed := strings.TrimSpace(query)
+
+	// Double hyphens could be substituted with a dash automatically on macOS.
+	for _, flag := range []string{ParamFlag, "—param"} {
+		if !strings.HasPrefix(trimmed, flag) {
+			continue
+		}
+
+		rest := trimmed[len(flag):]
+		if rest == "" || (rest[0] != '=' && !unicode.IsSpace(rune(rest[0]))) {
+			continue
+		}
+
+		value := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(rest, "=")), "$")
+
+		end := strings.IndexFunc(value, unicode.IsSpace)
+		if end < 0 {
+			end = len(value)
+		}
+
+		param, err := strconv.Atoi(value[:end])
+		if err != nil || param < 1 {
+			return 0, "", errors.Errorf("invalid number of the parameter, e.g. `%s 2`", ParamFlag)
+		}
+
+		return param, strings.TrimSpace(value[end:]), nil
+	}
+
+	return 1, query, nil
+}
@@ -43,7 +43,7 @@ func NewTerminateCmd(cmd *platform.Command, msg *models.Message, db *pgxpool.Poo
 }
 
 // Execute runs the terminate command.
-func (c *TerminateCmd) Execute() error {
+func (c *TerminateCmd) Execute(ctx context.Context) error {
 	pid, err := strconv.Atoi(c.command.Query)
 	if err != nil {
 		return errors.Wrap(err, "invalid pid given")
@@ -51,7 +51,7 @@ func (c *TerminateCmd) Execute() error {
 
 	query := "select pg_terminate_backend($1)::text"
 
-	terminate, err := querier.DBQuery(context.TODO(), c.db, query, pid)
+	terminate, err := querier.DBQuery(ctx, c.db, query, pid)
 	if err != nil {
 		return errors.Wrap(err, "failed to make query")
 	}
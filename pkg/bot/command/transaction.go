@@ -0,0 +1,88 @@
+/*
+2020 © Postgres.ai
+*/
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hako/durafmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
+	"gitlab.com/postgres-ai/joe/pkg/connection"
+	"gitlab.com/postgres-ai/joe/pkg/models"
+	"gitlab.com/postgres-ai/joe/pkg/services/platform"
+)
+
+// Messages of transaction commands.
+const (
+	MsgTransactionInProgress = "A transaction is already in progress. Use `commit` or `rollback` to finish it"
+	MsgNoTransaction         = "There is no transaction in progress. Use `begin` to start one"
+)
+
+// msgTransactionBegun describes a started transaction.
+const msgTransactionBegun = "The transaction has begun. Commands of the session run in it until `commit` or `rollback`."
+
+// Begin provides a command to begin a transaction on a connection pinned from the session pool.
+func Begin(ctx context.Context, cmd *platform.Command, msg *models.Message, msgSvc connection.Messenger,
+	pool *pgxpool.Pool, idleTimeout time.Duration, limits *querier.SessionLimits) (*querier.Transaction, error) {
+	tx, err := querier.BeginTransaction(ctx, pool, idleTimeout, limits)
+	if err != nil {
+		log.Err("Begin:", err)
+		return nil, err
+	}
+
+	result := msgTransactionBegun
+	if idleTimeout > 0 {
+		result += fmt.Sprintf(" The transaction is rolled back after %s of inactivity.", durafmt.Parse(idleTimeout))
+	}
+
+	if err := showTransactionResult(cmd, msg, msgSvc, result); err != nil {
+		if err := tx.Rollback(ctx); err != nil {
+			log.Err("Begin:", err)
+		}
+
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Commit provides a command to commit the transaction begun in the session.
+func Commit(ctx context.Context, cmd *platform.Command, msg *models.Message, msgSvc connection.Messenger,
+	tx *querier.Transaction) error {
+	if err := tx.Commit(ctx); err != nil {
+		log.Err("Commit:", err)
+		return err
+	}
+
+	return showTransactionResult(cmd, msg, msgSvc, "The transaction has been committed.")
+}
+
+// Rollback provides a command to roll back the transaction begun in the session.
+func Rollback(ctx context.Context, cmd *platform.Command, msg *models.Message, msgSvc connection.Messenger,
+	tx *querier.Transaction) error {
+	if err := tx.Rollback(ctx); err != nil {
+		log.Err("Rollback:", err)
+		return err
+	}
+
+	return showTransactionResult(cmd, msg, msgSvc, "The transaction has been rolled back.")
+}
+
+func showTransactionResult(cmd *platform.Command, msg *models.Message, msgSvc connection.Messenger, result string) error {
+	cmd.Response = result
+
+	msg.AppendText(result)
+	if err := msgSvc.UpdateText(msg); err != nil {
+		log.Err("Transaction:", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+2020 © Postgres.ai
+*/
+
+package command
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+
+	"gitlab.com/postgres-ai/joe/pkg/connection"
+	"gitlab.com/postgres-ai/joe/pkg/models"
+	"gitlab.com/postgres-ai/joe/pkg/pgexplain"
+	"gitlab.com/postgres-ai/joe/pkg/services/platform"
+)
+
+// MsgVisualizeOptionReq describes a visualize error.
+const MsgVisualizeOptionReq = "Paste a plan after `visualize` or attach it as a snippet with the `visualize` comment. " +
+	"JSON, TEXT, YAML and XML formats of `EXPLAIN` are supported, " +
+	"use `EXPLAIN (ANALYZE, BUFFERS)` to get the most detailed analysis"
+
+// Visualize analyzes a plan captured outside of Database Lab, e.g. on production.
+func Visualize(msgSvc connection.Messenger, command *platform.Command, msg *models.Message,
+	explainConfig pgexplain.ExplainConfig, anonymizer *pgexplain.Anonymizer) error {
+	plan := strings.Trim(strings.TrimSpace(command.Query), "`")
+
+	if strings.TrimSpace(plan) == "" {
+		return errors.New(MsgVisualizeOptionReq)
+	}
+
+	explain, err := pgexplain.ParseExplain(plan, explainConfig)
+	if err != nil {
+		log.Err("Explain parsing: ", err)
+
+		if err == pgexplain.ErrNoPlan {
+			return errors.New(MsgVisualizeOptionReq)
+		}
+
+		return errors.Wrap(err, "failed to parse the plan")
+	}
+
+	explain.Anonymize(anonymizer)
+
+	// The stored plan is the one which has been parsed, without psql decorations.
+	if cleanPlan := pgexplain.CleanPlan(plan); pgexplain.DetectFormat(cleanPlan) == pgexplain.FormatJSON {
+		planJSON, err := anonymizer.PlanJSON(cleanPlan)
+		if err != nil {
+			return errors.Wrap(err, "failed to anonymize the plan")
+		}
+
+		command.PlanExecJSON = planJSON
+	}
+
+	return showExplain(msgSvc, command, msg, explain, "Plan", nil)
+}
@@ -0,0 +1,121 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// backendsKey defines the context key of command backends.
+type backendsKey struct{}
+
+// CommandBackends contains PIDs of backends running queries of a command, so the queries can be canceled.
+type CommandBackends struct {
+	mu   sync.Mutex
+	pids map[uint32]struct{}
+}
+
+// NewCommandBackends creates a new set of command backends.
+func NewCommandBackends() *CommandBackends {
+	return &CommandBackends{pids: make(map[uint32]struct{})}
+}
+
+// ContextWithBackends returns a context which registers backends of connections acquired with it.
+func ContextWithBackends(ctx context.Context, backends *CommandBackends) context.Context {
+	return context.WithValue(ctx, backendsKey{}, backends)
+}
+
+// Add registers the backend of the connection.
+func (b *CommandBackends) Add(conn *pgx.Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pids[conn.PgConn().PID()] = struct{}{}
+}
+
+// Remove unregisters the backend of the connection.
+func (b *CommandBackends) Remove(conn *pgx.Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.pids, conn.PgConn().PID())
+}
+
+// PIDs returns sorted PIDs of registered backends.
+func (b *CommandBackends) PIDs() []uint32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pids := make([]uint32, 0, len(b.pids))
+	for pid := range b.pids {
+		pids = append(pids, pid)
+	}
+
+	sort.Slice(pids, func(i, j int) bool {
+		return pids[i] < pids[j]
+	})
+
+	return pids
+}
+
+// BackendTracker registers backends of connections acquired from a pool in backends of commands acquiring them.
+type BackendTracker struct {
+	mu       sync.Mutex
+	acquired map[*pgx.Conn]*CommandBackends
+}
+
+// NewBackendTracker creates a new tracker of pool backends.
+func NewBackendTracker() *BackendTracker {
+	return &BackendTracker{acquired: make(map[*pgx.Conn]*CommandBackends)}
+}
+
+// BeforeAcquire registers the backend of the connection if the acquiring context has command backends.
+// It is a hook of the connection pool.
+func (t *BackendTracker) BeforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	backends, ok := ctx.Value(backendsKey{}).(*CommandBackends)
+	if !ok {
+		return true
+	}
+
+	backends.Add(conn)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.acquired[conn] = backends
+
+	return true
+}
+
+// AfterRelease unregisters the backend of the connection. It is a hook of the connection pool.
+func (t *BackendTracker) AfterRelease(conn *pgx.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if backends, ok := t.acquired[conn]; ok {
+		backends.Remove(conn)
+		delete(t.acquired, conn)
+	}
+
+	return true
+}
+
+// CancelBackends cancels queries running on the backends.
+func CancelBackends(ctx context.Context, db DB, pids []uint32) error {
+	if len(pids) == 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(ctx, "SELECT pg_cancel_backend(pid) FROM unnest($1::int[]) AS pid", pids); err != nil {
+		return errors.Wrap(err, "failed to cancel queries")
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"context"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// DB defines the interface of a clone database which commands run queries on.
+// It is implemented by the session pool and by a transaction pinned to a connection of the pool.
+type DB interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Acquire(ctx context.Context) (Conn, error)
+}
+
+// Conn defines a connection acquired to run several queries, it has to be released after use.
+type Conn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Conn() *pgx.Conn
+	Release()
+}
+
+// Pool defines the session pool of clone connections.
+type Pool struct {
+	*pgxpool.Pool
+}
+
+var _ DB = Pool{}
+
+// Acquire acquires a connection from the pool.
+func (p Pool) Acquire(ctx context.Context) (Conn, error) {
+	conn, err := p.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,343 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+)
+
+// Base units of limited settings.
+const (
+	unitMilliseconds = "ms"
+	unitKilobytes    = "kB"
+)
+
+// limitedSettings defines settings which can be limited and their base units.
+var limitedSettings = map[string]string{
+	"statement_timeout":                   unitMilliseconds,
+	"lock_timeout":                        unitMilliseconds,
+	"idle_in_transaction_session_timeout": unitMilliseconds,
+	"temp_file_limit":                     unitKilobytes,
+}
+
+// unitMultipliers defines multipliers of units to base units.
+var unitMultipliers = map[string]map[string]float64{
+	unitMilliseconds: {"us": 0.001, "ms": 1, "s": 1000, "min": 60 * 1000, "h": 60 * 60 * 1000, "d": 24 * 60 * 60 * 1000},
+	unitKilobytes:    {"B": 1.0 / 1024, "kB": 1, "MB": 1024, "GB": 1024 * 1024, "TB": 1024 * 1024 * 1024},
+}
+
+var (
+	// settingValueRe matches values of settings with optional units, e.g. "30min" or "10 GB".
+	settingValueRe = regexp.MustCompile(`^(-?\d+(?:\.\d+)?)\s*([A-Za-z]*)$`)
+
+	// setLocalCommandRe matches transaction-level SET commands, e.g. "set local statement_timeout = 0".
+	setLocalCommandRe = regexp.MustCompile(`(?is)^set\s+local\s+("[^"]+"|[a-z_][\w.]*)\s*(?:=|\s+to\s+)\s*(.+)$`)
+
+	// setConfigCallRe matches calls of set_config(), e.g. "set_config('statement_timeout', '0', false)".
+	setConfigCallRe = regexp.MustCompile(`(?i)\bset_config\s*\(`)
+
+	// setConfigArgsRe matches literal arguments of set_config(): the name and the value.
+	setConfigArgsRe = regexp.MustCompile(`^\s*'([^']*)'\s*,\s*('(?:[^']|'')*'|[\w.-]+)\s*,`)
+)
+
+// SettingLimit defines a limit of a Postgres setting: the value applied to connections and the maximum users can set.
+// Values are given as Postgres values, e.g. "30min" or "10GB", empty values are not applied.
+type SettingLimit struct {
+	Name  string
+	Value string
+	Max   string
+}
+
+// SessionLimits contains limits of settings applied to connections of a clone.
+type SessionLimits struct {
+	limits    []SettingLimit
+	maxValues map[string]int64
+}
+
+// NewSessionLimits validates limits and creates a new set of session limits.
+func NewSessionLimits(limits []SettingLimit) (*SessionLimits, error) {
+	sessionLimits := &SessionLimits{maxValues: make(map[string]int64)}
+
+	for _, limit := range limits {
+		if limit.Value == "" && limit.Max == "" {
+			continue
+		}
+
+		unit, ok := limitedSettings[limit.Name]
+		if !ok {
+			return nil, errors.Errorf("setting %q cannot be limited", limit.Name)
+		}
+
+		var value int64
+
+		if limit.Value != "" {
+			parsedValue, err := parseSettingValue(limit.Value, unit)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid value of %s", limit.Name)
+			}
+
+			value = parsedValue
+		}
+
+		if limit.Max != "" {
+			maxValue, err := parseSettingValue(limit.Max, unit)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid maximum of %s", limit.Name)
+			}
+
+			if limit.Value != "" && exceedsLimit(value, maxValue, unit) {
+				return nil, errors.Errorf("value of %s exceeds its maximum", limit.Name)
+			}
+
+			sessionLimits.maxValues[limit.Name] = maxValue
+		}
+
+		sessionLimits.limits = append(sessionLimits.limits, limit)
+	}
+
+	return sessionLimits, nil
+}
+
+// RuntimeParams returns values of limited settings which are applied to connections when they are established.
+func (l *SessionLimits) RuntimeParams() map[string]string {
+	params := make(map[string]string)
+
+	for _, limit := range l.limits {
+		if limit.Value != "" {
+			params[limit.Name] = limit.Value
+		}
+	}
+
+	return params
+}
+
+// Check checks if the command sets a value exceeding the maximum.
+// Settings limited only by maximums cannot be reset, their defaults may exceed the maximums.
+func (l *SessionLimits) Check(command SettingCommand) error {
+	if command.Reset {
+		return l.checkReset(command.Name)
+	}
+
+	maxValue, ok := l.maxValues[command.Name]
+	if !ok {
+		return nil
+	}
+
+	unit := limitedSettings[command.Name]
+
+	value, err := parseSettingValue(strings.Trim(command.Value, `'`), unit)
+	if err != nil {
+		return errors.Wrapf(err, "invalid value of %s", command.Name)
+	}
+
+	if exceedsLimit(value, maxValue, unit) {
+		return errors.Errorf("%s cannot exceed %s in this channel", command.Name, l.maxOf(command.Name))
+	}
+
+	return nil
+}
+
+// CheckQuery checks changes of settings in all statements of the query: SET, SET LOCAL and RESET commands
+// as well as calls of set_config().
+func (l *SessionLimits) CheckQuery(query string) error {
+	if len(l.maxValues) == 0 {
+		return nil
+	}
+
+	for _, statement := range SplitStatements(query) {
+		commands, err := parseSettingChanges(statement)
+		if err != nil {
+			return err
+		}
+
+		for _, command := range commands {
+			if err := l.Check(command); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// BeforeAcquire lowers limited settings of a connection exceeding their maximums, e.g. after a user has changed them.
+// It is a hook of the connection pool, connections are used even if settings cannot be checked.
+func (l *SessionLimits) BeforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	l.Enforce(ctx, conn)
+
+	return true
+}
+
+// Enforce lowers limited settings of a connection exceeding their maximums, errors are logged.
+// It is used after user queries as well, since settings changed in a transaction are not checked until it ends.
+func (l *SessionLimits) Enforce(ctx context.Context, conn *pgx.Conn) {
+	if len(l.maxValues) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(l.maxValues))
+	for name := range l.maxValues {
+		names = append(names, name)
+	}
+
+	rows, err := conn.Query(ctx, "SELECT name, setting FROM pg_settings WHERE name = ANY($1)", names)
+	if err != nil {
+		log.Err("Failed to check limits of settings:", err)
+		return
+	}
+
+	commands := []string{}
+
+	for rows.Next() {
+		var name, setting string
+
+		if err := rows.Scan(&name, &setting); err != nil {
+			log.Err("Failed to check limits of settings:", err)
+			rows.Close()
+
+			return
+		}
+
+		unit := limitedSettings[name]
+
+		// Values in pg_settings are given in base units.
+		if value, err := parseSettingValue(setting, unit); err == nil && exceedsLimit(value, l.maxValues[name], unit) {
+			commands = append(commands, fmt.Sprintf("SET %s = %s", name, QuoteLiteral(l.maxOf(name))))
+		}
+	}
+
+	rows.Close()
+
+	if len(commands) == 0 {
+		return
+	}
+
+	if _, err := conn.Exec(ctx, strings.Join(commands, "; ")); err != nil {
+		log.Err("Failed to apply limits of settings:", err)
+	}
+}
+
+// String describes the limits, e.g. "`statement_timeout` 30min (up to 2h)".
+func (l *SessionLimits) String() string {
+	descriptions := make([]string, 0, len(l.limits))
+
+	for _, limit := range l.limits {
+		description := fmt.Sprintf("`%s`", limit.Name)
+
+		switch {
+		case limit.Value != "" && limit.Max != "":
+			description += fmt.Sprintf(" %s (up to %s)", limit.Value, limit.Max)
+
+		case limit.Value != "":
+			description += " " + limit.Value
+
+		default:
+			description += " up to " + limit.Max
+		}
+
+		descriptions = append(descriptions, description)
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+// checkReset checks if the setting or all settings for "RESET ALL" can be reset.
+func (l *SessionLimits) checkReset(name string) error {
+	for _, limit := range l.limits {
+		if limit.Max == "" || limit.Value != "" || (name != limit.Name && name != resetAllSettings) {
+			continue
+		}
+
+		return errors.Errorf("%s cannot be reset in this channel, set a value up to %s instead", limit.Name, limit.Max)
+	}
+
+	return nil
+}
+
+func (l *SessionLimits) maxOf(name string) string {
+	for _, limit := range l.limits {
+		if limit.Name == name {
+			return limit.Max
+		}
+	}
+
+	return ""
+}
+
+// parseSettingChanges finds changes of settings in the statement, calls of set_config() must have literal arguments.
+func parseSettingChanges(statement string) ([]SettingCommand, error) {
+	commands := []SettingCommand{}
+
+	if command, ok := ParseSettingCommand(statement); ok {
+		commands = append(commands, command)
+	}
+
+	if match := setLocalCommandRe.FindStringSubmatch(strings.TrimRight(statement, "; ")); match != nil {
+		commands = append(commands, newSetCommand(settingName(match[1]), match[2]))
+	}
+
+	for _, loc := range setConfigCallRe.FindAllStringIndex(statement, -1) {
+		match := setConfigArgsRe.FindStringSubmatch(statement[loc[1]:])
+		if match == nil {
+			return nil, errors.New("set_config() can be called only with literal names and values of settings")
+		}
+
+		commands = append(commands, newSetCommand(strings.ToLower(match[1]), match[2]))
+	}
+
+	return commands, nil
+}
+
+// parseSettingValue converts a value of a setting to the base unit, values without units are given in the base unit.
+func parseSettingValue(value, unit string) (int64, error) {
+	match := settingValueRe.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, errors.Errorf("invalid value %q", value)
+	}
+
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid value %q", value)
+	}
+
+	multiplier := 1.0
+
+	if match[2] != "" {
+		unitMultiplier, ok := unitMultipliers[unit][match[2]]
+		if !ok {
+			return 0, errors.Errorf("invalid unit of value %q", value)
+		}
+
+		multiplier = unitMultiplier
+	}
+
+	return int64(math.Round(number * multiplier)), nil
+}
+
+// exceedsLimit checks if the value exceeds the maximum. Zero timeouts and negative sizes mean no limit.
+func exceedsLimit(value, maxValue int64, unit string) bool {
+	unlimited := func(v int64) bool {
+		if unit == unitMilliseconds {
+			return v <= 0
+		}
+
+		return v < 0
+	}
+
+	if unlimited(maxValue) {
+		return false
+	}
+
+	return unlimited(value) || value > maxValue
+}
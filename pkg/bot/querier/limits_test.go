@@ -0,0 +1,118 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSettingValue(t *testing.T) {
+	testCases := []struct {
+		value    string
+		unit     string
+		expected int64
+	}{
+		{value: "1000", unit: unitMilliseconds, expected: 1000},
+		{value: "30s", unit: unitMilliseconds, expected: 30000},
+		{value: "30min", unit: unitMilliseconds, expected: 1800000},
+		{value: "1.5h", unit: unitMilliseconds, expected: 5400000},
+		{value: "0", unit: unitMilliseconds, expected: 0},
+		{value: "10GB", unit: unitKilobytes, expected: 10485760},
+		{value: "512 MB", unit: unitKilobytes, expected: 524288},
+		{value: "-1", unit: unitKilobytes, expected: -1},
+	}
+
+	for _, tc := range testCases {
+		value, err := parseSettingValue(tc.value, tc.unit)
+		require.NoError(t, err, tc.value)
+		assert.Equal(t, tc.expected, value, tc.value)
+	}
+
+	for _, value := range []string{"", "abc", "10GB", "1 year"} {
+		_, err := parseSettingValue(value, unitMilliseconds)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestSessionLimits(t *testing.T) {
+	limits, err := NewSessionLimits([]SettingLimit{
+		{Name: "statement_timeout", Value: "30min", Max: "2h"},
+		{Name: "temp_file_limit", Value: "10GB"},
+		{Name: "lock_timeout", Max: "10s"},
+		{Name: "idle_in_transaction_session_timeout"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"statement_timeout": "30min", "temp_file_limit": "10GB"}, limits.RuntimeParams())
+	assert.Equal(t, "`statement_timeout` 30min (up to 2h), `temp_file_limit` 10GB, `lock_timeout` up to 10s", limits.String())
+
+	testCases := []struct {
+		command string
+		valid   bool
+	}{
+		{command: "set statement_timeout = '1h'", valid: true},
+		{command: "set statement_timeout to 7200000", valid: true},
+		{command: "set statement_timeout = '3h'", valid: false},
+		{command: "set statement_timeout = 0", valid: false},
+		{command: "reset statement_timeout", valid: true},
+		{command: "set temp_file_limit = -1", valid: true},
+		{command: "set lock_timeout = '1min'", valid: false},
+		{command: "set work_mem = '1GB'", valid: true},
+	}
+
+	for _, tc := range testCases {
+		command, ok := ParseSettingCommand(tc.command)
+		require.True(t, ok, tc.command)
+
+		err := limits.Check(command)
+		assert.Equal(t, tc.valid, err == nil, tc.command)
+	}
+}
+
+func TestSessionLimitsCheckQuery(t *testing.T) {
+	limits, err := NewSessionLimits([]SettingLimit{
+		{Name: "statement_timeout", Value: "30min", Max: "2h"},
+		{Name: "lock_timeout", Max: "10s"},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		query string
+		valid bool
+	}{
+		{query: "set statement_timeout = '1h'; select pg_sleep(1)", valid: true},
+		{query: "select 1; set statement_timeout = 0; select pg_sleep(10000)", valid: false},
+		{query: "begin; set local statement_timeout = '3h'; select pg_sleep(10000); commit", valid: false},
+		{query: "SET LOCAL statement_timeout TO '1h'", valid: true},
+		{query: "select set_config('statement_timeout', '0', false); select pg_sleep(10000)", valid: false},
+		{query: "select set_config('Statement_Timeout', '90min', true)", valid: true},
+		{query: "select set_config('work_mem', '1GB', false)", valid: true},
+		{query: "select set_config(name, '0', false) from settings", valid: false},
+		{query: "reset statement_timeout; select 1", valid: true},
+		{query: "select 1; reset lock_timeout", valid: false},
+		{query: "reset all", valid: false},
+		{query: "set lock_timeout to default", valid: false},
+		{query: "select 'set statement_timeout = 0; set_config'; select 1", valid: true},
+	}
+
+	for _, tc := range testCases {
+		err := limits.CheckQuery(tc.query)
+		assert.Equal(t, tc.valid, err == nil, tc.query)
+	}
+}
+
+func TestSessionLimitsValidation(t *testing.T) {
+	_, err := NewSessionLimits([]SettingLimit{{Name: "work_mem", Value: "1GB"}})
+	assert.Error(t, err)
+
+	_, err = NewSessionLimits([]SettingLimit{{Name: "statement_timeout", Value: "3h", Max: "2h"}})
+	assert.Error(t, err)
+
+	_, err = NewSessionLimits([]SettingLimit{{Name: "statement_timeout", Max: "2 hours"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,300 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// literalPlaceholder replaces literals of normalized queries.
+const literalPlaceholder = "?"
+
+// literalListRe matches lists of literals, e.g. in "IN (?, ?, ?)".
+var literalListRe = regexp.MustCompile(`\?(\s*,\s*\?)+`)
+
+var (
+	// dmlRe matches data-modifying statements including ones in CTEs.
+	dmlRe = regexp.MustCompile(`(^|[\s(])(insert into|update \S+( \S+)? set|delete from|merge into) `)
+
+	// selectRe matches queries reading data.
+	selectRe = regexp.MustCompile(`^(select|with|values|table) `)
+
+	// selectIntoRe matches SELECT INTO creating a table.
+	selectIntoRe = regexp.MustCompile(`(^|[\s)])into `)
+
+	// transactionControlRe matches statements starting, finishing or partially rolling back transactions.
+	transactionControlRe = regexp.MustCompile(`^(begin|start transaction|commit|end|rollback|abort|savepoint|release|` +
+		`prepare transaction)( |$)`)
+)
+
+// NormalizeQuery replaces literals with placeholders, removes comments and collapses whitespaces,
+// so queries which differ only in values or formatting get the same normalized text.
+func NormalizeQuery(query string) string {
+	runes := []rune(query)
+	buf := &strings.Builder{}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		// Line comments.
+		case r == '-' && next(runes, i) == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+			buf.WriteRune(' ')
+
+		// Block comments.
+		case r == '/' && next(runes, i) == '*':
+			end := strings.Index(string(runes[i+2:]), "*/")
+			if end < 0 {
+				i = len(runes)
+			} else {
+				i += 2 + len([]rune(string(runes[i+2:])[:end])) + 1
+			}
+
+			buf.WriteRune(' ')
+
+		// String literals.
+		case r == '\'':
+			i = skipQuoted(runes, i, '\'')
+			buf.WriteString(literalPlaceholder)
+
+		// Quoted identifiers are kept as is.
+		case r == '"':
+			end := skipQuoted(runes, i, '"')
+			if end >= len(runes) {
+				end = len(runes) - 1
+			}
+
+			buf.WriteString(string(runes[i : end+1]))
+			i = end
+
+		// Dollar-quoted literals.
+		case r == '$' && !unicode.IsDigit(next(runes, i)):
+			if end, ok := skipDollarQuoted(runes, i); ok {
+				i = end
+				buf.WriteString(literalPlaceholder)
+
+				continue
+			}
+
+			buf.WriteRune(r)
+
+		// Parameters, e.g. $1, are kept as is.
+		case r == '$':
+			buf.WriteRune(r)
+
+			for i+1 < len(runes) && unicode.IsDigit(runes[i+1]) {
+				i++
+				buf.WriteRune(runes[i])
+			}
+
+		// Numbers which are not parts of identifiers.
+		case unicode.IsDigit(r) && (i == 0 || !isIdentRune(runes[i-1])):
+			for i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.') {
+				i++
+			}
+
+			buf.WriteString(literalPlaceholder)
+
+		case unicode.IsSpace(r):
+			buf.WriteRune(' ')
+
+		default:
+			buf.WriteRune(unicode.ToLower(r))
+		}
+	}
+
+	normalized := strings.Join(strings.Fields(buf.String()), " ")
+	normalized = literalListRe.ReplaceAllString(normalized, literalPlaceholder)
+
+	return strings.TrimSpace(strings.TrimRight(normalized, "; "))
+}
+
+// IsDML checks if the query modifies data: INSERT, UPDATE, DELETE or MERGE, including data-modifying CTEs.
+func IsDML(query string) bool {
+	return dmlRe.MatchString(NormalizeQuery(query) + " ")
+}
+
+// IsSelect checks if the query is a plain SELECT which does not modify data.
+func IsSelect(query string) bool {
+	normalized := NormalizeQuery(query) + " "
+
+	return selectRe.MatchString(normalized) && !selectIntoRe.MatchString(normalized) && !dmlRe.MatchString(normalized)
+}
+
+// IsTransactionControl checks if the statement controls transactions, e.g. BEGIN, COMMIT or SAVEPOINT.
+func IsTransactionControl(statement string) bool {
+	return transactionControlRe.MatchString(NormalizeQuery(statement))
+}
+
+// SplitStatements splits a query by semicolons which are not enclosed in literals, quoted identifiers or comments.
+// Empty statements are skipped.
+func SplitStatements(query string) []string {
+	runes := []rune(query)
+	statements := []string{}
+	start := 0
+
+	addStatement := func(end int) {
+		if statement := strings.TrimSpace(string(runes[start:end])); statement != "" {
+			statements = append(statements, statement)
+		}
+
+		start = end + 1
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '-' && next(runes, i) == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case r == '/' && next(runes, i) == '*':
+			end := strings.Index(string(runes[i+2:]), "*/")
+			if end < 0 {
+				i = len(runes)
+			} else {
+				i += 2 + len([]rune(string(runes[i+2:])[:end])) + 1
+			}
+
+		case r == '\'' || r == '"':
+			i = skipQuoted(runes, i, r)
+
+		case r == '$' && !unicode.IsDigit(next(runes, i)) && (i == 0 || !isIdentRune(runes[i-1])):
+			if end, ok := skipDollarQuoted(runes, i); ok {
+				i = end
+			}
+
+		case r == ';':
+			addStatement(i)
+		}
+	}
+
+	if start < len(runes) {
+		addStatement(len(runes))
+	}
+
+	return statements
+}
+
+// StripComments removes comments which are not enclosed in literals or quoted identifiers, e.g. "set work_mem = 1 -- tune".
+func StripComments(query string) string {
+	runes := []rune(query)
+	buf := &strings.Builder{}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '-' && next(runes, i) == '-':
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+
+			buf.WriteRune(' ')
+
+		case r == '/' && next(runes, i) == '*':
+			end := strings.Index(string(runes[i+2:]), "*/")
+			if end < 0 {
+				i = len(runes)
+			} else {
+				i += 2 + len([]rune(string(runes[i+2:])[:end])) + 1
+			}
+
+			buf.WriteRune(' ')
+
+		case r == '\'' || r == '"':
+			end := skipQuoted(runes, i, r)
+			if end >= len(runes) {
+				end = len(runes) - 1
+			}
+
+			buf.WriteString(string(runes[i : end+1]))
+			i = end
+
+		case r == '$' && !unicode.IsDigit(next(runes, i)) && (i == 0 || !isIdentRune(runes[i-1])):
+			end, ok := skipDollarQuoted(runes, i)
+			if !ok {
+				buf.WriteRune(r)
+				continue
+			}
+
+			if end >= len(runes) {
+				end = len(runes) - 1
+			}
+
+			buf.WriteString(string(runes[i : end+1]))
+			i = end
+
+		default:
+			buf.WriteRune(r)
+		}
+	}
+
+	return strings.TrimSpace(buf.String())
+}
+
+func next(runes []rune, i int) rune {
+	if i+1 < len(runes) {
+		return runes[i+1]
+	}
+
+	return 0
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+// skipQuoted returns the position of the closing quote, doubled quotes are escaped ones.
+func skipQuoted(runes []rune, start int, quote rune) int {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] != quote {
+			continue
+		}
+
+		if next(runes, i) == quote {
+			i++
+			continue
+		}
+
+		return i
+	}
+
+	return len(runes)
+}
+
+// skipDollarQuoted returns the position of the end of a dollar-quoted literal, e.g. $tag$text$tag$.
+func skipDollarQuoted(runes []rune, start int) (int, bool) {
+	tagEnd := start + 1
+	for tagEnd < len(runes) && runes[tagEnd] != '$' {
+		if !isIdentRune(runes[tagEnd]) {
+			return 0, false
+		}
+
+		tagEnd++
+	}
+
+	if tagEnd >= len(runes) {
+		return 0, false
+	}
+
+	tag := string(runes[start : tagEnd+1])
+	body := string(runes[tagEnd+1:])
+
+	end := strings.Index(body, tag)
+	if end < 0 {
+		return len(runes), true
+	}
+
+	return tagEnd + len([]rune(body[:end])) + len([]rune(tag)), true
+}
@@ -0,0 +1,135 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	testCases := []struct {
+		query      string
+		normalized string
+	}{
+		{
+			query:      "select * from t1 where id = 42;",
+			normalized: "select * from t1 where id = ?",
+		},
+		{
+			query:      "SELECT *\n  FROM t1 -- comment\n WHERE id = 7 /* another\n comment */ AND name = 'it''s'",
+			normalized: "select * from t1 where id = ? and name = ?",
+		},
+		{
+			query:      `select "Name" from "Users" where id in (1, 2, 3.5) and note = $tag$a 'b'$tag$ and x = $1`,
+			normalized: `select "Name" from "Users" where id in (?) and note = ? and x = $1`,
+		},
+		{
+			query:      "select 'a', $$b$$",
+			normalized: "select ?",
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.normalized, NormalizeQuery(tc.query), tc.query)
+	}
+}
+
+func TestIsDML(t *testing.T) {
+	testCases := []struct {
+		query string
+		isDML bool
+	}{
+		{query: "select * from t where note = 'delete from t'", isDML: false},
+		{query: "select * from t for update", isDML: false},
+		{query: "DELETE FROM t WHERE id = 1", isDML: true},
+		{query: "update t set a = 1", isDML: true},
+		{query: "update public.t t1 set a = 1", isDML: true},
+		{query: "insert into t values (1)", isDML: true},
+		{query: "with d as (delete from t returning *) select count(*) from d", isDML: true},
+		{query: "-- cleanup\nmerge into t using s on t.id = s.id when matched then delete", isDML: true},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.isDML, IsDML(tc.query), tc.query)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	testCases := []struct {
+		query      string
+		statements []string
+	}{
+		{query: "select 1", statements: []string{"select 1"}},
+		{query: " delete from t;\n commit; ", statements: []string{"delete from t", "commit"}},
+		{query: "select ';' -- comment; with semicolon\n; select 2", statements: []string{"select ';' -- comment; with semicolon", "select 2"}},
+		{query: `select "a;b" /* ; */ from t;;`, statements: []string{`select "a;b" /* ; */ from t`}},
+		{query: "do $body$ begin commit; end $body$; select $1", statements: []string{"do $body$ begin commit; end $body$", "select $1"}},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.statements, SplitStatements(tc.query), tc.query)
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	testCases := []struct {
+		query    string
+		stripped string
+	}{
+		{query: "select 1", stripped: "select 1"},
+		{query: "set work_mem = '64MB' -- tune", stripped: "set work_mem = '64MB'"},
+		{query: "select 1 /* one */ + 2 -- sum\n from t", stripped: "select 1   + 2  \n from t"},
+		{query: `select '--a', "/*b*/", $x$--c$x$ from t`, stripped: `select '--a', "/*b*/", $x$--c$x$ from t`},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.stripped, StripComments(tc.query), tc.query)
+	}
+}
+
+func TestIsTransactionControl(t *testing.T) {
+	testCases := []struct {
+		statement string
+		isControl bool
+	}{
+		{statement: "COMMIT", isControl: true},
+		{statement: "end;", isControl: true},
+		{statement: "/* finish */ rollback", isControl: true},
+		{statement: "begin isolation level serializable", isControl: true},
+		{statement: "start transaction", isControl: true},
+		{statement: "savepoint s1", isControl: true},
+		{statement: "release savepoint s1", isControl: true},
+		{statement: "prepare transaction 'tx1'", isControl: true},
+		{statement: "prepare stmt as select 1", isControl: false},
+		{statement: "select 'commit'", isControl: false},
+		{statement: "delete from ends", isControl: false},
+		{statement: "do $$ begin perform 1; end $$", isControl: false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.isControl, IsTransactionControl(tc.statement), tc.statement)
+	}
+}
+
+func TestIsSelect(t *testing.T) {
+	testCases := []struct {
+		query    string
+		isSelect bool
+	}{
+		{query: "SELECT * FROM t WHERE note = 'delete from t'", isSelect: true},
+		{query: "with recent as (select * from t) select count(*) from recent", isSelect: true},
+		{query: "values (1), (2)", isSelect: true},
+		{query: "select * into t2 from t", isSelect: false},
+		{query: "with d as (delete from t returning *) select count(*) from d", isSelect: false},
+		{query: "update t set a = 1", isSelect: false},
+		{query: "create table t2 as select * from t", isSelect: false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.isSelect, IsSelect(tc.query), tc.query)
+	}
+}
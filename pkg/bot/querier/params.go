@@ -0,0 +1,184 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// paramsCommentRe matches the trailing comment with values of query parameters, e.g. "-- params: 42, 'abc'".
+var paramsCommentRe = regexp.MustCompile(`(?i)--[ \t]*params[ \t]*:([^\n]*)\s*$`)
+
+// paramRe matches references to query parameters, e.g. $1.
+var paramRe = regexp.MustCompile(`\$(\d+)`)
+
+// PreparedStatement defines a query with parameters, e.g. $1, and values of the parameters given as SQL literals.
+type PreparedStatement struct {
+	Name   string
+	Query  string
+	Params []string
+}
+
+// SplitQueryParams separates values of query parameters from a query.
+// Values are given in the trailing comment as a list of SQL literals, e.g. "-- params: 42, 'abc', null",
+// or as a JSON array, e.g. `-- params: [42, "abc", null]`.
+func SplitQueryParams(query string) (string, []string, error) {
+	match := paramsCommentRe.FindStringSubmatchIndex(query)
+	if match == nil {
+		return query, nil, nil
+	}
+
+	list := strings.TrimSpace(query[match[2]:match[3]])
+	query = strings.TrimSpace(query[:match[0]])
+
+	var (
+		params []string
+		err    error
+	)
+
+	if strings.HasPrefix(list, "[") {
+		params, err = parseJSONParams(list)
+	} else {
+		params, err = parseSQLParams(list)
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(params) == 0 {
+		return "", nil, errors.New("values of query parameters are empty")
+	}
+
+	return query, params, nil
+}
+
+// CountParams returns the number of query parameters, which is the largest parameter number, e.g. 2 for "$1, $2".
+// Literals and comments are not taken into account.
+func CountParams(query string) int {
+	count := 0
+
+	for _, match := range paramRe.FindAllStringSubmatch(NormalizeQuery(query), -1) {
+		if number, err := strconv.Atoi(match[1]); err == nil && number > count {
+			count = number
+		}
+	}
+
+	return count
+}
+
+// PrepareCommand returns the command creating the prepared statement.
+func (s PreparedStatement) PrepareCommand() string {
+	return fmt.Sprintf("PREPARE %s AS %s", s.Name, strings.TrimRight(strings.TrimSpace(s.Query), ";"))
+}
+
+// ExecuteCommand returns the command executing the prepared statement with values of parameters.
+func (s PreparedStatement) ExecuteCommand() string {
+	return fmt.Sprintf("EXECUTE %s(%s)", s.Name, strings.Join(s.Params, ", "))
+}
+
+// DeallocateCommand returns the command removing the prepared statement.
+func (s PreparedStatement) DeallocateCommand() string {
+	return "DEALLOCATE " + s.Name
+}
+
+// parseJSONParams converts a JSON array to SQL literals.
+func parseJSONParams(list string) ([]string, error) {
+	decoder := json.NewDecoder(strings.NewReader(list))
+	decoder.UseNumber()
+
+	var values []interface{}
+
+	if err := decoder.Decode(&values); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON array of query parameters")
+	}
+
+	params := make([]string, 0, len(values))
+
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			params = append(params, "NULL")
+
+		case bool, json.Number:
+			params = append(params, fmt.Sprint(v))
+
+		case string:
+			params = append(params, QuoteLiteral(v))
+
+		default:
+			buf := &bytes.Buffer{}
+			encoder := json.NewEncoder(buf)
+			encoder.SetEscapeHTML(false)
+
+			if err := encoder.Encode(v); err != nil {
+				return nil, errors.Wrap(err, "invalid value of a query parameter")
+			}
+
+			params = append(params, QuoteLiteral(strings.TrimSpace(buf.String())))
+		}
+	}
+
+	return params, nil
+}
+
+// parseSQLParams splits a list of SQL literals separated with commas, e.g. "42, 'a,b', '2020-01-01'::date".
+func parseSQLParams(list string) ([]string, error) {
+	runes := []rune(list)
+	params := []string{}
+	start, depth := 0, 0
+
+	for i := 0; i <= len(runes); i++ {
+		if i == len(runes) || (runes[i] == ',' && depth == 0) {
+			param := strings.TrimSpace(string(runes[start:i]))
+			if param == "" {
+				return nil, errors.Errorf("invalid list of query parameters: %q", list)
+			}
+
+			params = append(params, param)
+			start = i + 1
+
+			continue
+		}
+
+		switch runes[i] {
+		case '\'', '"':
+			i = skipQuoted(runes, i, runes[i])
+			if i >= len(runes) {
+				return nil, errors.Errorf("unterminated quote in query parameters: %q", list)
+			}
+
+		case '(', '[':
+			depth++
+
+		case ')', ']':
+			depth--
+			if depth < 0 {
+				return nil, errors.Errorf("unbalanced brackets in query parameters: %q", list)
+			}
+
+		case ';':
+			return nil, errors.Errorf("invalid list of query parameters: %q", list)
+		}
+	}
+
+	if depth != 0 {
+		return nil, errors.Errorf("unbalanced brackets in query parameters: %q", list)
+	}
+
+	return params, nil
+}
+
+// QuoteLiteral quotes a string as an SQL literal.
+func QuoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,85 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitQueryParams(t *testing.T) {
+	testCases := []struct {
+		query         string
+		expectedQuery string
+		params        []string
+	}{
+		{
+			query:         "select 1",
+			expectedQuery: "select 1",
+		},
+		{
+			query:         "select * from t where id = $1 and name = $2 -- params: 42, 'a, ''b'''",
+			expectedQuery: "select * from t where id = $1 and name = $2",
+			params:        []string{"42", "'a, ''b'''"},
+		},
+		{
+			query:         "select * from t\nwhere created_at > $1 and ids = any($2)\n-- Params: '2020-01-01'::date, array[1, 2]\n",
+			expectedQuery: "select * from t\nwhere created_at > $1 and ids = any($2)",
+			params:        []string{"'2020-01-01'::date", "array[1, 2]"},
+		},
+		{
+			query:         `select * from t where id = $1 and name = $2 and note = $3 and data = $4 -- params: [42, "it's", null, {"a": "<b>"}]`,
+			expectedQuery: "select * from t where id = $1 and name = $2 and note = $3 and data = $4",
+			params:        []string{"42", "'it''s'", "NULL", `'{"a":"<b>"}'`},
+		},
+		{
+			query:         "select $1, now() -- params: coalesce(null, 1)",
+			expectedQuery: "select $1, now()",
+			params:        []string{"coalesce(null, 1)"},
+		},
+	}
+
+	for _, tc := range testCases {
+		query, params, err := SplitQueryParams(tc.query)
+		require.Nil(t, err, tc.query)
+		assert.Equal(t, tc.expectedQuery, query, tc.query)
+		assert.Equal(t, tc.params, params, tc.query)
+	}
+}
+
+func TestSplitQueryParamsErrors(t *testing.T) {
+	testCases := []string{
+		"select $1 -- params:",
+		"select $1 -- params: 1,",
+		"select $1 -- params: 'abc",
+		"select $1 -- params: 1); drop table t; (1",
+		"select $1 -- params: [1, 2",
+	}
+
+	for _, query := range testCases {
+		_, _, err := SplitQueryParams(query)
+		assert.NotNil(t, err, query)
+	}
+}
+
+func TestPreparedStatement(t *testing.T) {
+	statement := PreparedStatement{Name: "stmt", Query: "select $1, $2;", Params: []string{"1", "'a'"}}
+
+	assert.Equal(t, "PREPARE stmt AS select $1, $2", statement.PrepareCommand())
+	assert.Equal(t, "EXECUTE stmt(1, 'a')", statement.ExecuteCommand())
+	assert.Equal(t, "DEALLOCATE stmt", statement.DeallocateCommand())
+}
+
+func TestCountParams(t *testing.T) {
+	assert.Equal(t, 0, CountParams("select '$1'"))
+	assert.Equal(t, 1, CountParams("select $1 -- $2"))
+	assert.Equal(t, 12, CountParams("select * from t where a = $2 and b = $12 and c = $1"))
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	assert.Equal(t, "'it''s'", QuoteLiteral("it's"))
+}
@@ -0,0 +1,203 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+)
+
+// resetAllSettings defines the name of RESET ALL commands.
+const resetAllSettings = "all"
+
+var (
+	// setCommandRe matches session-level SET commands, e.g. "set work_mem = '256MB'" or "set session search_path to app".
+	setCommandRe = regexp.MustCompile(`(?is)^set\s+(?:session\s+)?("[^"]+"|[a-z_][\w.]*)\s*(?:=|\s+to\s+)\s*(.+)$`)
+
+	// setTimeZoneRe matches the special form of setting the time zone, e.g. "set time zone 'UTC'".
+	setTimeZoneRe = regexp.MustCompile(`(?is)^set\s+(?:session\s+)?time\s+zone\s+(.+)$`)
+
+	// resetCommandRe matches RESET commands, e.g. "reset work_mem" or "reset all".
+	resetCommandRe = regexp.MustCompile(`(?is)^reset\s+("[^"]+"|[a-z_][\w.]*)$`)
+)
+
+// Setting defines a configuration parameter set in a user session.
+type Setting struct {
+	Name  string
+	Value string // SQL text of the value, e.g. '256MB'.
+}
+
+// SettingCommand defines a SET or RESET command.
+type SettingCommand struct {
+	Setting
+	Reset bool
+}
+
+// SessionSettings contains settings of a user session, they are applied to every acquired connection of the session pool.
+type SessionSettings struct {
+	mu       sync.Mutex
+	settings map[string]string
+	version  int
+	applied  map[*pgx.Conn]int
+}
+
+// NewSessionSettings creates a new registry of session settings.
+func NewSessionSettings() *SessionSettings {
+	return &SessionSettings{
+		settings: make(map[string]string),
+		applied:  make(map[*pgx.Conn]int),
+	}
+}
+
+// ParseSettingCommand parses a session-level SET or RESET command, e.g. "set work_mem = '256MB'".
+// SET LOCAL, SET ROLE and other forms of the commands as well as several statements are not matched.
+// Comments are not kept in values, since the values are applied to connections in one query.
+func ParseSettingCommand(query string) (SettingCommand, bool) {
+	query = strings.TrimSpace(strings.TrimRight(StripComments(query), ";"))
+
+	if strings.Contains(NormalizeQuery(query), ";") {
+		return SettingCommand{}, false
+	}
+
+	if match := resetCommandRe.FindStringSubmatch(query); match != nil {
+		return SettingCommand{Setting: Setting{Name: settingName(match[1])}, Reset: true}, true
+	}
+
+	if match := setTimeZoneRe.FindStringSubmatch(query); match != nil {
+		return newSetCommand("timezone", match[1]), true
+	}
+
+	if match := setCommandRe.FindStringSubmatch(query); match != nil {
+		return newSetCommand(settingName(match[1]), match[2]), true
+	}
+
+	return SettingCommand{}, false
+}
+
+// Apply records the command.
+func (s *SessionSettings) Apply(command SettingCommand) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case command.Reset && command.Name == resetAllSettings:
+		s.settings = make(map[string]string)
+
+	case command.Reset:
+		delete(s.settings, command.Name)
+
+	default:
+		s.settings[command.Name] = command.Value
+	}
+
+	s.version++
+}
+
+// List returns recorded settings sorted by names.
+func (s *SessionSettings) List() []Setting {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := make([]Setting, 0, len(s.settings))
+
+	for name, value := range s.settings {
+		settings = append(settings, Setting{Name: name, Value: value})
+	}
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Name < settings[j].Name
+	})
+
+	return settings
+}
+
+// BeforeAcquire applies recorded settings to a connection if they have changed since the connection was acquired last time.
+// It is a hook of the connection pool, connections are used even if settings cannot be applied.
+func (s *SessionSettings) BeforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	version, applyQuery := s.applyQuery(conn)
+	if applyQuery == "" {
+		return true
+	}
+
+	if _, err := conn.Exec(ctx, applyQuery); err != nil {
+		log.Err("Failed to apply session settings:", err)
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Closed connections are not reused by the pool.
+	for appliedConn := range s.applied {
+		if appliedConn.IsClosed() {
+			delete(s.applied, appliedConn)
+		}
+	}
+
+	s.applied[conn] = version
+
+	return true
+}
+
+// Forget drops the record of settings applied to the connection, so they are applied again when the connection is acquired.
+// It is used when the connection has run commands which could change settings, e.g. a rolled back transaction.
+func (s *SessionSettings) Forget(conn *pgx.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.applied, conn)
+}
+
+// applyQuery returns the current version of settings and commands applying them if the connection has an outdated version.
+func (s *SessionSettings) applyQuery(conn *pgx.Conn) (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.applied[conn] == s.version {
+		return s.version, ""
+	}
+
+	names := make([]string, 0, len(s.settings))
+	for name := range s.settings {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	// Settings are reset to drop values which have been reset in the session.
+	commands := []string{"RESET ALL"}
+
+	for _, name := range names {
+		commands = append(commands, fmt.Sprintf("SET %s = %s", name, s.settings[name]))
+	}
+
+	return s.version, strings.Join(commands, "; ")
+}
+
+func newSetCommand(name, value string) SettingCommand {
+	value = strings.TrimSpace(value)
+
+	if strings.EqualFold(value, "default") {
+		return SettingCommand{Setting: Setting{Name: name}, Reset: true}
+	}
+
+	return SettingCommand{Setting: Setting{Name: name, Value: value}}
+}
+
+// settingName returns the name of a setting, unquoted names are case-insensitive.
+func settingName(name string) string {
+	if strings.HasPrefix(name, `"`) {
+		return name
+	}
+
+	return strings.ToLower(name)
+}
@@ -0,0 +1,86 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSettingCommand(t *testing.T) {
+	testCases := []struct {
+		query   string
+		command SettingCommand
+		ok      bool
+	}{
+		{query: "set work_mem = '256MB';", command: SettingCommand{Setting: Setting{Name: "work_mem", Value: "'256MB'"}}, ok: true},
+		{query: "SET SESSION Search_Path TO app, public", command: SettingCommand{Setting: Setting{Name: "search_path", Value: "app, public"}}, ok: true},
+		{query: "set time zone 'UTC'", command: SettingCommand{Setting: Setting{Name: "timezone", Value: "'UTC'"}}, ok: true},
+		{query: "set random_page_cost to default", command: SettingCommand{Setting: Setting{Name: "random_page_cost"}, Reset: true}, ok: true},
+		{query: "reset work_mem", command: SettingCommand{Setting: Setting{Name: "work_mem"}, Reset: true}, ok: true},
+		{query: "RESET ALL", command: SettingCommand{Setting: Setting{Name: "all"}, Reset: true}, ok: true},
+		{query: "set work_mem = '64MB' -- tune", command: SettingCommand{Setting: Setting{Name: "work_mem", Value: "'64MB'"}}, ok: true},
+		{query: "/* tune */ set work_mem to '64MB'; -- tune", command: SettingCommand{Setting: Setting{Name: "work_mem", Value: "'64MB'"}}, ok: true},
+		{query: "set local work_mem = '1GB'", ok: false},
+		{query: "set transaction isolation level serializable", ok: false},
+		{query: "set role app", ok: false},
+		{query: "set work_mem = '1GB'; select 1", ok: false},
+		{query: "select set_config('work_mem', '1GB', false)", ok: false},
+	}
+
+	for _, tc := range testCases {
+		command, ok := ParseSettingCommand(tc.query)
+		assert.Equal(t, tc.ok, ok, tc.query)
+		assert.Equal(t, tc.command, command, tc.query)
+	}
+}
+
+func TestSessionSettings(t *testing.T) {
+	settings := NewSessionSettings()
+
+	version, query := settings.applyQuery(nil)
+	assert.Equal(t, 0, version)
+	assert.Equal(t, "", query)
+
+	for _, command := range []string{"set work_mem = '256MB' -- tune", "set enable_seqscan = off", "set random_page_cost = 1.1", "reset enable_seqscan"} {
+		settingCommand, ok := ParseSettingCommand(command)
+		assert.True(t, ok)
+
+		settings.Apply(settingCommand)
+	}
+
+	assert.Equal(t, []Setting{{Name: "random_page_cost", Value: "1.1"}, {Name: "work_mem", Value: "'256MB'"}}, settings.List())
+
+	version, query = settings.applyQuery(nil)
+	assert.Equal(t, 4, version)
+	assert.Equal(t, "RESET ALL; SET random_page_cost = 1.1; SET work_mem = '256MB'", query)
+
+	settings.Apply(SettingCommand{Setting: Setting{Name: resetAllSettings}, Reset: true})
+	assert.Empty(t, settings.List())
+
+	_, query = settings.applyQuery(nil)
+	assert.Equal(t, "RESET ALL", query)
+}
+
+func TestSessionSettingsForget(t *testing.T) {
+	settings := NewSessionSettings()
+	conn := &pgx.Conn{}
+
+	settingCommand, ok := ParseSettingCommand("set work_mem = '256MB'")
+	assert.True(t, ok)
+
+	settings.Apply(settingCommand)
+	settings.applied[conn] = settings.version
+
+	_, query := settings.applyQuery(conn)
+	assert.Equal(t, "", query)
+
+	settings.Forget(conn)
+
+	_, query = settings.applyQuery(conn)
+	assert.Equal(t, "RESET ALL; SET work_mem = '256MB'", query)
+}
@@ -7,15 +7,34 @@ package querier
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"strings"
 
 	"github.com/jackc/pgconn"
-	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jackc/pgx/v4"
 	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
 	"gitlab.com/postgres-ai/database-lab/pkg/log"
 )
 
+// MaxExecResultRows limits the number of rows of query results kept in memory.
+const MaxExecResultRows = 100000
+
+// ExecResult defines rows returned by a query.
+type ExecResult struct {
+	// Table contains the header and rows, rows over MaxExecResultRows are skipped.
+	Table [][]string
+
+	// RowCount is the number of all returned rows.
+	RowCount int
+}
+
+// TableLimits defines limits of tables rendered in messages.
+type TableLimits struct {
+	MaxRows  int // The number of rows excluding the header.
+	MaxWidth int // The number of characters of a value.
+}
+
 const (
 	// SyntaxPQErrorCode defines the pq syntax error code.
 	SyntaxPQErrorCode = "42601"
@@ -25,16 +44,100 @@ const (
 )
 
 // DBQuery runs query and returns table results.
-func DBQuery(ctx context.Context, db *pgxpool.Pool, query string, args ...interface{}) ([][]string, error) {
+func DBQuery(ctx context.Context, db queryRunner, query string, args ...interface{}) ([][]string, error) {
 	return runTableQuery(ctx, db, query, args...)
 }
 
 // DBQueryWithResponse runs query with returning results.
-func DBQueryWithResponse(db *pgxpool.Pool, query string) (string, error) {
-	return runQuery(context.TODO(), db, query)
+// A pool or an acquired connection can be used, the latter keeps session state, e.g. prepared statements.
+func DBQueryWithResponse(ctx context.Context, db queryRunner, query string) (string, error) {
+	return runQuery(ctx, db, query)
+}
+
+// DBExecWithResult runs query, which may contain several statements, and returns rows of the last statement returning them.
+// Nil is returned if no statement returns rows, e.g. for CREATE INDEX.
+func DBExecWithResult(ctx context.Context, db connProvider, query string) (*ExecResult, error) {
+	log.Dbg("DB exec:", query)
+
+	var result *ExecResult
+
+	multiResult := db.Conn().PgConn().Exec(ctx, query)
+
+	for multiResult.NextResult() {
+		resultReader := multiResult.ResultReader()
+
+		fieldDescriptions := resultReader.FieldDescriptions()
+		if len(fieldDescriptions) == 0 {
+			continue
+		}
+
+		head := make([]string, 0, len(fieldDescriptions))
+		for _, column := range fieldDescriptions {
+			head = append(head, string(column.Name))
+		}
+
+		result = &ExecResult{Table: [][]string{head}}
+
+		for resultReader.NextRow() {
+			result.RowCount++
+
+			if result.RowCount > MaxExecResultRows {
+				continue
+			}
+
+			row := make([]string, 0, len(head))
+			for _, value := range resultReader.Values() {
+				row = append(row, string(value))
+			}
+
+			result.Table = append(result.Table, row)
+		}
+
+		if _, err := resultReader.Close(); err != nil {
+			break
+		}
+	}
+
+	if err := multiResult.Close(); err != nil {
+		log.Err("DB exec:", err)
+		return nil, clarifyQueryError([]byte(query), err)
+	}
+
+	return result, nil
 }
 
-func runQuery(ctx context.Context, db *pgxpool.Pool, query string) (string, error) {
+// DBQueryWithResponseInRollback runs query in a transaction which is always rolled back, and returns results.
+func DBQueryWithResponseInRollback(ctx context.Context, db txStarter, query string) (string, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to start a transaction")
+	}
+
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			log.Err("Failed to roll back a transaction:", err)
+		}
+	}()
+
+	return runQuery(ctx, tx, query)
+}
+
+// queryRunner defines the interface of pools, connections and transactions running queries.
+type queryRunner interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// connProvider defines the interface of pool connections and transactions providing the underlying connection.
+type connProvider interface {
+	Conn() *pgx.Conn
+}
+
+// txStarter defines the interface of pools and connections starting transactions.
+type txStarter interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+func runQuery(ctx context.Context, db queryRunner, query string) (string, error) {
 	log.Dbg("DB query:", query)
 
 	// TODO(anatoly): Retry mechanic.
@@ -66,7 +169,7 @@ func runQuery(ctx context.Context, db *pgxpool.Pool, query string) (string, erro
 }
 
 // runTableQuery runs query and returns results in the table view.
-func runTableQuery(ctx context.Context, db *pgxpool.Pool, query string, args ...interface{}) ([][]string, error) {
+func runTableQuery(ctx context.Context, db queryRunner, query string, args ...interface{}) ([][]string, error) {
 	log.Dbg("DB table query:", query)
 
 	rows, err := db.Query(ctx, query, args...)
@@ -127,6 +230,48 @@ func RenderTable(tableString *strings.Builder, res [][]string) {
 	table.Render()
 }
 
+// LimitTable cuts rows and long values of a table result, the header is kept. It reports if the table has been cut.
+// Zero limits are not applied.
+func LimitTable(res [][]string, limits TableLimits) ([][]string, bool) {
+	isCut := false
+
+	if limits.MaxRows > 0 && len(res) > limits.MaxRows+1 {
+		res = res[:limits.MaxRows+1]
+		isCut = true
+	}
+
+	limited := make([][]string, 0, len(res))
+
+	for _, row := range res {
+		limitedRow := make([]string, 0, len(row))
+
+		for _, value := range row {
+			if runes := []rune(value); limits.MaxWidth > 0 && len(runes) > limits.MaxWidth {
+				value = string(runes[:limits.MaxWidth]) + "…"
+				isCut = true
+			}
+
+			limitedRow = append(limitedRow, value)
+		}
+
+		limited = append(limited, limitedRow)
+	}
+
+	return limited, isCut
+}
+
+// RenderCSV renders table result in the CSV format.
+func RenderCSV(res [][]string) (string, error) {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+
+	if err := writer.WriteAll(res); err != nil {
+		return "", errors.Wrap(err, "failed to write CSV")
+	}
+
+	return buf.String(), nil
+}
+
 func clarifyQueryError(query []byte, err error) error {
 	if err == nil {
 		return err
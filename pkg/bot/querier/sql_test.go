@@ -0,0 +1,55 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitTable(t *testing.T) {
+	table := [][]string{
+		{"id", "note"},
+		{"1", "short"},
+		{"2", "значительно длиннее"},
+		{"3", ""},
+	}
+
+	testCases := []struct {
+		limits   TableLimits
+		expected [][]string
+		isCut    bool
+	}{
+		{
+			limits:   TableLimits{},
+			expected: table,
+			isCut:    false,
+		},
+		{
+			limits:   TableLimits{MaxRows: 3, MaxWidth: 19},
+			expected: table,
+			isCut:    false,
+		},
+		{
+			limits:   TableLimits{MaxRows: 2, MaxWidth: 11},
+			expected: [][]string{{"id", "note"}, {"1", "short"}, {"2", "значительно…"}},
+			isCut:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		limited, isCut := LimitTable(table, tc.limits)
+		assert.Equal(t, tc.expected, limited)
+		assert.Equal(t, tc.isCut, isCut)
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	resultCSV, err := RenderCSV([][]string{{"id", "note"}, {"1", `a, "b"`}, {"2", ""}})
+	require.Nil(t, err)
+	assert.Equal(t, "id,note\n1,\"a, \"\"b\"\"\"\n2,\n", resultCSV)
+}
@@ -0,0 +1,226 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+)
+
+// txStatusFailed defines the status of a connection in a failed transaction block.
+const txStatusFailed = 'E'
+
+// commandSavepoint defines the savepoint set before every command, so a failed command does not abort the transaction.
+const commandSavepoint = "joe_command"
+
+// Transaction defines a user transaction running on a connection pinned from the session pool until the transaction ends.
+// Transactions started by commands, e.g. for dry runs, are nested in it as savepoints.
+type Transaction struct {
+	conn *pgxpool.Conn
+	tx   pgx.Tx
+
+	limits *SessionLimits
+
+	// cmdMu is held by a running command, the pinned connection cannot run several commands at once.
+	cmdMu sync.Mutex
+
+	mu         sync.Mutex
+	running    int
+	lastUsedAt time.Time
+}
+
+var _ DB = (*Transaction)(nil)
+
+// pinnedConn defines the pinned connection acquired by a command, it is released when the transaction ends.
+type pinnedConn struct {
+	pgx.Tx
+}
+
+// Release does nothing because the connection stays pinned to the transaction.
+func (pinnedConn) Release() {}
+
+// BeginTransaction pins a connection of the pool and begins a transaction on it.
+// Postgres terminates the connection if the transaction is idle longer than the timeout, so locks are not held forever.
+// The pool hooks are not run for commands of the transaction, so the limits are enforced before every command.
+func BeginTransaction(ctx context.Context, pool *pgxpool.Pool, idleTimeout time.Duration,
+	limits *SessionLimits) (*Transaction, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to acquire a connection")
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		conn.Release()
+		return nil, errors.Wrap(err, "failed to begin a transaction")
+	}
+
+	if timeoutQuery := idleTimeoutQuery(idleTimeout, limits); timeoutQuery != "" {
+		if _, err := tx.Exec(ctx, timeoutQuery); err != nil {
+			if err := tx.Rollback(ctx); err != nil {
+				log.Err("Failed to roll back a transaction:", err)
+			}
+
+			conn.Release()
+
+			return nil, errors.Wrap(err, "failed to set the idle timeout of the transaction")
+		}
+	}
+
+	return &Transaction{conn: conn, tx: tx, limits: limits, lastUsedAt: time.Now()}, nil
+}
+
+// Begin starts a nested transaction as a savepoint.
+func (t *Transaction) Begin(ctx context.Context) (pgx.Tx, error) {
+	return t.tx.Begin(ctx)
+}
+
+// Exec executes the query in the transaction.
+func (t *Transaction) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return t.tx.Exec(ctx, sql, args...)
+}
+
+// Query runs the query in the transaction.
+func (t *Transaction) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return t.tx.Query(ctx, sql, args...)
+}
+
+// QueryRow runs the query returning one row in the transaction.
+func (t *Transaction) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return t.tx.QueryRow(ctx, sql, args...)
+}
+
+// Acquire returns the pinned connection.
+func (t *Transaction) Acquire(_ context.Context) (Conn, error) {
+	return pinnedConn{Tx: t.tx}, nil
+}
+
+// Conn returns the pinned connection.
+func (t *Transaction) Conn() *pgx.Conn {
+	return t.conn.Conn()
+}
+
+// Use waits until other commands of the transaction finish and sets a savepoint for a new command.
+// The returned function finishes the command, changes of a failed command are rolled back to the savepoint.
+func (t *Transaction) Use(ctx context.Context) (func(), error) {
+	t.mu.Lock()
+	t.running++
+	t.mu.Unlock()
+
+	t.cmdMu.Lock()
+
+	if t.limits != nil {
+		t.limits.Enforce(ctx, t.conn.Conn())
+	}
+
+	if _, err := t.tx.Exec(ctx, "SAVEPOINT "+commandSavepoint); err != nil {
+		t.finishCommand()
+		return nil, errors.Wrap(err, "failed to set a savepoint of the command")
+	}
+
+	return func() {
+		defer t.finishCommand()
+
+		// Postgres terminates connections of transactions which are idle for too long.
+		if t.conn.Conn().IsClosed() {
+			return
+		}
+
+		if t.conn.Conn().PgConn().TxStatus() == txStatusFailed {
+			if _, err := t.tx.Exec(context.Background(), "ROLLBACK TO SAVEPOINT "+commandSavepoint); err != nil {
+				log.Err("Failed to roll back a failed command:", err)
+			}
+		}
+
+		if _, err := t.tx.Exec(context.Background(), "RELEASE SAVEPOINT "+commandSavepoint); err != nil {
+			log.Err("Failed to release the savepoint of a command:", err)
+		}
+	}, nil
+}
+
+// finishCommand lets the next command run in the transaction.
+func (t *Transaction) finishCommand() {
+	t.cmdMu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.running--
+	t.lastUsedAt = time.Now()
+}
+
+// IdleFor returns how long the transaction has not been used by commands.
+func (t *Transaction) IdleFor() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.running > 0 {
+		return 0
+	}
+
+	return time.Since(t.lastUsedAt)
+}
+
+// Commit commits the transaction and returns the connection to the pool.
+// It waits until running commands of the transaction finish.
+func (t *Transaction) Commit(ctx context.Context) error {
+	t.cmdMu.Lock()
+	defer t.cmdMu.Unlock()
+
+	defer t.conn.Release()
+
+	if err := t.tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit the transaction")
+	}
+
+	return nil
+}
+
+// Rollback rolls back the transaction and returns the connection to the pool.
+// It waits until running commands of the transaction finish.
+func (t *Transaction) Rollback(ctx context.Context) error {
+	t.cmdMu.Lock()
+	defer t.cmdMu.Unlock()
+
+	defer t.conn.Release()
+
+	if err := t.tx.Rollback(ctx); err != nil {
+		return errors.Wrap(err, "failed to roll back the transaction")
+	}
+
+	return nil
+}
+
+// idleTimeoutQuery returns the command setting the idle timeout of a transaction.
+// The timeout does not exceed the value and the maximum of idle_in_transaction_session_timeout in the limits.
+func idleTimeoutQuery(idleTimeout time.Duration, limits *SessionLimits) string {
+	if idleTimeout <= 0 {
+		return ""
+	}
+
+	timeout := idleTimeout.Milliseconds()
+
+	if limits != nil {
+		const name = "idle_in_transaction_session_timeout"
+
+		if value, err := parseSettingValue(limits.RuntimeParams()[name], unitMilliseconds); err == nil && value > 0 && value < timeout {
+			timeout = value
+		}
+
+		if maxValue, ok := limits.maxValues[name]; ok && exceedsLimit(timeout, maxValue, unitMilliseconds) {
+			timeout = maxValue
+		}
+	}
+
+	return fmt.Sprintf("SET LOCAL idle_in_transaction_session_timeout = %d", timeout)
+}
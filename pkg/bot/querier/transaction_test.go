@@ -0,0 +1,29 @@
+/*
+2020 © Postgres.ai
+*/
+
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleTimeoutQuery(t *testing.T) {
+	assert.Equal(t, "", idleTimeoutQuery(0, nil))
+	assert.Equal(t, "SET LOCAL idle_in_transaction_session_timeout = 600000", idleTimeoutQuery(10*time.Minute, nil))
+
+	limits, err := NewSessionLimits([]SettingLimit{{Name: "idle_in_transaction_session_timeout", Value: "5min"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "SET LOCAL idle_in_transaction_session_timeout = 300000", idleTimeoutQuery(10*time.Minute, limits))
+	assert.Equal(t, "SET LOCAL idle_in_transaction_session_timeout = 60000", idleTimeoutQuery(time.Minute, limits))
+
+	limits, err = NewSessionLimits([]SettingLimit{{Name: "idle_in_transaction_session_timeout", Max: "2min"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "SET LOCAL idle_in_transaction_session_timeout = 120000", idleTimeoutQuery(10*time.Minute, limits))
+}
@@ -28,6 +28,9 @@ type App struct {
 	Port              uint          `env:"SERVER_PORT" env-default:"2400"`
 	MinNotifyDuration time.Duration `env:"MIN_NOTIFY_DURATION" env-default:"60s"`
 	Debug             bool          `env:"JOE_DEBUG"`
+	ExecMaxRows       int           `yaml:"execMaxRows" env:"EXEC_MAX_ROWS" env-default:"20"`
+	ExecMaxWidth      int           `yaml:"execMaxWidth" env:"EXEC_MAX_WIDTH" env-default:"100"`
+	TxIdleTimeout     time.Duration `yaml:"txIdleTimeout" env:"TX_IDLE_TIMEOUT" env-default:"5m"`
 }
 
 // Platform describes configuration parameters of a Postgres.ai platform.
@@ -64,10 +67,29 @@ type Credentials struct {
 
 // Channel defines a connection channel configuration.
 type Channel struct {
-	ChannelID   string      `yaml:"channelID" json:"channel_id"`
-	DBLabID     string      `yaml:"dblabServer" json:"-"`
-	Project     string      `yaml:"project" json:"-"`
-	DBLabParams DBLabParams `yaml:"dblabParams" json:"-"`
+	ChannelID      string        `yaml:"channelID" json:"channel_id"`
+	DBLabID        string        `yaml:"dblabServer" json:"-"`
+	Project        string        `yaml:"project" json:"-"`
+	DBLabParams    DBLabParams   `yaml:"dblabParams" json:"-"`
+	Privacy        Privacy       `yaml:"privacy" json:"-"`
+	DryRun         bool          `yaml:"dryRun" json:"-"`
+	CommandTimeout time.Duration `yaml:"commandTimeout" json:"-"`
+	Limits         Limits        `yaml:"limits" json:"-"`
+}
+
+// Limits defines limits of queries on clones, they are applied to every connection to a clone.
+// Users can change the limits in their sessions up to the maximums.
+type Limits struct {
+	StatementTimeout                Limit `yaml:"statementTimeout"`
+	TempFileLimit                   Limit `yaml:"tempFileLimit"`
+	IdleInTransactionSessionTimeout Limit `yaml:"idleInTransactionSessionTimeout"`
+	LockTimeout                     Limit `yaml:"lockTimeout"`
+}
+
+// Limit defines a Postgres value of a limit, e.g. "30min" or "10GB", and its maximum.
+type Limit struct {
+	Value string `yaml:"value"`
+	Max   string `yaml:"max"`
 }
 
 // DBLabParams defines database params for clone creation.
@@ -75,3 +97,9 @@ type DBLabParams struct {
 	DBName  string `yaml:"dbname" json:"-"`
 	SSLMode string `yaml:"sslmode" json:"-"`
 }
+
+// Privacy defines anonymization of queries and plans before they are shared or saved to history.
+type Privacy struct {
+	Enabled         bool `yaml:"enabled" json:"-"`
+	HashIdentifiers bool `yaml:"hashIdentifiers" json:"-"`
+}
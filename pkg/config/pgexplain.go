@@ -23,6 +23,10 @@ func LoadExplainConfig() (pgexplain.ExplainConfig, error) {
 		return explainConfig, err
 	}
 
+	if err := explainConfig.CompileRules(); err != nil {
+		return explainConfig, errors.Wrap(err, "invalid explain.yaml tips")
+	}
+
 	return explainConfig, nil
 }
 
@@ -0,0 +1,32 @@
+/*
+2020 © Postgres.ai
+*/
+
+package connection
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// artifactFileTypes contains file types of artifacts by extensions of their names.
+var artifactFileTypes = map[string]string{
+	".svg":  "svg",
+	".html": "html",
+	".csv":  "csv",
+}
+
+// ArtifactFile returns a file name and a file type of an artifact.
+// The file type is defined by the extension of the artifact name, e.g. "plan-flamegraph.svg", text is used by default.
+func ArtifactFile(name string) (string, string) {
+	const textFileType, textExtension = "text", "txt"
+
+	filename := strings.ToLower(strings.ReplaceAll(name, " ", "-"))
+
+	if fileType, ok := artifactFileTypes[path.Ext(filename)]; ok {
+		return filename, fileType
+	}
+
+	return fmt.Sprintf("%s.%s", filename, textExtension), textFileType
+}
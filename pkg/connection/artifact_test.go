@@ -0,0 +1,32 @@
+/*
+2020 © Postgres.ai
+*/
+
+package connection
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filename string
+		fileType string
+	}{
+		{name: "plan-text", filename: "plan-text.txt", fileType: "text"},
+		{name: "Plan Text", filename: "plan-text.txt", fileType: "text"},
+		{name: "plan-flamegraph.svg", filename: "plan-flamegraph.svg", fileType: "svg"},
+		{name: "plan.html", filename: "plan.html", fileType: "html"},
+		{name: "rows.csv", filename: "rows.csv", fileType: "csv"},
+		{name: "plan.json", filename: "plan.json.txt", fileType: "text"},
+	}
+
+	for _, tc := range testCases {
+		filename, fileType := ArtifactFile(tc.name)
+		assert.Equal(t, tc.filename, filename)
+		assert.Equal(t, tc.fileType, fileType)
+	}
+}
@@ -7,6 +7,7 @@ package connection
 import (
 	"context"
 
+	"gitlab.com/postgres-ai/joe/pkg/config"
 	"gitlab.com/postgres-ai/joe/pkg/models"
 	"gitlab.com/postgres-ai/joe/pkg/services/dblab"
 )
@@ -20,7 +21,7 @@ type Assistant interface {
 	CheckIdleSessions(context.Context)
 
 	// AddChannel adds a new Database Lab instance to communication via the assistant.
-	AddChannel(channelID, project string, dbLabInstance *dblab.Instance)
+	AddChannel(channel config.Channel, dbLabInstance *dblab.Instance)
 }
 
 // MessageProcessor defines the interface of a message processor.
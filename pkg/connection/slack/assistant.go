@@ -110,20 +110,24 @@ func (a *Assistant) Init(_ context.Context) error {
 }
 
 // AddChannel sets a message processor for a specific channel.
-func (a *Assistant) AddChannel(channelID, project string, dbLabInstance *dblab.Instance) {
-	messageProcessor := a.buildMessageProcessor(project, dbLabInstance)
+func (a *Assistant) AddChannel(channel config.Channel, dbLabInstance *dblab.Instance) {
+	messageProcessor := a.buildMessageProcessor(channel, dbLabInstance)
 
-	a.addProcessingService(channelID, messageProcessor)
+	a.addProcessingService(channel.ChannelID, messageProcessor)
 }
 
-func (a *Assistant) buildMessageProcessor(project string, dbLabInstance *dblab.Instance) *msgproc.ProcessingService {
+func (a *Assistant) buildMessageProcessor(channel config.Channel, dbLabInstance *dblab.Instance) *msgproc.ProcessingService {
 	processingCfg := msgproc.ProcessingConfig{
-		App:      a.appCfg.App,
-		Platform: a.appCfg.Platform,
-		Explain:  a.appCfg.Explain,
-		DBLab:    dbLabInstance.Config(),
-		EntOpts:  a.appCfg.Enterprise,
-		Project:  project,
+		App:            a.appCfg.App,
+		Platform:       a.appCfg.Platform,
+		Explain:        a.appCfg.Explain,
+		DBLab:          dbLabInstance.Config(),
+		EntOpts:        a.appCfg.Enterprise,
+		Project:        channel.Project,
+		Privacy:        channel.Privacy,
+		DryRun:         channel.DryRun,
+		CommandTimeout: channel.CommandTimeout,
+		Limits:         channel.Limits,
 	}
 
 	return msgproc.NewProcessingService(a.messenger, MessageValidator{}, dbLabInstance.Client(), a.userManager, a.platformClient,
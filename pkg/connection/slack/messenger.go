@@ -16,6 +16,7 @@ import (
 
 	"gitlab.com/postgres-ai/database-lab/pkg/log"
 
+	"gitlab.com/postgres-ai/joe/pkg/connection"
 	"gitlab.com/postgres-ai/joe/pkg/models"
 )
 
@@ -207,14 +208,11 @@ func (m *Messenger) AddArtifact(title, explainResult, channelID, messageID strin
 }
 
 func (m *Messenger) uploadFile(title string, content string, channel string, ts string) (*slack.File, error) {
-	const fileType = "txt"
-
-	name := strings.ToLower(strings.ReplaceAll(title, " ", "-"))
-	filename := fmt.Sprintf("%s.%s", name, fileType)
+	filename, fileType := connection.ArtifactFile(title)
 
 	params := slack.FileUploadParameters{
 		Title:           title,
-		Filetype:        "text",
+		Filetype:        fileType,
 		Filename:        filename,
 		Content:         content,
 		Channels:        []string{channel},
@@ -0,0 +1,529 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Anonymization placeholders.
+const (
+	anonymizedLiteral      = "?"
+	anonymizedIdentPrefix  = "h_"
+	anonymizedIdentHashLen = 8
+)
+
+// anonymizedExpressions contains plan properties which may contain literals.
+var anonymizedExpressions = map[string]bool{
+	"Filter":          true,
+	"Index Cond":      true,
+	"Recheck Cond":    true,
+	"Hash Cond":       true,
+	"Merge Cond":      true,
+	"Join Filter":     true,
+	"One-Time Filter": true,
+	"TID Cond":        true,
+	"Cache Key":       true,
+	"Output":          true,
+	"Sort Key":        true,
+	"Group Key":       true,
+	"Presorted Key":   true,
+}
+
+// anonymizedIdentifiers contains plan properties which contain names of database objects.
+var anonymizedIdentifiers = map[string]bool{
+	"Relation Name": true,
+	"Alias":         true,
+	"Schema":        true,
+	"Index Name":    true,
+	"CTE Name":      true,
+}
+
+// sqlWords contains keywords, type names and plan terms which are kept when identifiers are hashed.
+var sqlWords = makeWordSet(`all and any array as asc between by case cast collate current_date current_time
+	current_timestamp current_user default delete desc distinct else end except exists false fetch first for from
+	full group having ilike in inner insert intersect interval into is isnull join last lateral left like limit
+	natural not notnull null nulls offset on only or order outer over partition returning right select set similar
+	some symmetric table then to true union unknown update using values when where window with
+	bigint bit bool boolean bytea char character decimal double float int int2 int4 int8 integer json jsonb
+	numeric oid precision real regclass smallint text timestamp timestamptz uuid varchar varying without
+	hashed initplan subplan`)
+
+// castTypeWords contains words of type names which are followed by other words, e.g. "timestamp without time zone".
+var castTypeWords = makeWordSet("bit character double time timestamp with without")
+
+var textPlanPropertyRe = regexp.MustCompile(`^(\s*(?:->\s+)?)([A-Z][A-Za-z -]*): (.*)$`)
+
+// Anonymizer replaces literals of queries and plans with placeholders and optionally hashes names of database objects.
+// Hashes are stable, so the same name gets the same hash in the query, the plan text, JSON and the summary.
+// Identifiers of expressions are detected heuristically: words which are not keywords, type names or function names.
+// Nil Anonymizer leaves values unchanged.
+type Anonymizer struct {
+	hashIdentifiers bool
+	known           map[string]bool
+}
+
+// NewAnonymizer creates a new Anonymizer.
+func NewAnonymizer(hashIdentifiers bool) *Anonymizer {
+	return &Anonymizer{
+		hashIdentifiers: hashIdentifiers,
+		known:           make(map[string]bool),
+	}
+}
+
+// Query anonymizes an SQL query.
+func (a *Anonymizer) Query(query string) string {
+	if a == nil {
+		return query
+	}
+
+	return a.expression(query)
+}
+
+// Identifier returns the hash of a name of a database object if identifiers are hashed.
+func (a *Anonymizer) Identifier(name string) string {
+	if a == nil || !a.hashIdentifiers || name == "" {
+		return name
+	}
+
+	a.known[name] = true
+
+	sum := sha256.Sum256([]byte(name))
+
+	return anonymizedIdentPrefix + hex.EncodeToString(sum[:])[:anonymizedIdentHashLen]
+}
+
+// Anonymize anonymizes plan nodes.
+func (ex *Explain) Anonymize(a *Anonymizer) {
+	if a == nil {
+		return
+	}
+
+	a.anonymizePlan(&ex.Plan)
+}
+
+func (a *Anonymizer) anonymizePlan(plan *Plan) {
+	for _, value := range []*string{&plan.Filter, &plan.IndexCondition, &plan.HashCondition, &plan.MergeCondition,
+		&plan.JoinFilter, &plan.OneTimeFilter, &plan.TidCondition, &plan.CacheKey} {
+		*value = a.expression(*value)
+	}
+
+	for _, values := range [][]string{plan.Output, plan.SortKey, plan.GroupKey, plan.PresortedKey} {
+		for i := range values {
+			values[i] = a.expression(values[i])
+		}
+	}
+
+	for _, value := range []*string{&plan.RelationName, &plan.Alias, &plan.Schema, &plan.IndexName, &plan.CteName} {
+		*value = a.Identifier(*value)
+	}
+
+	for index := range plan.Plans {
+		a.anonymizePlan(&plan.Plans[index])
+	}
+}
+
+// PlanJSON anonymizes EXPLAIN output in the JSON format keeping the order of keys.
+func (a *Anonymizer) PlanJSON(plan string) (string, error) {
+	if a == nil {
+		return plan, nil
+	}
+
+	type level struct {
+		object    bool
+		expectKey bool
+		key       string
+		count     int
+	}
+
+	buf := &bytes.Buffer{}
+	stack := []*level{}
+
+	decoder := json.NewDecoder(strings.NewReader(plan))
+	decoder.UseNumber()
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return "", errors.Wrap(err, "failed to parse the plan")
+		}
+
+		var top *level
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		if delim, ok := token.(json.Delim); ok && (delim == '}' || delim == ']') {
+			buf.WriteRune(rune(delim))
+			stack = stack[:len(stack)-1]
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.count++
+				parent.expectKey = parent.object
+			}
+
+			continue
+		}
+
+		if top != nil {
+			switch {
+			case top.object && top.expectKey && top.count > 0, !top.object && top.count > 0:
+				buf.WriteString(",")
+
+			case top.object && !top.expectKey:
+				buf.WriteString(":")
+			}
+		}
+
+		switch value := token.(type) {
+		case json.Delim:
+			buf.WriteRune(rune(value))
+
+			child := &level{object: value == '{', expectKey: value == '{'}
+			if top != nil {
+				child.key = top.key
+			}
+
+			stack = append(stack, child)
+
+			continue
+
+		case string:
+			if top != nil && top.object && top.expectKey {
+				writeJSONValue(buf, value)
+
+				top.key = value
+				top.expectKey = false
+
+				continue
+			}
+
+			if top != nil {
+				value = a.planValue(top.key, value)
+			}
+
+			writeJSONValue(buf, value)
+
+		default:
+			writeJSONValue(buf, value)
+		}
+
+		if top != nil {
+			top.count++
+			top.expectKey = top.object
+		}
+	}
+
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, buf.Bytes(), "", "  "); err != nil {
+		return "", errors.Wrap(err, "failed to format the plan")
+	}
+
+	return indented.String(), nil
+}
+
+// writeJSONValue writes a JSON value without escaping of HTML characters which are common in conditions.
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	encoded := &bytes.Buffer{}
+
+	encoder := json.NewEncoder(encoded)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+
+	buf.Write(bytes.TrimRight(encoded.Bytes(), "\n"))
+}
+
+func (a *Anonymizer) planValue(key, value string) string {
+	switch {
+	case anonymizedExpressions[key]:
+		return a.expression(value)
+
+	case anonymizedIdentifiers[key]:
+		return a.Identifier(value)
+	}
+
+	return value
+}
+
+// PlanText anonymizes EXPLAIN output in the text format.
+func (a *Anonymizer) PlanText(plan string) string {
+	if a == nil {
+		return plan
+	}
+
+	// Names of database objects are needed to find them in captions of nodes.
+	if explain, err := ParseExplain(plan, ExplainConfig{}); err == nil {
+		explain.Anonymize(a)
+	}
+
+	lines := strings.Split(plan, "\n")
+
+	for i, line := range lines {
+		if match := textPlanPropertyRe.FindStringSubmatch(line); match != nil && anonymizedExpressions[match[2]] {
+			lines[i] = match[1] + match[2] + ": " + a.expression(match[3])
+			continue
+		}
+
+		lines[i] = a.knownIdentifiers(line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// knownIdentifiers hashes names of database objects in a caption of a plan node.
+func (a *Anonymizer) knownIdentifiers(line string) string {
+	if !a.hashIdentifiers {
+		return line
+	}
+
+	caption, details := line, ""
+	if i := strings.Index(line, "  ("); i >= 0 {
+		caption, details = line[:i], line[i:]
+	}
+
+	return a.replaceWords(caption, func(word string, quoted bool) string {
+		if a.known[word] {
+			return a.Identifier(word)
+		}
+
+		return quoteIdent(word, quoted)
+	}) + details
+}
+
+// expression replaces literals of an SQL expression and hashes identifiers if needed.
+func (a *Anonymizer) expression(expr string) string {
+	if expr == "" {
+		return expr
+	}
+
+	runes := []rune(expr)
+	buf := &strings.Builder{}
+	previousWord, castType := "", false
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '\'':
+			i = skipQuotedRunes(runes, i, '\'')
+			buf.WriteString(anonymizedLiteral)
+
+		case r == '"':
+			end := skipQuotedRunes(runes, i, '"')
+			word := strings.ReplaceAll(string(runes[i+1:minInt(end, len(runes))]), `""`, `"`)
+			buf.WriteString(a.word(word, true, false))
+			i = end
+
+		case r == '$' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			// Parameters are kept.
+			for buf.WriteRune(r); i+1 < len(runes) && unicode.IsDigit(runes[i+1]); i++ {
+				buf.WriteRune(runes[i+1])
+			}
+
+		case r == '$':
+			end, ok := skipDollarQuotedRunes(runes, i)
+			if !ok {
+				buf.WriteRune(r)
+				continue
+			}
+
+			buf.WriteString(anonymizedLiteral)
+			i = end
+
+		case unicode.IsDigit(r):
+			start := i
+			for i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.') {
+				i++
+			}
+
+			// Numbers of subplans are kept to link them with nodes.
+			if previousWord == "subplan" || previousWord == "initplan" {
+				buf.WriteString(string(runes[start : i+1]))
+			} else {
+				buf.WriteString(anonymizedLiteral)
+			}
+
+		case isIdentStart(r):
+			start := i
+			for i+1 < len(runes) && isIdentRune(runes[i+1]) {
+				i++
+			}
+
+			word := string(runes[start : i+1])
+
+			// Escape string constants, e.g. E'\n'.
+			if strings.EqualFold(word, "e") && i+1 < len(runes) && runes[i+1] == '\'' {
+				continue
+			}
+
+			buf.WriteString(a.word(word, false, castType || isFunctionCall(runes, i+1)))
+
+			previousWord = strings.ToLower(word)
+			castType = castType && castTypeWords[previousWord]
+
+			continue
+
+		case r == ':' && i+1 < len(runes) && runes[i+1] == ':':
+			buf.WriteString("::")
+			i++
+			castType = true
+
+			continue
+
+		default:
+			buf.WriteRune(r)
+		}
+
+		if !unicode.IsSpace(r) {
+			castType = false
+		}
+	}
+
+	return buf.String()
+}
+
+// word hashes a word of an expression if it's an identifier.
+func (a *Anonymizer) word(word string, quoted, keep bool) string {
+	if !a.hashIdentifiers || keep || (!quoted && sqlWords[strings.ToLower(word)]) {
+		return quoteIdent(word, quoted)
+	}
+
+	if !quoted {
+		// Unquoted identifiers are case-insensitive.
+		word = strings.ToLower(word)
+	}
+
+	return a.Identifier(word)
+}
+
+// replaceWords replaces identifiers of a text.
+func (a *Anonymizer) replaceWords(text string, replace func(word string, quoted bool) string) string {
+	runes := []rune(text)
+	buf := &strings.Builder{}
+
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '"':
+			end := skipQuotedRunes(runes, i, '"')
+			buf.WriteString(replace(strings.ReplaceAll(string(runes[i+1:minInt(end, len(runes))]), `""`, `"`), true))
+			i = end
+
+		case isIdentStart(r):
+			start := i
+			for i+1 < len(runes) && isIdentRune(runes[i+1]) {
+				i++
+			}
+
+			buf.WriteString(replace(string(runes[start:i+1]), false))
+
+		default:
+			buf.WriteRune(r)
+		}
+	}
+
+	return buf.String()
+}
+
+func quoteIdent(word string, quoted bool) string {
+	if !quoted {
+		return word
+	}
+
+	return `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+}
+
+func isFunctionCall(runes []rune, i int) bool {
+	for ; i < len(runes); i++ {
+		if !unicode.IsSpace(runes[i]) {
+			return runes[i] == '('
+		}
+	}
+
+	return false
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+// skipQuotedRunes returns the position of the closing quote, doubled quotes are escaped ones.
+func skipQuotedRunes(runes []rune, start int, quote rune) int {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] != quote {
+			continue
+		}
+
+		if i+1 < len(runes) && runes[i+1] == quote {
+			i++
+			continue
+		}
+
+		return i
+	}
+
+	return len(runes)
+}
+
+// skipDollarQuotedRunes returns the position of the end of a dollar-quoted literal, e.g. $tag$text$tag$.
+func skipDollarQuotedRunes(runes []rune, start int) (int, bool) {
+	tagEnd := start + 1
+	for tagEnd < len(runes) && runes[tagEnd] != '$' {
+		if !isIdentRune(runes[tagEnd]) {
+			return 0, false
+		}
+
+		tagEnd++
+	}
+
+	if tagEnd >= len(runes) {
+		return 0, false
+	}
+
+	tag := runes[start : tagEnd+1]
+
+	for i := tagEnd + 1; i+len(tag) <= len(runes); i++ {
+		if string(runes[i:i+len(tag)]) == string(tag) {
+			return i + len(tag) - 1, true
+		}
+	}
+
+	return len(runes), true
+}
+
+func makeWordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+
+	return set
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,91 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnonymizeQuery(t *testing.T) {
+	testCases := []struct {
+		name            string
+		hashIdentifiers bool
+		query           string
+		expected        string
+	}{
+		{
+			name:     "literals",
+			query:    "select * from users where email = 'john@example.com' and id in (1, 2) and note = E'a\\n' and x = $$b$$ and y = $1",
+			expected: "select * from users where email = ? and id in (?, ?) and note = ? and x = ? and y = $1",
+		},
+		{
+			name:            "identifiers",
+			hashIdentifiers: true,
+			query:           `SELECT u.id FROM Users u WHERE lower(u."Email") = 'a'::character varying AND u.created_at > now()`,
+			expected: "SELECT " + testHash("u") + "." + testHash("id") + " FROM " + testHash("users") + " " + testHash("u") +
+				" WHERE lower(" + testHash("u") + "." + testHash("Email") + ") = ?::character varying AND " +
+				testHash("u") + "." + testHash("created_at") + " > now()",
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, NewAnonymizer(tc.hashIdentifiers).Query(tc.query), tc.name)
+	}
+
+	var anonymizer *Anonymizer
+	assert.Equal(t, "select 1", anonymizer.Query("select 1"))
+}
+
+func TestAnonymizePlan(t *testing.T) {
+	anonymizer := NewAnonymizer(true)
+
+	planJSON, err := anonymizer.PlanJSON(InputJSONParse)
+	require.Nil(t, err)
+
+	explain, err := NewExplain(planJSON, ExplainConfig{})
+	require.Nil(t, err)
+
+	expected, err := ParseExplain(InputTextParse, ExplainConfig{})
+	require.Nil(t, err)
+	expected.Anonymize(anonymizer)
+
+	assert.Equal(t, expected.RenderPlanText(), explain.RenderPlanText())
+	assert.Equal(t, expected.Fingerprint(), explain.Fingerprint())
+
+	planText := explain.RenderPlanText()
+	assert.Contains(t, planText, "Index Scan using "+testHash("orders_pkey")+" on "+testHash("public")+"."+
+		testHash("orders")+" "+testHash("o"))
+	assert.Contains(t, planText, "Index Cond: ("+testHash("o")+"."+testHash("id")+" > ?)")
+	assert.Contains(t, planText, "Filter: "+testHash("u")+"."+testHash("active"))
+
+	for _, name := range []string{"orders", "users", "user_id", "name", "> 10"} {
+		assert.NotContains(t, planText, name)
+		assert.NotContains(t, planJSON, name)
+	}
+
+	rawText := anonymizer.PlanText(InputTextParse)
+	assert.Contains(t, rawText, "->  Index Scan Backward using "+testHash("orders_pkey")+" on "+testHash("public")+"."+
+		testHash("orders")+" "+testHash("o")+"  (cost=0.15..9.20")
+	assert.Contains(t, rawText, "Hash Cond: ("+testHash("o")+"."+testHash("user_id")+" = "+testHash("u")+"."+testHash("id")+")")
+	assert.False(t, strings.Contains(rawText, "users"))
+}
+
+func TestAnonymizeLiteralsOnly(t *testing.T) {
+	anonymizer := NewAnonymizer(false)
+
+	planText := anonymizer.PlanText(InputTextParse)
+
+	assert.Contains(t, planText, "Index Scan Backward using orders_pkey on public.orders o")
+	assert.Contains(t, planText, "Index Cond: (o.id > ?)")
+	assert.Contains(t, planText, "Hash Cond: (o.user_id = u.id)")
+}
+
+func testHash(name string) string {
+	return NewAnonymizer(true).Identifier(name)
+}
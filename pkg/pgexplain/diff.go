@@ -0,0 +1,357 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"gitlab.com/postgres-ai/joe/pkg/util"
+)
+
+// DiffStatus defines how a plan node has changed between two plans.
+type DiffStatus string
+
+// Diff statuses of plan nodes.
+const (
+	DiffSame        DiffStatus = "same"
+	DiffTypeChanged DiffStatus = "type-changed"
+	DiffAdded       DiffStatus = "added"
+	DiffRemoved     DiffStatus = "removed"
+)
+
+var diffStatusMarks = map[DiffStatus]string{
+	DiffSame:        " ",
+	DiffTypeChanged: "~",
+	DiffAdded:       "+",
+	DiffRemoved:     "-",
+}
+
+// PlanDiff contains a node-by-node comparison of two explains.
+type PlanDiff struct {
+	Before *Explain
+	After  *Explain
+	Nodes  []NodeDiff
+}
+
+// NodeDiff describes changes of a single plan node.
+type NodeDiff struct {
+	Status DiffStatus
+	Depth  int
+
+	// Before is nil for added nodes, After is nil for removed nodes.
+	Before *Plan
+	After  *Plan
+
+	// Deltas of the calculated actual duration (ms), actual rows and shared buffers.
+	ActualDurationDelta   float64
+	ActualRowsDelta       int64
+	SharedHitBlocksDelta  int64
+	SharedReadBlocksDelta int64
+}
+
+// Compare builds a node-by-node diff of two explains.
+func Compare(before, after *Explain) *PlanDiff {
+	diff := &PlanDiff{
+		Before: before,
+		After:  after,
+	}
+
+	diff.compareNodes(&before.Plan, &after.Plan, 0)
+
+	return diff
+}
+
+// Render renders the diff in the text format.
+func (d *PlanDiff) Render() string {
+	buf := new(bytes.Buffer)
+	d.writeDiffText(buf)
+
+	return buf.String()
+}
+
+// HasShapeChanges checks if any node has been added, removed or changed its type.
+func (d *PlanDiff) HasShapeChanges() bool {
+	for _, node := range d.Nodes {
+		if node.Status != DiffSame {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *PlanDiff) compareNodes(before, after *Plan, depth int) {
+	status := DiffSame
+	if planNodeKey(before) != planNodeKey(after) {
+		status = DiffTypeChanged
+	}
+
+	d.Nodes = append(d.Nodes, newNodeDiff(status, before, after, depth))
+
+	for _, pair := range alignPlans(before.Plans, after.Plans) {
+		switch {
+		case pair.before == nil:
+			d.appendSubtree(DiffAdded, pair.after, depth+1)
+
+		case pair.after == nil:
+			d.appendSubtree(DiffRemoved, pair.before, depth+1)
+
+		default:
+			d.compareNodes(pair.before, pair.after, depth+1)
+		}
+	}
+}
+
+func (d *PlanDiff) appendSubtree(status DiffStatus, plan *Plan, depth int) {
+	var nodeDiff NodeDiff
+
+	if status == DiffAdded {
+		nodeDiff = newNodeDiff(status, nil, plan, depth)
+	} else {
+		nodeDiff = newNodeDiff(status, plan, nil, depth)
+	}
+
+	d.Nodes = append(d.Nodes, nodeDiff)
+
+	for index := range plan.Plans {
+		d.appendSubtree(status, &plan.Plans[index], depth+1)
+	}
+}
+
+func newNodeDiff(status DiffStatus, before, after *Plan, depth int) NodeDiff {
+	beforeValues, afterValues := &Plan{}, &Plan{}
+
+	if before != nil {
+		beforeValues = before
+	}
+
+	if after != nil {
+		afterValues = after
+	}
+
+	return NodeDiff{
+		Status:                status,
+		Depth:                 depth,
+		Before:                before,
+		After:                 after,
+		ActualDurationDelta:   afterValues.ActualDuration - beforeValues.ActualDuration,
+		ActualRowsDelta:       int64(afterValues.ActualRows) - int64(beforeValues.ActualRows),
+		SharedHitBlocksDelta:  int64(afterValues.SharedHitBlocks) - int64(beforeValues.SharedHitBlocks),
+		SharedReadBlocksDelta: int64(afterValues.SharedReadBlocks) - int64(beforeValues.SharedReadBlocks),
+	}
+}
+
+// planNodeKey defines which nodes are considered to be the same in both plans.
+func planNodeKey(plan *Plan) string {
+	return fmt.Sprintf("%s|%s|%s", plan.NodeType, plan.RelationName, plan.CteName)
+}
+
+type planPair struct {
+	before *Plan
+	after  *Plan
+}
+
+// alignPlans matches child nodes of two plans.
+// Nodes with the same key are matched using the longest common subsequence,
+// remaining nodes between matches are paired by relations, then by their positions.
+func alignPlans(before, after []Plan) []planPair {
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if planNodeKey(&before[i]) == planNodeKey(&after[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+				continue
+			}
+
+			lcs[i][j] = lcs[i+1][j]
+			if lcs[i][j+1] > lcs[i][j] {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	pairs := make([]planPair, 0, len(before)+len(after))
+	unmatchedBefore, unmatchedAfter := []*Plan{}, []*Plan{}
+
+	flushUnmatched := func() {
+		pairs = append(pairs, pairUnmatchedPlans(unmatchedBefore, unmatchedAfter)...)
+		unmatchedBefore, unmatchedAfter = unmatchedBefore[:0], unmatchedAfter[:0]
+	}
+
+	i, j := 0, 0
+	for i < len(before) && j < len(after) {
+		switch {
+		case planNodeKey(&before[i]) == planNodeKey(&after[j]):
+			flushUnmatched()
+			pairs = append(pairs, planPair{before: &before[i], after: &after[j]})
+			i++
+			j++
+
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			unmatchedBefore = append(unmatchedBefore, &before[i])
+			i++
+
+		default:
+			unmatchedAfter = append(unmatchedAfter, &after[j])
+			j++
+		}
+	}
+
+	for ; i < len(before); i++ {
+		unmatchedBefore = append(unmatchedBefore, &before[i])
+	}
+
+	for ; j < len(after); j++ {
+		unmatchedAfter = append(unmatchedAfter, &after[j])
+	}
+
+	flushUnmatched()
+
+	return pairs
+}
+
+func pairUnmatchedPlans(before, after []*Plan) []planPair {
+	pairs := make([]planPair, 0, len(before)+len(after))
+	usedBefore := make([]bool, len(before))
+	pairedAfter := make([]*Plan, len(after))
+
+	// Nodes scanning the same relation (e.g., Seq Scan → Index Scan) are the same node with a changed type.
+	for j, afterPlan := range after {
+		if afterPlan.RelationName == "" {
+			continue
+		}
+
+		for i, beforePlan := range before {
+			if !usedBefore[i] && beforePlan.RelationName == afterPlan.RelationName {
+				usedBefore[i] = true
+				pairedAfter[j] = beforePlan
+
+				break
+			}
+		}
+	}
+
+	i := 0
+	for j, afterPlan := range after {
+		if pairedAfter[j] == nil && afterPlan.RelationName == "" {
+			for i < len(before) && (usedBefore[i] || before[i].RelationName != "") {
+				i++
+			}
+
+			if i < len(before) {
+				usedBefore[i] = true
+				pairedAfter[j] = before[i]
+			}
+		}
+
+		pairs = append(pairs, planPair{before: pairedAfter[j], after: afterPlan})
+	}
+
+	for i, beforePlan := range before {
+		if !usedBefore[i] {
+			pairs = append(pairs, planPair{before: beforePlan})
+		}
+	}
+
+	return pairs
+}
+
+func (d *PlanDiff) writeDiffText(writer io.Writer) {
+	fmt.Fprintf(writer, "Time: %s\n", durationChange(d.Before.TotalTime, d.After.TotalTime))
+	fmt.Fprintf(writer, "  - planning: %s\n", durationChange(d.Before.PlanningTime, d.After.PlanningTime))
+	fmt.Fprintf(writer, "  - execution: %s\n", durationChange(d.Before.ExecutionTime, d.After.ExecutionTime))
+
+	fmt.Fprintf(writer, "\nShared buffers:\n")
+	fmt.Fprintf(writer, "  - hits: %s\n", blocksChange(d.Before.SharedHitBlocks, d.After.SharedHitBlocks))
+	fmt.Fprintf(writer, "  - reads: %s\n", blocksChange(d.Before.SharedReadBlocks, d.After.SharedReadBlocks))
+
+	fmt.Fprintf(writer, "\nNodes:\n")
+
+	for _, node := range d.Nodes {
+		indent := strings.Repeat("  ", node.Depth)
+		fmt.Fprintf(writer, "%s %s%s\n", diffStatusMarks[node.Status], indent, node.caption())
+
+		details := indent + "    "
+
+		switch node.Status {
+		case DiffAdded, DiffRemoved:
+			plan := node.After
+			if plan == nil {
+				plan = node.Before
+			}
+
+			fmt.Fprintf(writer, "  %stime: %s, rows: %d, buffers: shared hit=%d read=%d\n", details,
+				util.MillisecondsToString(plan.ActualDuration), plan.ActualRows, plan.SharedHitBlocks, plan.SharedReadBlocks)
+
+		default:
+			fmt.Fprintf(writer, "  %stime: %s\n", details, durationChange(node.Before.ActualDuration, node.After.ActualDuration))
+			fmt.Fprintf(writer, "  %srows: %s\n", details, countChange(node.Before.ActualRows, node.After.ActualRows))
+			fmt.Fprintf(writer, "  %sbuffers: shared hit %s, read %s\n", details,
+				countChange(node.Before.SharedHitBlocks, node.After.SharedHitBlocks),
+				countChange(node.Before.SharedReadBlocks, node.After.SharedReadBlocks))
+		}
+	}
+}
+
+func (n NodeDiff) caption() string {
+	switch n.Status {
+	case DiffAdded:
+		return planCaption(n.After)
+
+	case DiffRemoved:
+		return planCaption(n.Before)
+
+	case DiffTypeChanged:
+		return fmt.Sprintf("%s → %s", planCaption(n.Before), planCaption(n.After))
+
+	default:
+		return planCaption(n.After)
+	}
+}
+
+// planCaption returns a node caption without costs and timing.
+func planCaption(plan *Plan) string {
+	caption := ""
+
+	writePlanTextNodeCaption(func(format string, a ...interface{}) (int, error) {
+		caption = fmt.Sprintf(format, a...)
+		return len(caption), nil
+	}, plan, false)
+
+	return caption
+}
+
+func durationChange(before, after float64) string {
+	delta := after - before
+	sign := "+"
+
+	if delta < 0 {
+		sign = "-"
+	}
+
+	return fmt.Sprintf("%s → %s (%s%s)", util.MillisecondsToString(before), util.MillisecondsToString(after),
+		sign, util.MillisecondsToString(math.Abs(delta)))
+}
+
+func countChange(before, after uint64) string {
+	return fmt.Sprintf("%d → %d (%+d)", before, after, int64(after)-int64(before))
+}
+
+func blocksChange(before, after uint64) string {
+	delta := int64(after) - int64(before)
+	if delta == 0 {
+		return fmt.Sprintf("%d → %d (+0)", before, after)
+	}
+
+	return fmt.Sprintf("%d → %d (%+d, ~%s)", before, after, delta, blocksToBytes(uint64(math.Abs(float64(delta)))))
+}
@@ -0,0 +1,156 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	before, err := NewExplain(InputJSONDiffBefore, ExplainConfig{})
+	require.Nil(t, err)
+
+	after, err := NewExplain(InputJSONDiffAfter, ExplainConfig{})
+	require.Nil(t, err)
+
+	planDiff := Compare(before, after)
+
+	assert.True(t, planDiff.HasShapeChanges())
+	require.Equal(t, 4, len(planDiff.Nodes))
+
+	assert.Equal(t, DiffSame, planDiff.Nodes[0].Status)
+	assert.Equal(t, NodeType(Limit), planDiff.Nodes[0].After.NodeType)
+
+	assert.Equal(t, DiffTypeChanged, planDiff.Nodes[1].Status)
+	assert.Equal(t, NodeType(SequenceScan), planDiff.Nodes[1].Before.NodeType)
+	assert.Equal(t, NodeType(IndexScan), planDiff.Nodes[1].After.NodeType)
+	assert.Equal(t, int64(-90), planDiff.Nodes[1].SharedHitBlocksDelta)
+	assert.Equal(t, int64(-1000), planDiff.Nodes[1].SharedReadBlocksDelta)
+	assert.Equal(t, int64(0), planDiff.Nodes[1].ActualRowsDelta)
+
+	assert.Equal(t, DiffSame, planDiff.Nodes[2].Status)
+	assert.Equal(t, NodeType(Hash), planDiff.Nodes[2].After.NodeType)
+
+	assert.Equal(t, DiffRemoved, planDiff.Nodes[3].Status)
+	assert.Nil(t, planDiff.Nodes[3].After)
+	assert.Equal(t, NodeType("Materialize"), planDiff.Nodes[3].Before.NodeType)
+
+	if actual := planDiff.Render(); actual != ExpectedTextDiff {
+		t.Errorf("got different than expected: \n%s\n", diff(ExpectedTextDiff, actual))
+	}
+}
+
+func TestCompareSamePlans(t *testing.T) {
+	before, err := NewExplain(InputJSON0, ExplainConfig{})
+	require.Nil(t, err)
+
+	after, err := NewExplain(InputJSON0, ExplainConfig{})
+	require.Nil(t, err)
+
+	planDiff := Compare(before, after)
+
+	assert.False(t, planDiff.HasShapeChanges())
+
+	for _, node := range planDiff.Nodes {
+		assert.Equal(t, DiffSame, node.Status)
+		assert.Equal(t, 0.0, node.ActualDurationDelta)
+	}
+}
+
+const InputJSONDiffBefore = `[{
+  "Plan": {
+    "Node Type": "Limit",
+    "Actual Total Time": 12.5,
+    "Actual Rows": 10,
+    "Actual Loops": 1,
+    "Shared Hit Blocks": 100,
+    "Shared Read Blocks": 1000,
+    "Plans": [
+      {
+        "Node Type": "Seq Scan",
+        "Relation Name": "orders",
+        "Actual Total Time": 12.0,
+        "Actual Rows": 10,
+        "Actual Loops": 1,
+        "Shared Hit Blocks": 95,
+        "Shared Read Blocks": 1000
+      },
+      {
+        "Node Type": "Hash",
+        "Actual Total Time": 0.2,
+        "Actual Rows": 1,
+        "Actual Loops": 1,
+        "Shared Hit Blocks": 3
+      },
+      {
+        "Node Type": "Materialize",
+        "Actual Total Time": 0.1,
+        "Actual Rows": 1,
+        "Actual Loops": 1,
+        "Shared Hit Blocks": 2
+      }
+    ]
+  },
+  "Planning Time": 0.5,
+  "Execution Time": 12.6
+}]`
+
+const InputJSONDiffAfter = `[{
+  "Plan": {
+    "Node Type": "Limit",
+    "Actual Total Time": 0.5,
+    "Actual Rows": 10,
+    "Actual Loops": 1,
+    "Shared Hit Blocks": 8,
+    "Plans": [
+      {
+        "Node Type": "Index Scan",
+        "Relation Name": "orders",
+        "Index Name": "orders_pkey",
+        "Actual Total Time": 0.1,
+        "Actual Rows": 10,
+        "Actual Loops": 1,
+        "Shared Hit Blocks": 5
+      },
+      {
+        "Node Type": "Hash",
+        "Actual Total Time": 0.15,
+        "Actual Rows": 1,
+        "Actual Loops": 1,
+        "Shared Hit Blocks": 3
+      }
+    ]
+  },
+  "Planning Time": 0.4,
+  "Execution Time": 0.6
+}]`
+
+const ExpectedTextDiff = `Time: 13.100 ms → 1.000 ms (-12.100 ms)
+  - planning: 0.500 ms → 0.400 ms (-0.100 ms)
+  - execution: 12.600 ms → 0.600 ms (-12.000 ms)
+
+Shared buffers:
+  - hits: 100 → 8 (-92, ~736.00 KiB)
+  - reads: 1000 → 0 (-1000, ~7.80 MiB)
+
+Nodes:
+  Limit
+      time: 0.200 ms → 0.250 ms (+0.050 ms)
+      rows: 10 → 10 (+0)
+      buffers: shared hit 100 → 8 (-92), read 1000 → 0 (-1000)
+~   Seq Scan on orders → Index Scan using orders_pkey on orders
+        time: 12.000 ms → 0.100 ms (-11.900 ms)
+        rows: 10 → 10 (+0)
+        buffers: shared hit 95 → 5 (-90), read 1000 → 0 (-1000)
+    Hash
+        time: 0.200 ms → 0.150 ms (-0.050 ms)
+        rows: 1 → 1 (+0)
+        buffers: shared hit 3 → 3 (+0), read 0 → 0 (+0)
+-   Materialize
+        time: 0.100 ms, rows: 1, buffers: shared hit=2 read=0
+`
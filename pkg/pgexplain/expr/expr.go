@@ -0,0 +1,640 @@
+/*
+2020 © Postgres.ai
+*/
+
+// Package expr provides a small expression language to describe rules over explain plans.
+//
+// Expressions support number, string, boolean and list literals, variables with field access
+// (e.g. `node.SharedReadBlocks`), arithmetic (+ - * / %), comparison (== != < <= > >= in),
+// logical operators (&& || ! and their word aliases and, or, not) and function calls.
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Func defines a function available in expressions.
+type Func func(args ...interface{}) (interface{}, error)
+
+// Env contains variables and extra functions available during evaluation.
+type Env struct {
+	Vars  map[string]interface{}
+	Funcs map[string]Func
+}
+
+// Expression defines a compiled expression.
+type Expression struct {
+	src  string
+	root node
+}
+
+// Compile parses an expression.
+func Compile(src string) (*Expression, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse expression %q", src)
+	}
+
+	return &Expression{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression. Numbers are always returned as float64.
+func (e *Expression) Eval(env Env) (interface{}, error) {
+	value, err := e.root.eval(env)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to evaluate expression %q", e.src)
+	}
+
+	return value, nil
+}
+
+// EvalBool evaluates the expression and converts the result to boolean.
+func (e *Expression) EvalBool(env Env) (bool, error) {
+	value, err := e.Eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	return truthy(value), nil
+}
+
+// EvalNumber evaluates the expression and requires the result to be a number.
+func (e *Expression) EvalNumber(env Env) (float64, error) {
+	value, err := e.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	num, ok := value.(float64)
+	if !ok {
+		return 0, errors.Errorf("expression %q is not a number: %v", e.src, value)
+	}
+
+	return num, nil
+}
+
+// Template defines a text with embedded expressions, e.g. "Seq Scan on {{node.RelationName}}".
+type Template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	text       string
+	expression *Expression
+}
+
+// CompileTemplate parses a template.
+func CompileTemplate(src string) (*Template, error) {
+	const open, closing = "{{", "}}"
+
+	tmpl := &Template{}
+
+	for src != "" {
+		start := strings.Index(src, open)
+		if start < 0 {
+			tmpl.parts = append(tmpl.parts, templatePart{text: src})
+			break
+		}
+
+		end := strings.Index(src[start:], closing)
+		if end < 0 {
+			return nil, errors.Errorf("unclosed %q in template", open)
+		}
+
+		expression, err := Compile(strings.TrimSpace(src[start+len(open) : start+end]))
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl.parts = append(tmpl.parts, templatePart{text: src[:start]}, templatePart{expression: expression})
+		src = src[start+end+len(closing):]
+	}
+
+	return tmpl, nil
+}
+
+// Render renders the template.
+func (t *Template) Render(env Env) (string, error) {
+	result := strings.Builder{}
+
+	for _, part := range t.parts {
+		if part.expression == nil {
+			result.WriteString(part.text)
+			continue
+		}
+
+		value, err := part.expression.Eval(env)
+		if err != nil {
+			return "", err
+		}
+
+		result.WriteString(toString(value))
+	}
+
+	return result.String(), nil
+}
+
+type node interface {
+	eval(env Env) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(_ Env) (interface{}, error) {
+	return n.value, nil
+}
+
+type variableNode struct {
+	name string
+}
+
+func (n *variableNode) eval(env Env) (interface{}, error) {
+	value, ok := env.Vars[n.name]
+	if !ok {
+		return nil, errors.Errorf("unknown variable %q", n.name)
+	}
+
+	return normalize(reflect.ValueOf(value)), nil
+}
+
+type memberNode struct {
+	base node
+	name string
+}
+
+func (n *memberNode) eval(env Env) (interface{}, error) {
+	base, err := n.base.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	value := reflect.ValueOf(base)
+
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil, nil
+		}
+
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Invalid:
+		// Field access on nil gives nil, e.g. `parent.NodeType` for the root node.
+		return nil, nil
+
+	case reflect.Struct:
+		field, ok := findField(value, n.name)
+		if !ok {
+			return nil, errors.Errorf("unknown field %q", n.name)
+		}
+
+		return normalize(field), nil
+
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			break
+		}
+
+		item := value.MapIndex(reflect.ValueOf(n.name).Convert(value.Type().Key()))
+		if !item.IsValid() {
+			return nil, nil
+		}
+
+		return normalize(item), nil
+	}
+
+	return nil, errors.Errorf("cannot access field %q of %v", n.name, base)
+}
+
+// findField looks for an exported struct field by its name or by its yaml/json tag.
+func findField(value reflect.Value, name string) (reflect.Value, bool) {
+	if field := value.FieldByName(name); field.IsValid() && field.CanInterface() {
+		return field, true
+	}
+
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		for _, tag := range []string{field.Tag.Get("yaml"), field.Tag.Get("json")} {
+			if strings.Split(tag, ",")[0] == name {
+				return value.Field(i), true
+			}
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(env Env) (interface{}, error) {
+	list := make([]interface{}, 0, len(n.items))
+
+	for _, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, value)
+	}
+
+	return list, nil
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n *callNode) eval(env Env) (interface{}, error) {
+	fn, ok := env.Funcs[n.name]
+	if !ok {
+		fn, ok = builtinFuncs[n.name]
+	}
+
+	if !ok {
+		return nil, errors.Errorf("unknown function %q", n.name)
+	}
+
+	args := make([]interface{}, 0, len(n.args))
+
+	for _, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, value)
+	}
+
+	result, err := fn(args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "function %q", n.name)
+	}
+
+	return normalize(reflect.ValueOf(result)), nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(env Env) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "!" {
+		return !truthy(value), nil
+	}
+
+	num, ok := value.(float64)
+	if !ok {
+		return nil, errors.Errorf("cannot negate %v", value)
+	}
+
+	return -num, nil
+}
+
+type binaryNode struct {
+	op    string
+	left  node
+	right node
+}
+
+func (n *binaryNode) eval(env Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit logical operators.
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return truthy(right), nil
+
+	case "==":
+		return equal(left, right), nil
+
+	case "!=":
+		return !equal(left, right), nil
+
+	case "in":
+		return contains(right, left)
+
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	}
+
+	return arithmetic(n.op, left, right)
+}
+
+func compare(op string, left, right interface{}) (bool, error) {
+	var cmp int
+
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, errors.Errorf("cannot compare %v and %v", left, right)
+		}
+
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, errors.Errorf("cannot compare %v and %v", left, right)
+		}
+
+		cmp = strings.Compare(l, r)
+
+	default:
+		// Missing values never match comparisons.
+		return false, nil
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	if l, ok := left.(string); ok && op == "+" {
+		return l + toString(right), nil
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+
+	if !lok || !rok {
+		return nil, errors.Errorf("cannot apply %q to %v and %v", op, left, right)
+	}
+
+	switch op {
+	case "+":
+		return l + r, nil
+
+	case "-":
+		return l - r, nil
+
+	case "*":
+		return l * r, nil
+
+	case "/":
+		if r == 0 {
+			return 0.0, nil
+		}
+
+		return l / r, nil
+
+	case "%":
+		if r == 0 {
+			return 0.0, nil
+		}
+
+		return float64(int64(l) % int64(r)), nil
+	}
+
+	return nil, errors.Errorf("unknown operator %q", op)
+}
+
+func equal(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+
+	return reflect.DeepEqual(left, right)
+}
+
+func contains(collection, item interface{}) (bool, error) {
+	if s, ok := collection.(string); ok {
+		return strings.Contains(s, toString(item)), nil
+	}
+
+	value := reflect.ValueOf(collection)
+
+	switch value.Kind() {
+	case reflect.Invalid:
+		return false, nil
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if equal(normalize(value.Index(i)), item) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	return false, errors.Errorf("%v is not a list or a string", collection)
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+
+	rv := reflect.ValueOf(value)
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() > 0
+	case reflect.Ptr:
+		return !rv.IsNil()
+	}
+
+	return true
+}
+
+// normalize converts numbers to float64 and string types to string.
+func normalize(value reflect.Value) interface{} {
+	if value.Kind() == reflect.Interface && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Invalid:
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+
+	case reflect.String:
+		return value.String()
+
+	case reflect.Bool:
+		return value.Bool()
+
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+	}
+
+	return value.Interface()
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(value)
+}
+
+var builtinFuncs = map[string]Func{
+	"len": func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 1); err != nil {
+			return nil, err
+		}
+
+		if s, ok := args[0].(string); ok {
+			return len(s), nil
+		}
+
+		value := reflect.ValueOf(args[0])
+
+		switch value.Kind() {
+		case reflect.Invalid:
+			return 0, nil
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return value.Len(), nil
+		}
+
+		return nil, errors.Errorf("cannot get length of %v", args[0])
+	},
+
+	"contains": func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 2); err != nil {
+			return nil, err
+		}
+
+		return contains(args[0], args[1])
+	},
+
+	"startsWith": func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 2); err != nil {
+			return nil, err
+		}
+
+		return strings.HasPrefix(toString(args[0]), toString(args[1])), nil
+	},
+
+	"endsWith": func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 2); err != nil {
+			return nil, err
+		}
+
+		return strings.HasSuffix(toString(args[0]), toString(args[1])), nil
+	},
+
+	"matches": func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 2); err != nil {
+			return nil, err
+		}
+
+		re, err := regexp.Compile(toString(args[1]))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid regular expression")
+		}
+
+		return re.MatchString(toString(args[0])), nil
+	},
+
+	"lower": func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 1); err != nil {
+			return nil, err
+		}
+
+		return strings.ToLower(toString(args[0])), nil
+	},
+
+	"upper": func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 1); err != nil {
+			return nil, err
+		}
+
+		return strings.ToUpper(toString(args[0])), nil
+	},
+}
+
+func checkArgs(args []interface{}, expected int) error {
+	if len(args) != expected {
+		return errors.Errorf("expected %d argument(s), got %d", expected, len(args))
+	}
+
+	return nil
+}
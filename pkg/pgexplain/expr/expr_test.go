@@ -0,0 +1,101 @@
+/*
+2020 © Postgres.ai
+*/
+
+package expr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testNode struct {
+	NodeType     string
+	Schema       string `json:"Schema"`
+	RelationName string `yaml:"relation"`
+	Rows         int64
+	Child        *testNode
+}
+
+func TestEval(t *testing.T) {
+	env := Env{
+		Vars: map[string]interface{}{
+			"node":   testNode{NodeType: "Seq Scan", Schema: "billing", RelationName: "invoices", Rows: 1500},
+			"params": map[string]interface{}{"rowsMin": 1000},
+		},
+		Funcs: map[string]Func{
+			"double": func(args ...interface{}) (interface{}, error) {
+				return args[0].(float64) * 2, nil
+			},
+		},
+	}
+
+	testCases := []struct {
+		expression string
+		expected   interface{}
+	}{
+		{expression: `1 + 2 * 3`, expected: 7.0},
+		{expression: `(1 + 2) * 3`, expected: 9.0},
+		{expression: `-node.Rows + 500`, expected: -1000.0},
+		{expression: `10 / 0`, expected: 0.0},
+		{expression: `node.NodeType == "Seq Scan" && node.Schema == 'billing'`, expected: true},
+		{expression: `node.NodeType == "Seq Scan" and not (node.Rows < params.rowsMin)`, expected: true},
+		{expression: `node.relation`, expected: "invoices"},
+		{expression: `node.Child.NodeType`, expected: nil},
+		{expression: `node.Child.Rows > 0`, expected: false},
+		{expression: `node.Schema in ["billing", "accounting"]`, expected: true},
+		{expression: `"bill" in node.Schema`, expected: true},
+		{expression: `startsWith(node.RelationName, "inv") || false`, expected: true},
+		{expression: `matches(upper(node.Schema), "^BILL")`, expected: true},
+		{expression: `len(node.Schema)`, expected: 7.0},
+		{expression: `double(node.Rows)`, expected: 3000.0},
+		{expression: `"rows: " + node.Rows`, expected: "rows: 1500"},
+		{expression: `params.unknown == nil`, expected: true},
+	}
+
+	for _, tc := range testCases {
+		expression, err := Compile(tc.expression)
+		require.Nil(t, err, tc.expression)
+
+		value, err := expression.Eval(env)
+		require.Nil(t, err, tc.expression)
+		assert.Equal(t, tc.expected, value, tc.expression)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, src := range []string{``, `1 +`, `(1 + 2`, `"unterminated`, `node.`, `a # b`, `f(1,`} {
+		_, err := Compile(src)
+		assert.NotNil(t, err, src)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	env := Env{Vars: map[string]interface{}{"node": testNode{}}}
+
+	for _, src := range []string{`unknown`, `node.Unknown`, `unknownFunc()`, `1 < "a"`, `"a" - 1`, `len(1)`} {
+		expression, err := Compile(src)
+		require.Nil(t, err, src)
+
+		_, err = expression.Eval(env)
+		assert.NotNil(t, err, src)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	env := Env{Vars: map[string]interface{}{
+		"node": testNode{NodeType: "Seq Scan", RelationName: "invoices", Rows: 1500},
+	}}
+
+	tmpl, err := CompileTemplate("{{ node.NodeType }} on {{node.RelationName}} ({{ node.Rows / 1000 }}k rows)")
+	require.Nil(t, err)
+
+	rendered, err := tmpl.Render(env)
+	require.Nil(t, err)
+	assert.Equal(t, "Seq Scan on invoices (1.5k rows)", rendered)
+
+	_, err = CompileTemplate("{{ node.NodeType ")
+	assert.NotNil(t, err)
+}
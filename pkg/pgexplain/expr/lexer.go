@@ -0,0 +1,123 @@
+/*
+2020 © Postgres.ai
+*/
+
+package expr
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+// operators lists supported operators, longer ones go first.
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+// keywordOperators maps word aliases to operators.
+var keywordOperators = map[string]string{
+	"and": "&&",
+	"or":  "||",
+	"not": "!",
+	"in":  "in",
+}
+
+func tokenize(src string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(src)
+
+	for pos := 0; pos < len(runes); {
+		r := runes[pos]
+
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+
+		case unicode.IsDigit(r):
+			start := pos
+			for pos < len(runes) && (unicode.IsDigit(runes[pos]) || runes[pos] == '.') {
+				pos++
+			}
+
+			num, err := strconv.ParseFloat(string(runes[start:pos]), 64)
+			if err != nil {
+				return nil, errors.Errorf("invalid number %q at position %d", string(runes[start:pos]), start)
+			}
+
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:pos]), num: num, pos: start})
+
+		case r == '"' || r == '\'':
+			start := pos
+			value := strings.Builder{}
+			pos++
+
+			for ; pos < len(runes) && runes[pos] != r; pos++ {
+				if runes[pos] == '\\' && pos+1 < len(runes) {
+					pos++
+				}
+
+				value.WriteRune(runes[pos])
+			}
+
+			if pos >= len(runes) {
+				return nil, errors.Errorf("unterminated string at position %d", start)
+			}
+
+			pos++
+			tokens = append(tokens, token{kind: tokenString, text: value.String(), pos: start})
+
+		case unicode.IsLetter(r) || r == '_':
+			start := pos
+			for pos < len(runes) && (unicode.IsLetter(runes[pos]) || unicode.IsDigit(runes[pos]) || runes[pos] == '_') {
+				pos++
+			}
+
+			word := string(runes[start:pos])
+			if op, ok := keywordOperators[strings.ToLower(word)]; ok {
+				tokens = append(tokens, token{kind: tokenOperator, text: op, pos: start})
+				continue
+			}
+
+			tokens = append(tokens, token{kind: tokenIdent, text: word, pos: start})
+
+		default:
+			op := matchOperator(runes[pos:])
+			if op == "" {
+				return nil, errors.Errorf("unexpected character %q at position %d", r, pos)
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: pos})
+			pos += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+func matchOperator(runes []rune) string {
+	for _, op := range operators {
+		if len(runes) >= len(op) && string(runes[:len(op)]) == op {
+			return op
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,238 @@
+/*
+2020 © Postgres.ai
+*/
+
+package expr
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Operator precedence levels, from the lowest to the highest.
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3,
+	"!=": 3,
+	"<":  4,
+	"<=": 4,
+	">":  4,
+	">=": 4,
+	"in": 4,
+	"+":  5,
+	"-":  5,
+	"*":  6,
+	"/":  6,
+	"%":  6,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	root, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, errors.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	return root, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+func (p *parser) isOperator(op string) bool {
+	tok := p.peek()
+	return tok.kind == tokenOperator && tok.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if !p.isOperator(op) {
+		tok := p.peek()
+		return errors.Errorf("expected %q at position %d", op, tok.pos)
+	}
+
+	p.next()
+
+	return nil
+}
+
+// parseBinary parses binary operators using precedence climbing.
+func (p *parser) parseBinary(minPrecedence int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		precedence, ok := binaryPrecedence[tok.text]
+
+		if tok.kind != tokenOperator || !ok || precedence < minPrecedence {
+			return left, nil
+		}
+
+		p.next()
+
+		right, err := p.parseBinary(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryNode{op: tok.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOperator("!") || p.isOperator("-") {
+		op := p.next().text
+
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator(".") {
+		p.next()
+
+		tok := p.next()
+		if tok.kind != tokenIdent {
+			return nil, errors.Errorf("expected a field name at position %d", tok.pos)
+		}
+
+		base = &memberNode{base: base, name: tok.text}
+	}
+
+	return base, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenNumber:
+		return &literalNode{value: tok.num}, nil
+
+	case tokenString:
+		return &literalNode{value: tok.text}, nil
+
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+
+		case "false":
+			return &literalNode{value: false}, nil
+
+		case "nil", "null":
+			return &literalNode{value: nil}, nil
+		}
+
+		if p.isOperator("(") {
+			p.next()
+
+			args, err := p.parseList(")")
+			if err != nil {
+				return nil, err
+			}
+
+			return &callNode{name: tok.text, args: args}, nil
+		}
+
+		return &variableNode{name: tok.text}, nil
+
+	case tokenOperator:
+		switch tok.text {
+		case "(":
+			inner, err := p.parseBinary(1)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+
+			return inner, nil
+
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+
+			return &listNode{items: items}, nil
+		}
+	}
+
+	if tok.kind == tokenEOF {
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	return nil, errors.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// parseList parses comma-separated expressions up to the closing operator.
+func (p *parser) parseList(closing string) ([]node, error) {
+	items := []node{}
+
+	if p.isOperator(closing) {
+		p.next()
+		return items, nil
+	}
+
+	for {
+		item, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+
+		if p.isOperator(",") {
+			p.next()
+			continue
+		}
+
+		if err := p.expect(closing); err != nil {
+			return nil, err
+		}
+
+		return items, nil
+	}
+}
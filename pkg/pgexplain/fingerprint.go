@@ -0,0 +1,46 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// fingerprintLength defines the number of hex characters of a plan fingerprint.
+const fingerprintLength = 16
+
+// Fingerprint returns a stable hash of the plan shape: node types, relations, indexes, join types and the tree structure.
+// Costs, timings, row counts and literals of conditions are not included,
+// so plans of the same query get the same fingerprint until the planner chooses a different plan.
+func (ex *Explain) Fingerprint() string {
+	buf := &strings.Builder{}
+	writePlanShape(buf, &ex.Plan)
+
+	sum := sha256.Sum256([]byte(buf.String()))
+
+	return hex.EncodeToString(sum[:])[:fingerprintLength]
+}
+
+// writePlanShape writes a canonical representation of the plan shape.
+func writePlanShape(buf *strings.Builder, plan *Plan) {
+	// Scan direction is shown in text plans only for backward scans.
+	scanDirection := plan.ScanDirection
+	if scanDirection == "Forward" {
+		scanDirection = ""
+	}
+
+	fmt.Fprintf(buf, "(%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%t",
+		plan.ParentRelationship, plan.NodeType, plan.Operation, plan.Strategy, plan.PartialMode, plan.JoinType,
+		plan.RelationName, plan.IndexName, plan.CteName, plan.FunctionName, scanDirection, plan.ParallelAware)
+
+	for index := range plan.Plans {
+		writePlanShape(buf, &plan.Plans[index])
+	}
+
+	buf.WriteString(")")
+}
@@ -0,0 +1,63 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	expected, err := NewExplain(InputJSONParse, ExplainConfig{})
+	require.Nil(t, err)
+
+	fingerprint := expected.Fingerprint()
+	assert.Len(t, fingerprint, fingerprintLength)
+
+	testCases := []struct {
+		name  string
+		input string
+		same  bool
+	}{
+		{name: "text with execution", input: InputTextParse, same: true},
+		{name: "without execution and with other literals", input: InputTextFingerprintPlan, same: true},
+		{name: "another scan", input: InputTextFingerprintSeqScan, same: false},
+	}
+
+	for _, tc := range testCases {
+		explain, err := ParseExplain(tc.input, ExplainConfig{})
+		require.Nil(t, err, tc.name)
+
+		if tc.same {
+			assert.Equal(t, fingerprint, explain.Fingerprint(), tc.name)
+		} else {
+			assert.NotEqual(t, fingerprint, explain.Fingerprint(), tc.name)
+		}
+	}
+}
+
+const InputTextFingerprintPlan = `Limit  (cost=20.50..20.51 rows=1 width=12)
+  ->  Sort  (cost=20.50..20.52 rows=8 width=12)
+        Sort Key: o.id DESC
+        ->  Hash Join  (cost=1.11..20.45 rows=8 width=12)
+              Hash Cond: (o.user_id = u.id)
+              ->  Index Scan Backward using orders_pkey on orders o  (cost=0.15..19.20 rows=80 width=8)
+                    Index Cond: (id > 42)
+              ->  Hash  (cost=1.05..1.05 rows=5 width=8)
+                    ->  Seq Scan on users u  (cost=0.00..1.05 rows=5 width=8)
+                          Filter: active`
+
+const InputTextFingerprintSeqScan = `Limit  (cost=20.50..20.51 rows=1 width=12)
+  ->  Sort  (cost=20.50..20.52 rows=8 width=12)
+        Sort Key: o.id DESC
+        ->  Hash Join  (cost=1.11..20.45 rows=8 width=12)
+              Hash Cond: (o.user_id = u.id)
+              ->  Seq Scan on orders o  (cost=0.00..19.20 rows=80 width=8)
+                    Filter: (id > 42)
+              ->  Hash  (cost=1.05..1.05 rows=5 width=8)
+                    ->  Seq Scan on users u  (cost=0.00..1.05 rows=5 width=8)
+                          Filter: active`
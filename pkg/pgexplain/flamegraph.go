@@ -0,0 +1,311 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+
+	"gitlab.com/postgres-ai/joe/pkg/util"
+)
+
+// FlameGraphMetric defines a metric which defines widths of flame graph boxes.
+type FlameGraphMetric string
+
+// Flame graph metrics.
+const (
+	// FlameGraphTime uses exclusive time of nodes, or exclusive costs for plans without execution.
+	FlameGraphTime FlameGraphMetric = "time"
+
+	// FlameGraphBuffers uses exclusive shared buffers (hits and reads) of nodes.
+	FlameGraphBuffers FlameGraphMetric = "buffers"
+)
+
+// Flame graph layout.
+const (
+	flameGraphWidth      = 1200
+	flameGraphPadding    = 10
+	flameGraphHeader     = 50
+	flameGraphRowHeight  = 18
+	flameGraphCharWidth  = 7
+	flameGraphMinBoxText = 3
+)
+
+// flameGraphBox defines a plan node box of the flame graph.
+type flameGraphBox struct {
+	plan      *Plan
+	depth     int
+	x         float64
+	width     float64
+	value     float64 // The value of the node and its children.
+	exclusive float64 // The value of the node itself.
+	total     float64
+}
+
+// RenderFlameGraph renders the plan as a self-contained SVG icicle chart.
+// Boxes of nodes contain boxes of their children, and the uncovered part of a box is the node's exclusive value.
+// Charts for both metrics are included, the metric defines the initially visible one.
+func (ex *Explain) RenderFlameGraph(metric FlameGraphMetric) string {
+	buf := &strings.Builder{}
+	ex.writeFlameGraph(buf, metric)
+
+	return buf.String()
+}
+
+func (ex *Explain) writeFlameGraph(writer io.Writer, metric FlameGraphMetric) {
+	metrics := []FlameGraphMetric{FlameGraphTime, FlameGraphBuffers}
+
+	boxes := make(map[FlameGraphMetric][]flameGraphBox, len(metrics))
+	depth := 0
+
+	for _, m := range metrics {
+		boxes[m] = ex.flameGraphBoxes(m)
+
+		for _, box := range boxes[m] {
+			if box.depth+1 > depth {
+				depth = box.depth + 1
+			}
+		}
+	}
+
+	height := flameGraphHeader + depth*flameGraphRowHeight + flameGraphPadding
+
+	fmt.Fprintf(writer, `<?xml version="1.0" standalone="no"?>`+"\n")
+	fmt.Fprintf(writer, `<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" `+
+		`xmlns="http://www.w3.org/2000/svg" font-family="Verdana, sans-serif" font-size="12">`+"\n",
+		flameGraphWidth, height, flameGraphWidth, height)
+	fmt.Fprintf(writer, "<style>.box:hover rect { stroke: #000; stroke-width: 0.5; cursor: pointer; } "+
+		".switch { fill: #1f6feb; cursor: pointer; text-decoration: underline; }</style>\n")
+	fmt.Fprintf(writer, `<rect x="0" y="0" width="100%%" height="100%%" fill="#f8f8f8"/>`+"\n")
+
+	// Metric switch works if the SVG is opened in a browser, otherwise the initial metric is shown.
+	fmt.Fprintf(writer, "<script type=\"text/ecmascript\"><![CDATA[\n"+
+		"function showMetric(metric) {\n"+
+		"  ['%s', '%s'].forEach(function (m) {\n"+
+		"    document.getElementById('metric-' + m).setAttribute('display', m === metric ? 'inline' : 'none');\n"+
+		"  });\n"+
+		"}\n"+
+		"]]></script>\n", FlameGraphTime, FlameGraphBuffers)
+
+	for _, m := range metrics {
+		display := "none"
+		if m == metric {
+			display = "inline"
+		}
+
+		fmt.Fprintf(writer, `<g id="metric-%s" display="%s">`+"\n", m, display)
+		ex.writeFlameGraphHeader(writer, m, metrics)
+
+		for _, box := range boxes[m] {
+			writeFlameGraphBox(writer, box, ex.flameGraphMetricName(m))
+		}
+
+		fmt.Fprintf(writer, "</g>\n")
+	}
+
+	fmt.Fprintf(writer, "</svg>\n")
+}
+
+func (ex *Explain) writeFlameGraphHeader(writer io.Writer, metric FlameGraphMetric, metrics []FlameGraphMetric) {
+	title := fmt.Sprintf("Execution plan: %s, total %s", ex.flameGraphMetricName(metric), ex.flameGraphTotal(metric))
+
+	fmt.Fprintf(writer, `<text x="%d" y="24" font-size="16">%s</text>`+"\n", flameGraphPadding, html.EscapeString(title))
+
+	x := flameGraphWidth - flameGraphPadding - 150
+
+	for _, m := range metrics {
+		if m == metric {
+			fmt.Fprintf(writer, `<text x="%d" y="24">%s</text>`+"\n", x, m)
+		} else {
+			fmt.Fprintf(writer, `<text x="%d" y="24" class="switch" onclick="showMetric('%s')">%s</text>`+"\n", x, m, m)
+		}
+
+		x += 75
+	}
+}
+
+func (ex *Explain) flameGraphTotal(metric FlameGraphMetric) string {
+	switch {
+	case metric == FlameGraphBuffers:
+		blocks := ex.SharedHitBlocks + ex.SharedReadBlocks
+		return fmt.Sprintf("%d shared buffers (~%s)", blocks, blocksToBytes(blocks))
+
+	case ex.hasFlameGraphTiming():
+		return util.MillisecondsToString(ex.Plan.InclusiveDuration)
+	}
+
+	return fmt.Sprintf("cost %.2f", ex.TotalCost)
+}
+
+// flameGraphMetricName returns the name of the metric used to build the chart.
+func (ex *Explain) flameGraphMetricName(metric FlameGraphMetric) string {
+	if metric == FlameGraphTime && !ex.hasFlameGraphTiming() {
+		return "cost"
+	}
+
+	return string(metric)
+}
+
+// hasFlameGraphTiming checks if the plan contains actual timing, costs are used otherwise.
+func (ex *Explain) hasFlameGraphTiming() bool {
+	return ex.Plan.InclusiveDuration > 0
+}
+
+// flameGraphBoxes lays out plan nodes, the box of a node contains boxes of its children.
+func (ex *Explain) flameGraphBoxes(metric FlameGraphMetric) []flameGraphBox {
+	values := make(map[*Plan]float64)
+
+	useTiming := ex.hasFlameGraphTiming()
+
+	var totalValue func(plan *Plan) float64
+
+	totalValue = func(plan *Plan) float64 {
+		value := flameGraphValue(plan, metric, useTiming)
+
+		for index := range plan.Plans {
+			value += totalValue(&plan.Plans[index])
+		}
+
+		values[plan] = value
+
+		return value
+	}
+
+	total := totalValue(&ex.Plan)
+	boxes := []flameGraphBox{}
+
+	var layout func(plan *Plan, depth int, x, width float64)
+
+	layout = func(plan *Plan, depth int, x, width float64) {
+		boxes = append(boxes, flameGraphBox{
+			plan:      plan,
+			depth:     depth,
+			x:         x,
+			width:     width,
+			value:     values[plan],
+			exclusive: flameGraphValue(plan, metric, useTiming),
+			total:     total,
+		})
+
+		for index := range plan.Plans {
+			child := &plan.Plans[index]
+
+			childWidth := 0.0
+			if values[plan] > 0 {
+				childWidth = width * values[child] / values[plan]
+			}
+
+			layout(child, depth+1, x, childWidth)
+			x += childWidth
+		}
+	}
+
+	layout(&ex.Plan, 0, flameGraphPadding, flameGraphWidth-2*flameGraphPadding)
+
+	return boxes
+}
+
+func flameGraphValue(plan *Plan, metric FlameGraphMetric, useTiming bool) float64 {
+	switch {
+	case metric == FlameGraphBuffers:
+		return float64(plan.ExclusiveSharedHitBlocks + plan.ExclusiveSharedReadBlocks)
+
+	case useTiming:
+		return plan.ActualDuration
+	}
+
+	return plan.ActualCost
+}
+
+func writeFlameGraphBox(writer io.Writer, box flameGraphBox, metricName string) {
+	const minBoxWidth = 0.1
+
+	if box.width < minBoxWidth {
+		return
+	}
+
+	y := flameGraphHeader + box.depth*flameGraphRowHeight
+	caption := planCaption(box.plan)
+
+	fmt.Fprintf(writer, `<g class="box">`+"\n")
+	fmt.Fprintf(writer, "<title>%s</title>\n", html.EscapeString(flameGraphTooltip(box, metricName)))
+	fmt.Fprintf(writer, `<rect x="%.2f" y="%d" width="%.2f" height="%d" rx="2" ry="2" fill="%s"/>`+"\n",
+		box.x, y, box.width, flameGraphRowHeight-1, flameGraphColor(box))
+
+	if chars := int((box.width - 6) / flameGraphCharWidth); chars >= flameGraphMinBoxText {
+		label := []rune(caption)
+		if len(label) > chars {
+			label = append(label[:chars-2], []rune("..")...)
+		}
+
+		fmt.Fprintf(writer, `<text x="%.2f" y="%d">%s</text>`+"\n", box.x+3, y+13, html.EscapeString(string(label)))
+	}
+
+	fmt.Fprintf(writer, "</g>\n")
+}
+
+// flameGraphTooltip describes the node, it's shown when hovering over the box.
+func flameGraphTooltip(box flameGraphBox, metricName string) string {
+	plan := box.plan
+
+	lines := []string{planCaption(plan)}
+
+	if plan.SubplanName != "" {
+		lines = append(lines, plan.SubplanName)
+	}
+
+	if box.total > 0 {
+		lines = append(lines, fmt.Sprintf("%s: %.1f%% of total (%.1f%% by the node itself)", metricName,
+			100*box.value/box.total, 100*box.exclusive/box.total))
+	}
+
+	if plan.ActualLoops > 0 {
+		if !plan.TimingOff {
+			lines = append(lines, fmt.Sprintf("time: %s (exclusive), %s (inclusive)",
+				util.MillisecondsToString(plan.ActualDuration), util.MillisecondsToString(plan.InclusiveDuration)))
+		}
+
+		lines = append(lines,
+			fmt.Sprintf("rows: %d actual, %d planned, loops: %d", plan.ActualRows, plan.PlanRows, plan.ActualLoops))
+	} else {
+		lines = append(lines, fmt.Sprintf("rows: %d planned", plan.PlanRows))
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("cost: %.2f..%.2f (exclusive %.2f)", plan.StartupCost, plan.TotalCost, plan.ActualCost),
+		fmt.Sprintf("buffers: shared hit=%d read=%d (exclusive hit=%d read=%d)", plan.SharedHitBlocks,
+			plan.SharedReadBlocks, plan.ExclusiveSharedHitBlocks, plan.ExclusiveSharedReadBlocks))
+
+	for _, detail := range []struct{ name, value string }{
+		{name: "Index Cond", value: plan.IndexCondition},
+		{name: "Hash Cond", value: plan.HashCondition},
+		{name: "Merge Cond", value: plan.MergeCondition},
+		{name: "Join Filter", value: plan.JoinFilter},
+		{name: "Filter", value: plan.Filter},
+	} {
+		if detail.value != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", detail.name, detail.value))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// flameGraphColor makes boxes warmer if the node itself takes a bigger part of the total.
+func flameGraphColor(box flameGraphBox) string {
+	share := 0.0
+	if box.total > 0 {
+		share = box.exclusive / box.total
+	}
+
+	// From light yellow to red.
+	green := 230 - int(math.Min(1, share*2)*180)
+	blue := 120 - int(math.Min(1, share*2)*80)
+
+	return fmt.Sprintf("rgb(250,%d,%d)", green, blue)
+}
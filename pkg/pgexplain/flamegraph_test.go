@@ -0,0 +1,65 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderFlameGraph(t *testing.T) {
+	explain, err := NewExplain(InputJSONInitPlan, ExplainConfig{})
+	require.Nil(t, err)
+
+	svg := explain.RenderFlameGraph(FlameGraphTime)
+
+	// The chart must be a well-formed document.
+	decoder := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		require.Nil(t, err)
+	}
+
+	assert.Contains(t, svg, `<g id="metric-time" display="inline">`)
+	assert.Contains(t, svg, `<g id="metric-buffers" display="none">`)
+
+	// Limit: 5 ms of 60 ms by itself, the whole width.
+	assert.Contains(t, svg, `<rect x="10.00" y="50" width="1180.00" height="17"`)
+	assert.Contains(t, svg, "<title>Limit\ntime: 100.0% of total (8.3% by the node itself)")
+
+	// InitPlan: 30 ms, Seq Scan: 25 ms.
+	assert.Contains(t, svg, `<rect x="10.00" y="68" width="590.00" height="17"`)
+	assert.Contains(t, svg, `<rect x="600.00" y="68" width="491.67" height="17"`)
+	assert.Contains(t, svg, "Seq Scan on t\ntime: 41.7% of total (41.7% by the node itself)")
+	assert.Contains(t, svg, "Filter: (a &gt; $0)")
+
+	// Buffers: 10 of 160 by Limit, 100 by InitPlan, 50 by Seq Scan.
+	assert.Contains(t, svg, "Limit\nbuffers: 100.0% of total (6.2% by the node itself)")
+	assert.Contains(t, svg, `<rect x="10.00" y="68" width="737.50" height="17"`)
+
+	assert.Contains(t, explain.RenderFlameGraph(FlameGraphBuffers), `<g id="metric-buffers" display="inline">`)
+}
+
+func TestRenderFlameGraphWithoutExecution(t *testing.T) {
+	explain, err := ParseExplain(`Limit  (cost=0.00..10.00 rows=10 width=4)
+  ->  Seq Scan on t  (cost=0.00..8.00 rows=100 width=4)`, ExplainConfig{})
+	require.Nil(t, err)
+
+	svg := explain.RenderFlameGraph(FlameGraphTime)
+
+	// Costs are used if there is no timing.
+	assert.Contains(t, svg, "Execution plan: cost, total cost 10.00")
+	assert.Contains(t, svg, "<title>Seq Scan on t\ncost: 80.0% of total (80.0% by the node itself)\nrows: 100 planned")
+	assert.Contains(t, svg, `<rect x="10.00" y="68" width="944.00" height="17"`)
+}
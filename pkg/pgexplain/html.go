@@ -0,0 +1,248 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/postgres-ai/joe/pkg/util"
+)
+
+// htmlPlan contains data of the HTML plan viewer.
+type htmlPlan struct {
+	Root  htmlNode
+	Tips  []htmlTip
+	Stats string
+}
+
+// htmlNode describes a plan node in the HTML plan viewer.
+type htmlNode struct {
+	ID          string
+	Caption     string
+	SubplanName string
+	Details     []string
+
+	Slowest   bool
+	Costliest bool
+	Largest   bool
+
+	HasTiming         bool
+	TimingOff         bool
+	Duration          string
+	InclusiveDuration string
+	Share             float64 // Percent of the total time, or of the total cost for plans without execution.
+
+	ActualRows  uint64
+	PlanRows    uint64
+	ActualLoops uint64
+	Misestimate string
+
+	Cost             string
+	Buffers          string
+	ExclusiveBuffers string
+
+	Tips     []htmlTip
+	Children []htmlNode
+}
+
+// htmlTip describes a tip in the HTML plan viewer.
+type htmlTip struct {
+	Severity    string
+	Name        string
+	Description string
+	DetailsURL  string
+	Nodes       []htmlTipNode
+}
+
+// htmlTipNode describes a plan node which triggered a tip.
+type htmlTipNode struct {
+	ID      string
+	Message string
+}
+
+// RenderPlanHTML renders a self-contained HTML page with the collapsible plan tree, tips and the summary.
+func (ex *Explain) RenderPlanHTML() (string, error) {
+	tips, err := ex.GetTips()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get tips")
+	}
+
+	page := htmlPlan{
+		Stats: strings.TrimSpace(ex.RenderStats()),
+	}
+
+	nodeTips := make(map[string][]htmlTip)
+
+	for _, tip := range tips {
+		pageTip := htmlTip{
+			Severity:    tip.Severity,
+			Name:        tip.Name,
+			Description: tip.Description,
+			DetailsURL:  tip.DetailsUrl,
+		}
+
+		for _, node := range tip.Nodes {
+			tipNode := htmlTipNode{ID: htmlNodeID(node.Path), Message: node.String()}
+			pageTip.Nodes = append(pageTip.Nodes, tipNode)
+
+			nodeTip := pageTip
+			nodeTip.Nodes = []htmlTipNode{tipNode}
+			nodeTips[node.Path] = append(nodeTips[node.Path], nodeTip)
+		}
+
+		page.Tips = append(page.Tips, pageTip)
+	}
+
+	page.Root = ex.newHTMLNode(&ex.Plan, nodeTips)
+
+	buf := &strings.Builder{}
+
+	if err := planHTMLTemplate.Execute(buf, page); err != nil {
+		return "", errors.Wrap(err, "failed to render the plan")
+	}
+
+	return buf.String(), nil
+}
+
+func (ex *Explain) newHTMLNode(plan *Plan, nodeTips map[string][]htmlTip) htmlNode {
+	node := htmlNode{
+		ID:          htmlNodeID(plan.Path),
+		Caption:     planCaption(plan),
+		SubplanName: plan.SubplanName,
+		Slowest:     plan.Slowest,
+		Costliest:   plan.Costliest,
+		Largest:     plan.Largest,
+		HasTiming:   plan.ActualLoops > 0,
+		TimingOff:   plan.TimingOff,
+		ActualRows:  plan.ActualRows,
+		PlanRows:    plan.PlanRows,
+		ActualLoops: plan.ActualLoops,
+		Tips:        nodeTips[plan.Path],
+	}
+
+	node.Duration = util.MillisecondsToString(plan.ActualDuration)
+	node.InclusiveDuration = util.MillisecondsToString(plan.InclusiveDuration)
+
+	switch {
+	case ex.Plan.InclusiveDuration > 0:
+		node.Share = 100 * plan.ActualDuration / ex.Plan.InclusiveDuration
+
+	case ex.TotalCost > 0:
+		node.Share = 100 * plan.ActualCost / ex.TotalCost
+	}
+
+	if node.HasTiming && plan.PlannerRowEstimateFactor > 1 {
+		node.Misestimate = fmt.Sprintf("%s-estimated ×%.1f", strings.ToLower(string(plan.PlannerRowEstimateDirection)),
+			plan.PlannerRowEstimateFactor)
+	}
+
+	node.Cost = fmt.Sprintf("%.2f..%.2f (exclusive %.2f)", plan.StartupCost, plan.TotalCost, plan.ActualCost)
+
+	if plan.SharedHitBlocks > 0 || plan.SharedReadBlocks > 0 {
+		node.Buffers = fmt.Sprintf("shared hit=%d read=%d", plan.SharedHitBlocks, plan.SharedReadBlocks)
+		node.ExclusiveBuffers = fmt.Sprintf("hit=%d read=%d (~%s)", plan.ExclusiveSharedHitBlocks,
+			plan.ExclusiveSharedReadBlocks, blocksToBytes(plan.ExclusiveSharedHitBlocks+plan.ExclusiveSharedReadBlocks))
+	}
+
+	writePlanTextNodeDetails(func(format string, a ...interface{}) (int, error) {
+		line := fmt.Sprintf(format, a...)
+		node.Details = append(node.Details, line)
+
+		return len(line), nil
+	}, plan)
+
+	for index := range plan.Plans {
+		node.Children = append(node.Children, ex.newHTMLNode(&plan.Plans[index], nodeTips))
+	}
+
+	return node
+}
+
+func htmlNodeID(path string) string {
+	return "node-" + strings.ReplaceAll(path, ".", "-")
+}
+
+var planHTMLTemplate = template.Must(template.New("plan").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Execution plan</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; font-size: 14px; margin: 20px; color: #24292e; }
+h2 { font-size: 18px; margin: 24px 0 8px; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; }
+.toolbar button { margin-right: 8px; }
+details { margin-left: 24px; border-left: 1px dashed #d1d5da; padding-left: 8px; }
+details.root { margin-left: 0; border-left: none; padding-left: 0; }
+summary { cursor: pointer; padding: 4px 0; }
+.caption { font-weight: 600; font-family: Menlo, Consolas, monospace; }
+.subplan { color: #6a737d; font-style: italic; margin-right: 4px; }
+.badge { display: inline-block; border-radius: 3px; padding: 0 4px; margin-left: 4px; font-size: 12px; color: #fff; }
+.slowest { background: #d73a49; }
+.costliest { background: #e36209; }
+.largest { background: #6f42c1; }
+.bar { display: inline-block; height: 8px; background: #f97583; vertical-align: middle; margin-left: 8px; }
+.metrics { color: #586069; margin: 2px 0 4px; }
+.metrics span { margin-right: 12px; }
+.misestimate { color: #b08800; }
+.node-details { font-family: Menlo, Consolas, monospace; font-size: 12px; color: #444d56; white-space: pre-wrap; margin: 2px 0; }
+.tip { margin: 4px 0; padding: 4px 8px; border-left: 3px solid #f9c513; background: #fffbdd; }
+.tip.critical { border-color: #d73a49; background: #ffeef0; }
+.tip.info { border-color: #0366d6; background: #f1f8ff; }
+.highlight > summary { background: #fff5b1; }
+</style>
+</head>
+<body>
+<h1>Execution plan</h1>
+<div class="toolbar">
+<button onclick="toggleAll(true)">Expand all</button>
+<button onclick="toggleAll(false)">Collapse all</button>
+</div>
+{{if .Tips}}
+<h2>Recommendations</h2>
+{{range .Tips}}<div class="tip {{.Severity}}"><b>{{.Name}}</b> – {{.Description}}{{if .DetailsURL}} <a href="{{.DetailsURL}}" target="_blank" rel="noopener">Show details</a>{{end}}
+{{- range .Nodes}}<br>• <a href="#{{.ID}}" onclick="showNode('{{.ID}}')">{{.Message}}</a>{{end}}</div>
+{{end}}{{end}}
+<h2>Plan</h2>
+{{template "node" .Root}}
+<h2>Summary</h2>
+<pre>{{.Stats}}</pre>
+<script>
+function toggleAll(open) {
+  document.querySelectorAll('details').forEach(function (el) { el.open = open; });
+}
+function showNode(id) {
+  var node = document.getElementById(id);
+  for (var el = node; el; el = el.parentElement) {
+    if (el.tagName === 'DETAILS') { el.open = true; }
+  }
+  document.querySelectorAll('.highlight').forEach(function (el) { el.classList.remove('highlight'); });
+  node.classList.add('highlight');
+}
+</script>
+</body>
+</html>
+{{define "node"}}<details open id="{{.ID}}"{{if eq .ID "node-0"}} class="root"{{end}}>
+<summary>{{if .SubplanName}}<span class="subplan">{{.SubplanName}}</span>{{end}}<span class="caption">{{.Caption}}</span>
+{{- if .Slowest}}<span class="badge slowest">slowest</span>{{end}}
+{{- if .Costliest}}<span class="badge costliest">costliest</span>{{end}}
+{{- if .Largest}}<span class="badge largest">largest</span>{{end}}
+<span class="bar" style="width: {{printf "%.0f" .Share}}px"></span> {{printf "%.1f" .Share}}%</summary>
+<div class="metrics">
+{{- if .HasTiming}}{{if not .TimingOff}}<span>time: {{.Duration}} (inclusive {{.InclusiveDuration}})</span>{{end}}<span>rows: {{.ActualRows}} of {{.PlanRows}} planned{{if .Misestimate}} <span class="misestimate">{{.Misestimate}}</span>{{end}}</span><span>loops: {{.ActualLoops}}</span>
+{{- else}}<span>rows: {{.PlanRows}} planned</span>{{end}}
+<span>cost: {{.Cost}}</span>
+{{- if .Buffers}}<span>buffers: {{.Buffers}}, exclusive {{.ExclusiveBuffers}}</span>{{end}}
+</div>
+{{- if .Details}}<div class="node-details">{{range .Details}}{{.}}
+{{end}}</div>{{end}}
+{{- range .Tips}}<div class="tip {{.Severity}}"><b>{{.Name}}</b>{{range .Nodes}}: {{.Message}}{{end}}</div>{{end}}
+{{- range .Children}}{{template "node" .}}{{end}}
+</details>
+{{end}}`))
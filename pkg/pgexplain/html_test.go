@@ -0,0 +1,68 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderPlanHTML(t *testing.T) {
+	config := ExplainConfig{
+		Tips: []Tip{
+			{
+				Code:        "FILTERED",
+				Name:        "Rows filtered",
+				Description: "Too many rows are filtered",
+				Condition:   "node.RowsRemovedByFilter > 100",
+				Metric:      "rows removed",
+				Value:       "node.RowsRemovedByFilter",
+			},
+		},
+	}
+
+	explain, err := NewExplain(InputJSONInitPlan, config)
+	require.Nil(t, err)
+
+	page, err := explain.RenderPlanHTML()
+	require.Nil(t, err)
+
+	assert.True(t, strings.HasPrefix(page, "<!DOCTYPE html>"))
+	assert.NotContains(t, page, "<script src=")
+	assert.NotContains(t, page, `<link rel="stylesheet"`)
+
+	// Nodes are collapsible and highlighted.
+	assert.Contains(t, page, `<details open id="node-0" class="root">`)
+	assert.Contains(t, page, `<details open id="node-0-0">`)
+	assert.Contains(t, page, `<span class="subplan">InitPlan 1 (returns $0)</span><span class="caption">Aggregate</span>`+
+		`<span class="badge slowest">slowest</span>`)
+	assert.Contains(t, page, `<span class="caption">Seq Scan on t</span><span class="badge largest">largest</span>`)
+
+	// Percent of the total time, buffers and misestimation.
+	assert.Contains(t, page, "</span> 41.7%</summary>")
+	assert.Contains(t, page, "<span>buffers: shared hit=150 read=0, exclusive hit=50 read=0 (~400.00 KiB)</span>")
+	assert.Contains(t, page, "Filter: (a &gt; $0)")
+
+	// Tips are listed with links to the nodes and next to the nodes.
+	assert.Contains(t, page, `<div class="tip warning"><b>Rows filtered</b> – Too many rows are filtered`+
+		`<br>• <a href="#node-0-1" onclick="showNode('node-0-1')">Seq Scan on t (rows removed 1.0k)</a></div>`)
+	assert.Contains(t, page, `<div class="tip warning"><b>Rows filtered</b>: Seq Scan on t (rows removed 1.0k)</div>`)
+
+	// The summary.
+	assert.Contains(t, page, "Time: 60.600 ms")
+}
+
+func TestRenderPlanHTMLMisestimate(t *testing.T) {
+	explain, err := NewExplain(InputJSONCTE, ExplainConfig{})
+	require.Nil(t, err)
+
+	page, err := explain.RenderPlanHTML()
+	require.Nil(t, err)
+
+	assert.Contains(t, page, `rows: 100 of 300 planned <span class="misestimate">over-estimated ×3.0</span>`)
+}
@@ -0,0 +1,223 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxCandidateColumns limits the number of columns of candidate indexes.
+const maxCandidateColumns = 3
+
+// identPattern matches identifiers printed by Postgres, quoted if needed.
+const identPattern = `"(?:[^"]|"")+"|[a-z_][a-z0-9_$]*`
+
+var (
+	plainIdentRe = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+	sortKeyRe    = regexp.MustCompile(`^(` + identPattern + `)\.(` + identPattern + `)((?: (?:ASC|DESC))?(?: NULLS (?:FIRST|LAST))?)$`)
+)
+
+// IndexCandidate defines an index which may speed up a query.
+type IndexCandidate struct {
+	Schema  string
+	Table   string
+	Columns []string
+
+	// Source describes the part of the plan the candidate is found in, e.g. "Filter of Seq Scan on orders".
+	Source string
+}
+
+// Definition returns the definition of the index, e.g. "CREATE INDEX ON public.orders (customer_id, created_at)".
+func (c IndexCandidate) Definition() string {
+	return c.definition("CREATE INDEX")
+}
+
+// ConcurrentDefinition returns the definition of the index built without blocking writes,
+// e.g. "CREATE INDEX CONCURRENTLY ON public.orders (customer_id)".
+func (c IndexCandidate) ConcurrentDefinition() string {
+	return c.definition("CREATE INDEX CONCURRENTLY")
+}
+
+func (c IndexCandidate) definition(command string) string {
+	table := quoteName(c.Table)
+	if c.Schema != "" {
+		table = quoteName(c.Schema) + "." + table
+	}
+
+	return fmt.Sprintf("%s ON %s (%s)", command, table, strings.Join(c.Columns, ", "))
+}
+
+// scannedRelation defines a relation scanned by a plan node.
+type scannedRelation struct {
+	schema string
+	table  string
+	alias  string
+}
+
+// columnRef defines a column used in a condition, columns compared for equality go first in indexes.
+type columnRef struct {
+	name     string
+	equality bool
+}
+
+// FindIndexCandidates finds candidate indexes in conditions of sequential and inefficient index scans,
+// join conditions and sort keys. The plan must be built with the VERBOSE option, so columns are qualified.
+func FindIndexCandidates(plan *Plan) []IndexCandidate {
+	relations := map[string]scannedRelation{}
+	aliases := []string{}
+
+	walkPlan(plan, nil, func(node, _ *Plan) {
+		if node.RelationName == "" || node.Alias == "" {
+			return
+		}
+
+		if _, ok := relations[node.Alias]; !ok {
+			relations[node.Alias] = scannedRelation{schema: node.Schema, table: node.RelationName, alias: node.Alias}
+			aliases = append(aliases, node.Alias)
+		}
+	})
+
+	candidates := []IndexCandidate{}
+	found := map[string]struct{}{}
+
+	addCandidate := func(rel scannedRelation, columns []columnRef, source string) {
+		candidate := IndexCandidate{Schema: rel.schema, Table: rel.table, Source: source}
+
+		// Columns compared for equality go first, so the index can be used for ranges of other columns.
+		for _, equality := range []bool{true, false} {
+			for _, column := range columns {
+				if column.equality == equality && !containsString(candidate.Columns, column.name) &&
+					len(candidate.Columns) < maxCandidateColumns {
+					candidate.Columns = append(candidate.Columns, column.name)
+				}
+			}
+		}
+
+		if len(candidate.Columns) == 0 {
+			return
+		}
+
+		if _, ok := found[candidate.Definition()]; ok {
+			return
+		}
+
+		found[candidate.Definition()] = struct{}{}
+		candidates = append(candidates, candidate)
+	}
+
+	walkPlan(plan, nil, func(node, _ *Plan) {
+		rel, scanned := relations[node.Alias]
+
+		scanSource := func(conditions string) string {
+			return fmt.Sprintf("%s of %s on %s", conditions, node.NodeType, node.RelationName)
+		}
+
+		switch {
+		case scanned && node.NodeType == SequenceScan && node.Filter != "":
+			columns := conditionColumns(node.Filter, rel.alias)
+			addCandidate(rel, columns, scanSource("Filter"))
+
+			if len(columns) > 1 {
+				for _, column := range columns {
+					addCandidate(rel, []columnRef{column}, scanSource("Filter"))
+				}
+			}
+
+		case scanned && (node.NodeType == IndexScan || node.NodeType == IndexOnlyScan) && node.Filter != "":
+			columns := append(conditionColumns(node.IndexCondition, rel.alias), conditionColumns(node.Filter, rel.alias)...)
+			addCandidate(rel, columns, scanSource("Index Cond and Filter"))
+
+		case scanned && node.NodeType == BitmapHeapScan && node.Filter != "":
+			columns := append(conditionColumns(node.RecheckCondition, rel.alias), conditionColumns(node.Filter, rel.alias)...)
+			addCandidate(rel, columns, scanSource("Recheck Cond and Filter"))
+		}
+
+		for _, condition := range []string{node.HashCondition, node.MergeCondition, node.JoinFilter} {
+			if condition == "" {
+				continue
+			}
+
+			for _, alias := range aliases {
+				joined := relations[alias]
+
+				for _, column := range conditionColumns(condition, joined.alias) {
+					addCandidate(joined, []columnRef{column}, fmt.Sprintf("join condition of %s", node.NodeType))
+				}
+			}
+		}
+
+		if node.NodeType == Sort || node.NodeType == IncrementalSort {
+			if sortRel, columns, ok := sortColumns(node.SortKey, relations); ok {
+				addCandidate(sortRel, columns, fmt.Sprintf("Sort Key of %s", node.NodeType))
+			}
+		}
+	})
+
+	return candidates
+}
+
+// conditionColumns finds columns of the relation used in the condition, e.g. "(orders.customer_id = 42)".
+func conditionColumns(condition, alias string) []columnRef {
+	if condition == "" {
+		return nil
+	}
+
+	columnRe := regexp.MustCompile(`(?:^|[^a-z0-9_$."])` + regexp.QuoteMeta(quoteName(alias)) +
+		`\.(` + identPattern + `)(\s*(?:= |IS NULL))?`)
+
+	columns := []columnRef{}
+
+	for _, match := range columnRe.FindAllStringSubmatch(condition, -1) {
+		column := columnRef{name: match[1], equality: match[2] != ""}
+
+		found := false
+
+		for i := range columns {
+			if columns[i].name == column.name {
+				columns[i].equality = columns[i].equality || column.equality
+				found = true
+			}
+		}
+
+		if !found {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// sortColumns returns columns of sort keys if all keys are plain columns of one relation.
+func sortColumns(sortKeys []string, relations map[string]scannedRelation) (scannedRelation, []columnRef, bool) {
+	var sortRel scannedRelation
+
+	columns := []columnRef{}
+
+	for _, key := range sortKeys {
+		match := sortKeyRe.FindStringSubmatch(key)
+		if match == nil {
+			return scannedRelation{}, nil, false
+		}
+
+		rel, ok := relations[unquoteIdent(match[1])]
+		if !ok || (sortRel.alias != "" && rel.alias != sortRel.alias) {
+			return scannedRelation{}, nil, false
+		}
+
+		sortRel = rel
+
+		// Sort keys keep their order, so they are not reordered as equality columns.
+		columns = append(columns, columnRef{name: match[2] + match[3]})
+	}
+
+	return sortRel, columns, len(columns) > 0
+}
+
+// quoteName quotes the name if it is not a plain identifier.
+func quoteName(name string) string {
+	return quoteIdent(name, !plainIdentRe.MatchString(name))
+}
@@ -0,0 +1,132 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const inputJSONIndexCandidates = `[
+  {
+    "Plan": {
+      "Node Type": "Sort",
+      "Startup Cost": 2301.5,
+      "Total Cost": 2301.75,
+      "Plan Rows": 100,
+      "Plan Width": 64,
+      "Sort Key": ["o.created_at DESC"],
+      "Plans": [
+        {
+          "Node Type": "Hash Join",
+          "Parent Relationship": "Outer",
+          "Join Type": "Inner",
+          "Startup Cost": 30.5,
+          "Total Cost": 2298.1,
+          "Plan Rows": 100,
+          "Plan Width": 64,
+          "Hash Cond": "(o.customer_id = c.id)",
+          "Plans": [
+            {
+              "Node Type": "Seq Scan",
+              "Parent Relationship": "Outer",
+              "Relation Name": "orders",
+              "Schema": "public",
+              "Alias": "o",
+              "Startup Cost": 0,
+              "Total Cost": 2250,
+              "Plan Rows": 100,
+              "Plan Width": 32,
+              "Filter": "((o.status = 'new'::text) AND (o.created_at > (now() - '1 day'::interval)))"
+            },
+            {
+              "Node Type": "Hash",
+              "Parent Relationship": "Inner",
+              "Startup Cost": 18,
+              "Total Cost": 18,
+              "Plan Rows": 1000,
+              "Plan Width": 32,
+              "Plans": [
+                {
+                  "Node Type": "Seq Scan",
+                  "Parent Relationship": "Outer",
+                  "Relation Name": "Customers",
+                  "Schema": "public",
+                  "Alias": "c",
+                  "Startup Cost": 0,
+                  "Total Cost": 18,
+                  "Plan Rows": 1000,
+                  "Plan Width": 32
+                }
+              ]
+            }
+          ]
+        }
+      ]
+    }
+  }
+]`
+
+func TestFindIndexCandidates(t *testing.T) {
+	explain, err := NewExplain(inputJSONIndexCandidates, ExplainConfig{})
+	require.Nil(t, err)
+
+	candidates := FindIndexCandidates(&explain.Plan)
+
+	definitions := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		definitions = append(definitions, candidate.Definition())
+	}
+
+	assert.Equal(t, []string{
+		"CREATE INDEX ON public.orders (created_at DESC)",
+		"CREATE INDEX ON public.orders (customer_id)",
+		`CREATE INDEX ON public."Customers" (id)`,
+		"CREATE INDEX ON public.orders (status, created_at)",
+		"CREATE INDEX ON public.orders (status)",
+		"CREATE INDEX ON public.orders (created_at)",
+	}, definitions)
+
+	assert.Equal(t, `CREATE INDEX CONCURRENTLY ON public."Customers" (id)`, candidates[2].ConcurrentDefinition())
+
+	assert.Equal(t, "Sort Key of Sort", candidates[0].Source)
+	assert.Equal(t, "join condition of Hash Join", candidates[1].Source)
+	assert.Equal(t, "Filter of Seq Scan on orders", candidates[3].Source)
+}
+
+func TestConditionColumns(t *testing.T) {
+	testCases := []struct {
+		condition string
+		alias     string
+		expected  []columnRef
+	}{
+		{
+			condition: "((o.status = 'new'::text) AND (o.created_at > now()))",
+			alias:     "o",
+			expected:  []columnRef{{name: "status", equality: true}, {name: "created_at"}},
+		},
+		{
+			condition: `((lower(o."Email") = 'a@b.c'::text) OR (o.deleted_at IS NULL))`,
+			alias:     "o",
+			expected:  []columnRef{{name: `"Email"`}, {name: "deleted_at", equality: true}},
+		},
+		{
+			condition: "(foo.id = o.foo_id)",
+			alias:     "o",
+			expected:  []columnRef{{name: "foo_id"}},
+		},
+		{
+			condition: `("Order Items".order_id = 1)`,
+			alias:     "Order Items",
+			expected:  []columnRef{{name: "order_id", equality: true}},
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, conditionColumns(tc.condition, tc.alias), tc.condition)
+	}
+}
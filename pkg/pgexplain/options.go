@@ -0,0 +1,200 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExplainOption defines an option of the EXPLAIN command, e.g. "TIMING OFF".
+type ExplainOption struct {
+	Name  string
+	Value string
+}
+
+// ExplainOptions defines options of the EXPLAIN command given by a user.
+type ExplainOptions []ExplainOption
+
+// explainOptionSpec describes an option supported by Postgres.
+type explainOptionSpec struct {
+	minVersion int // The minimal value of server_version_num.
+	values     []string
+}
+
+var booleanOptionValues = []string{"", "ON", "OFF", "TRUE", "FALSE", "1", "0"}
+
+// explainOptionSpecs contains EXPLAIN options supported by Postgres.
+var explainOptionSpecs = map[string]explainOptionSpec{
+	"ANALYZE":      {values: booleanOptionValues},
+	"VERBOSE":      {values: booleanOptionValues},
+	"COSTS":        {values: booleanOptionValues},
+	"SETTINGS":     {minVersion: 120000, values: booleanOptionValues},
+	"GENERIC_PLAN": {minVersion: 160000, values: booleanOptionValues},
+	"BUFFERS":      {values: booleanOptionValues},
+	"SERIALIZE":    {minVersion: 170000, values: []string{"", "NONE", "TEXT", "BINARY"}},
+	"WAL":          {minVersion: 130000, values: booleanOptionValues},
+	"TIMING":       {values: booleanOptionValues},
+	"SUMMARY":      {values: booleanOptionValues},
+	"MEMORY":       {minVersion: 170000, values: booleanOptionValues},
+	"FORMAT":       {values: []string{"TEXT", "XML", "JSON", "YAML"}},
+}
+
+// requiredExplainOptions contains options needed to analyze plans, they cannot be changed by users.
+var requiredExplainOptions = ExplainOptions{
+	{Name: "ANALYZE"},
+	{Name: "FORMAT", Value: "JSON"},
+}
+
+// defaultExplainOptions contains options which are enabled unless users disable them.
+var defaultExplainOptions = ExplainOptions{
+	{Name: "COSTS"},
+	{Name: "VERBOSE"},
+	{Name: "BUFFERS"},
+}
+
+// SplitExplainOptions separates EXPLAIN options from a query, e.g. "(timing off, settings) select 1".
+// The query is returned as is if it does not start with a list of options.
+func SplitExplainOptions(query string) (ExplainOptions, string, error) {
+	trimmed := strings.TrimSpace(query)
+
+	if !strings.HasPrefix(trimmed, "(") {
+		return nil, query, nil
+	}
+
+	end := strings.Index(trimmed, ")")
+	if end < 0 {
+		return nil, query, nil
+	}
+
+	items := splitList(trimmed[1:end])
+	options := make(ExplainOptions, 0, len(items))
+
+	for i, item := range items {
+		fields := strings.Fields(item)
+		if len(fields) == 0 || len(fields) > 2 {
+			if i == 0 {
+				return nil, query, nil
+			}
+
+			return nil, "", errors.Errorf("invalid EXPLAIN option: %q", item)
+		}
+
+		option := ExplainOption{Name: strings.ToUpper(fields[0])}
+		if len(fields) == 2 {
+			option.Value = strings.ToUpper(strings.Trim(fields[1], "'"))
+		}
+
+		// A parenthesized query, e.g. "(select 1) union (select 2)".
+		if _, ok := explainOptionSpecs[option.Name]; !ok && i == 0 {
+			return nil, query, nil
+		}
+
+		options = append(options, option)
+	}
+
+	return options, strings.TrimSpace(trimmed[end+1:]), nil
+}
+
+// Validate checks if options are supported by the server and compatible with the analysis of plans.
+func (o ExplainOptions) Validate(serverVersion int) error {
+	for _, option := range o {
+		spec, ok := explainOptionSpecs[option.Name]
+		if !ok {
+			return errors.Errorf("unknown EXPLAIN option: %s", option.Name)
+		}
+
+		if !containsString(spec.values, option.Value) {
+			return errors.Errorf("invalid value of the EXPLAIN option %s: %q", option.Name, option.Value)
+		}
+
+		if serverVersion < spec.minVersion {
+			return errors.Errorf("EXPLAIN option %s requires Postgres %d or newer", option.Name, spec.minVersion/10000)
+		}
+
+		switch option.Name {
+		case "ANALYZE":
+			if isOptionOff(option) {
+				return errors.New("ANALYZE cannot be disabled, use `plan` to see the query's plan without execution")
+			}
+
+		case "FORMAT":
+			if option.Value != "JSON" {
+				return errors.New("FORMAT cannot be changed, the plan is requested in JSON and rendered by Joe")
+			}
+
+		case "GENERIC_PLAN":
+			if !isOptionOff(option) {
+				return errors.New("GENERIC_PLAN cannot be used with ANALYZE")
+			}
+		}
+	}
+
+	return nil
+}
+
+// AnalyzeCommand builds the EXPLAIN ANALYZE prefix of a query merging user options with the required ones.
+func (o ExplainOptions) AnalyzeCommand() string {
+	options := ExplainOptions{requiredExplainOptions[0]}
+
+	for _, option := range defaultExplainOptions {
+		if !o.has(option.Name) {
+			options = append(options, option)
+		}
+	}
+
+	for _, option := range o {
+		if !requiredExplainOptions.has(option.Name) {
+			options = append(options, option)
+		}
+	}
+
+	options = append(options, requiredExplainOptions[1:]...)
+
+	items := make([]string, 0, len(options))
+
+	for _, option := range options {
+		items = append(items, strings.TrimSpace(option.Name+" "+option.Value))
+	}
+
+	return fmt.Sprintf("EXPLAIN (%s) ", strings.Join(items, ", "))
+}
+
+// String renders options given by a user.
+func (o ExplainOptions) String() string {
+	items := make([]string, 0, len(o))
+
+	for _, option := range o {
+		items = append(items, strings.TrimSpace(option.Name+" "+option.Value))
+	}
+
+	return strings.Join(items, ", ")
+}
+
+func (o ExplainOptions) has(name string) bool {
+	for _, option := range o {
+		if option.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isOptionOff(option ExplainOption) bool {
+	return option.Value == "OFF" || option.Value == "FALSE" || option.Value == "0"
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
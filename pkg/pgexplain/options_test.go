@@ -0,0 +1,131 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitExplainOptions(t *testing.T) {
+	testCases := []struct {
+		input   string
+		options ExplainOptions
+		query   string
+	}{
+		{
+			input: "select 1",
+			query: "select 1",
+		},
+		{
+			input:   " (timing off, Settings, wal) select 1",
+			options: ExplainOptions{{Name: "TIMING", Value: "OFF"}, {Name: "SETTINGS"}, {Name: "WAL"}},
+			query:   "select 1",
+		},
+		{
+			input:   "(serialize 'text')\nselect 1",
+			options: ExplainOptions{{Name: "SERIALIZE", Value: "TEXT"}},
+			query:   "select 1",
+		},
+		{
+			input: "(select 1) union (select 2)",
+			query: "(select 1) union (select 2)",
+		},
+	}
+
+	for _, tc := range testCases {
+		options, query, err := SplitExplainOptions(tc.input)
+		require.Nil(t, err, tc.input)
+
+		assert.Equal(t, tc.options, options, tc.input)
+		assert.Equal(t, tc.query, query, tc.input)
+	}
+
+	_, _, err := SplitExplainOptions("(timing off, costs on off) select 1")
+	assert.NotNil(t, err)
+}
+
+func TestValidateExplainOptions(t *testing.T) {
+	testCases := []struct {
+		options ExplainOptions
+		version int
+		valid   bool
+	}{
+		{options: ExplainOptions{{Name: "TIMING", Value: "OFF"}, {Name: "SETTINGS"}}, version: 120000, valid: true},
+		{options: ExplainOptions{{Name: "WAL"}}, version: 120000, valid: false},
+		{options: ExplainOptions{{Name: "WAL", Value: "ON"}}, version: 130000, valid: true},
+		{options: ExplainOptions{{Name: "ANALYZE", Value: "OFF"}}, version: 130000, valid: false},
+		{options: ExplainOptions{{Name: "FORMAT", Value: "TEXT"}}, version: 130000, valid: false},
+		{options: ExplainOptions{{Name: "FORMAT", Value: "JSON"}}, version: 130000, valid: true},
+		{options: ExplainOptions{{Name: "GENERIC_PLAN"}}, version: 160000, valid: false},
+		{options: ExplainOptions{{Name: "COSTS", Value: "MAYBE"}}, version: 130000, valid: false},
+		{options: ExplainOptions{{Name: "UNKNOWN"}}, version: 130000, valid: false},
+	}
+
+	for _, tc := range testCases {
+		err := tc.options.Validate(tc.version)
+		assert.Equal(t, tc.valid, err == nil, tc.options.String())
+	}
+}
+
+func TestExplainOptionsAnalyzeCommand(t *testing.T) {
+	assert.Equal(t, "EXPLAIN (ANALYZE, COSTS, VERBOSE, BUFFERS, FORMAT JSON) ", ExplainOptions{}.AnalyzeCommand())
+
+	options := ExplainOptions{{Name: "ANALYZE"}, {Name: "TIMING", Value: "OFF"}, {Name: "BUFFERS", Value: "OFF"},
+		{Name: "SETTINGS"}, {Name: "FORMAT", Value: "JSON"}}
+	assert.Equal(t, "EXPLAIN (ANALYZE, COSTS, VERBOSE, TIMING OFF, BUFFERS OFF, SETTINGS, FORMAT JSON) ",
+		options.AnalyzeCommand())
+}
+
+func TestTimingOffAndSettings(t *testing.T) {
+	explain, err := NewExplain(InputJSONTimingOff, ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.True(t, explain.TimingOff)
+	assert.Equal(t, map[string]string{"enable_seqscan": "off", "work_mem": "64MB"}, explain.Settings)
+	assert.Equal(t, ExpectedTextTimingOff, explain.RenderPlanText())
+	assert.Contains(t, explain.RenderStats(), "\nSettings:\n  - enable_seqscan: off\n  - work_mem: 64MB\n")
+
+	parsed, err := ParseExplain(ExpectedTextTimingOff+"Settings: enable_seqscan = 'off', work_mem = '64MB'\n"+
+		"Execution Time: 0.050 ms", ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.True(t, parsed.TimingOff)
+	assert.Equal(t, explain.Settings, parsed.Settings)
+	assert.Equal(t, ExpectedTextTimingOff, parsed.RenderPlanText())
+}
+
+const InputJSONTimingOff = `[
+  {
+    "Plan": {
+      "Node Type": "Index Scan",
+      "Parallel Aware": false,
+      "Scan Direction": "Forward",
+      "Index Name": "users_pkey",
+      "Relation Name": "users",
+      "Alias": "users",
+      "Startup Cost": 0.29,
+      "Total Cost": 8.30,
+      "Plan Rows": 1,
+      "Plan Width": 8,
+      "Actual Rows": 1,
+      "Actual Loops": 1,
+      "Index Cond": "(id = 1)"
+    },
+    "Settings": {
+      "enable_seqscan": "off",
+      "work_mem": "64MB"
+    },
+    "Planning Time": 0.070,
+    "Triggers": [],
+    "Execution Time": 0.050
+  }
+]`
+
+const ExpectedTextTimingOff = ` Index Scan using users_pkey on users  (cost=0.29..8.30 rows=1 width=8) (actual rows=1 loops=1)
+   Index Cond: (id = 1)
+`
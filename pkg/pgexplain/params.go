@@ -0,0 +1,125 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ParamColumn defines a column of a relation compared with a query parameter in plan conditions.
+type ParamColumn struct {
+	Schema   string
+	Relation string
+	Alias    string
+	Column   string
+}
+
+// conditionCastRe matches type casts in conditions, e.g. "::text" or "::character varying[]".
+var conditionCastRe = regexp.MustCompile(`(?i)::(?:"[^"]+"|[a-z_][a-z0-9_]*)(?: varying| precision| with(?:out)? time zone)?(?:\[\])?`)
+
+// conditionIdent defines a pattern of a column name which can be qualified with a relation name.
+const conditionIdent = `((?:"[^"]+"|[A-Za-z_][\w$]*)(?:\.(?:"[^"]+"|[A-Za-z_][\w$]*))?)`
+
+// conditionOperator defines a pattern of comparison operators.
+const conditionOperator = `(?:=|<>|!=|<=|>=|<|>|~~\*?|!~~\*?)`
+
+// FindParamColumn returns the column compared with the query parameter, e.g. $1, in conditions of scan nodes.
+// Plans with VERBOSE contain qualified names, so the column is matched with the alias of the scanned relation.
+func (ex *Explain) FindParamColumn(param int) (ParamColumn, bool) {
+	paramRef := fmt.Sprintf(`\$%d\b`, param)
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(conditionIdent + `\s*` + conditionOperator + `\s*(?:(?i:any|all)\s*)?` + paramRef),
+		regexp.MustCompile(paramRef + `\s*` + conditionOperator + `\s*` + conditionIdent),
+	}
+
+	var (
+		found ParamColumn
+		ok    bool
+	)
+
+	walkPlan(&ex.Plan, nil, func(plan, _ *Plan) {
+		if ok || plan.RelationName == "" {
+			return
+		}
+
+		for _, condition := range []string{plan.IndexCondition, plan.RecheckCondition, plan.Filter, plan.TidCondition} {
+			condition = conditionCastRe.ReplaceAllString(condition, "")
+			condition = strings.NewReplacer("(", " ", ")", " ").Replace(condition)
+
+			for _, pattern := range patterns {
+				for _, match := range pattern.FindAllStringSubmatch(condition, -1) {
+					column, matched := matchConditionColumn(match[1], plan)
+					if !matched {
+						continue
+					}
+
+					found = ParamColumn{Schema: plan.Schema, Relation: plan.RelationName, Alias: plan.Alias, Column: column}
+					ok = true
+
+					return
+				}
+			}
+		}
+	})
+
+	return found, ok
+}
+
+// String renders the qualified name of the column.
+func (c ParamColumn) String() string {
+	name := c.Relation + "." + c.Column
+	if c.Schema != "" {
+		name = c.Schema + "." + name
+	}
+
+	return name
+}
+
+// RelationScans describes how relations are scanned, e.g. "Index Scan using orders_pkey on orders o".
+func (ex *Explain) RelationScans() []string {
+	scans := []string{}
+
+	walkPlan(&ex.Plan, nil, func(plan, _ *Plan) {
+		if plan.RelationName == "" {
+			return
+		}
+
+		scan := string(plan.NodeType)
+		if plan.IndexName != "" {
+			scan += " using " + plan.IndexName
+		}
+
+		scan += " on " + plan.RelationName
+		if plan.Alias != "" && plan.Alias != plan.RelationName {
+			scan += " " + plan.Alias
+		}
+
+		scans = append(scans, scan)
+	})
+
+	return scans
+}
+
+// matchConditionColumn returns the name of the column if it belongs to the relation of the plan node.
+func matchConditionColumn(name string, plan *Plan) (string, bool) {
+	parts := strings.SplitN(name, ".", 2)
+	column := parts[len(parts)-1]
+
+	if len(parts) == 2 {
+		qualifier := strings.Trim(parts[0], `"`)
+		if qualifier != plan.Alias && qualifier != plan.RelationName {
+			return "", false
+		}
+	}
+
+	// Functions and keywords are not columns.
+	if strings.EqualFold(column, "any") || strings.EqualFold(column, "all") {
+		return "", false
+	}
+
+	return strings.Trim(column, `"`), true
+}
@@ -0,0 +1,131 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindParamColumn(t *testing.T) {
+	explain, err := NewExplain(InputJSONGenericPlan, ExplainConfig{})
+	require.Nil(t, err)
+
+	testCases := []struct {
+		param  int
+		column ParamColumn
+		found  bool
+	}{
+		{param: 1, column: ParamColumn{Schema: "public", Relation: "users", Alias: "u", Column: "tenant_id"}, found: true},
+		{param: 2, column: ParamColumn{Schema: "public", Relation: "orders", Alias: "o", Column: "created_at"}, found: true},
+		{param: 3, column: ParamColumn{Schema: "public", Relation: "orders", Alias: "o", Column: "Status"}, found: true},
+		{param: 4, column: ParamColumn{Schema: "public", Relation: "orders", Alias: "o", Column: "id"}, found: true},
+		{param: 5, found: false},
+	}
+
+	for _, tc := range testCases {
+		column, found := explain.FindParamColumn(tc.param)
+		assert.Equal(t, tc.found, found, tc.param)
+		assert.Equal(t, tc.column, column, tc.param)
+	}
+
+	assert.Equal(t, "public.users.tenant_id", ParamColumn{Schema: "public", Relation: "users", Column: "tenant_id"}.String())
+}
+
+func TestRelationScans(t *testing.T) {
+	explain, err := NewExplain(InputJSONGenericPlan, ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"Seq Scan on users u",
+		"Bitmap Heap Scan on orders o",
+		"Index Scan using orders_pkey on orders o",
+	}, explain.RelationScans())
+}
+
+const InputJSONGenericPlan = `[
+  {
+    "Plan": {
+      "Node Type": "Append",
+      "Parallel Aware": false,
+      "Startup Cost": 1.07,
+      "Total Cost": 40.12,
+      "Plan Rows": 12,
+      "Plan Width": 8,
+      "Plans": [
+        {
+          "Node Type": "Hash Join",
+          "Parent Relationship": "Member",
+          "Parallel Aware": false,
+          "Join Type": "Inner",
+          "Startup Cost": 1.07,
+          "Total Cost": 30.1,
+          "Plan Rows": 10,
+          "Plan Width": 8,
+          "Hash Cond": "(o.user_id = u.id)",
+          "Plans": [
+            {
+              "Node Type": "Seq Scan",
+              "Parent Relationship": "Inner",
+              "Parallel Aware": false,
+              "Relation Name": "users",
+              "Schema": "public",
+              "Alias": "u",
+              "Startup Cost": 0.00,
+              "Total Cost": 1.05,
+              "Plan Rows": 1,
+              "Plan Width": 4,
+              "Filter": "(u.active AND (u.tenant_id = $1))"
+            },
+            {
+              "Node Type": "Bitmap Heap Scan",
+              "Parent Relationship": "Outer",
+              "Parallel Aware": false,
+              "Relation Name": "orders",
+              "Schema": "public",
+              "Alias": "o",
+              "Startup Cost": 4.2,
+              "Total Cost": 25.3,
+              "Plan Rows": 10,
+              "Plan Width": 8,
+              "Recheck Cond": "(o.created_at > ($2)::timestamp with time zone)",
+              "Filter": "((($3)::text = (o.\"Status\")::text) AND (u.id > $5))",
+              "Plans": [
+                {
+                  "Node Type": "Bitmap Index Scan",
+                  "Parent Relationship": "Outer",
+                  "Parallel Aware": false,
+                  "Index Name": "orders_created_at_idx",
+                  "Startup Cost": 0.00,
+                  "Total Cost": 4.2,
+                  "Plan Rows": 10,
+                  "Plan Width": 0,
+                  "Index Cond": "(o.created_at > ($2)::timestamp with time zone)"
+                }
+              ]
+            }
+          ]
+        },
+        {
+          "Node Type": "Index Scan",
+          "Parent Relationship": "Member",
+          "Parallel Aware": false,
+          "Scan Direction": "Forward",
+          "Index Name": "orders_pkey",
+          "Relation Name": "orders",
+          "Schema": "public",
+          "Alias": "o",
+          "Startup Cost": 0.15,
+          "Total Cost": 8.17,
+          "Plan Rows": 2,
+          "Plan Width": 8,
+          "Index Cond": "(o.id = ANY ($4))"
+        }
+      ]
+    }
+  }
+]`
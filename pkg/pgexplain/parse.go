@@ -0,0 +1,346 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Format defines an EXPLAIN output format.
+type Format string
+
+// EXPLAIN output formats.
+const (
+	FormatJSON Format = "json"
+	FormatText Format = "text"
+	FormatYAML Format = "yaml"
+	FormatXML  Format = "xml"
+)
+
+// ErrNoPlan defines an error of input which does not contain a plan.
+var ErrNoPlan = errors.New("invalid plan: no plan nodes found")
+
+var (
+	psqlSeparatorRe = regexp.MustCompile(`^[-+]+$`)
+	psqlFooterRe    = regexp.MustCompile(`^\(\d+ rows?\)$`)
+	leadingNumberRe = regexp.MustCompile(`^-?\d+(\.\d+)?`)
+)
+
+// jsonKinds contains kinds of plan fields by their EXPLAIN keys. It's used to convert values of non-JSON formats.
+var jsonKinds = collectJSONKinds(reflect.TypeOf(Explain{}), map[string]reflect.Kind{}, map[reflect.Type]bool{})
+
+// CleanPlan removes psql decorations from EXPLAIN output, JSON plans are returned as arrays of plans.
+func CleanPlan(input string) string {
+	input = cleanPsqlOutput(input)
+
+	if DetectFormat(input) == FormatJSON {
+		input = strings.TrimSpace(input)
+
+		// Single objects come from auto_explain.
+		if strings.HasPrefix(input, "{") {
+			input = "[" + input + "]"
+		}
+	}
+
+	return input
+}
+
+// ParseExplain parses EXPLAIN output in any format, including plans copied from psql.
+func ParseExplain(input string, config ExplainConfig) (*Explain, error) {
+	input = CleanPlan(input)
+
+	var (
+		explains []interface{}
+		err      error
+	)
+
+	switch DetectFormat(input) {
+	case FormatJSON:
+		return NewExplain(input, config)
+
+	case FormatYAML:
+		explains, err = parseYAML(input)
+
+	case FormatXML:
+		explains, err = parseXML(input)
+
+	default:
+		explains, err = parseText(input)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	explainJSON, err := json.Marshal(explains)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert the plan")
+	}
+
+	return NewExplain(string(explainJSON), config)
+}
+
+// DetectFormat detects a format of EXPLAIN output.
+func DetectFormat(input string) Format {
+	input = strings.TrimSpace(input)
+
+	switch {
+	case strings.HasPrefix(input, "[") || strings.HasPrefix(input, "{"):
+		return FormatJSON
+
+	case strings.HasPrefix(input, "<"):
+		return FormatXML
+
+	case strings.HasPrefix(input, "- Plan:") || strings.HasPrefix(input, "Plan:"):
+		return FormatYAML
+	}
+
+	return FormatText
+}
+
+// cleanPsqlOutput removes psql headers, footers and line continuation marks.
+func cleanPsqlOutput(input string) string {
+	lines := []string{}
+
+	for _, line := range strings.Split(strings.ReplaceAll(input, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" || trimmed == "QUERY PLAN" || psqlSeparatorRe.MatchString(trimmed) || psqlFooterRe.MatchString(trimmed) {
+			continue
+		}
+
+		line = strings.TrimRight(line, " ")
+
+		if strings.HasSuffix(line, " +") {
+			line = strings.TrimRight(strings.TrimSuffix(line, "+"), " ")
+		}
+
+		lines = append(lines, line)
+	}
+
+	// Leading spaces are kept as they define the plan structure in the text format.
+	return strings.Join(lines, "\n")
+}
+
+func parseYAML(input string) ([]interface{}, error) {
+	var explains interface{}
+
+	if err := yaml.Unmarshal([]byte(input), &explains); err != nil {
+		return nil, errors.Wrap(err, "failed to parse YAML plan")
+	}
+
+	explains = normalizeYAML(explains)
+
+	if explain, ok := explains.(map[string]interface{}); ok {
+		return []interface{}{explain}, nil
+	}
+
+	list, ok := explains.([]interface{})
+	if !ok {
+		return nil, errors.New("invalid YAML plan")
+	}
+
+	return list, nil
+}
+
+// normalizeYAML converts YAML maps to JSON-compatible ones.
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+
+		return result
+
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+	}
+
+	return value
+}
+
+type xmlElement struct {
+	name     string
+	text     strings.Builder
+	children []*xmlElement
+}
+
+func parseXML(input string) ([]interface{}, error) {
+	decoder := xml.NewDecoder(strings.NewReader(input))
+
+	root := &xmlElement{}
+	stack := []*xmlElement{root}
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse XML plan")
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			element := &xmlElement{name: t.Name.Local}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, element)
+			stack = append(stack, element)
+
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case xml.CharData:
+			stack[len(stack)-1].text.Write(t)
+		}
+	}
+
+	if len(root.children) == 0 || root.children[0].name != "explain" {
+		return nil, errors.New("invalid XML plan: <explain> expected")
+	}
+
+	explains := []interface{}{}
+
+	for _, query := range root.children[0].children {
+		if query.name == "Query" {
+			explains = append(explains, xmlToMap(query))
+		}
+	}
+
+	return explains, nil
+}
+
+func xmlToMap(element *xmlElement) map[string]interface{} {
+	result := make(map[string]interface{}, len(element.children))
+
+	for _, child := range element.children {
+		key := xmlKey(child.name)
+		result[key] = xmlValue(key, child)
+	}
+
+	return result
+}
+
+func xmlValue(key string, element *xmlElement) interface{} {
+	switch {
+	case key == "Plans" || key == "Triggers" || key == "Workers":
+		items := make([]interface{}, 0, len(element.children))
+		for _, child := range element.children {
+			items = append(items, xmlToMap(child))
+		}
+
+		return items
+
+	case len(element.children) > 0 && element.children[0].name == "Item":
+		items := make([]interface{}, 0, len(element.children))
+		for _, child := range element.children {
+			items = append(items, strings.TrimSpace(child.text.String()))
+		}
+
+		return items
+
+	case len(element.children) > 0:
+		return xmlToMap(element)
+	}
+
+	return convertValue(key, strings.TrimSpace(element.text.String()))
+}
+
+// xmlDashedKeys contains EXPLAIN keys with dashes which cannot be restored from XML tags.
+var xmlDashedKeys = map[string]string{
+	"Full-sort-Groups":  "Full-sort Groups",
+	"Pre-sorted-Groups": "Pre-sorted Groups",
+}
+
+// xmlKey restores an EXPLAIN key from an XML tag, e.g. "I-O-Read-Time" -> "I/O Read Time".
+func xmlKey(tag string) string {
+	if key, ok := xmlDashedKeys[tag]; ok {
+		return key
+	}
+
+	key := strings.ReplaceAll(tag, "-", " ")
+
+	if strings.HasPrefix(key, "I O ") {
+		key = "I/O " + key[len("I O "):]
+	}
+
+	return key
+}
+
+// convertValue converts a raw value to the type of the corresponding plan field.
+func convertValue(key, raw string) interface{} {
+	kind, ok := jsonKinds[key]
+	if !ok || kind == reflect.String {
+		return raw
+	}
+
+	// Keys are not unique across nested objects, e.g. JIT "Inlining" is both an option and a timing.
+	if raw == "true" || raw == "false" {
+		return raw == "true"
+	}
+
+	num, err := strconv.ParseFloat(leadingNumberRe.FindString(raw), 64)
+	if err != nil {
+		return raw
+	}
+
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return math.Round(num)
+	}
+
+	return num
+}
+
+func collectJSONKinds(structType reflect.Type, kinds map[string]reflect.Kind, visited map[reflect.Type]bool) map[string]reflect.Kind {
+	visited[structType] = true
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		key := strings.Split(field.Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr || fieldType.Kind() == reflect.Slice {
+			fieldType = fieldType.Elem()
+		}
+
+		if fieldType.Kind() == reflect.Struct {
+			if !visited[fieldType] {
+				collectJSONKinds(fieldType, kinds, visited)
+			}
+
+			continue
+		}
+
+		if field.Type.Kind() != reflect.Slice {
+			kinds[key] = fieldType.Kind()
+		}
+	}
+
+	return kinds
+}
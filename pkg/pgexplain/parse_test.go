@@ -0,0 +1,939 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExplain(t *testing.T) {
+	expected, err := NewExplain(InputJSONParse, ExplainConfig{})
+	require.Nil(t, err)
+
+	testCases := []struct {
+		name   string
+		input  string
+		format Format
+	}{
+		{name: "json", input: InputJSONParse, format: FormatJSON},
+		{name: "text", input: InputTextParse, format: FormatText},
+		{name: "psql text", input: InputPsqlTextParse, format: FormatText},
+		{name: "yaml", input: InputYAMLParse, format: FormatYAML},
+		{name: "xml", input: InputXMLParse, format: FormatXML},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.format, DetectFormat(cleanPsqlOutput(tc.input)), tc.name)
+
+		explain, err := ParseExplain(tc.input, ExplainConfig{})
+		require.Nil(t, err, tc.name)
+
+		assert.Equal(t, expected.Plan, explain.Plan, tc.name)
+		assert.Equal(t, expected.PlanningTime, explain.PlanningTime, tc.name)
+		assert.Equal(t, expected.ExecutionTime, explain.ExecutionTime, tc.name)
+		assert.Equal(t, expected.RenderPlanText(), explain.RenderPlanText(), tc.name)
+	}
+}
+
+func TestParseTextPlanNodes(t *testing.T) {
+	input := `Update on public.orders  (cost=0.00..35.50 rows=10 width=10)
+  InitPlan 1 (returns $0)
+    ->  Result  (cost=0.00..0.01 rows=1 width=4)
+  CTE recent
+    ->  Parallel Seq Scan on "Order Items" items  (cost=0.00..1.00 rows=1 width=4)
+  ->  Nested Loop Left Join  (cost=0.00..35.50 rows=10 width=10)
+        ->  CTE Scan on recent r  (cost=0.00..0.02 rows=1 width=4)
+        ->  Bitmap Heap Scan on orders  (cost=4.20..13.67 rows=6 width=10) (never executed)
+              Recheck Cond: (id = r.id)
+              ->  Bitmap Index Scan on orders_pkey  (cost=0.00..4.20 rows=6 width=0)
+                    Index Cond: (id = r.id)
+  SubPlan 2
+    ->  Finalize HashAggregate  (cost=1.00..2.00 rows=1 width=8)
+          Group Key: a.x, (lower(a.y))
+          ->  Function Scan on pg_catalog.generate_series a  (cost=0.00..1.00 rows=1 width=8)
+Planning:
+  Buffers: shared hit=12
+Planning Time: 0.100 ms`
+
+	explain, err := ParseExplain(input, ExplainConfig{})
+	require.Nil(t, err)
+
+	root := explain.Plan
+	assert.Equal(t, NodeType("ModifyTable"), root.NodeType)
+	assert.Equal(t, "Update", root.Operation)
+	assert.Equal(t, "public", root.Schema)
+	assert.Equal(t, "orders", root.RelationName)
+	assert.Equal(t, 0.1, explain.PlanningTime)
+	require.Equal(t, 4, len(root.Plans))
+
+	initPlan := root.Plans[0]
+	assert.Equal(t, NodeType("Result"), initPlan.NodeType)
+	assert.Equal(t, "InitPlan", initPlan.ParentRelationship)
+	assert.Equal(t, "InitPlan 1 (returns $0)", initPlan.SubplanName)
+
+	cte := root.Plans[1]
+	assert.Equal(t, NodeType(SequenceScan), cte.NodeType)
+	assert.True(t, cte.ParallelAware)
+	assert.Equal(t, "Order Items", cte.RelationName)
+	assert.Equal(t, "items", cte.Alias)
+	assert.Equal(t, "CTE recent", cte.SubplanName)
+
+	join := root.Plans[2]
+	assert.Equal(t, NodeType(NestedLoop), join.NodeType)
+	assert.Equal(t, "Left", join.JoinType)
+	assert.Equal(t, "Outer", join.ParentRelationship)
+	require.Equal(t, 2, len(join.Plans))
+	assert.Equal(t, "recent", join.Plans[0].CteName)
+	assert.Equal(t, "r", join.Plans[0].Alias)
+	assert.Equal(t, "Inner", join.Plans[1].ParentRelationship)
+	assert.Equal(t, uint64(0), join.Plans[1].ActualLoops)
+	assert.Equal(t, "orders_pkey", join.Plans[1].Plans[0].IndexName)
+	assert.Equal(t, "(id = r.id)", join.Plans[1].Plans[0].IndexCondition)
+
+	subPlan := root.Plans[3]
+	assert.Equal(t, NodeType("Aggregate"), subPlan.NodeType)
+	assert.Equal(t, "Hashed", subPlan.Strategy)
+	assert.Equal(t, "SubPlan", subPlan.ParentRelationship)
+	assert.Equal(t, []string{"a.x", "(lower(a.y))"}, subPlan.GroupKey)
+	assert.Equal(t, "generate_series", subPlan.Plans[0].FunctionName)
+	assert.Equal(t, "pg_catalog", subPlan.Plans[0].Schema)
+	assert.Equal(t, "a", subPlan.Plans[0].Alias)
+}
+
+func TestParseTextPastedPlan(t *testing.T) {
+	// The first line loses its indent when a plan is pasted after a command.
+	explain, err := ParseExplain("Result  (cost=0.00..0.01 rows=1 width=4) (actual time=0.002..0.002 rows=1 loops=1)\n"+
+		" Planning Time: 0.018 ms\n Execution Time: 0.010 ms", ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.Equal(t, NodeType("Result"), explain.Plan.NodeType)
+	assert.Equal(t, 0.018, explain.PlanningTime)
+	assert.Equal(t, 0.01, explain.ExecutionTime)
+
+	explain, err = ParseExplain(strings.TrimSpace(InputPsqlTextParse), ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.Equal(t, 0.25, explain.ExecutionTime)
+	assert.Equal(t, 1, len(explain.Plan.Plans))
+}
+
+func TestCleanPlan(t *testing.T) {
+	assert.Equal(t, `[{"Plan": {"Node Type": "Result"}}]`,
+		CleanPlan("                 QUERY PLAN\n-----------------------------\n"+
+			` {"Plan": {"Node Type": "Result"}}`+"\n(1 row)\n"))
+
+	assert.Equal(t, `[{"Plan": {"Node Type": "Result"}}]`, CleanPlan(`[{"Plan": {"Node Type": "Result"}}]`))
+}
+
+func TestParseTextPlanWithoutAnalyze(t *testing.T) {
+	explain, err := ParseExplain(`Limit  (cost=0.00..0.16 rows=10 width=4)
+  ->  Nested Loop  (cost=0.00..40.00 rows=1000 width=4)
+        Join Filter: (t.i <> u.i)
+        ->  Seq Scan on t  (cost=0.00..15.50 rows=1000 width=4)
+              Filter: (i > 0)
+        ->  Seq Scan on u  (cost=0.00..1.01 rows=1 width=4)`, ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.False(t, explain.Analyzed)
+	assert.Equal(t, ` Limit  (cost=0.00..0.16 rows=10 width=4)
+   ->  Nested Loop  (cost=0.00..40.00 rows=1000 width=4)
+         Join Filter: (t.i <> u.i)
+         ->  Seq Scan on t  (cost=0.00..15.50 rows=1000 width=4)
+               Filter: (i > 0)
+         ->  Seq Scan on u  (cost=0.00..1.01 rows=1 width=4)
+`, explain.RenderPlanText())
+
+	explain, err = ParseExplain(`Limit  (cost=0.00..0.16 rows=1 width=4) (actual time=0.010..0.011 rows=0 loops=1)
+  ->  Seq Scan on t  (cost=0.00..15.50 rows=1000 width=4) (never executed)`, ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.True(t, explain.Analyzed)
+	assert.Contains(t, explain.RenderPlanText(), "Seq Scan on t  (cost=0.00..15.50 rows=1000 width=4) (never executed)")
+}
+
+func TestParseTextPlanWithoutCosts(t *testing.T) {
+	explain, err := ParseExplain("Limit\n  ->  Seq Scan on t\n        Filter: (i > 0)", ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.Equal(t, NodeType(Limit), explain.Plan.NodeType)
+	assert.Equal(t, NodeType(SequenceScan), explain.Plan.Plans[0].NodeType)
+}
+
+func TestParseExplainErrors(t *testing.T) {
+	for _, input := range []string{"hello", "select * from t", "Query Text: select 1\nselect 1"} {
+		_, err := ParseExplain(input, ExplainConfig{})
+		assert.Equal(t, ErrNoPlan, err, input)
+	}
+
+	for _, input := range []string{
+		"",
+		"Seq Scan on t\n  some garbage",
+		"<explain><Query>",
+		"- Plan: [",
+	} {
+		_, err := ParseExplain(input, ExplainConfig{})
+		assert.NotNil(t, err, input)
+	}
+}
+
+const InputJSONParse = `[
+  {
+    "Plan": {
+      "Node Type": "Limit",
+      "Parallel Aware": false,
+      "Startup Cost": 10.50,
+      "Total Cost": 10.51,
+      "Plan Rows": 1,
+      "Plan Width": 12,
+      "Actual Startup Time": 0.210,
+      "Actual Total Time": 0.212,
+      "Actual Rows": 1,
+      "Actual Loops": 1,
+      "Output": ["o.id", "u.name"],
+      "Shared Hit Blocks": 6,
+      "Shared Read Blocks": 2,
+      "Shared Dirtied Blocks": 0,
+      "Shared Written Blocks": 0,
+      "I/O Read Time": 0.050,
+      "I/O Write Time": 0.000,
+      "Plans": [
+        {
+          "Node Type": "Sort",
+          "Parent Relationship": "Outer",
+          "Parallel Aware": false,
+          "Startup Cost": 10.50,
+          "Total Cost": 10.52,
+          "Plan Rows": 5,
+          "Plan Width": 12,
+          "Actual Startup Time": 0.208,
+          "Actual Total Time": 0.209,
+          "Actual Rows": 1,
+          "Actual Loops": 1,
+          "Output": ["o.id", "u.name"],
+          "Sort Key": ["o.id DESC"],
+          "Sort Method": "top-N heapsort",
+          "Sort Space Used": 25,
+          "Sort Space Type": "Memory",
+          "Shared Hit Blocks": 6,
+          "Shared Read Blocks": 2,
+          "I/O Read Time": 0.050,
+          "I/O Write Time": 0.000,
+          "Plans": [
+            {
+              "Node Type": "Hash Join",
+              "Parent Relationship": "Outer",
+              "Parallel Aware": false,
+              "Join Type": "Inner",
+              "Startup Cost": 1.11,
+              "Total Cost": 10.45,
+              "Plan Rows": 5,
+              "Plan Width": 12,
+              "Actual Startup Time": 0.100,
+              "Actual Total Time": 0.190,
+              "Actual Rows": 4,
+              "Actual Loops": 1,
+              "Output": ["o.id", "u.name"],
+              "Inner Unique": true,
+              "Hash Cond": "(o.user_id = u.id)",
+              "Shared Hit Blocks": 6,
+              "Shared Read Blocks": 2,
+              "I/O Read Time": 0.050,
+              "I/O Write Time": 0.000,
+              "Plans": [
+                {
+                  "Node Type": "Index Scan",
+                  "Parent Relationship": "Outer",
+                  "Parallel Aware": false,
+                  "Scan Direction": "Backward",
+                  "Index Name": "orders_pkey",
+                  "Relation Name": "orders",
+                  "Schema": "public",
+                  "Alias": "o",
+                  "Startup Cost": 0.15,
+                  "Total Cost": 9.20,
+                  "Plan Rows": 50,
+                  "Plan Width": 8,
+                  "Actual Startup Time": 0.020,
+                  "Actual Total Time": 0.150,
+                  "Actual Rows": 50,
+                  "Actual Loops": 1,
+                  "Output": ["o.id", "o.user_id"],
+                  "Index Cond": "(o.id > 10)",
+                  "Rows Removed by Index Recheck": 0,
+                  "Shared Hit Blocks": 5,
+                  "Shared Read Blocks": 2,
+                  "I/O Read Time": 0.050,
+                  "I/O Write Time": 0.000
+                },
+                {
+                  "Node Type": "Hash",
+                  "Parent Relationship": "Inner",
+                  "Parallel Aware": false,
+                  "Startup Cost": 1.05,
+                  "Total Cost": 1.05,
+                  "Plan Rows": 5,
+                  "Plan Width": 8,
+                  "Actual Startup Time": 0.015,
+                  "Actual Total Time": 0.015,
+                  "Actual Rows": 4,
+                  "Actual Loops": 1,
+                  "Output": ["u.name", "u.id"],
+                  "Hash Buckets": 1024,
+                  "Original Hash Buckets": 1024,
+                  "Hash Batches": 1,
+                  "Original Hash Batches": 1,
+                  "Peak Memory Usage": 9,
+                  "Shared Hit Blocks": 1,
+                  "Plans": [
+                    {
+                      "Node Type": "Seq Scan",
+                      "Parent Relationship": "Outer",
+                      "Parallel Aware": false,
+                      "Relation Name": "users",
+                      "Schema": "public",
+                      "Alias": "u",
+                      "Startup Cost": 0.00,
+                      "Total Cost": 1.05,
+                      "Plan Rows": 5,
+                      "Plan Width": 8,
+                      "Actual Startup Time": 0.005,
+                      "Actual Total Time": 0.008,
+                      "Actual Rows": 4,
+                      "Actual Loops": 1,
+                      "Output": ["u.name", "u.id"],
+                      "Filter": "u.active",
+                      "Rows Removed by Filter": 1,
+                      "Shared Hit Blocks": 1
+                    }
+                  ]
+                }
+              ]
+            }
+          ]
+        }
+      ]
+    },
+    "Planning Time": 0.120,
+    "Triggers": [],
+    "Execution Time": 0.250
+  }
+]`
+
+const InputTextParse = `Limit  (cost=10.50..10.51 rows=1 width=12) (actual time=0.210..0.212 rows=1 loops=1)
+  Output: o.id, u.name
+  Buffers: shared hit=6 read=2
+  I/O Timings: read=0.050
+  ->  Sort  (cost=10.50..10.52 rows=5 width=12) (actual time=0.208..0.209 rows=1 loops=1)
+        Output: o.id, u.name
+        Sort Key: o.id DESC
+        Sort Method: top-N heapsort  Memory: 25kB
+        Buffers: shared hit=6 read=2
+        I/O Timings: read=0.050
+        ->  Hash Join  (cost=1.11..10.45 rows=5 width=12) (actual time=0.100..0.190 rows=4 loops=1)
+              Output: o.id, u.name
+              Inner Unique: true
+              Hash Cond: (o.user_id = u.id)
+              Buffers: shared hit=6 read=2
+              I/O Timings: read=0.050
+              ->  Index Scan Backward using orders_pkey on public.orders o  (cost=0.15..9.20 rows=50 width=8) (actual time=0.020..0.150 rows=50 loops=1)
+                    Output: o.id, o.user_id
+                    Index Cond: (o.id > 10)
+                    Buffers: shared hit=5 read=2
+                    I/O Timings: read=0.050
+              ->  Hash  (cost=1.05..1.05 rows=5 width=8) (actual time=0.015..0.015 rows=4 loops=1)
+                    Output: u.name, u.id
+                    Buckets: 1024  Batches: 1  Memory Usage: 9kB
+                    Buffers: shared hit=1
+                    ->  Seq Scan on public.users u  (cost=0.00..1.05 rows=5 width=8) (actual time=0.005..0.008 rows=4 loops=1)
+                          Output: u.name, u.id
+                          Filter: u.active
+                          Rows Removed by Filter: 1
+                          Buffers: shared hit=1
+Planning Time: 0.120 ms
+Execution Time: 0.250 ms`
+
+const InputPsqlTextParse = `                                                              QUERY PLAN
+--------------------------------------------------------------------------------------------------------------------------------------
+ Limit  (cost=10.50..10.51 rows=1 width=12) (actual time=0.210..0.212 rows=1 loops=1)
+   Output: o.id, u.name
+   Buffers: shared hit=6 read=2
+   I/O Timings: read=0.050
+   ->  Sort  (cost=10.50..10.52 rows=5 width=12) (actual time=0.208..0.209 rows=1 loops=1)
+         Output: o.id, u.name
+         Sort Key: o.id DESC
+         Sort Method: top-N heapsort  Memory: 25kB
+         Buffers: shared hit=6 read=2
+         I/O Timings: read=0.050
+         ->  Hash Join  (cost=1.11..10.45 rows=5 width=12) (actual time=0.100..0.190 rows=4 loops=1)
+               Output: o.id, u.name
+               Inner Unique: true
+               Hash Cond: (o.user_id = u.id)
+               Buffers: shared hit=6 read=2
+               I/O Timings: read=0.050
+               ->  Index Scan Backward using orders_pkey on public.orders o  (cost=0.15..9.20 rows=50 width=8) (actual time=0.020..0.150 rows=50 loops=1)
+                     Output: o.id, o.user_id
+                     Index Cond: (o.id > 10)
+                     Buffers: shared hit=5 read=2
+                     I/O Timings: read=0.050
+               ->  Hash  (cost=1.05..1.05 rows=5 width=8) (actual time=0.015..0.015 rows=4 loops=1)
+                     Output: u.name, u.id
+                     Buckets: 1024  Batches: 1  Memory Usage: 9kB
+                     Buffers: shared hit=1
+                     ->  Seq Scan on public.users u  (cost=0.00..1.05 rows=5 width=8) (actual time=0.005..0.008 rows=4 loops=1)
+                           Output: u.name, u.id
+                           Filter: u.active
+                           Rows Removed by Filter: 1
+                           Buffers: shared hit=1
+ Planning Time: 0.120 ms
+ Execution Time: 0.250 ms
+(32 rows)
+`
+
+const InputYAMLParse = `- Plan:
+    Node Type: "Limit"
+    Parallel Aware: false
+    Startup Cost: 10.50
+    Total Cost: 10.51
+    Plan Rows: 1
+    Plan Width: 12
+    Actual Startup Time: 0.210
+    Actual Total Time: 0.212
+    Actual Rows: 1
+    Actual Loops: 1
+    Output:
+      - "o.id"
+      - "u.name"
+    Shared Hit Blocks: 6
+    Shared Read Blocks: 2
+    I/O Read Time: 0.050
+    I/O Write Time: 0.000
+    Plans:
+      - Node Type: "Sort"
+        Parent Relationship: "Outer"
+        Parallel Aware: false
+        Startup Cost: 10.50
+        Total Cost: 10.52
+        Plan Rows: 5
+        Plan Width: 12
+        Actual Startup Time: 0.208
+        Actual Total Time: 0.209
+        Actual Rows: 1
+        Actual Loops: 1
+        Output:
+          - "o.id"
+          - "u.name"
+        Sort Key:
+          - "o.id DESC"
+        Sort Method: "top-N heapsort"
+        Sort Space Used: 25
+        Sort Space Type: "Memory"
+        Shared Hit Blocks: 6
+        Shared Read Blocks: 2
+        I/O Read Time: 0.050
+        I/O Write Time: 0.000
+        Plans:
+          - Node Type: "Hash Join"
+            Parent Relationship: "Outer"
+            Parallel Aware: false
+            Join Type: "Inner"
+            Startup Cost: 1.11
+            Total Cost: 10.45
+            Plan Rows: 5
+            Plan Width: 12
+            Actual Startup Time: 0.100
+            Actual Total Time: 0.190
+            Actual Rows: 4
+            Actual Loops: 1
+            Output:
+              - "o.id"
+              - "u.name"
+            Inner Unique: true
+            Hash Cond: "(o.user_id = u.id)"
+            Shared Hit Blocks: 6
+            Shared Read Blocks: 2
+            I/O Read Time: 0.050
+            I/O Write Time: 0.000
+            Plans:
+              - Node Type: "Index Scan"
+                Parent Relationship: "Outer"
+                Parallel Aware: false
+                Scan Direction: "Backward"
+                Index Name: "orders_pkey"
+                Relation Name: "orders"
+                Schema: "public"
+                Alias: "o"
+                Startup Cost: 0.15
+                Total Cost: 9.20
+                Plan Rows: 50
+                Plan Width: 8
+                Actual Startup Time: 0.020
+                Actual Total Time: 0.150
+                Actual Rows: 50
+                Actual Loops: 1
+                Output:
+                  - "o.id"
+                  - "o.user_id"
+                Index Cond: "(o.id > 10)"
+                Rows Removed by Index Recheck: 0
+                Shared Hit Blocks: 5
+                Shared Read Blocks: 2
+                I/O Read Time: 0.050
+                I/O Write Time: 0.000
+              - Node Type: "Hash"
+                Parent Relationship: "Inner"
+                Parallel Aware: false
+                Startup Cost: 1.05
+                Total Cost: 1.05
+                Plan Rows: 5
+                Plan Width: 8
+                Actual Startup Time: 0.015
+                Actual Total Time: 0.015
+                Actual Rows: 4
+                Actual Loops: 1
+                Output:
+                  - "u.name"
+                  - "u.id"
+                Hash Buckets: 1024
+                Original Hash Buckets: 1024
+                Hash Batches: 1
+                Original Hash Batches: 1
+                Peak Memory Usage: 9
+                Shared Hit Blocks: 1
+                Plans:
+                  - Node Type: "Seq Scan"
+                    Parent Relationship: "Outer"
+                    Parallel Aware: false
+                    Relation Name: "users"
+                    Schema: "public"
+                    Alias: "u"
+                    Startup Cost: 0.00
+                    Total Cost: 1.05
+                    Plan Rows: 5
+                    Plan Width: 8
+                    Actual Startup Time: 0.005
+                    Actual Total Time: 0.008
+                    Actual Rows: 4
+                    Actual Loops: 1
+                    Output:
+                      - "u.name"
+                      - "u.id"
+                    Filter: "u.active"
+                    Rows Removed by Filter: 1
+                    Shared Hit Blocks: 1
+  Planning Time: 0.120
+  Triggers:
+  Execution Time: 0.250`
+
+const InputXMLParse = `<explain xmlns="http://www.postgresql.org/2009/explain">
+  <Query>
+    <Plan>
+      <Node-Type>Limit</Node-Type>
+      <Parallel-Aware>false</Parallel-Aware>
+      <Startup-Cost>10.50</Startup-Cost>
+      <Total-Cost>10.51</Total-Cost>
+      <Plan-Rows>1</Plan-Rows>
+      <Plan-Width>12</Plan-Width>
+      <Actual-Startup-Time>0.210</Actual-Startup-Time>
+      <Actual-Total-Time>0.212</Actual-Total-Time>
+      <Actual-Rows>1</Actual-Rows>
+      <Actual-Loops>1</Actual-Loops>
+      <Output>
+        <Item>o.id</Item>
+        <Item>u.name</Item>
+      </Output>
+      <Shared-Hit-Blocks>6</Shared-Hit-Blocks>
+      <Shared-Read-Blocks>2</Shared-Read-Blocks>
+      <I-O-Read-Time>0.050</I-O-Read-Time>
+      <I-O-Write-Time>0.000</I-O-Write-Time>
+      <Plans>
+        <Plan>
+          <Node-Type>Sort</Node-Type>
+          <Parent-Relationship>Outer</Parent-Relationship>
+          <Parallel-Aware>false</Parallel-Aware>
+          <Startup-Cost>10.50</Startup-Cost>
+          <Total-Cost>10.52</Total-Cost>
+          <Plan-Rows>5</Plan-Rows>
+          <Plan-Width>12</Plan-Width>
+          <Actual-Startup-Time>0.208</Actual-Startup-Time>
+          <Actual-Total-Time>0.209</Actual-Total-Time>
+          <Actual-Rows>1</Actual-Rows>
+          <Actual-Loops>1</Actual-Loops>
+          <Output>
+            <Item>o.id</Item>
+            <Item>u.name</Item>
+          </Output>
+          <Sort-Key>
+            <Item>o.id DESC</Item>
+          </Sort-Key>
+          <Sort-Method>top-N heapsort</Sort-Method>
+          <Sort-Space-Used>25</Sort-Space-Used>
+          <Sort-Space-Type>Memory</Sort-Space-Type>
+          <Shared-Hit-Blocks>6</Shared-Hit-Blocks>
+          <Shared-Read-Blocks>2</Shared-Read-Blocks>
+          <I-O-Read-Time>0.050</I-O-Read-Time>
+          <I-O-Write-Time>0.000</I-O-Write-Time>
+          <Plans>
+            <Plan>
+              <Node-Type>Hash Join</Node-Type>
+              <Parent-Relationship>Outer</Parent-Relationship>
+              <Parallel-Aware>false</Parallel-Aware>
+              <Join-Type>Inner</Join-Type>
+              <Startup-Cost>1.11</Startup-Cost>
+              <Total-Cost>10.45</Total-Cost>
+              <Plan-Rows>5</Plan-Rows>
+              <Plan-Width>12</Plan-Width>
+              <Actual-Startup-Time>0.100</Actual-Startup-Time>
+              <Actual-Total-Time>0.190</Actual-Total-Time>
+              <Actual-Rows>4</Actual-Rows>
+              <Actual-Loops>1</Actual-Loops>
+              <Output>
+                <Item>o.id</Item>
+                <Item>u.name</Item>
+              </Output>
+              <Inner-Unique>true</Inner-Unique>
+              <Hash-Cond>(o.user_id = u.id)</Hash-Cond>
+              <Shared-Hit-Blocks>6</Shared-Hit-Blocks>
+              <Shared-Read-Blocks>2</Shared-Read-Blocks>
+              <I-O-Read-Time>0.050</I-O-Read-Time>
+              <I-O-Write-Time>0.000</I-O-Write-Time>
+              <Plans>
+                <Plan>
+                  <Node-Type>Index Scan</Node-Type>
+                  <Parent-Relationship>Outer</Parent-Relationship>
+                  <Parallel-Aware>false</Parallel-Aware>
+                  <Scan-Direction>Backward</Scan-Direction>
+                  <Index-Name>orders_pkey</Index-Name>
+                  <Relation-Name>orders</Relation-Name>
+                  <Schema>public</Schema>
+                  <Alias>o</Alias>
+                  <Startup-Cost>0.15</Startup-Cost>
+                  <Total-Cost>9.20</Total-Cost>
+                  <Plan-Rows>50</Plan-Rows>
+                  <Plan-Width>8</Plan-Width>
+                  <Actual-Startup-Time>0.020</Actual-Startup-Time>
+                  <Actual-Total-Time>0.150</Actual-Total-Time>
+                  <Actual-Rows>50</Actual-Rows>
+                  <Actual-Loops>1</Actual-Loops>
+                  <Output>
+                    <Item>o.id</Item>
+                    <Item>o.user_id</Item>
+                  </Output>
+                  <Index-Cond>(o.id &gt; 10)</Index-Cond>
+                  <Rows-Removed-by-Index-Recheck>0</Rows-Removed-by-Index-Recheck>
+                  <Shared-Hit-Blocks>5</Shared-Hit-Blocks>
+                  <Shared-Read-Blocks>2</Shared-Read-Blocks>
+                  <I-O-Read-Time>0.050</I-O-Read-Time>
+                  <I-O-Write-Time>0.000</I-O-Write-Time>
+                </Plan>
+                <Plan>
+                  <Node-Type>Hash</Node-Type>
+                  <Parent-Relationship>Inner</Parent-Relationship>
+                  <Parallel-Aware>false</Parallel-Aware>
+                  <Startup-Cost>1.05</Startup-Cost>
+                  <Total-Cost>1.05</Total-Cost>
+                  <Plan-Rows>5</Plan-Rows>
+                  <Plan-Width>8</Plan-Width>
+                  <Actual-Startup-Time>0.015</Actual-Startup-Time>
+                  <Actual-Total-Time>0.015</Actual-Total-Time>
+                  <Actual-Rows>4</Actual-Rows>
+                  <Actual-Loops>1</Actual-Loops>
+                  <Output>
+                    <Item>u.name</Item>
+                    <Item>u.id</Item>
+                  </Output>
+                  <Hash-Buckets>1024</Hash-Buckets>
+                  <Original-Hash-Buckets>1024</Original-Hash-Buckets>
+                  <Hash-Batches>1</Hash-Batches>
+                  <Original-Hash-Batches>1</Original-Hash-Batches>
+                  <Peak-Memory-Usage>9</Peak-Memory-Usage>
+                  <Shared-Hit-Blocks>1</Shared-Hit-Blocks>
+                  <Plans>
+                    <Plan>
+                      <Node-Type>Seq Scan</Node-Type>
+                      <Parent-Relationship>Outer</Parent-Relationship>
+                      <Parallel-Aware>false</Parallel-Aware>
+                      <Relation-Name>users</Relation-Name>
+                      <Schema>public</Schema>
+                      <Alias>u</Alias>
+                      <Startup-Cost>0.00</Startup-Cost>
+                      <Total-Cost>1.05</Total-Cost>
+                      <Plan-Rows>5</Plan-Rows>
+                      <Plan-Width>8</Plan-Width>
+                      <Actual-Startup-Time>0.005</Actual-Startup-Time>
+                      <Actual-Total-Time>0.008</Actual-Total-Time>
+                      <Actual-Rows>4</Actual-Rows>
+                      <Actual-Loops>1</Actual-Loops>
+                      <Output>
+                        <Item>u.name</Item>
+                        <Item>u.id</Item>
+                      </Output>
+                      <Filter>u.active</Filter>
+                      <Rows-Removed-by-Filter>1</Rows-Removed-by-Filter>
+                      <Shared-Hit-Blocks>1</Shared-Hit-Blocks>
+                    </Plan>
+                  </Plans>
+                </Plan>
+              </Plans>
+            </Plan>
+          </Plans>
+        </Plan>
+      </Plans>
+    </Plan>
+    <Planning-Time>0.120</Planning-Time>
+    <Triggers>
+    </Triggers>
+    <Execution-Time>0.250</Execution-Time>
+  </Query>
+</explain>`
+
+func TestParseModernPlan(t *testing.T) {
+	expected, err := NewExplain(InputJSON8Modern, ExplainConfig{})
+	require.Nil(t, err)
+
+	for _, input := range []string{InputText8Modern, InputXML8Modern} {
+		explain, err := ParseExplain(input, ExplainConfig{})
+		require.Nil(t, err)
+
+		assert.Equal(t, expected.RenderPlanText(), explain.RenderPlanText())
+		assert.Equal(t, expected.RenderStats(), explain.RenderStats())
+		assert.Equal(t, expected.Planning, explain.Planning)
+		assert.Equal(t, expected.JIT, explain.JIT)
+	}
+}
+
+func TestRenderStatsModern(t *testing.T) {
+	explain, err := NewExplain(InputJSON8Modern, ExplainConfig{})
+	require.Nil(t, err)
+
+	stats := explain.RenderStats()
+
+	assert.Contains(t, stats, "\nPlanning buffers:\n  - hits: 24 (~192.00 KiB)\n  - reads: 3 (~24.00 KiB)\n")
+	assert.Contains(t, stats, "\nWAL:\n  - records: 3\n  - full page images: 1\n  - bytes: 8402 (~8.20 KiB)\n")
+	assert.Contains(t, stats, "\nJIT:\n  - functions: 12\n")
+	assert.Contains(t, stats, "  - options: inlining false, optimization false, expressions true, deforming true\n")
+	assert.Contains(t, stats, "  - time: 4.423 ms\n    - generation: 1.012 ms\n")
+}
+
+const InputText8Modern = `Gather Merge  (cost=1062.93..1180.02 rows=1000 width=16) (actual time=4.913..6.211 rows=1000 loops=1)
+  Workers Planned: 2
+  Workers Launched: 2
+  Buffers: shared hit=2120 read=5
+  WAL: records=3 fpi=1 bytes=8402
+  ->  Incremental Sort  (cost=62.91..164.49 rows=417 width=16) (actual time=0.832..1.624 rows=333 loops=3)
+        Sort Key: t.a, t.b
+        Presorted Key: t.a
+        Full-sort Groups: 11  Sort Method: quicksort  Average Memory: 26kB  Peak Memory: 26kB
+        Pre-sorted Groups: 2  Sort Methods: top-N heapsort, quicksort  Average Memory: 30kB  Peak Memory: 31kB
+        Buffers: shared hit=2120 read=5
+        WAL: records=3 fpi=1 bytes=8402
+        ->  Nested Loop  (cost=0.57..150.23 rows=417 width=16) (actual time=0.041..1.302 rows=333 loops=3)
+              Buffers: shared hit=2120 read=5
+              WAL: records=3 fpi=1 bytes=8402
+              ->  Parallel Index Scan using t_a_idx on t  (cost=0.28..48.34 rows=417 width=12) (actual time=0.018..0.311 rows=333 loops=3)
+                    Buffers: shared hit=1110 read=5
+                    WAL: records=3 fpi=1 bytes=8402
+              ->  Memoize  (cost=0.29..0.31 rows=1 width=8) (actual time=0.001..0.001 rows=1 loops=1000)
+                    Cache Key: t.c
+                    Cache Mode: logical
+                    Hits: 990  Misses: 10  Evictions: 0  Overflows: 0  Memory Usage: 2kB
+                    Buffers: shared hit=1010
+                    ->  Tid Range Scan on u  (cost=0.01..0.28 rows=1 width=8) (actual time=0.009..0.010 rows=1 loops=10)
+                          TID Cond: ((u.ctid >= '(0,1)'::tid) AND (u.ctid < '(10,1)'::tid))
+                          Filter: (u.id = t.c)
+                          Rows Removed by Filter: 0
+                          Buffers: shared hit=1010
+Planning:
+  Buffers: shared hit=24 read=3
+Planning Time: 0.452 ms
+JIT:
+  Functions: 12
+  Options: Inlining false, Optimization false, Expressions true, Deforming true
+  Timing: Generation 1.012 ms (Deform 0.210 ms), Inlining 0.000 ms, Optimization 0.541 ms, Emission 2.870 ms, Total 4.423 ms
+Execution Time: 11.504 ms`
+
+const InputXML8Modern = `<explain xmlns="http://www.postgresql.org/2009/explain">
+  <Query>
+    <Plan>
+      <Node-Type>Gather Merge</Node-Type>
+      <Startup-Cost>1062.93</Startup-Cost>
+      <Total-Cost>1180.02</Total-Cost>
+      <Plan-Rows>1000</Plan-Rows>
+      <Plan-Width>16</Plan-Width>
+      <Actual-Startup-Time>4.913</Actual-Startup-Time>
+      <Actual-Total-Time>6.211</Actual-Total-Time>
+      <Actual-Rows>1000</Actual-Rows>
+      <Actual-Loops>1</Actual-Loops>
+      <Workers-Planned>2</Workers-Planned>
+      <Workers-Launched>2</Workers-Launched>
+      <Shared-Hit-Blocks>2120</Shared-Hit-Blocks>
+      <Shared-Read-Blocks>5</Shared-Read-Blocks>
+      <WAL-Records>3</WAL-Records>
+      <WAL-FPI>1</WAL-FPI>
+      <WAL-Bytes>8402</WAL-Bytes>
+      <Plans>
+        <Plan>
+          <Node-Type>Incremental Sort</Node-Type>
+          <Parent-Relationship>Outer</Parent-Relationship>
+          <Startup-Cost>62.91</Startup-Cost>
+          <Total-Cost>164.49</Total-Cost>
+          <Plan-Rows>417</Plan-Rows>
+          <Plan-Width>16</Plan-Width>
+          <Actual-Startup-Time>0.832</Actual-Startup-Time>
+          <Actual-Total-Time>1.624</Actual-Total-Time>
+          <Actual-Rows>333</Actual-Rows>
+          <Actual-Loops>3</Actual-Loops>
+          <Sort-Key>
+            <Item>t.a</Item>
+            <Item>t.b</Item>
+          </Sort-Key>
+          <Presorted-Key>
+            <Item>t.a</Item>
+          </Presorted-Key>
+          <Full-sort-Groups>
+            <Group-Count>11</Group-Count>
+            <Sort-Methods-Used>
+              <Item>quicksort</Item>
+            </Sort-Methods-Used>
+            <Sort-Space-Memory>
+              <Average-Sort-Space-Used>26</Average-Sort-Space-Used>
+              <Peak-Sort-Space-Used>26</Peak-Sort-Space-Used>
+            </Sort-Space-Memory>
+          </Full-sort-Groups>
+          <Pre-sorted-Groups>
+            <Group-Count>2</Group-Count>
+            <Sort-Methods-Used>
+              <Item>top-N heapsort</Item>
+              <Item>quicksort</Item>
+            </Sort-Methods-Used>
+            <Sort-Space-Memory>
+              <Average-Sort-Space-Used>30</Average-Sort-Space-Used>
+              <Peak-Sort-Space-Used>31</Peak-Sort-Space-Used>
+            </Sort-Space-Memory>
+          </Pre-sorted-Groups>
+          <Shared-Hit-Blocks>2120</Shared-Hit-Blocks>
+          <Shared-Read-Blocks>5</Shared-Read-Blocks>
+          <WAL-Records>3</WAL-Records>
+          <WAL-FPI>1</WAL-FPI>
+          <WAL-Bytes>8402</WAL-Bytes>
+          <Plans>
+            <Plan>
+              <Node-Type>Nested Loop</Node-Type>
+              <Parent-Relationship>Outer</Parent-Relationship>
+              <Join-Type>Inner</Join-Type>
+              <Startup-Cost>0.57</Startup-Cost>
+              <Total-Cost>150.23</Total-Cost>
+              <Plan-Rows>417</Plan-Rows>
+              <Plan-Width>16</Plan-Width>
+              <Actual-Startup-Time>0.041</Actual-Startup-Time>
+              <Actual-Total-Time>1.302</Actual-Total-Time>
+              <Actual-Rows>333</Actual-Rows>
+              <Actual-Loops>3</Actual-Loops>
+              <Shared-Hit-Blocks>2120</Shared-Hit-Blocks>
+              <Shared-Read-Blocks>5</Shared-Read-Blocks>
+              <WAL-Records>3</WAL-Records>
+              <WAL-FPI>1</WAL-FPI>
+              <WAL-Bytes>8402</WAL-Bytes>
+              <Plans>
+                <Plan>
+                  <Node-Type>Index Scan</Node-Type>
+                  <Parent-Relationship>Outer</Parent-Relationship>
+                  <Parallel-Aware>true</Parallel-Aware>
+                  <Scan-Direction>Forward</Scan-Direction>
+                  <Index-Name>t_a_idx</Index-Name>
+                  <Relation-Name>t</Relation-Name>
+                  <Alias>t</Alias>
+                  <Startup-Cost>0.28</Startup-Cost>
+                  <Total-Cost>48.34</Total-Cost>
+                  <Plan-Rows>417</Plan-Rows>
+                  <Plan-Width>12</Plan-Width>
+                  <Actual-Startup-Time>0.018</Actual-Startup-Time>
+                  <Actual-Total-Time>0.311</Actual-Total-Time>
+                  <Actual-Rows>333</Actual-Rows>
+                  <Actual-Loops>3</Actual-Loops>
+                  <Shared-Hit-Blocks>1110</Shared-Hit-Blocks>
+                  <Shared-Read-Blocks>5</Shared-Read-Blocks>
+                  <WAL-Records>3</WAL-Records>
+                  <WAL-FPI>1</WAL-FPI>
+                  <WAL-Bytes>8402</WAL-Bytes>
+                </Plan>
+                <Plan>
+                  <Node-Type>Memoize</Node-Type>
+                  <Parent-Relationship>Inner</Parent-Relationship>
+                  <Startup-Cost>0.29</Startup-Cost>
+                  <Total-Cost>0.31</Total-Cost>
+                  <Plan-Rows>1</Plan-Rows>
+                  <Plan-Width>8</Plan-Width>
+                  <Actual-Startup-Time>0.001</Actual-Startup-Time>
+                  <Actual-Total-Time>0.001</Actual-Total-Time>
+                  <Actual-Rows>1</Actual-Rows>
+                  <Actual-Loops>1000</Actual-Loops>
+                  <Cache-Key>t.c</Cache-Key>
+                  <Cache-Mode>logical</Cache-Mode>
+                  <Cache-Hits>990</Cache-Hits>
+                  <Cache-Misses>10</Cache-Misses>
+                  <Cache-Evictions>0</Cache-Evictions>
+                  <Cache-Overflows>0</Cache-Overflows>
+                  <Peak-Memory-Usage>2</Peak-Memory-Usage>
+                  <Shared-Hit-Blocks>1010</Shared-Hit-Blocks>
+                  <Plans>
+                    <Plan>
+                      <Node-Type>Tid Range Scan</Node-Type>
+                      <Parent-Relationship>Outer</Parent-Relationship>
+                      <Relation-Name>u</Relation-Name>
+                      <Alias>u</Alias>
+                      <Startup-Cost>0.01</Startup-Cost>
+                      <Total-Cost>0.28</Total-Cost>
+                      <Plan-Rows>1</Plan-Rows>
+                      <Plan-Width>8</Plan-Width>
+                      <Actual-Startup-Time>0.009</Actual-Startup-Time>
+                      <Actual-Total-Time>0.010</Actual-Total-Time>
+                      <Actual-Rows>1</Actual-Rows>
+                      <Actual-Loops>10</Actual-Loops>
+                      <TID-Cond>((u.ctid &gt;= '(0,1)'::tid) AND (u.ctid &lt; '(10,1)'::tid))</TID-Cond>
+                      <Filter>(u.id = t.c)</Filter>
+                      <Rows-Removed-by-Filter>0</Rows-Removed-by-Filter>
+                      <Shared-Hit-Blocks>1010</Shared-Hit-Blocks>
+                    </Plan>
+                  </Plans>
+                </Plan>
+              </Plans>
+            </Plan>
+          </Plans>
+        </Plan>
+      </Plans>
+    </Plan>
+    <Planning>
+      <Shared-Hit-Blocks>24</Shared-Hit-Blocks>
+      <Shared-Read-Blocks>3</Shared-Read-Blocks>
+    </Planning>
+    <Planning-Time>0.452</Planning-Time>
+    <Triggers>
+    </Triggers>
+    <JIT>
+      <Functions>12</Functions>
+      <Options>
+        <Inlining>false</Inlining>
+        <Optimization>false</Optimization>
+        <Expressions>true</Expressions>
+        <Deforming>true</Deforming>
+      </Options>
+      <Timing>
+        <Generation>
+          <Deform>0.210</Deform>
+          <Total>1.012</Total>
+        </Generation>
+        <Inlining>0.000</Inlining>
+        <Optimization>0.541</Optimization>
+        <Emission>2.870</Emission>
+        <Total>4.423</Total>
+      </Timing>
+    </JIT>
+    <Execution-Time>11.504</Execution-Time>
+  </Query>
+</explain>`
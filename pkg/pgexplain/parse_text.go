@@ -0,0 +1,723 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	textPropertyRe     = regexp.MustCompile(`^([A-Za-z][\w /-]*?):(?:\s+(.*))?$`)
+	textNodeStatsRe    = regexp.MustCompile(`\s+\((cost=|actual |never executed)`)
+	textCostRe         = regexp.MustCompile(`\(cost=([\d.]+)\.\.([\d.]+) rows=(\d+) width=(\d+)\)`)
+	textActualRe       = regexp.MustCompile(`\(actual(?: time=([\d.]+)\.\.([\d.]+))? rows=([\d.]+) loops=(\d+)\)`)
+	textSubplanRe      = regexp.MustCompile(`^(InitPlan|SubPlan|CTE) \S.*$`)
+	textWorkerRe       = regexp.MustCompile(`^Worker (\d+):\s*(.*)$`)
+	textWorkerActualRe = regexp.MustCompile(`^actual(?: time=([\d.]+)\.\.([\d.]+))? rows=([\d.]+) loops=(\d+)$`)
+	textJoinRe         = regexp.MustCompile(`^(Hash|Merge|Nested Loop)(?: (Left|Right|Full|Semi|Anti|Right Semi|Right Anti))?( Join)?$`)
+	textCustomRe       = regexp.MustCompile(`^Custom Scan \((.+)\)$`)
+	textBlocksRe       = regexp.MustCompile(`(hit|read|dirtied|written)=(\d+)`)
+	textIOTimingRe     = regexp.MustCompile(`(read|write)=([\d.]+)`)
+	textHashRe         = regexp.MustCompile(`(Buckets|Batches): (\d+)(?: \(originally (\d+)\))?`)
+	textMemoryRe       = regexp.MustCompile(`Memory Usage: (\d+)kB`)
+	textCacheRe        = regexp.MustCompile(`(Hits|Misses|Evictions|Overflows): (\d+)`)
+	textWALRe          = regexp.MustCompile(`(records|fpi|bytes)=(\d+)`)
+	textGroupsRe       = regexp.MustCompile(`^(\d+)\s+Sort Methods?: (.+?)(?:\s{2}|$)`)
+	textGroupSpace     = regexp.MustCompile(`(Average|Peak) (Memory|Disk): (\d+)kB`)
+	textJITOptionRe    = regexp.MustCompile(`(\w+) (true|false)`)
+	textJITTimingRe    = regexp.MustCompile(`(\w+) ([\d.]+) ms`)
+	textParenthesesRe  = regexp.MustCompile(`\([^)]*\)`)
+)
+
+var textAggregateStrategies = map[string]string{
+	"Aggregate":      "Plain",
+	"HashAggregate":  "Hashed",
+	"GroupAggregate": "Sorted",
+	"MixedAggregate": "Mixed",
+}
+
+var textExplainProperties = map[string]bool{
+	"planning":       true,
+	"planning time":  true,
+	"execution time": true,
+	"total runtime":  true,
+	"jit":            true,
+	"settings":       true,
+}
+
+// textNodeTypes contains node types of plans printed with COSTS OFF, their nodes have no stats.
+var textNodeTypes = map[string]bool{
+	"Result": true, "ProjectSet": true, "ModifyTable": true, "Append": true, "Merge Append": true,
+	"Recursive Union": true, "BitmapAnd": true, "BitmapOr": true, "Nested Loop": true, "Merge Join": true,
+	"Hash Join": true, "Seq Scan": true, "Sample Scan": true, "Gather": true, "Gather Merge": true,
+	"Index Scan": true, "Index Only Scan": true, "Bitmap Index Scan": true, "Bitmap Heap Scan": true,
+	"Tid Scan": true, "Tid Range Scan": true, "Subquery Scan": true, "Function Scan": true,
+	"Table Function Scan": true, "Values Scan": true, "CTE Scan": true, "Named Tuplestore Scan": true,
+	"WorkTable Scan": true, "Foreign Scan": true, "Custom Scan": true, "Materialize": true, "Memoize": true,
+	"Sort": true, "Incremental Sort": true, "Group": true, "Aggregate": true, "WindowAgg": true, "Unique": true,
+	"SetOp": true, "HashSetOp": true, "LockRows": true, "Limit": true, "Hash": true,
+}
+
+var textListProperties = map[string]bool{
+	"Output":        true,
+	"Sort Key":      true,
+	"Group Key":     true,
+	"Presorted Key": true,
+}
+
+type textNode struct {
+	indent int
+	plan   map[string]interface{}
+}
+
+// textParser builds the JSON-like plan structure from TEXT EXPLAIN output.
+type textParser struct {
+	explain  map[string]interface{}
+	root     map[string]interface{}
+	stack    []textNode
+	treeDone bool
+
+	// innerIndent defines the indent of root node details. Less indented lines are explain-level properties.
+	// The root line itself is not used as it may lose its indent when a plan is pasted after a command.
+	innerIndent int
+
+	// section contains explain-level properties with nested lines, e.g. "Planning:".
+	section       map[string]interface{}
+	sectionIndent int
+
+	// subplan defines the name of the next subplan node, e.g. "InitPlan 1 (returns $0)".
+	subplan string
+
+	// worker contains stats of a parallel worker of the current node, more indented lines belong to it.
+	worker       map[string]interface{}
+	workerIndent int
+}
+
+func parseText(input string) ([]interface{}, error) {
+	p := &textParser{explain: map[string]interface{}{}}
+
+	for _, line := range strings.Split(input, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if err := p.parseLine(line); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.root == nil {
+		return nil, ErrNoPlan
+	}
+
+	setParentRelationships(p.root)
+	p.explain["Plan"] = p.root
+
+	return []interface{}{p.explain}, nil
+}
+
+func (p *textParser) parseLine(line string) error {
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	content := strings.TrimSpace(line)
+
+	if p.root == nil {
+		// Skip a preamble, e.g. auto_explain's "Query Text: ...".
+		if textPropertyRe.MatchString(content) {
+			return nil
+		}
+
+		if !isTextPlanNode(content) {
+			return ErrNoPlan
+		}
+
+		p.root = p.addNode(content, -1)
+		p.innerIndent = -1
+
+		return nil
+	}
+
+	if p.innerIndent < 0 {
+		p.innerIndent = indent
+	}
+
+	if !p.treeDone && (indent < p.innerIndent || isTextExplainProperty(content)) {
+		p.treeDone = true
+	}
+
+	if p.treeDone {
+		p.parseExplainProperty(content, indent)
+		return nil
+	}
+
+	if p.worker != nil {
+		if indent > p.workerIndent {
+			if match := textPropertyRe.FindStringSubmatch(content); match != nil {
+				setTextProperty(p.worker, match[1], match[2])
+			}
+
+			return nil
+		}
+
+		p.worker = nil
+	}
+
+	if strings.HasPrefix(content, "->") {
+		p.addNode(strings.TrimSpace(strings.TrimPrefix(content, "->")), indent)
+		return nil
+	}
+
+	if textSubplanRe.MatchString(content) {
+		// The header is indented as siblings of its node, so the owner is the closest less indented node.
+		p.popNodes(indent)
+		p.subplan = content
+
+		return nil
+	}
+
+	if match := textWorkerRe.FindStringSubmatch(content); match != nil {
+		p.addWorker(match[1], match[2], indent)
+		return nil
+	}
+
+	match := textPropertyRe.FindStringSubmatch(content)
+	if match == nil {
+		return errors.Errorf("invalid plan: unexpected line %q", content)
+	}
+
+	setTextProperty(p.stack[len(p.stack)-1].plan, match[1], match[2])
+
+	return nil
+}
+
+func (p *textParser) addNode(content string, indent int) map[string]interface{} {
+	plan := parseTextNode(content)
+
+	if p.subplan != "" {
+		plan["Parent Relationship"] = "InitPlan"
+		if strings.HasPrefix(p.subplan, "SubPlan") {
+			plan["Parent Relationship"] = "SubPlan"
+		}
+
+		plan["Subplan Name"] = p.subplan
+		p.subplan = ""
+	}
+
+	p.popNodes(indent)
+
+	if len(p.stack) > 0 {
+		parent := p.stack[len(p.stack)-1].plan
+		children, _ := parent["Plans"].([]interface{})
+		parent["Plans"] = append(children, plan)
+	}
+
+	p.stack = append(p.stack, textNode{indent: indent, plan: plan})
+	p.worker = nil
+
+	return plan
+}
+
+// isTextPlanNode checks if the line is a plan node: it has costs or actual values, or its node type is known.
+func isTextPlanNode(content string) bool {
+	if textNodeStatsRe.MatchString(content) {
+		return true
+	}
+
+	nodeType, _ := parseTextNode(content)["Node Type"].(string)
+
+	return textNodeTypes[nodeType]
+}
+
+// isTextExplainProperty checks if the line is a property of the whole explain.
+func isTextExplainProperty(content string) bool {
+	match := textPropertyRe.FindStringSubmatch(content)
+
+	return match != nil && textExplainProperties[strings.ToLower(match[1])]
+}
+
+// addWorker adds stats of a parallel worker to the current node,
+// e.g. "Worker 0:  actual time=0.010..5.000 rows=100 loops=1" or "Worker 0:  Sort Method: quicksort  Memory: 25kB".
+func (p *textParser) addWorker(number, details string, indent int) {
+	plan := p.stack[len(p.stack)-1].plan
+	workers, _ := plan["Workers"].([]interface{})
+
+	workerNumber := convertValue("Worker Number", number)
+
+	// Older versions render worker details in separate lines.
+	p.worker = nil
+
+	for _, item := range workers {
+		if worker := item.(map[string]interface{}); worker["Worker Number"] == workerNumber {
+			p.worker = worker
+		}
+	}
+
+	if p.worker == nil {
+		p.worker = map[string]interface{}{"Worker Number": workerNumber}
+		plan["Workers"] = append(workers, p.worker)
+	}
+
+	p.workerIndent = indent
+
+	if match := textWorkerActualRe.FindStringSubmatch(details); match != nil {
+		if match[1] != "" {
+			p.worker["Actual Startup Time"] = convertValue("Actual Startup Time", match[1])
+			p.worker["Actual Total Time"] = convertValue("Actual Total Time", match[2])
+		}
+
+		p.worker["Actual Rows"] = convertValue("Actual Rows", match[3])
+		p.worker["Actual Loops"] = convertValue("Actual Loops", match[4])
+
+		return
+	}
+
+	if match := textPropertyRe.FindStringSubmatch(details); match != nil {
+		setTextProperty(p.worker, match[1], match[2])
+	}
+}
+
+// popNodes leaves only nodes which can be parents of a node with the indent.
+func (p *textParser) popNodes(indent int) {
+	for len(p.stack) > 0 && p.stack[len(p.stack)-1].indent >= indent {
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+}
+
+func (p *textParser) parseExplainProperty(content string, indent int) {
+	match := textPropertyRe.FindStringSubmatch(content)
+	if match == nil {
+		return
+	}
+
+	key, value := match[1], match[2]
+
+	if p.section != nil && indent > p.sectionIndent {
+		setTextProperty(p.section, key, value)
+		return
+	}
+
+	p.section = nil
+
+	switch strings.ToLower(key) {
+	case "planning time":
+		p.explain["Planning Time"] = convertValue("Planning Time", value)
+
+	case "execution time", "total runtime":
+		p.explain["Execution Time"] = convertValue("Execution Time", value)
+
+	case "settings":
+		p.explain["Settings"] = parseTextSettings(value)
+
+	default:
+		if value != "" {
+			p.explain[key] = value
+			return
+		}
+
+		p.section = map[string]interface{}{}
+		p.sectionIndent = indent
+		p.explain[key] = p.section
+	}
+}
+
+// parseTextSettings parses modified settings, e.g. "enable_seqscan = 'off', work_mem = '64MB'".
+func parseTextSettings(value string) map[string]interface{} {
+	settings := map[string]interface{}{}
+
+	for _, item := range splitList(value) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		settings[strings.TrimSpace(parts[0])] = strings.ReplaceAll(strings.Trim(strings.TrimSpace(parts[1]), "'"), "''", "'")
+	}
+
+	return settings
+}
+
+// parseTextNode parses a node line, e.g. "Index Scan using idx on t  (cost=...) (actual ...)".
+func parseTextNode(content string) map[string]interface{} {
+	plan := map[string]interface{}{}
+
+	caption := content
+
+	if loc := textNodeStatsRe.FindStringIndex(content); loc != nil {
+		caption = content[:loc[0]]
+		stats := content[loc[0]:]
+
+		if match := textCostRe.FindStringSubmatch(stats); match != nil {
+			plan["Startup Cost"] = convertValue("Startup Cost", match[1])
+			plan["Total Cost"] = convertValue("Total Cost", match[2])
+			plan["Plan Rows"] = convertValue("Plan Rows", match[3])
+			plan["Plan Width"] = convertValue("Plan Width", match[4])
+		}
+
+		if match := textActualRe.FindStringSubmatch(stats); match != nil {
+			if match[1] != "" {
+				plan["Actual Startup Time"] = convertValue("Actual Startup Time", match[1])
+				plan["Actual Total Time"] = convertValue("Actual Total Time", match[2])
+			}
+
+			plan["Actual Rows"] = convertValue("Actual Rows", match[3])
+			plan["Actual Loops"] = convertValue("Actual Loops", match[4])
+		}
+	}
+
+	parseTextNodeCaption(plan, strings.TrimSpace(caption))
+
+	return plan
+}
+
+func parseTextNodeCaption(plan map[string]interface{}, caption string) {
+	nodeType, target := caption, ""
+
+	if i := strings.Index(caption, " using "); i >= 0 {
+		nodeType = caption[:i]
+		index := caption[i+len(" using "):]
+
+		if j := strings.Index(index, " on "); j >= 0 {
+			index, target = index[:j], index[j+len(" on "):]
+		}
+
+		plan["Index Name"] = unquoteIdent(index)
+	} else if i := strings.Index(caption, " on "); i >= 0 {
+		nodeType, target = caption[:i], caption[i+len(" on "):]
+	}
+
+	if strings.HasPrefix(nodeType, "Parallel ") {
+		plan["Parallel Aware"] = true
+		nodeType = strings.TrimPrefix(nodeType, "Parallel ")
+	}
+
+	for _, mode := range []string{"Partial", "Finalize", "Simple"} {
+		if strings.HasPrefix(nodeType, mode+" ") {
+			plan["Partial Mode"] = mode
+			nodeType = strings.TrimPrefix(nodeType, mode+" ")
+		}
+	}
+
+	if strings.HasSuffix(nodeType, " Backward") {
+		plan["Scan Direction"] = "Backward"
+		nodeType = strings.TrimSuffix(nodeType, " Backward")
+	}
+
+	if strategy, ok := textAggregateStrategies[nodeType]; ok {
+		plan["Strategy"] = strategy
+		nodeType = "Aggregate"
+	}
+
+	switch nodeType {
+	case "Insert", "Update", "Delete", "Merge":
+		plan["Operation"] = nodeType
+		nodeType = "ModifyTable"
+
+	case string(IndexScan), string(IndexOnlyScan):
+		if _, ok := plan["Scan Direction"]; !ok {
+			plan["Scan Direction"] = "Forward"
+		}
+	}
+
+	// Hash Join is shown as "Hash Join", "Hash Left Join", etc. unlike Hash, Nested Loop is shown without "Join".
+	if match := textJoinRe.FindStringSubmatch(nodeType); match != nil && (match[3] != "" || match[1] == "Nested Loop") {
+		nodeType = match[1] + " Join"
+		if match[1] == "Nested Loop" {
+			nodeType = match[1]
+		}
+
+		plan["Join Type"] = "Inner"
+		if match[2] != "" {
+			plan["Join Type"] = match[2]
+		}
+	}
+
+	if match := textCustomRe.FindStringSubmatch(nodeType); match != nil {
+		nodeType = "Custom Scan"
+		plan["Custom Plan Provider"] = match[1]
+	}
+
+	plan["Node Type"] = nodeType
+
+	if target != "" {
+		setTextNodeTarget(plan, nodeType, target)
+	}
+}
+
+// setTextNodeTarget parses the object of a node, e.g. "public.orders o" of "Seq Scan on public.orders o".
+func setTextNodeTarget(plan map[string]interface{}, nodeType, target string) {
+	parts := splitIdents(target, ' ')
+	name, alias := parts[0], ""
+
+	if len(parts) > 1 {
+		alias = unquoteIdent(parts[1])
+	}
+
+	nameParts := splitIdents(name, '.')
+	name = unquoteIdent(nameParts[len(nameParts)-1])
+
+	if alias == "" {
+		alias = name
+	}
+
+	schema := ""
+	if len(nameParts) > 1 {
+		schema = unquoteIdent(nameParts[len(nameParts)-2])
+	}
+
+	switch nodeType {
+	case string(BitmapIndexScan):
+		plan["Index Name"] = name
+		return
+
+	case string(CTEScan), "WorkTable Scan":
+		plan["CTE Name"] = name
+
+	case string(FunctionScan):
+		plan["Function Name"] = name
+
+	case string(SubqueryScan), string(ValuesScan):
+		// Only an alias is shown.
+
+	default:
+		plan["Relation Name"] = name
+	}
+
+	if schema != "" {
+		plan["Schema"] = schema
+	}
+
+	plan["Alias"] = alias
+}
+
+func setTextProperty(plan map[string]interface{}, key, value string) {
+	switch key {
+	case "Buffers":
+		setTextBuffers(plan, value)
+
+	case "I/O Timings":
+		for _, match := range textIOTimingRe.FindAllStringSubmatch(value, -1) {
+			key := "I/O Read Time"
+			if match[1] == "write" {
+				key = "I/O Write Time"
+			}
+
+			plan[key] = convertValue(key, match[2])
+		}
+
+	case "Sort Method":
+		parts := strings.SplitN(value, "  ", 2)
+		plan["Sort Method"] = parts[0]
+
+		if len(parts) == 2 {
+			if space := textPropertyRe.FindStringSubmatch(strings.TrimSpace(parts[1])); space != nil {
+				plan["Sort Space Type"] = space[1]
+				plan["Sort Space Used"] = convertValue("Sort Space Used", space[2])
+			}
+		}
+
+	case "Buckets":
+		for _, match := range textHashRe.FindAllStringSubmatch(key+": "+value, -1) {
+			original := match[3]
+			if original == "" {
+				original = match[2]
+			}
+
+			plan["Hash "+match[1]] = convertValue("Hash "+match[1], match[2])
+			plan["Original Hash "+match[1]] = convertValue("Original Hash "+match[1], original)
+		}
+
+		if match := textMemoryRe.FindStringSubmatch(value); match != nil {
+			plan["Peak Memory Usage"] = convertValue("Peak Memory Usage", match[1])
+		}
+
+	case "Hits":
+		for _, match := range textCacheRe.FindAllStringSubmatch(key+": "+value, -1) {
+			plan["Cache "+match[1]] = convertValue("Cache "+match[1], match[2])
+		}
+
+		if match := textMemoryRe.FindStringSubmatch(value); match != nil {
+			plan["Peak Memory Usage"] = convertValue("Peak Memory Usage", match[1])
+		}
+
+	case "Full-sort Groups", "Pre-sorted Groups":
+		setTextSortGroups(plan, key, value)
+
+	case "WAL":
+		for _, match := range textWALRe.FindAllStringSubmatch(value, -1) {
+			key := "WAL " + strings.Title(match[1])
+			if match[1] == "fpi" {
+				key = "WAL FPI"
+			}
+
+			plan[key] = convertValue(key, match[2])
+		}
+
+	case "Options":
+		// JIT options, e.g. "Inlining false, Optimization false, Expressions true, Deforming true".
+		options := map[string]interface{}{}
+		for _, match := range textJITOptionRe.FindAllStringSubmatch(value, -1) {
+			options[match[1]] = match[2] == "true"
+		}
+
+		plan[key] = options
+
+	case "Timing":
+		// JIT timing, e.g. "Generation 0.512 ms (Deform 0.1 ms), Inlining 0.000 ms, ..., Total 4.137 ms".
+		timing := map[string]interface{}{}
+		for _, part := range strings.Split(textParenthesesRe.ReplaceAllString(value, ""), ",") {
+			if match := textJITTimingRe.FindStringSubmatch(part); match != nil {
+				timing[match[1]] = convertValue("Total", match[2])
+			}
+		}
+
+		plan[key] = timing
+
+	default:
+		if textListProperties[key] {
+			plan[key] = splitList(value)
+			return
+		}
+
+		plan[key] = convertValue(key, value)
+	}
+}
+
+// setTextSortGroups parses groups of Incremental Sort, e.g. "1  Sort Method: quicksort  Average Memory: 25kB  Peak Memory: 25kB".
+func setTextSortGroups(plan map[string]interface{}, key, value string) {
+	match := textGroupsRe.FindStringSubmatch(value)
+	if match == nil {
+		return
+	}
+
+	groups := map[string]interface{}{
+		"Group Count":       convertValue("Group Count", match[1]),
+		"Sort Methods Used": splitList(match[2]),
+	}
+
+	for _, space := range textGroupSpace.FindAllStringSubmatch(value, -1) {
+		spaceKey := "Sort Space " + space[2]
+
+		spaceUsage, ok := groups[spaceKey].(map[string]interface{})
+		if !ok {
+			spaceUsage = map[string]interface{}{}
+			groups[spaceKey] = spaceUsage
+		}
+
+		usedKey := space[1] + " Sort Space Used"
+		spaceUsage[usedKey] = convertValue(usedKey, space[3])
+	}
+
+	plan[key] = groups
+}
+
+// setTextBuffers parses buffers, e.g. "shared hit=3 read=1, temp written=5".
+func setTextBuffers(plan map[string]interface{}, value string) {
+	for _, group := range strings.Split(value, ",") {
+		fields := strings.Fields(group)
+		if len(fields) == 0 {
+			continue
+		}
+
+		scope := strings.Title(fields[0])
+
+		for _, match := range textBlocksRe.FindAllStringSubmatch(group, -1) {
+			key := scope + " " + strings.Title(match[1]) + " Blocks"
+			plan[key] = convertValue(key, match[2])
+		}
+	}
+}
+
+func setParentRelationships(plan map[string]interface{}) {
+	children, _ := plan["Plans"].([]interface{})
+	regular := 0
+
+	for _, item := range children {
+		child := item.(map[string]interface{})
+
+		if _, ok := child["Parent Relationship"]; !ok {
+			switch plan["Node Type"] {
+			case "Append", "Merge Append":
+				child["Parent Relationship"] = "Member"
+
+			case string(SubqueryScan):
+				child["Parent Relationship"] = "Subquery"
+
+			default:
+				child["Parent Relationship"] = "Outer"
+				if regular > 0 {
+					child["Parent Relationship"] = "Inner"
+				}
+			}
+
+			regular++
+		}
+
+		setParentRelationships(child)
+	}
+}
+
+// splitList splits a comma-separated list ignoring commas inside parentheses and quotes.
+func splitList(value string) []string {
+	items := []string{}
+	depth, start := 0, 0
+	quote := rune(0)
+
+	for i, r := range value {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+
+		case r == '\'' || r == '"':
+			quote = r
+
+		case r == '(' || r == '[':
+			depth++
+
+		case r == ')' || r == ']':
+			depth--
+
+		case r == ',' && depth == 0:
+			items = append(items, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(items, strings.TrimSpace(value[start:]))
+}
+
+// splitIdents splits identifiers by the separator ignoring quoted ones.
+func splitIdents(value string, separator rune) []string {
+	parts := []string{}
+	quoted := false
+	start := 0
+
+	for i, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+
+		case r == separator && !quoted:
+			if i > start {
+				parts = append(parts, value[start:i])
+			}
+
+			start = i + 1
+		}
+	}
+
+	return append(parts, value[start:])
+}
+
+func unquoteIdent(ident string) string {
+	if len(ident) >= 2 && strings.HasPrefix(ident, `"`) && strings.HasSuffix(ident, `"`) {
+		return strings.ReplaceAll(ident[1:len(ident)-1], `""`, `"`)
+	}
+
+	return ident
+}
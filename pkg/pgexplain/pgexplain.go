@@ -12,6 +12,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sort"
 	"strings"
 
 	"gitlab.com/postgres-ai/joe/pkg/util"
@@ -29,7 +31,12 @@ type NodeType string
 const (
 	Limit           NodeType = "Limit"
 	Append                   = "Append"
+	AsyncAppend              = "Async Append"
 	Sort                     = "Sort"
+	IncrementalSort          = "Incremental Sort"
+	Gather                   = "Gather"
+	GatherMerge              = "Gather Merge"
+	Memoize                  = "Memoize"
 	NestedLoop               = "Nested Loop"
 	MergeJoin                = "Merge Join"
 	Hash                     = "Hash"
@@ -41,6 +48,8 @@ const (
 	IndexOnlyScan            = "Index Only Scan"
 	BitmapHeapScan           = "Bitmap Heap Scan"
 	BitmapIndexScan          = "Bitmap Index Scan"
+	TidScan                  = "Tid Scan"
+	TidRangeScan             = "Tid Range Scan"
 	CTEScan                  = "CTE Scan"
 	FunctionScan             = "Function Scan"
 	SubqueryScan             = "Subquery Scan"
@@ -56,6 +65,21 @@ type Explain struct {
 	ExecutionTime float64 `json:"Execution Time"`
 	TotalTime     float64
 
+	// Planning contains planning buffers (PG13+).
+	Planning *Planning `json:"Planning"`
+
+	// JIT contains JIT compilation details, it's nil if JIT has not been used.
+	JIT *JIT `json:"JIT"`
+
+	// Settings contains modified planner-related settings, EXPLAIN (SETTINGS) (PG12+).
+	Settings map[string]string `json:"Settings"`
+
+	// Analyzed is set if the plan contains actual values, EXPLAIN (ANALYZE).
+	Analyzed bool `json:"-"`
+
+	// TimingOff is set if actual time of nodes has not been collected, EXPLAIN (ANALYZE, TIMING OFF).
+	TimingOff bool `json:"-"`
+
 	TotalCost float64
 
 	// Buffers.
@@ -74,14 +98,28 @@ type Explain struct {
 	IOReadTime  float64
 	IOWriteTime float64
 
+	// WAL usage.
+	WALRecords uint64
+	WALFPI     uint64
+	WALBytes   uint64
+
 	ActualRows      uint64
 	MaxRows         uint64
 	MaxCost         float64
 	MaxDuration     float64
 	ContainsSeqScan bool
 
+	// Deprecated: the flags are set by GetTips if the corresponding tips are triggered, use tips instead.
 	IndexIneffHighFiltered bool
 	VacuumAnalyzeNeeded    bool
+	RowEstimateMismatch    bool
+	HashBatchesSpilled     bool
+	SortOnDisk             bool
+	NestedLoopInnerLoops   bool
+	IndexRecheckHigh       bool
+	WorkersNotLaunched     bool
+
+	MaxExclusiveSharedBlocks uint64
 
 	Config ExplainConfig `json:"-"`
 }
@@ -105,6 +143,11 @@ type Plan struct {
 	IOReadTime  float64 `json:"I/O Read Time"`  // ms
 	IOWriteTime float64 `json:"I/O Write Time"` // ms
 
+	// WAL usage.
+	WALRecords uint64 `json:"WAL Records"`
+	WALFPI     uint64 `json:"WAL FPI"` // Full page images.
+	WALBytes   uint64 `json:"WAL Bytes"`
+
 	// Actual.
 	ActualLoops       uint64  `json:"Actual Loops"`
 	ActualRows        uint64  `json:"Actual Rows"`
@@ -118,44 +161,70 @@ type Plan struct {
 	TotalCost   float64 `json:"Total Cost"`
 
 	// General.
-	Alias                     string   `json:"Alias"`
-	CteName                   string   `json:"CTE Name"`
-	Filter                    string   `json:"Filter"`
-	FunctionName              string   `json:"Function Name"`
-	GroupKey                  []string `json:"Group Key"`
-	HashBatches               uint64   `json:"Hash Batches"`
-	HashBuckets               uint64   `json:"Hash Buckets"`
-	HashCondition             string   `json:"Hash Cond"`
-	HeapFetches               uint64   `json:"Heap Fetches"`
-	IndexCondition            string   `json:"Index Cond"`
-	IndexName                 string   `json:"Index Name"`
-	MergeCondition            string   `json:"Merge Cond"`
-	JoinType                  string   `json:"Join Type"`
-	NodeType                  NodeType `json:"Node Type"`
-	Operation                 string   `json:"Operation"`
-	OriginalHashBatches       uint64   `json:"Original Hash Batches"`
-	OriginalHashBuckets       uint64   `json:"Original Hash Buckets"`
-	Output                    []string `json:"Output"`
-	ParallelAware             bool     `json:"Parallel Aware"`
-	ParentRelationship        string   `json:"Parent Relationship"`
-	PeakMemoryUsage           uint64   `json:"Peak Memory Usage"` // kB
-	RelationName              string   `json:"Relation Name"`
-	RowsRemovedByFilter       uint64   `json:"Rows Removed by Filter"`
-	RowsRemovedByIndexRecheck uint64   `json:"Rows Removed by Index Recheck"`
-	ScanDirection             string   `json:"Scan Direction"`
-	Schema                    string   `json:"Schema"`
-	SortKey                   []string `json:"Sort Key"`
-	SortMethod                string   `json:"Sort Method"`
-	SortSpaceType             string   `json:"Sort Space Type"`
-	SortSpaceUsed             uint64   `json:"Sort Space Used"` // kB
-	Strategy                  string   `json:"Strategy"`
-	SubplanName               string   `json:"Subplan Name"`
-	WorkersLaunched           uint     `json:"Workers Launched"`
-	WorkersPlanned            uint     `json:"Workers Planned"`
+	Alias                     string      `json:"Alias"`
+	AsyncCapable              bool        `json:"Async Capable"`
+	CacheEvictions            uint64      `json:"Cache Evictions"`
+	CacheHits                 uint64      `json:"Cache Hits"`
+	CacheKey                  string      `json:"Cache Key"`
+	CacheMisses               uint64      `json:"Cache Misses"`
+	CacheMode                 string      `json:"Cache Mode"`
+	CacheOverflows            uint64      `json:"Cache Overflows"`
+	CteName                   string      `json:"CTE Name"`
+	FullSortGroups            *SortGroups `json:"Full-sort Groups"`
+	Filter                    string      `json:"Filter"`
+	FunctionName              string      `json:"Function Name"`
+	GroupKey                  []string    `json:"Group Key"`
+	HashBatches               uint64      `json:"Hash Batches"`
+	HashBuckets               uint64      `json:"Hash Buckets"`
+	HashCondition             string      `json:"Hash Cond"`
+	HeapFetches               uint64      `json:"Heap Fetches"`
+	IndexCondition            string      `json:"Index Cond"`
+	IndexName                 string      `json:"Index Name"`
+	JoinFilter                string      `json:"Join Filter"`
+	MergeCondition            string      `json:"Merge Cond"`
+	JoinType                  string      `json:"Join Type"`
+	NodeType                  NodeType    `json:"Node Type"`
+	OneTimeFilter             string      `json:"One-Time Filter"`
+	Operation                 string      `json:"Operation"`
+	OriginalHashBatches       uint64      `json:"Original Hash Batches"`
+	OriginalHashBuckets       uint64      `json:"Original Hash Buckets"`
+	Output                    []string    `json:"Output"`
+	PreSortedGroups           *SortGroups `json:"Pre-sorted Groups"`
+	PresortedKey              []string    `json:"Presorted Key"`
+	ParallelAware             bool        `json:"Parallel Aware"`
+	ParentRelationship        string      `json:"Parent Relationship"`
+	PartialMode               string      `json:"Partial Mode"`
+	PeakMemoryUsage           uint64      `json:"Peak Memory Usage"` // kB
+	RecheckCondition          string      `json:"Recheck Cond"`
+	RelationName              string      `json:"Relation Name"`
+	RowsRemovedByFilter       uint64      `json:"Rows Removed by Filter"`
+	RowsRemovedByJoinFilter   uint64      `json:"Rows Removed by Join Filter"`
+	RowsRemovedByIndexRecheck uint64      `json:"Rows Removed by Index Recheck"`
+	ScanDirection             string      `json:"Scan Direction"`
+	Schema                    string      `json:"Schema"`
+	SingleCopy                bool        `json:"Single Copy"`
+	SortKey                   []string    `json:"Sort Key"`
+	SortMethod                string      `json:"Sort Method"`
+	SortSpaceType             string      `json:"Sort Space Type"`
+	SortSpaceUsed             uint64      `json:"Sort Space Used"` // kB
+	Strategy                  string      `json:"Strategy"`
+	SubplanName               string      `json:"Subplan Name"`
+	SubplansRemoved           uint64      `json:"Subplans Removed"`
+	TidCondition              string      `json:"TID Cond"`
+	WorkersLaunched           uint        `json:"Workers Launched"`
+	WorkersPlanned            uint        `json:"Workers Planned"`
+	Workers                   []Worker    `json:"Workers"`
 
 	// Calculated params.
+	Path                        string
+	Analyzed                    bool `json:"-"`
+	TimingOff                   bool `json:"-"`
 	ActualCost                  float64
-	ActualDuration              float64
+	ActualDuration              float64 // Exclusive time of the node, ms.
+	InclusiveDuration           float64 // Wall-clock time of the node including its children, ms.
+	ExclusiveSharedHitBlocks    uint64
+	ExclusiveSharedReadBlocks   uint64
+	ExclusiveTempWrittenBlocks  uint64
 	Costliest                   bool
 	Largest                     bool
 	PlannerRowEstimateDirection EstimateDirection
@@ -163,6 +232,117 @@ type Plan struct {
 	Slowest                     bool
 }
 
+// Worker contains stats of a parallel worker reported by EXPLAIN (ANALYZE, VERBOSE).
+type Worker struct {
+	WorkerNumber uint64 `json:"Worker Number"`
+
+	// Actual.
+	ActualLoops       uint64  `json:"Actual Loops"`
+	ActualRows        uint64  `json:"Actual Rows"`
+	ActualStartupTime float64 `json:"Actual Startup Time"`
+	ActualTotalTime   float64 `json:"Actual Total Time"`
+
+	// Sort.
+	SortMethod    string `json:"Sort Method"`
+	SortSpaceType string `json:"Sort Space Type"`
+	SortSpaceUsed uint64 `json:"Sort Space Used"` // kB
+
+	// Buffers.
+	SharedHitBlocks     uint64 `json:"Shared Hit Blocks"`
+	SharedReadBlocks    uint64 `json:"Shared Read Blocks"`
+	SharedDirtiedBlocks uint64 `json:"Shared Dirtied Blocks"`
+	SharedWrittenBlocks uint64 `json:"Shared Written Blocks"`
+	LocalHitBlocks      uint64 `json:"Local Hit Blocks"`
+	LocalReadBlocks     uint64 `json:"Local Read Blocks"`
+	LocalDirtiedBlocks  uint64 `json:"Local Dirtied Blocks"`
+	LocalWrittenBlocks  uint64 `json:"Local Written Blocks"`
+	TempReadBlocks      uint64 `json:"Temp Read Blocks"`
+	TempWrittenBlocks   uint64 `json:"Temp Written Blocks"`
+
+	// IO timing.
+	IOReadTime  float64 `json:"I/O Read Time"`  // ms
+	IOWriteTime float64 `json:"I/O Write Time"` // ms
+}
+
+// SortGroups describes groups sorted by Incremental Sort.
+type SortGroups struct {
+	GroupCount      uint64     `json:"Group Count"`
+	SortMethodsUsed []string   `json:"Sort Methods Used"`
+	SortSpaceMemory *SortSpace `json:"Sort Space Memory"`
+	SortSpaceDisk   *SortSpace `json:"Sort Space Disk"`
+}
+
+// SortSpace describes space used by sorts of Incremental Sort groups.
+type SortSpace struct {
+	AverageSortSpaceUsed uint64 `json:"Average Sort Space Used"` // kB
+	PeakSortSpaceUsed    uint64 `json:"Peak Sort Space Used"`    // kB
+}
+
+// Planning contains buffers used by the planner.
+type Planning struct {
+	SharedHitBlocks     uint64 `json:"Shared Hit Blocks"`
+	SharedReadBlocks    uint64 `json:"Shared Read Blocks"`
+	SharedDirtiedBlocks uint64 `json:"Shared Dirtied Blocks"`
+	SharedWrittenBlocks uint64 `json:"Shared Written Blocks"`
+	LocalHitBlocks      uint64 `json:"Local Hit Blocks"`
+	LocalReadBlocks     uint64 `json:"Local Read Blocks"`
+	LocalDirtiedBlocks  uint64 `json:"Local Dirtied Blocks"`
+	LocalWrittenBlocks  uint64 `json:"Local Written Blocks"`
+	TempReadBlocks      uint64 `json:"Temp Read Blocks"`
+	TempWrittenBlocks   uint64 `json:"Temp Written Blocks"`
+}
+
+// JIT contains details of JIT compilation.
+type JIT struct {
+	Functions uint64     `json:"Functions"`
+	Options   JITOptions `json:"Options"`
+	Timing    JITTiming  `json:"Timing"`
+}
+
+// JITOptions contains JIT compilation options.
+type JITOptions struct {
+	Inlining     bool `json:"Inlining"`
+	Optimization bool `json:"Optimization"`
+	Expressions  bool `json:"Expressions"`
+	Deforming    bool `json:"Deforming"`
+}
+
+// JITTiming contains JIT compilation timing.
+type JITTiming struct {
+	Generation   JITDuration `json:"Generation"`
+	Inlining     JITDuration `json:"Inlining"`
+	Optimization JITDuration `json:"Optimization"`
+	Emission     JITDuration `json:"Emission"`
+	Total        JITDuration `json:"Total"`
+}
+
+// JITDuration defines a JIT timing in milliseconds.
+// Since PG17 the generation timing is an object with a deforming part, only its total is kept.
+type JITDuration float64
+
+// UnmarshalJSON decodes a duration from a number or an object with the total duration.
+func (d *JITDuration) UnmarshalJSON(data []byte) error {
+	var value float64
+
+	if err := json.Unmarshal(data, &value); err == nil {
+		*d = JITDuration(value)
+		return nil
+	}
+
+	var details struct {
+		Total float64 `json:"Total"`
+	}
+
+	if err := json.Unmarshal(data, &details); err != nil {
+		return err
+	}
+
+	*d = JITDuration(details.Total)
+
+	return nil
+}
+
+// Codes of the built-in tips.
 const (
 	TIP_SEQSCAN_USED                    = "SEQSCAN_USED"
 	TIP_TOO_MUCH_DATA                   = "TOO_MUCH_DATA"
@@ -170,6 +350,13 @@ const (
 	TIP_TEMP_BUF_WRITTEN                = "TEMP_BUF_WRITTEN"
 	TIP_INDEX_INEFFICIENT_HIGH_FILTERED = "INDEX_INEFFICIENT_HIGH_FILTERED"
 	TIP_VACUUM_ANALYZE_NEEDED           = "VACUUM_ANALYZE_NEEDED"
+	TIP_ROW_ESTIMATE_MISMATCH           = "ROW_ESTIMATE_MISMATCH"
+	TIP_HASH_BATCHES_SPILLED            = "HASH_BATCHES_SPILLED"
+	TIP_SORT_ON_DISK                    = "SORT_ON_DISK"
+	TIP_NESTED_LOOP_INNER_LOOPS         = "NESTED_LOOP_INNER_LOOPS"
+	TIP_INDEX_RECHECK_HIGH              = "INDEX_RECHECK_HIGH"
+	TIP_WORKERS_NOT_LAUNCHED            = "WORKERS_NOT_LAUNCHED"
+	TIP_JIT_TIME_HIGH                   = "JIT_TIME_HIGH"
 )
 
 type ExplainConfig struct {
@@ -182,6 +369,64 @@ type Tip struct {
 	Name        string `yaml:"name"`
 	Description string `yaml:"description"`
 	DetailsUrl  string `yaml:"detailsUrl"`
+
+	// Scope defines whether the condition is checked for every node or once for the plan.
+	Scope    string `yaml:"scope"`
+	Severity string `yaml:"severity"`
+
+	// Condition defines an expression which triggers the tip.
+	Condition string `yaml:"condition"`
+
+	// NodeCondition selects nodes to attribute a plan-scoped tip.
+	NodeCondition string `yaml:"nodeCondition"`
+
+	// Metric and Value describe the node metric, Message overrides the whole node description.
+	Metric  string `yaml:"metric"`
+	Value   string `yaml:"value"`
+	Message string `yaml:"message"`
+
+	rule *tipRule
+
+	// Nodes contains plan nodes which triggered the tip.
+	Nodes []TipNode `yaml:"-"`
+}
+
+// TipNode describes a plan node which triggered a tip.
+type TipNode struct {
+	Path         string
+	NodeType     NodeType
+	RelationName string
+	IndexName    string
+
+	// Metric defines a node metric that crossed the threshold.
+	Metric string
+	Value  float64
+
+	// Message defines a custom description of the node.
+	Message string
+}
+
+// String returns a short description of the node, e.g. "Seq Scan on orders (buffers 1.2M)".
+func (n TipNode) String() string {
+	if n.Message != "" {
+		return n.Message
+	}
+
+	caption := string(n.NodeType)
+
+	if n.IndexName != "" {
+		caption += " using " + n.IndexName
+	}
+
+	if n.RelationName != "" {
+		caption += " on " + n.RelationName
+	}
+
+	if n.Metric == "" {
+		return caption
+	}
+
+	return fmt.Sprintf("%s (%s %s)", caption, n.Metric, formatMetric(n.Value))
 }
 
 // TODO(anatoly): Refactor names.
@@ -204,6 +449,28 @@ type ParamsConfig struct {
 
 	// T6 VACUUM_ANALYZE_NEEDED.
 	VacuumAnalyzeNeededFetchesMin uint64 `yaml:"vacuumAnalyzeNeededFetchesMin"`
+
+	// T7 ROW_ESTIMATE_MISMATCH.
+	RowEstimateFactorMin float64 `yaml:"rowEstimateFactorMin"`
+	RowEstimateRowsMin   uint64  `yaml:"rowEstimateRowsMin"`
+
+	// T8 HASH_BATCHES_SPILLED.
+	HashBatchesMax uint64 `yaml:"hashBatchesMax"`
+
+	// T9 SORT_ON_DISK.
+	SortDiskSpaceMin uint64 `yaml:"sortDiskSpaceMin"` // kB
+
+	// T10 NESTED_LOOP_INNER_LOOPS.
+	NestedLoopInnerLoopsMin uint64 `yaml:"nestedLoopInnerLoopsMin"`
+
+	// T11 INDEX_RECHECK_HIGH.
+	IndexRecheckRowsMin uint64 `yaml:"indexRecheckRowsMin"`
+
+	// T13 JIT_TIME_HIGH.
+	JITTimeRatioMax float64 `yaml:"jitTimeRatioMax"`
+
+	// Custom params available in tip rules.
+	Custom map[string]interface{} `yaml:",inline"`
 }
 
 // Explain Processing.
@@ -222,10 +489,10 @@ func NewExplain(explainJson string, config ExplainConfig) (*Explain, error) {
 
 	// TODO(anatoly): Is it possible to have more than one explain?
 	var ex = &explains[0]
-	ex.processExplain()
-
 	ex.Config = config
 
+	ex.processExplain()
+
 	return ex, nil
 }
 
@@ -241,75 +508,58 @@ func (ex *Explain) RenderStats() string {
 	return buf.String()
 }
 
+// GetTips returns tips triggered by the plan.
 func (ex *Explain) GetTips() ([]Tip, error) {
-	c := ex.Config
-	p := c.Params
-
-	var tips []Tip
-
-	// T1: SeqScan used.
-	hitReadBlocks := ex.SharedReadBlocks + ex.SharedHitBlocks
-	if ex.ContainsSeqScan && hitReadBlocks > p.BuffersHitReadSeqScan {
-		tip, err := c.getTipByCode(TIP_SEQSCAN_USED)
-		if err != nil {
-			return make([]Tip, 0), err
-		}
-		tips = append(tips, tip)
+	tips, err := ex.evalTips()
+	if err != nil {
+		return nil, err
 	}
 
-	// T2: Buffers read too big.
-	if ex.SharedReadBlocks > p.BuffersReadBigMax ||
-		ex.SharedHitBlocks > p.BuffersHitBigMax {
-		tip, err := c.getTipByCode(TIP_TOO_MUCH_DATA)
-		if err != nil {
-			return make([]Tip, 0), err
-		}
-		tips = append(tips, tip)
-	}
+	ex.setTipFlags(tips)
 
-	// T3: Add limit.
-	if ex.ActualRows > p.AddLimitMinRows && ex.Plan.NodeType != Limit {
-		tip, err := c.getTipByCode(TIP_ADD_LIMIT)
-		if err != nil {
-			return make([]Tip, 0), err
-		}
-		tips = append(tips, tip)
-	}
-
-	// T4: Temp buffers written.
-	if ex.TempWrittenBlocks > p.TempWrittenBlocksMin {
-		tip, err := c.getTipByCode(TIP_TEMP_BUF_WRITTEN)
-		if err != nil {
-			return make([]Tip, 0), err
-		}
-		tips = append(tips, tip)
-	}
+	return tips, nil
+}
 
-	// T5: Index inefficient high filtered.
-	if ex.IndexIneffHighFiltered {
-		tip, err := c.getTipByCode(TIP_INDEX_INEFFICIENT_HIGH_FILTERED)
-		if err != nil {
-			return make([]Tip, 0), err
-		}
-		tips = append(tips, tip)
+// setTipFlags sets the deprecated flags of triggered tips.
+func (ex *Explain) setTipFlags(tips []Tip) {
+	flags := map[string]*bool{
+		TIP_INDEX_INEFFICIENT_HIGH_FILTERED: &ex.IndexIneffHighFiltered,
+		TIP_VACUUM_ANALYZE_NEEDED:           &ex.VacuumAnalyzeNeeded,
+		TIP_ROW_ESTIMATE_MISMATCH:           &ex.RowEstimateMismatch,
+		TIP_HASH_BATCHES_SPILLED:            &ex.HashBatchesSpilled,
+		TIP_SORT_ON_DISK:                    &ex.SortOnDisk,
+		TIP_NESTED_LOOP_INNER_LOOPS:         &ex.NestedLoopInnerLoops,
+		TIP_INDEX_RECHECK_HIGH:              &ex.IndexRecheckHigh,
+		TIP_WORKERS_NOT_LAUNCHED:            &ex.WorkersNotLaunched,
 	}
 
-	// T6: Vacuum analyze needed.
-	if ex.VacuumAnalyzeNeeded {
-		tip, err := c.getTipByCode(TIP_VACUUM_ANALYZE_NEEDED)
-		if err != nil {
-			return make([]Tip, 0), err
+	for _, tip := range tips {
+		if flag, ok := flags[tip.Code]; ok {
+			*flag = true
 		}
-		tips = append(tips, tip)
 	}
-
-	return tips, nil
 }
 
 func (ex *Explain) processExplain() {
 	ex.calculateParams()
 
-	ex.processPlan(&ex.Plan)
+	// The root node is executed at least once, so it has actual loops only if the plan has been analyzed.
+	ex.Analyzed = ex.Plan.ActualLoops > 0
+	ex.TimingOff = ex.Analyzed && !hasActualTime(&ex.Plan)
+
+	ex.processPlan(&ex.Plan, "0", 1)
+
+	// Exclusive values depend on other nodes of the tree (e.g. CTE Scan nodes depend on CTEs),
+	// so they are calculated when the whole tree is processed.
+	subplans := newSubplanOwners(&ex.Plan)
+
+	walkPlan(&ex.Plan, nil, func(plan, _ *Plan) {
+		ex.ContainsSeqScan = ex.ContainsSeqScan || plan.NodeType == SequenceScan
+
+		ex.calculateActuals(plan, subplans)
+		ex.calculateMaximums(plan)
+	})
+
 	ex.calculateOutlierNodes(&ex.Plan)
 }
 
@@ -332,21 +582,58 @@ func (ex *Explain) calculateParams() {
 	ex.TotalTime = ex.PlanningTime + ex.ExecutionTime
 	ex.IOReadTime = ex.Plan.IOReadTime
 	ex.IOWriteTime = ex.Plan.IOWriteTime
+
+	ex.WALRecords = ex.Plan.WALRecords
+	ex.WALFPI = ex.Plan.WALFPI
+	ex.WALBytes = ex.Plan.WALBytes
 }
 
-func (ex *Explain) processPlan(plan *Plan) {
-	ex.checkSeqScan(plan)
+// processPlan calculates params of the node and its children,
+// processes defines the number of processes executing the node concurrently.
+func (ex *Explain) processPlan(plan *Plan, path string, processes uint) {
+	plan.Path = path
+	plan.Analyzed = ex.Analyzed
+	plan.TimingOff = ex.TimingOff
+
 	ex.calculatePlannerEstimate(plan)
-	ex.calculateActuals(plan)
-	ex.calculateMaximums(plan)
+	ex.calculateInclusiveDuration(plan, processes)
 
 	for index := range plan.Plans {
-		ex.processPlan(&plan.Plans[index])
+		childProcesses := processes
+
+		if (plan.NodeType == Gather || plan.NodeType == GatherMerge) && plan.Plans[index].ParentRelationship == "Outer" {
+			childProcesses = gatherProcesses(plan)
+		}
+
+		ex.processPlan(&plan.Plans[index], fmt.Sprintf("%s.%d", path, index), childProcesses)
 	}
 }
 
-func (ex *Explain) checkSeqScan(plan *Plan) {
-	ex.ContainsSeqScan = ex.ContainsSeqScan || plan.NodeType == SequenceScan
+// hasActualTime checks if actual time of any node has been collected.
+func hasActualTime(plan *Plan) bool {
+	if plan.ActualStartupTime > 0 || plan.ActualTotalTime > 0 {
+		return true
+	}
+
+	for index := range plan.Plans {
+		if hasActualTime(&plan.Plans[index]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gatherProcesses returns the number of processes executing the parallel part of the plan.
+func gatherProcesses(plan *Plan) uint {
+	processes := plan.WorkersLaunched
+
+	// The leader participates in the execution unless Single Copy is used.
+	if !plan.SingleCopy || processes == 0 {
+		processes++
+	}
+
+	return processes
 }
 
 func (ex *Explain) calculatePlannerEstimate(plan *Plan) {
@@ -370,24 +657,83 @@ func (ex *Explain) calculatePlannerEstimate(plan *Plan) {
 	}
 }
 
-func (ex *Explain) calculateActuals(plan *Plan) {
-	plan.ActualDuration = plan.ActualTotalTime
+// calculateInclusiveDuration calculates the wall-clock time of the node.
+// Actual Total Time is an average per loop, and parallel processes execute their loops concurrently.
+func (ex *Explain) calculateInclusiveDuration(plan *Plan, processes uint) {
+	duration := plan.ActualTotalTime * float64(plan.ActualLoops)
+
+	if len(plan.Workers) == 0 {
+		plan.InclusiveDuration = duration / float64(processes)
+		return
+	}
+
+	// Per-worker stats define the slowest process, the rest of the time is spent by the leader.
+	leaderDuration := duration
+	plan.InclusiveDuration = 0
+
+	for _, worker := range plan.Workers {
+		workerDuration := worker.ActualTotalTime * float64(worker.ActualLoops)
+		leaderDuration -= workerDuration
+
+		plan.InclusiveDuration = math.Max(plan.InclusiveDuration, workerDuration)
+	}
+
+	plan.InclusiveDuration = math.Max(plan.InclusiveDuration, leaderDuration)
+}
+
+func (ex *Explain) calculateActuals(plan *Plan, subplans *subplanOwners) {
+	plan.ActualDuration = plan.InclusiveDuration
 	plan.ActualCost = plan.TotalCost
 
-	for _, child := range plan.Plans {
-		if child.NodeType != CTEScan {
-			plan.ActualDuration = plan.ActualDuration - child.ActualTotalTime
-			plan.ActualCost = plan.ActualCost - child.TotalCost
+	for index := range plan.Plans {
+		child := &plan.Plans[index]
+
+		// Costs of subplans are charged to the node they are attached to.
+		plan.ActualCost = plan.ActualCost - child.TotalCost
+
+		if !subplans.isMoved(child) {
+			plan.ActualDuration = plan.ActualDuration - child.InclusiveDuration
 		}
 	}
 
+	for _, owned := range subplans.owned(plan) {
+		plan.ActualDuration = plan.ActualDuration - owned.plan.InclusiveDuration*owned.share
+	}
+
 	if plan.ActualCost < 0 {
 		plan.ActualCost = 0
 	}
 
+	if plan.ActualDuration < 0 {
+		plan.ActualDuration = 0
+	}
+
 	ex.TotalCost = ex.TotalCost + plan.ActualCost
 
-	plan.ActualDuration = plan.ActualDuration * float64(plan.ActualLoops)
+	ex.calculateExclusiveBlocks(plan, subplans)
+}
+
+// calculateExclusiveBlocks calculates buffers used by the node itself without its children.
+func (ex *Explain) calculateExclusiveBlocks(plan *Plan, subplans *subplanOwners) {
+	plan.ExclusiveSharedHitBlocks = plan.SharedHitBlocks
+	plan.ExclusiveSharedReadBlocks = plan.SharedReadBlocks
+	plan.ExclusiveTempWrittenBlocks = plan.TempWrittenBlocks
+
+	subtract := func(child *Plan, share float64) {
+		plan.ExclusiveSharedHitBlocks = subtractBlocks(plan.ExclusiveSharedHitBlocks, shareBlocks(child.SharedHitBlocks, share))
+		plan.ExclusiveSharedReadBlocks = subtractBlocks(plan.ExclusiveSharedReadBlocks, shareBlocks(child.SharedReadBlocks, share))
+		plan.ExclusiveTempWrittenBlocks = subtractBlocks(plan.ExclusiveTempWrittenBlocks, shareBlocks(child.TempWrittenBlocks, share))
+	}
+
+	for index := range plan.Plans {
+		if !subplans.isMoved(&plan.Plans[index]) {
+			subtract(&plan.Plans[index], 1)
+		}
+	}
+
+	for _, owned := range subplans.owned(plan) {
+		subtract(owned.plan, owned.share)
+	}
 }
 
 func (ex *Explain) calculateMaximums(plan *Plan) {
@@ -400,37 +746,31 @@ func (ex *Explain) calculateMaximums(plan *Plan) {
 	if ex.MaxDuration < plan.ActualDuration {
 		ex.MaxDuration = plan.ActualDuration
 	}
+	if blocks := plan.ExclusiveSharedHitBlocks + plan.ExclusiveSharedReadBlocks; ex.MaxExclusiveSharedBlocks < blocks {
+		ex.MaxExclusiveSharedBlocks = blocks
+	}
 }
 
 func (ex *Explain) calculateOutlierNodes(plan *Plan) {
-	p := ex.Config.Params
-
 	plan.Costliest = plan.ActualCost == ex.MaxCost
 	plan.Largest = plan.ActualRows == ex.MaxRows
-	plan.Slowest = plan.ActualDuration == ex.MaxDuration
-
-	if plan.NodeType == IndexScan && plan.RowsRemovedByFilter > p.IndexIneffHighFilteredMin {
-		ex.IndexIneffHighFiltered = true
-	}
-
-	if plan.NodeType == IndexOnlyScan && plan.HeapFetches > p.VacuumAnalyzeNeededFetchesMin {
-		ex.VacuumAnalyzeNeeded = true
-	}
+	plan.Slowest = ex.MaxDuration > 0 && plan.ActualDuration == ex.MaxDuration
 
 	for index := range plan.Plans {
 		ex.calculateOutlierNodes(&plan.Plans[index])
 	}
 }
 
-func (config *ExplainConfig) getTipByCode(code string) (Tip, error) {
-	tips := config.Tips
-	for _, tip := range tips {
-		if tip.Code == code {
-			return tip, nil
-		}
+func shareBlocks(blocks uint64, share float64) uint64 {
+	return uint64(math.Round(float64(blocks) * share))
+}
+
+func subtractBlocks(blocks, sub uint64) uint64 {
+	if sub > blocks {
+		return 0
 	}
 
-	return Tip{}, errors.New("Tip not found, check your explain config")
+	return blocks - sub
 }
 
 func (ex *Explain) writeExplainText(writer io.Writer) {
@@ -480,6 +820,56 @@ func (ex *Explain) writeStatsText(writer io.Writer) {
 	if ex.TempWrittenBlocks > 0 {
 		ex.writeBlocks(writer, "writes", ex.TempWrittenBlocks, "")
 	}
+
+	if p := ex.Planning; p != nil && (p.SharedHitBlocks > 0 || p.SharedReadBlocks > 0 ||
+		p.SharedDirtiedBlocks > 0 || p.SharedWrittenBlocks > 0) {
+		fmt.Fprintf(writer, "\nPlanning buffers:\n")
+		ex.writeBlocks(writer, "hits", p.SharedHitBlocks, "")
+		ex.writeBlocks(writer, "reads", p.SharedReadBlocks, "")
+		ex.writeBlocks(writer, "dirtied", p.SharedDirtiedBlocks, "")
+		ex.writeBlocks(writer, "writes", p.SharedWrittenBlocks, "")
+	}
+
+	if ex.WALRecords > 0 || ex.WALFPI > 0 || ex.WALBytes > 0 {
+		fmt.Fprintf(writer, "\nWAL:\n")
+		fmt.Fprintf(writer, "  - records: %d\n", ex.WALRecords)
+		fmt.Fprintf(writer, "  - full page images: %d\n", ex.WALFPI)
+		fmt.Fprintf(writer, "  - bytes: %d (~%s)\n", ex.WALBytes, IBytes(ex.WALBytes, "%.02f %s"))
+	}
+
+	if ex.JIT != nil {
+		timing := ex.JIT.Timing
+		options := ex.JIT.Options
+
+		fmt.Fprintf(writer, "\nJIT:\n")
+		fmt.Fprintf(writer, "  - functions: %d\n", ex.JIT.Functions)
+		fmt.Fprintf(writer, "  - options: inlining %t, optimization %t, expressions %t, deforming %t\n",
+			options.Inlining, options.Optimization, options.Expressions, options.Deforming)
+		fmt.Fprintf(writer, "  - time: %s\n", util.MillisecondsToString(float64(timing.Total)))
+		fmt.Fprintf(writer, "    - generation: %s\n", util.MillisecondsToString(float64(timing.Generation)))
+		fmt.Fprintf(writer, "    - inlining: %s\n", util.MillisecondsToString(float64(timing.Inlining)))
+		fmt.Fprintf(writer, "    - optimization: %s\n", util.MillisecondsToString(float64(timing.Optimization)))
+		fmt.Fprintf(writer, "    - emission: %s\n", util.MillisecondsToString(float64(timing.Emission)))
+	}
+
+	if len(ex.Settings) > 0 {
+		names := make([]string, 0, len(ex.Settings))
+		for name := range ex.Settings {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		fmt.Fprintf(writer, "\nSettings:\n")
+
+		for _, name := range names {
+			fmt.Fprintf(writer, "  - %s: %s\n", name, ex.Settings[name])
+		}
+	}
+
+	if ex.TimingOff {
+		fmt.Fprintf(writer, "\nTiming of nodes is not collected (TIMING OFF), exclusive time is not available.\n")
+	}
 }
 
 func (ex *Explain) writeBlocks(writer io.Writer, name string, blocks uint64, cmmt string) {
@@ -534,8 +924,21 @@ func writeSubplanTextNodeCaption(outputFn func(string, ...interface{}) (int, err
 
 func planCostsAndTiming(plan *Plan) string {
 	costs := fmt.Sprintf("(cost=%.2f..%.2f rows=%d width=%d)", plan.StartupCost, plan.TotalCost, plan.PlanRows, plan.PlanWidth)
+
+	if !plan.Analyzed {
+		return fmt.Sprintf("  %s", costs)
+	}
+
 	timing := fmt.Sprintf("(actual time=%.3f..%.3f rows=%d loops=%d)", plan.ActualStartupTime, plan.ActualTotalTime, plan.ActualRows, plan.ActualLoops)
 
+	switch {
+	case plan.ActualLoops == 0:
+		timing = "(never executed)"
+
+	case plan.TimingOff:
+		timing = fmt.Sprintf("(actual rows=%d loops=%d)", plan.ActualRows, plan.ActualLoops)
+	}
+
 	return fmt.Sprintf("  %s %s", costs, timing)
 }
 
@@ -622,6 +1025,10 @@ func writePlanTextNodeDetails(outputFn func(string, ...interface{}) (int, error)
 		outputFn("Sort Key: %s", keys)
 	}
 
+	if len(plan.PresortedKey) > 0 {
+		outputFn("Presorted Key: %s", strings.Join(plan.PresortedKey, ", "))
+	}
+
 	if plan.SortMethod != "" || plan.SortSpaceType != "" {
 		details := ""
 		if plan.SortMethod != "" {
@@ -636,6 +1043,9 @@ func writePlanTextNodeDetails(outputFn func(string, ...interface{}) (int, error)
 		outputFn("%s", details)
 	}
 
+	writeSortGroupsText(outputFn, "Full-sort", plan.FullSortGroups)
+	writeSortGroupsText(outputFn, "Pre-sorted", plan.PreSortedGroups)
+
 	if len(plan.GroupKey) > 0 {
 		keys := ""
 		for _, key := range plan.GroupKey {
@@ -647,6 +1057,19 @@ func writePlanTextNodeDetails(outputFn func(string, ...interface{}) (int, error)
 		outputFn("Group Key: %s", keys)
 	}
 
+	if plan.CacheKey != "" {
+		outputFn("Cache Key: %s", plan.CacheKey)
+	}
+
+	if plan.CacheMode != "" {
+		outputFn("Cache Mode: %s", plan.CacheMode)
+	}
+
+	if plan.NodeType == Memoize && plan.ActualLoops > 0 {
+		outputFn("Hits: %d  Misses: %d  Evictions: %d  Overflows: %d  Memory Usage: %dkB",
+			plan.CacheHits, plan.CacheMisses, plan.CacheEvictions, plan.CacheOverflows, plan.PeakMemoryUsage)
+	}
+
 	if plan.HashBuckets != 0 {
 		outputFn("Buckets: %d  Batches: %d  Memory Usage: %dkB", plan.HashBuckets, plan.HashBatches, plan.PeakMemoryUsage)
 	}
@@ -655,6 +1078,10 @@ func writePlanTextNodeDetails(outputFn func(string, ...interface{}) (int, error)
 		outputFn("Index Cond: %v", plan.IndexCondition)
 	}
 
+	if plan.TidCondition != "" {
+		outputFn("TID Cond: %v", plan.TidCondition)
+	}
+
 	if plan.MergeCondition != "" {
 		outputFn("Merge Cond: %v", plan.MergeCondition)
 	}
@@ -667,9 +1094,24 @@ func writePlanTextNodeDetails(outputFn func(string, ...interface{}) (int, error)
 		outputFn("Hash Cond: %v", plan.HashCondition)
 	}
 
+	if plan.JoinFilter != "" {
+		outputFn("Join Filter: %v", plan.JoinFilter)
+
+		if plan.Analyzed {
+			outputFn("Rows Removed by Join Filter: %d", plan.RowsRemovedByJoinFilter)
+		}
+	}
+
 	if plan.Filter != "" {
 		outputFn("Filter: %v", plan.Filter)
-		outputFn("Rows Removed by Filter: %d", plan.RowsRemovedByFilter)
+
+		if plan.Analyzed {
+			outputFn("Rows Removed by Filter: %d", plan.RowsRemovedByFilter)
+		}
+	}
+
+	if plan.OneTimeFilter != "" {
+		outputFn("One-Time Filter: %v", plan.OneTimeFilter)
 	}
 
 	if plan.WorkersPlanned > 0 {
@@ -677,54 +1119,130 @@ func writePlanTextNodeDetails(outputFn func(string, ...interface{}) (int, error)
 		outputFn("Workers Launched: %d", plan.WorkersLaunched)
 	}
 
-	buffers := ""
-	if plan.SharedDirtiedBlocks > 0 || plan.SharedHitBlocks > 0 || plan.SharedReadBlocks > 0 || plan.SharedWrittenBlocks > 0 {
-		buffers += "shared"
-		if plan.SharedHitBlocks > 0 {
-			buffers += fmt.Sprintf(" hit=%d", plan.SharedHitBlocks)
-		}
-		if plan.SharedReadBlocks > 0 {
-			buffers += fmt.Sprintf(" read=%d", plan.SharedReadBlocks)
-		}
-		if plan.SharedDirtiedBlocks > 0 {
-			buffers += fmt.Sprintf(" dirtied=%d", plan.SharedDirtiedBlocks)
-		}
-		if plan.SharedWrittenBlocks > 0 {
-			buffers += fmt.Sprintf(" written=%d", plan.SharedWrittenBlocks)
-		}
+	if plan.SingleCopy {
+		outputFn("Single Copy: true")
+	}
+
+	if plan.SubplansRemoved > 0 {
+		outputFn("Subplans Removed: %d", plan.SubplansRemoved)
+	}
+
+	writeBuffersText(outputFn,
+		[]uint64{plan.SharedHitBlocks, plan.SharedReadBlocks, plan.SharedDirtiedBlocks, plan.SharedWrittenBlocks},
+		[]uint64{plan.LocalHitBlocks, plan.LocalReadBlocks, plan.LocalDirtiedBlocks, plan.LocalWrittenBlocks})
+	writeIOTimingsText(outputFn, plan.IOReadTime, plan.IOWriteTime)
+
+	wal := ""
+	if plan.WALRecords > 0 {
+		wal += fmt.Sprintf(" records=%d", plan.WALRecords)
+	}
+	if plan.WALFPI > 0 {
+		wal += fmt.Sprintf(" fpi=%d", plan.WALFPI)
+	}
+	if plan.WALBytes > 0 {
+		wal += fmt.Sprintf(" bytes=%d", plan.WALBytes)
+	}
+
+	if len(wal) > 0 {
+		outputFn("WAL:%s", wal)
+	}
+
+	for _, worker := range plan.Workers {
+		writeWorkerText(outputFn, worker, plan.TimingOff)
+	}
+}
+
+// writeWorkerText renders stats of a parallel worker.
+func writeWorkerText(outputFn func(string, ...interface{}) (int, error), worker Worker, timingOff bool) {
+	if timingOff {
+		outputFn("Worker %d:  actual rows=%d loops=%d", worker.WorkerNumber, worker.ActualRows, worker.ActualLoops)
+	} else {
+		outputFn("Worker %d:  actual time=%.3f..%.3f rows=%d loops=%d",
+			worker.WorkerNumber, worker.ActualStartupTime, worker.ActualTotalTime, worker.ActualRows, worker.ActualLoops)
+	}
+
+	var workerOutputFn = func(format string, a ...interface{}) (int, error) {
+		return outputFn("  "+format, a...)
+	}
+
+	if worker.SortMethod != "" {
+		workerOutputFn("Sort Method: %s  %s: %dkB", worker.SortMethod, worker.SortSpaceType, worker.SortSpaceUsed)
 	}
-	if plan.LocalDirtiedBlocks > 0 || plan.LocalHitBlocks > 0 || plan.LocalReadBlocks > 0 || plan.LocalWrittenBlocks > 0 {
+
+	writeBuffersText(workerOutputFn,
+		[]uint64{worker.SharedHitBlocks, worker.SharedReadBlocks, worker.SharedDirtiedBlocks, worker.SharedWrittenBlocks},
+		[]uint64{worker.LocalHitBlocks, worker.LocalReadBlocks, worker.LocalDirtiedBlocks, worker.LocalWrittenBlocks})
+	writeIOTimingsText(workerOutputFn, worker.IOReadTime, worker.IOWriteTime)
+}
+
+// writeBuffersText renders shared and local buffers given as hit, read, dirtied and written blocks.
+func writeBuffersText(outputFn func(string, ...interface{}) (int, error), shared, local []uint64) {
+	buffers := formatBuffers("shared", shared)
+
+	if localBuffers := formatBuffers("local", local); localBuffers != "" {
 		if buffers != "" {
 			buffers += " "
 		}
-		buffers += "local"
-		if plan.LocalHitBlocks > 0 {
-			buffers += fmt.Sprintf(" hit=%d", plan.LocalHitBlocks)
-		}
-		if plan.LocalReadBlocks > 0 {
-			buffers += fmt.Sprintf(" read=%d", plan.LocalReadBlocks)
-		}
-		if plan.LocalDirtiedBlocks > 0 {
-			buffers += fmt.Sprintf(" dirtied=%d", plan.LocalDirtiedBlocks)
-		}
-		if plan.LocalWrittenBlocks > 0 {
-			buffers += fmt.Sprintf(" written=%d", plan.LocalWrittenBlocks)
-		}
+		buffers += localBuffers
 	}
 
 	if buffers != "" {
 		outputFn("Buffers: %s", buffers)
 	}
+}
+
+func formatBuffers(scope string, blocks []uint64) string {
+	buffers := ""
+
+	for index, name := range []string{"hit", "read", "dirtied", "written"} {
+		if blocks[index] > 0 {
+			buffers += fmt.Sprintf(" %s=%d", name, blocks[index])
+		}
+	}
 
+	if buffers == "" {
+		return ""
+	}
+
+	return scope + buffers
+}
+
+func writeIOTimingsText(outputFn func(string, ...interface{}) (int, error), readTime, writeTime float64) {
 	ioTiming := ""
-	if plan.IOReadTime > 0 {
-		ioTiming += fmt.Sprintf(" read=%.3f", plan.IOReadTime)
+	if readTime > 0 {
+		ioTiming += fmt.Sprintf(" read=%.3f", readTime)
 	}
-	if plan.IOWriteTime > 0 {
-		ioTiming += fmt.Sprintf(" write=%.3f", plan.IOWriteTime)
+	if writeTime > 0 {
+		ioTiming += fmt.Sprintf(" write=%.3f", writeTime)
 	}
 
 	if len(ioTiming) > 0 {
 		outputFn("I/O Timings:%s", ioTiming)
 	}
 }
+
+// writeSortGroupsText renders groups of Incremental Sort, e.g. "Full-sort Groups: 1  Sort Method: quicksort  ...".
+func writeSortGroupsText(outputFn func(string, ...interface{}) (int, error), label string, groups *SortGroups) {
+	if groups == nil || groups.GroupCount == 0 {
+		return
+	}
+
+	methods := "Sort Method"
+	if len(groups.SortMethodsUsed) > 1 {
+		methods = "Sort Methods"
+	}
+
+	details := fmt.Sprintf("%s Groups: %d  %s: %s", label, groups.GroupCount, methods, strings.Join(groups.SortMethodsUsed, ", "))
+
+	if groups.SortSpaceMemory != nil {
+		details += fmt.Sprintf("  Average Memory: %dkB  Peak Memory: %dkB",
+			groups.SortSpaceMemory.AverageSortSpaceUsed, groups.SortSpaceMemory.PeakSortSpaceUsed)
+	}
+
+	if groups.SortSpaceDisk != nil {
+		details += fmt.Sprintf("  Average Disk: %dkB  Peak Disk: %dkB",
+			groups.SortSpaceDisk.AverageSortSpaceUsed, groups.SortSpaceDisk.PeakSortSpaceUsed)
+	}
+
+	outputFn("%s", details)
+}
@@ -6,11 +6,14 @@ package pgexplain
 
 import (
 	"bytes"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"gitlab.com/postgres-ai/joe/pkg/util"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
+	"gopkg.in/yaml.v2"
 )
 
 func TestVisualize(t *testing.T) {
@@ -38,6 +41,10 @@ func TestVisualize(t *testing.T) {
 			inputJson: InputJSON4,
 			expected:  ExpectedText4,
 		},
+		{
+			inputJson: InputJSON8Modern,
+			expected:  ExpectedText8Modern,
+		},
 	}
 
 	for i, test := range tests {
@@ -102,37 +109,7 @@ func TestVisualizeWithoutCosts(t *testing.T) {
 }
 
 func TestTips(t *testing.T) {
-	explainConfig := ExplainConfig{
-		Params: ParamsConfig{
-			BuffersHitReadSeqScan:         50,
-			BuffersReadBigMax:             100,
-			BuffersHitBigMax:              1000,
-			AddLimitMinRows:               10000,
-			TempWrittenBlocksMin:          0,
-			IndexIneffHighFilteredMin:     100,
-			VacuumAnalyzeNeededFetchesMin: 0,
-		},
-		Tips: []Tip{
-			{
-				Code: "SEQSCAN_USED",
-			},
-			{
-				Code: "TOO_MUCH_DATA",
-			},
-			{
-				Code: "ADD_LIMIT",
-			},
-			{
-				Code: "TEMP_BUF_WRITTEN",
-			},
-			{
-				Code: "INDEX_INEFFICIENT_HIGH_FILTERED",
-			},
-			{
-				Code: "VACUUM_ANALYZE_NEEDED",
-			},
-		},
-	}
+	explainConfig := loadExplainConfig(t)
 
 	tests := []struct {
 		inputJson     string
@@ -252,33 +229,536 @@ func TestTips(t *testing.T) {
 			]`,
 			expectedCodes: []string{"VACUUM_ANALYZE_NEEDED"},
 		},
+		// ROW_ESTIMATE_MISMATCH.
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Index Scan",
+						"Plan Rows": 1000,
+						"Actual Rows": 500,
+						"Actual Loops": 1
+					}
+				}
+			]`,
+			expectedCodes: []string{},
+		},
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Index Scan",
+						"Plan Rows": 1,
+						"Actual Rows": 5000,
+						"Actual Loops": 1
+					}
+				}
+			]`,
+			expectedCodes: []string{"ROW_ESTIMATE_MISMATCH"},
+		},
+		// HASH_BATCHES_SPILLED.
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Hash Join",
+						"Plans": [
+							{
+								"Node Type": "Hash",
+								"Hash Buckets": 1024,
+								"Hash Batches": 1
+							}
+						]
+					}
+				}
+			]`,
+			expectedCodes: []string{},
+		},
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Hash Join",
+						"Plans": [
+							{
+								"Node Type": "Hash",
+								"Hash Buckets": 1024,
+								"Hash Batches": 4
+							}
+						]
+					}
+				}
+			]`,
+			expectedCodes: []string{"HASH_BATCHES_SPILLED"},
+		},
+		// SORT_ON_DISK.
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Sort",
+						"Sort Method": "quicksort",
+						"Sort Space Used": 25,
+						"Sort Space Type": "Memory"
+					}
+				}
+			]`,
+			expectedCodes: []string{},
+		},
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Sort",
+						"Sort Method": "external merge",
+						"Sort Space Used": 2560,
+						"Sort Space Type": "Disk"
+					}
+				}
+			]`,
+			expectedCodes: []string{"SORT_ON_DISK"},
+		},
+		// NESTED_LOOP_INNER_LOOPS.
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Nested Loop",
+						"Plans": [
+							{
+								"Node Type": "Index Scan",
+								"Parent Relationship": "Outer"
+							},
+							{
+								"Node Type": "Index Scan",
+								"Parent Relationship": "Inner",
+								"Actual Loops": 100000
+							}
+						]
+					}
+				}
+			]`,
+			expectedCodes: []string{"NESTED_LOOP_INNER_LOOPS"},
+		},
+		// INDEX_RECHECK_HIGH.
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Bitmap Heap Scan",
+						"Rows Removed by Index Recheck": 50000
+					}
+				}
+			]`,
+			expectedCodes: []string{"INDEX_RECHECK_HIGH"},
+		},
+		// WORKERS_NOT_LAUNCHED.
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Gather",
+						"Actual Loops": 1,
+						"Workers Planned": 2,
+						"Workers Launched": 2
+					}
+				}
+			]`,
+			expectedCodes: []string{},
+		},
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Gather",
+						"Actual Loops": 1,
+						"Workers Planned": 2,
+						"Workers Launched": 0
+					}
+				}
+			]`,
+			expectedCodes: []string{"WORKERS_NOT_LAUNCHED"},
+		},
+		{
+			// Workers are not launched by EXPLAIN without ANALYZE.
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Gather Merge",
+						"Workers Planned": 2
+					}
+				}
+			]`,
+			expectedCodes: []string{},
+		},
+		// JIT_TIME_HIGH.
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Result"
+					},
+					"JIT": {
+						"Functions": 2,
+						"Timing": {
+							"Generation": 0.5,
+							"Total": 1.5
+						}
+					},
+					"Execution Time": 10
+				}
+			]`,
+			expectedCodes: []string{},
+		},
+		{
+			inputJson: `[
+				{
+					"Plan": {
+						"Node Type": "Result"
+					},
+					"JIT": {
+						"Functions": 2,
+						"Timing": {
+							"Generation": {
+								"Deform": 0.5,
+								"Total": 1
+							},
+							"Total": 8.5
+						}
+					},
+					"Execution Time": 10
+				}
+			]`,
+			expectedCodes: []string{"JIT_TIME_HIGH"},
+		},
 	}
 
-	for i, test := range tests {
-		inputJson := test.inputJson
-		expectedCodes := test.expectedCodes
+	// Configurations without conditions use the built-in rules of the known tips.
+	for _, explainConfig := range []ExplainConfig{explainConfig, loadLegacyExplainConfig(t)} {
+		for i, test := range tests {
+			inputJson := test.inputJson
+			expectedCodes := test.expectedCodes
 
-		explain, err := NewExplain(inputJson, explainConfig)
-		if err != nil {
-			t.Errorf("(%d) explain parsing failed: %v", i, err)
-			t.FailNow()
+			explain, err := NewExplain(inputJson, explainConfig)
+			if err != nil {
+				t.Errorf("(%d) explain parsing failed: %v", i, err)
+				t.FailNow()
+			}
+
+			actualTips, err := explain.GetTips()
+			if err != nil {
+				t.Errorf("(%d) tips discover failed: %v", i, err)
+				t.FailNow()
+			}
+
+			actualCodes := getCodes(actualTips)
+
+			if !util.EqualStringSlicesUnordered(actualCodes, expectedCodes) {
+				t.Errorf("(%d) got different than expected: \nActual: %s\nExpected: %s\n",
+					i, actualCodes, expectedCodes)
+			}
 		}
+	}
+}
 
-		actualTips, err := explain.GetTips()
-		if err != nil {
-			t.Errorf("(%d) tips discover failed: %v", i, err)
-			t.FailNow()
+func TestTipsWithoutAnalyze(t *testing.T) {
+	explainConfig := loadExplainConfig(t)
+
+	// Plans of EXPLAIN without ANALYZE have no actual values, so the rules relying on them must not match.
+	inputs := []string{
+		`[
+			{
+				"Plan": {
+					"Node Type": "Gather",
+					"Plan Rows": 500000,
+					"Workers Planned": 2,
+					"Plans": [
+						{
+							"Node Type": "Nested Loop",
+							"Parent Relationship": "Outer",
+							"Plan Rows": 208333,
+							"Plans": [
+								{
+									"Node Type": "Seq Scan",
+									"Parent Relationship": "Outer",
+									"Relation Name": "orders",
+									"Plan Rows": 208333
+								},
+								{
+									"Node Type": "Index Scan",
+									"Parent Relationship": "Inner",
+									"Relation Name": "customers",
+									"Plan Rows": 1
+								}
+							]
+						}
+					]
+				}
+			}
+		]`,
+		`Gather  (cost=1000.00..10633.43 rows=500000 width=8)
+  Workers Planned: 2
+  ->  Parallel Seq Scan on orders  (cost=0.00..9633.33 rows=208333 width=8)
+        Filter: (amount > 10)`,
+	}
+
+	for _, explainConfig := range []ExplainConfig{explainConfig, loadLegacyExplainConfig(t)} {
+		for i, input := range inputs {
+			explain, err := ParseExplain(input, explainConfig)
+			if err != nil {
+				t.Fatalf("(%d) explain parsing failed: %v", i, err)
+			}
+
+			tips, err := explain.GetTips()
+			if err != nil {
+				t.Fatalf("(%d) tips discover failed: %v", i, err)
+			}
+
+			if codes := getCodes(tips); len(codes) != 0 {
+				t.Errorf("(%d) unexpected tips for a plan without ANALYZE: %s", i, codes)
+			}
+		}
+	}
+}
+
+func TestBuiltinTips(t *testing.T) {
+	normalize := func(rule string) string {
+		return strings.Join(strings.Fields(rule), " ")
+	}
+
+	// Built-in rules must match the default configuration.
+	for _, tip := range loadExplainConfig(t).Tips {
+		builtin, ok := builtinTips[tip.Code]
+		if !ok {
+			t.Errorf("(%s) no built-in rule", tip.Code)
+			continue
+		}
+
+		builtin.Code = tip.Code
+		if err := builtin.compile(); err != nil {
+			t.Fatalf("(%s) failed to compile the built-in rule: %v", tip.Code, err)
+		}
+
+		if normalize(builtin.Condition) != normalize(tip.Condition) ||
+			normalize(builtin.NodeCondition) != normalize(tip.NodeCondition) ||
+			builtin.Scope != tip.Scope || builtin.Severity != tip.Severity ||
+			builtin.Metric != tip.Metric || builtin.Value != tip.Value {
+			t.Errorf("(%s) the built-in rule differs from explain.yaml", tip.Code)
+		}
+	}
+}
+
+func TestDeprecatedTipFlags(t *testing.T) {
+	explain, err := NewExplain(`[{"Plan": {"Node Type": "Seq Scan", "Plans": [
+		{"Node Type": "Index Only Scan", "Heap Fetches": 10, "Actual Loops": 1}]}}]`, loadExplainConfig(t))
+	if err != nil {
+		t.Fatalf("explain parsing failed: %v", err)
+	}
+
+	if _, err := explain.GetTips(); err != nil {
+		t.Fatalf("tips discover failed: %v", err)
+	}
+
+	if !explain.ContainsSeqScan || !explain.VacuumAnalyzeNeeded || explain.IndexIneffHighFiltered {
+		t.Errorf("unexpected flags: %+v", explain)
+	}
+}
+
+func TestTipNodes(t *testing.T) {
+	explainConfig := loadExplainConfig(t)
+
+	inputJSON := `[
+		{
+			"Plan": {
+				"Node Type": "Nested Loop",
+				"Actual Rows": 10,
+				"Shared Hit Blocks": 1200300,
+				"Shared Read Blocks": 20,
+				"Plans": [
+					{
+						"Node Type": "Seq Scan",
+						"Relation Name": "orders",
+						"Shared Hit Blocks": 1200000,
+						"Shared Read Blocks": 20
+					},
+					{
+						"Node Type": "Index Scan",
+						"Relation Name": "users",
+						"Index Name": "users_pkey",
+						"Rows Removed by Filter": 1500,
+						"Shared Hit Blocks": 300
+					}
+				]
+			}
+		}
+	]`
+
+	explain, err := NewExplain(inputJSON, explainConfig)
+	if err != nil {
+		t.Fatalf("explain parsing failed: %v", err)
+	}
+
+	tips, err := explain.GetTips()
+	if err != nil {
+		t.Fatalf("tips discover failed: %v", err)
+	}
+
+	expected := map[string][]string{
+		"SEQSCAN_USED":                    {"Seq Scan on orders (buffers 1.2M)"},
+		"TOO_MUCH_DATA":                   {"Seq Scan on orders (buffers 1.2M)"},
+		"INDEX_INEFFICIENT_HIGH_FILTERED": {"Index Scan using users_pkey on users (rows removed by filter 1.5k)"},
+	}
+
+	if len(tips) != len(expected) {
+		t.Fatalf("got different number of tips: %v", getCodes(tips))
+	}
+
+	for _, tip := range tips {
+		nodes := make([]string, 0, len(tip.Nodes))
+		for _, node := range tip.Nodes {
+			nodes = append(nodes, node.String())
+		}
+
+		if !util.EqualStringSlicesUnordered(nodes, expected[tip.Code]) {
+			t.Errorf("(%s) got different than expected: \nActual: %s\nExpected: %s\n", tip.Code, nodes, expected[tip.Code])
 		}
+	}
+
+	if path := tips[0].Nodes[0].Path; path != "0.0" {
+		t.Errorf("got different node path: %s", path)
+	}
+}
+
+func TestCustomTip(t *testing.T) {
+	explainConfig := ExplainConfig{
+		Params: ParamsConfig{
+			Custom: map[string]interface{}{"billingRowsMin": 100},
+		},
+		Tips: []Tip{
+			{
+				Code:      "BILLING_SEQSCAN",
+				Severity:  SeverityCritical,
+				Condition: `node.NodeType == "Seq Scan" && node.Schema in ["billing"] && node.ActualRows > params.billingRowsMin`,
+				Message:   "Seq Scan on {{ node.Schema }}.{{ node.RelationName }} ({{ human(node.ActualRows) }} rows)",
+			},
+			{
+				Code:          "SLOW_ROOT",
+				Scope:         ScopePlan,
+				Condition:     "explain.ExecutionTime > 100",
+				NodeCondition: "parent == nil",
+				Message:       "{{ caption(node) }}",
+			},
+		},
+	}
+
+	if err := explainConfig.CompileRules(); err != nil {
+		t.Fatalf("rules compilation failed: %v", err)
+	}
+
+	inputJSON := `[
+		{
+			"Plan": {
+				"Node Type": "Hash Join",
+				"Join Type": "Inner",
+				"Actual Rows": 10,
+				"Plans": [
+					{
+						"Node Type": "Seq Scan",
+						"Schema": "billing",
+						"Relation Name": "invoices",
+						"Actual Rows": 2500
+					},
+					{
+						"Node Type": "Seq Scan",
+						"Schema": "public",
+						"Relation Name": "users",
+						"Actual Rows": 2500
+					}
+				]
+			},
+			"Execution Time": 150.5
+		}
+	]`
 
-		actualCodes := getCodes(actualTips)
+	explain, err := NewExplain(inputJSON, explainConfig)
+	if err != nil {
+		t.Fatalf("explain parsing failed: %v", err)
+	}
+
+	tips, err := explain.GetTips()
+	if err != nil {
+		t.Fatalf("tips discover failed: %v", err)
+	}
+
+	if codes := getCodes(tips); !util.EqualStringSlicesUnordered(codes, []string{"BILLING_SEQSCAN", "SLOW_ROOT"}) {
+		t.Fatalf("got different tips: %v", codes)
+	}
 
-		if !util.EqualStringSlicesUnordered(actualCodes, expectedCodes) {
-			t.Errorf("(%d) got different than expected: \nActual: %s\nExpected: %s\n",
-				i, actualCodes, expectedCodes)
+	if len(tips[0].Nodes) != 1 || tips[0].Nodes[0].String() != "Seq Scan on billing.invoices (2.5k rows)" {
+		t.Errorf("got different nodes: %v", tips[0].Nodes)
+	}
+
+	if len(tips[1].Nodes) != 1 || tips[1].Nodes[0].String() != "Hash Join" {
+		t.Errorf("got different nodes: %v", tips[1].Nodes)
+	}
+}
+
+func TestCompileRulesErrors(t *testing.T) {
+	invalidTips := []Tip{
+		{Code: "NO_CONDITION"},
+		{Code: "BAD_SCOPE", Scope: "query", Condition: "true"},
+		{Code: "BAD_SEVERITY", Severity: "fatal", Condition: "true"},
+		{Code: "BAD_EXPRESSION", Condition: "node.NodeType =="},
+		{Code: "BAD_TEMPLATE", Condition: "true", Message: "{{ node.NodeType"},
+	}
+
+	for _, tip := range invalidTips {
+		explainConfig := ExplainConfig{Tips: []Tip{tip}}
+
+		if err := explainConfig.CompileRules(); err == nil {
+			t.Errorf("(%s) expected an error", tip.Code)
 		}
 	}
 }
 
+// loadLegacyExplainConfig loads the default explain configuration without rules of tips.
+func loadLegacyExplainConfig(t *testing.T) ExplainConfig {
+	explainConfig := loadExplainConfig(t)
+
+	tips := make([]Tip, 0, len(explainConfig.Tips))
+	for _, tip := range explainConfig.Tips {
+		tips = append(tips, Tip{Code: tip.Code, Name: tip.Name, Description: tip.Description, DetailsUrl: tip.DetailsUrl})
+	}
+
+	explainConfig.Tips = tips
+
+	if err := explainConfig.CompileRules(); err != nil {
+		t.Fatalf("failed to compile legacy explain rules: %v", err)
+	}
+
+	return explainConfig
+}
+
+// loadExplainConfig loads the default explain configuration.
+func loadExplainConfig(t *testing.T) ExplainConfig {
+	var explainConfig ExplainConfig
+
+	b, err := ioutil.ReadFile("../../config/explain.yaml")
+	if err != nil {
+		t.Fatalf("failed to read explain config: %v", err)
+	}
+
+	if err := yaml.Unmarshal(b, &explainConfig); err != nil {
+		t.Fatalf("failed to parse explain config: %v", err)
+	}
+
+	if err := explainConfig.CompileRules(); err != nil {
+		t.Fatalf("failed to compile explain rules: %v", err)
+	}
+
+	return explainConfig
+}
+
 func getCodes(tips []Tip) []string {
 	if len(tips) == 0 {
 		return make([]string, 0)
@@ -1547,7 +2027,6 @@ const ExpectedText5HashJoinAndNestedLoop = ` Nested Loop Left Join
    ->  Hash Right Join
          Hash Cond: (u1.u1y = "*VALUES*_1".column2)
          Filter: ("*VALUES*_1".column1 = "*VALUES*".column1)
-         Rows Removed by Filter: 0
          ->  Function Scan on unnest u1
          ->  Hash
                ->  Values Scan on "*VALUES*_1"
@@ -1678,18 +2157,14 @@ const ExpectedText6SubqueryScan = ` Nested Loop
                      ->  Materialize
                            ->  Seq Scan on text_tbl tt1
                                  Filter: (f1 = 'foo'::text)
-                                 Rows Removed by Filter: 0
                ->  Materialize
                      ->  Seq Scan on text_tbl tt3
                            Filter: (f1 = 'foo'::text)
-                           Rows Removed by Filter: 0
          ->  Hash
                ->  Seq Scan on text_tbl tt4
                      Filter: (f1 = 'foo'::text)
-                     Rows Removed by Filter: 0
    ->  Subquery Scan on ss1
          Filter: (ss1.c0 = 'foo'::text)
-         Rows Removed by Filter: 0
          ->  Limit
                ->  Seq Scan on text_tbl tt5
 `
@@ -1845,3 +2320,221 @@ const ExpectedText7AntiJoin = ` Hash Anti Join
                                  Sort Key: t3.c1
                                  ->  Seq Scan on tt4x t3
 `
+
+const InputJSON8Modern = `[
+  {
+    "Plan": {
+      "Node Type": "Gather Merge",
+      "Parallel Aware": false,
+      "Async Capable": false,
+      "Startup Cost": 1062.93,
+      "Total Cost": 1180.02,
+      "Plan Rows": 1000,
+      "Plan Width": 16,
+      "Actual Startup Time": 4.913,
+      "Actual Total Time": 6.211,
+      "Actual Rows": 1000,
+      "Actual Loops": 1,
+      "Workers Planned": 2,
+      "Workers Launched": 2,
+      "Shared Hit Blocks": 2120,
+      "Shared Read Blocks": 5,
+      "WAL Records": 3,
+      "WAL FPI": 1,
+      "WAL Bytes": 8402,
+      "Plans": [
+        {
+          "Node Type": "Incremental Sort",
+          "Parent Relationship": "Outer",
+          "Parallel Aware": false,
+          "Async Capable": false,
+          "Startup Cost": 62.91,
+          "Total Cost": 164.49,
+          "Plan Rows": 417,
+          "Plan Width": 16,
+          "Actual Startup Time": 0.832,
+          "Actual Total Time": 1.624,
+          "Actual Rows": 333,
+          "Actual Loops": 3,
+          "Sort Key": ["t.a", "t.b"],
+          "Presorted Key": ["t.a"],
+          "Full-sort Groups": {
+            "Group Count": 11,
+            "Sort Methods Used": ["quicksort"],
+            "Sort Space Memory": {
+              "Average Sort Space Used": 26,
+              "Peak Sort Space Used": 26
+            }
+          },
+          "Pre-sorted Groups": {
+            "Group Count": 2,
+            "Sort Methods Used": ["top-N heapsort", "quicksort"],
+            "Sort Space Memory": {
+              "Average Sort Space Used": 30,
+              "Peak Sort Space Used": 31
+            }
+          },
+          "Shared Hit Blocks": 2120,
+          "Shared Read Blocks": 5,
+          "WAL Records": 3,
+          "WAL FPI": 1,
+          "WAL Bytes": 8402,
+          "Plans": [
+            {
+              "Node Type": "Nested Loop",
+              "Parent Relationship": "Outer",
+              "Parallel Aware": false,
+              "Async Capable": false,
+              "Join Type": "Inner",
+              "Startup Cost": 0.57,
+              "Total Cost": 150.23,
+              "Plan Rows": 417,
+              "Plan Width": 16,
+              "Actual Startup Time": 0.041,
+              "Actual Total Time": 1.302,
+              "Actual Rows": 333,
+              "Actual Loops": 3,
+              "Inner Unique": false,
+              "Shared Hit Blocks": 2120,
+              "Shared Read Blocks": 5,
+              "WAL Records": 3,
+              "WAL FPI": 1,
+              "WAL Bytes": 8402,
+              "Plans": [
+                {
+                  "Node Type": "Index Scan",
+                  "Parent Relationship": "Outer",
+                  "Parallel Aware": true,
+                  "Async Capable": false,
+                  "Scan Direction": "Forward",
+                  "Index Name": "t_a_idx",
+                  "Relation Name": "t",
+                  "Alias": "t",
+                  "Startup Cost": 0.28,
+                  "Total Cost": 48.34,
+                  "Plan Rows": 417,
+                  "Plan Width": 12,
+                  "Actual Startup Time": 0.018,
+                  "Actual Total Time": 0.311,
+                  "Actual Rows": 333,
+                  "Actual Loops": 3,
+                  "Shared Hit Blocks": 1110,
+                  "Shared Read Blocks": 5,
+                  "WAL Records": 3,
+                  "WAL FPI": 1,
+                  "WAL Bytes": 8402
+                },
+                {
+                  "Node Type": "Memoize",
+                  "Parent Relationship": "Inner",
+                  "Parallel Aware": false,
+                  "Async Capable": false,
+                  "Startup Cost": 0.29,
+                  "Total Cost": 0.31,
+                  "Plan Rows": 1,
+                  "Plan Width": 8,
+                  "Actual Startup Time": 0.001,
+                  "Actual Total Time": 0.001,
+                  "Actual Rows": 1,
+                  "Actual Loops": 1000,
+                  "Cache Key": "t.c",
+                  "Cache Mode": "logical",
+                  "Cache Hits": 990,
+                  "Cache Misses": 10,
+                  "Cache Evictions": 0,
+                  "Cache Overflows": 0,
+                  "Peak Memory Usage": 2,
+                  "Shared Hit Blocks": 1010,
+                  "Plans": [
+                    {
+                      "Node Type": "Tid Range Scan",
+                      "Parent Relationship": "Outer",
+                      "Parallel Aware": false,
+                      "Async Capable": false,
+                      "Relation Name": "u",
+                      "Alias": "u",
+                      "Startup Cost": 0.01,
+                      "Total Cost": 0.28,
+                      "Plan Rows": 1,
+                      "Plan Width": 8,
+                      "Actual Startup Time": 0.009,
+                      "Actual Total Time": 0.010,
+                      "Actual Rows": 1,
+                      "Actual Loops": 10,
+                      "TID Cond": "((u.ctid >= '(0,1)'::tid) AND (u.ctid < '(10,1)'::tid))",
+                      "Filter": "(u.id = t.c)",
+                      "Rows Removed by Filter": 0,
+                      "Shared Hit Blocks": 1010
+                    }
+                  ]
+                }
+              ]
+            }
+          ]
+        }
+      ]
+    },
+    "Planning": {
+      "Shared Hit Blocks": 24,
+      "Shared Read Blocks": 3,
+      "Shared Dirtied Blocks": 0,
+      "Shared Written Blocks": 0,
+      "Local Hit Blocks": 0,
+      "Local Read Blocks": 0,
+      "Local Dirtied Blocks": 0,
+      "Local Written Blocks": 0,
+      "Temp Read Blocks": 0,
+      "Temp Written Blocks": 0
+    },
+    "Planning Time": 0.452,
+    "Triggers": [
+    ],
+    "JIT": {
+      "Functions": 12,
+      "Options": {
+        "Inlining": false,
+        "Optimization": false,
+        "Expressions": true,
+        "Deforming": true
+      },
+      "Timing": {
+        "Generation": 1.012,
+        "Inlining": 0.000,
+        "Optimization": 0.541,
+        "Emission": 2.870,
+        "Total": 4.423
+      }
+    },
+    "Execution Time": 11.504
+  }
+]`
+
+const ExpectedText8Modern = ` Gather Merge  (cost=1062.93..1180.02 rows=1000 width=16) (actual time=4.913..6.211 rows=1000 loops=1)
+   Workers Planned: 2
+   Workers Launched: 2
+   Buffers: shared hit=2120 read=5
+   WAL: records=3 fpi=1 bytes=8402
+   ->  Incremental Sort  (cost=62.91..164.49 rows=417 width=16) (actual time=0.832..1.624 rows=333 loops=3)
+         Sort Key: t.a, t.b
+         Presorted Key: t.a
+         Full-sort Groups: 11  Sort Method: quicksort  Average Memory: 26kB  Peak Memory: 26kB
+         Pre-sorted Groups: 2  Sort Methods: top-N heapsort, quicksort  Average Memory: 30kB  Peak Memory: 31kB
+         Buffers: shared hit=2120 read=5
+         WAL: records=3 fpi=1 bytes=8402
+         ->  Nested Loop  (cost=0.57..150.23 rows=417 width=16) (actual time=0.041..1.302 rows=333 loops=3)
+               Buffers: shared hit=2120 read=5
+               WAL: records=3 fpi=1 bytes=8402
+               ->  Parallel Index Scan using t_a_idx on t  (cost=0.28..48.34 rows=417 width=12) (actual time=0.018..0.311 rows=333 loops=3)
+                     Buffers: shared hit=1110 read=5
+                     WAL: records=3 fpi=1 bytes=8402
+               ->  Memoize  (cost=0.29..0.31 rows=1 width=8) (actual time=0.001..0.001 rows=1 loops=1000)
+                     Cache Key: t.c
+                     Cache Mode: logical
+                     Hits: 990  Misses: 10  Evictions: 0  Overflows: 0  Memory Usage: 2kB
+                     Buffers: shared hit=1010
+                     ->  Tid Range Scan on u  (cost=0.01..0.28 rows=1 width=8) (actual time=0.009..0.010 rows=1 loops=10)
+                           TID Cond: ((u.ctid >= '(0,1)'::tid) AND (u.ctid < '(10,1)'::tid))
+                           Filter: (u.id = t.c)
+                           Rows Removed by Filter: 0
+                           Buffers: shared hit=1010
+`
@@ -0,0 +1,393 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"gitlab.com/postgres-ai/joe/pkg/pgexplain/expr"
+)
+
+// Tip scopes.
+const (
+	// ScopeNode checks the tip condition for every plan node.
+	ScopeNode = "node"
+
+	// ScopePlan checks the tip condition once for the whole plan.
+	ScopePlan = "plan"
+)
+
+// Tip severities.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// tipRule contains compiled expressions of a tip.
+type tipRule struct {
+	condition     *expr.Expression
+	nodeCondition *expr.Expression
+	value         *expr.Expression
+	metric        *expr.Template
+	message       *expr.Template
+}
+
+// builtinTips defines rules of the known tips. They are used if a tip is configured without a condition,
+// e.g. in explain.yaml files created before tips were defined as rules.
+var builtinTips = map[string]Tip{
+	TIP_SEQSCAN_USED: {
+		Condition: `node.NodeType == "Seq Scan" && explain.SharedHitBlocks + explain.SharedReadBlocks > params.buffersHitReadSeqScan`,
+		Metric:    "buffers",
+		Value:     "node.SharedHitBlocks + node.SharedReadBlocks",
+	},
+	TIP_TOO_MUCH_DATA: {
+		Scope:     ScopePlan,
+		Condition: "explain.SharedReadBlocks > params.buffersReadBigMax || explain.SharedHitBlocks > params.buffersHitBigMax",
+		NodeCondition: "node.ExclusiveSharedReadBlocks > params.buffersReadBigMax || " +
+			"node.ExclusiveSharedHitBlocks > params.buffersHitBigMax || " +
+			"node.ExclusiveSharedHitBlocks + node.ExclusiveSharedReadBlocks == explain.MaxExclusiveSharedBlocks",
+		Metric: "buffers",
+		Value:  "node.ExclusiveSharedHitBlocks + node.ExclusiveSharedReadBlocks",
+	},
+	TIP_ADD_LIMIT: {
+		Scope:         ScopePlan,
+		Severity:      SeverityInfo,
+		Condition:     `explain.ActualRows > params.addLimitMinRows && plan.NodeType != "Limit"`,
+		NodeCondition: "parent == nil",
+		Metric:        "rows",
+		Value:         "node.ActualRows",
+	},
+	TIP_TEMP_BUF_WRITTEN: {
+		Scope:         ScopePlan,
+		Condition:     "explain.TempWrittenBlocks > params.tempWrittenBlocksMin",
+		NodeCondition: "node.ExclusiveTempWrittenBlocks > 0",
+		Metric:        "temp written",
+		Value:         "node.ExclusiveTempWrittenBlocks",
+	},
+	TIP_INDEX_INEFFICIENT_HIGH_FILTERED: {
+		Condition: `node.NodeType == "Index Scan" && node.RowsRemovedByFilter > params.indexIneffHighFilteredMin`,
+		Metric:    "rows removed by filter",
+		Value:     "node.RowsRemovedByFilter",
+	},
+	TIP_VACUUM_ANALYZE_NEEDED: {
+		Condition: `node.NodeType == "Index Only Scan" && node.HeapFetches > params.vacuumAnalyzeNeededFetchesMin`,
+		Metric:    "heap fetches",
+		Value:     "node.HeapFetches",
+	},
+	TIP_ROW_ESTIMATE_MISMATCH: {
+		Condition: "node.ActualLoops > 0 && node.PlannerRowEstimateFactor >= params.rowEstimateFactorMin && " +
+			"(node.PlanRows >= params.rowEstimateRowsMin || node.ActualRows >= params.rowEstimateRowsMin)",
+		Metric: "{{ lower(node.PlannerRowEstimateDirection) }}-estimated rows by factor",
+		Value:  "node.PlannerRowEstimateFactor",
+	},
+	TIP_HASH_BATCHES_SPILLED: {
+		Condition: `node.NodeType == "Hash" && node.HashBatches > params.hashBatchesMax`,
+		Metric:    "batches",
+		Value:     "node.HashBatches",
+	},
+	TIP_SORT_ON_DISK: {
+		Condition: `startsWith(node.SortMethod, "external") && node.SortSpaceUsed >= params.sortDiskSpaceMin`,
+		Metric:    "disk kB",
+		Value:     "node.SortSpaceUsed",
+	},
+	TIP_NESTED_LOOP_INNER_LOOPS: {
+		Condition: `parent.NodeType == "Nested Loop" && node.ParentRelationship == "Inner" && ` +
+			`node.ActualLoops > params.nestedLoopInnerLoopsMin`,
+		Metric: "loops",
+		Value:  "node.ActualLoops",
+	},
+	TIP_INDEX_RECHECK_HIGH: {
+		Condition: `node.NodeType == "Bitmap Heap Scan" && node.RowsRemovedByIndexRecheck > params.indexRecheckRowsMin`,
+		Metric:    "rows removed by index recheck",
+		Value:     "node.RowsRemovedByIndexRecheck",
+	},
+	TIP_WORKERS_NOT_LAUNCHED: {
+		Severity:  SeverityInfo,
+		Condition: "node.ActualLoops > 0 && node.WorkersLaunched < node.WorkersPlanned",
+		Metric:    "workers launched",
+		Value:     "node.WorkersLaunched",
+	},
+	TIP_JIT_TIME_HIGH: {
+		Scope:     ScopePlan,
+		Severity:  SeverityInfo,
+		Condition: "explain.JIT != nil && explain.JIT.Timing.Total > explain.ExecutionTime * params.jitTimeRatioMax",
+	},
+}
+
+// CompileRules validates and compiles tip rules.
+func (config *ExplainConfig) CompileRules() error {
+	for i := range config.Tips {
+		if err := config.Tips[i].compile(); err != nil {
+			return errors.Wrapf(err, "invalid tip %q", config.Tips[i].Code)
+		}
+	}
+
+	return nil
+}
+
+func (tip *Tip) compile() error {
+	if tip.Condition == "" {
+		builtin, ok := builtinTips[tip.Code]
+		if !ok {
+			return errors.New("condition is required")
+		}
+
+		tip.useBuiltinRule(builtin)
+	}
+
+	if tip.Scope == "" {
+		tip.Scope = ScopeNode
+	}
+
+	if tip.Severity == "" {
+		tip.Severity = SeverityWarning
+	}
+
+	if tip.Scope != ScopeNode && tip.Scope != ScopePlan {
+		return errors.Errorf("unknown scope %q", tip.Scope)
+	}
+
+	if tip.Severity != SeverityInfo && tip.Severity != SeverityWarning && tip.Severity != SeverityCritical {
+		return errors.Errorf("unknown severity %q", tip.Severity)
+	}
+
+	if tip.Condition == "" {
+		return errors.New("condition is required")
+	}
+
+	rule := &tipRule{}
+
+	var err error
+
+	if rule.condition, err = expr.Compile(tip.Condition); err != nil {
+		return err
+	}
+
+	if tip.NodeCondition != "" {
+		if rule.nodeCondition, err = expr.Compile(tip.NodeCondition); err != nil {
+			return err
+		}
+	}
+
+	if tip.Value != "" {
+		if rule.value, err = expr.Compile(tip.Value); err != nil {
+			return err
+		}
+	}
+
+	if rule.metric, err = expr.CompileTemplate(tip.Metric); err != nil {
+		return err
+	}
+
+	if rule.message, err = expr.CompileTemplate(tip.Message); err != nil {
+		return err
+	}
+
+	tip.rule = rule
+
+	return nil
+}
+
+// useBuiltinRule fills the rule of the tip with the built-in one, configured values are kept.
+func (tip *Tip) useBuiltinRule(builtin Tip) {
+	tip.Condition = builtin.Condition
+
+	if tip.Scope == "" {
+		tip.Scope = builtin.Scope
+	}
+
+	if tip.Severity == "" {
+		tip.Severity = builtin.Severity
+	}
+
+	if tip.NodeCondition == "" {
+		tip.NodeCondition = builtin.NodeCondition
+	}
+
+	if tip.Metric == "" {
+		tip.Metric = builtin.Metric
+	}
+
+	if tip.Value == "" {
+		tip.Value = builtin.Value
+	}
+}
+
+// evalTips checks tip rules against the plan.
+func (ex *Explain) evalTips() ([]Tip, error) {
+	params, err := ex.Config.Params.toMap()
+	if err != nil {
+		return nil, err
+	}
+
+	tips := []Tip{}
+
+	for i := range ex.Config.Tips {
+		if ex.Config.Tips[i].rule == nil {
+			if err := ex.Config.Tips[i].compile(); err != nil {
+				return nil, errors.Wrapf(err, "invalid tip %q", ex.Config.Tips[i].Code)
+			}
+		}
+
+		tip := ex.Config.Tips[i]
+
+		nodes, matched, err := ex.evalTip(tip, params)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to check tip %q", tip.Code)
+		}
+
+		if matched {
+			tip.Nodes = nodes
+			tips = append(tips, tip)
+		}
+	}
+
+	return tips, nil
+}
+
+func (ex *Explain) evalTip(tip Tip, params map[string]interface{}) ([]TipNode, bool, error) {
+	rule := tip.rule
+
+	nodeCondition := rule.condition
+
+	if tip.Scope == ScopePlan {
+		matched, err := rule.condition.EvalBool(ex.ruleEnv(params, nil, nil))
+		if err != nil || !matched {
+			return nil, false, err
+		}
+
+		nodeCondition = rule.nodeCondition
+	}
+
+	nodes := []TipNode{}
+
+	if nodeCondition == nil {
+		return nodes, true, nil
+	}
+
+	var walkErr error
+
+	walkPlan(&ex.Plan, nil, func(plan, parent *Plan) {
+		if walkErr != nil {
+			return
+		}
+
+		env := ex.ruleEnv(params, plan, parent)
+
+		matched, err := nodeCondition.EvalBool(env)
+		if err != nil || !matched {
+			walkErr = err
+			return
+		}
+
+		node, err := newTipNode(rule, plan, env)
+		if err != nil {
+			walkErr = err
+			return
+		}
+
+		nodes = append(nodes, node)
+	})
+
+	if walkErr != nil {
+		return nil, false, walkErr
+	}
+
+	// Node-scoped tips are triggered by nodes only.
+	return nodes, tip.Scope == ScopePlan || len(nodes) > 0, nil
+}
+
+func newTipNode(rule *tipRule, plan *Plan, env expr.Env) (TipNode, error) {
+	node := TipNode{
+		Path:         plan.Path,
+		NodeType:     plan.NodeType,
+		RelationName: plan.RelationName,
+		IndexName:    plan.IndexName,
+	}
+
+	var err error
+
+	if node.Metric, err = rule.metric.Render(env); err != nil {
+		return node, err
+	}
+
+	if rule.value != nil {
+		if node.Value, err = rule.value.EvalNumber(env); err != nil {
+			return node, err
+		}
+	}
+
+	if node.Message, err = rule.message.Render(env); err != nil {
+		return node, err
+	}
+
+	return node, nil
+}
+
+// ruleEnv defines variables and functions available in tip rules.
+func (ex *Explain) ruleEnv(params map[string]interface{}, node, parent *Plan) expr.Env {
+	return expr.Env{
+		Vars: map[string]interface{}{
+			"explain": ex,
+			"plan":    &ex.Plan,
+			"node":    node,
+			"parent":  parent,
+			"params":  params,
+		},
+		Funcs: map[string]expr.Func{
+			"caption": func(args ...interface{}) (interface{}, error) {
+				if len(args) != 1 {
+					return nil, errors.New("expected a plan node")
+				}
+
+				plan, ok := args[0].(*Plan)
+				if !ok {
+					return nil, errors.New("expected a plan node")
+				}
+
+				return planCaption(plan), nil
+			},
+			"human": func(args ...interface{}) (interface{}, error) {
+				if len(args) != 1 {
+					return nil, errors.New("expected a number")
+				}
+
+				value, ok := args[0].(float64)
+				if !ok {
+					return nil, errors.New("expected a number")
+				}
+
+				return formatMetric(value), nil
+			},
+		},
+	}
+}
+
+// toMap returns params by their config names including custom ones.
+func (p ParamsConfig) toMap() (map[string]interface{}, error) {
+	b, err := yaml.Marshal(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal params")
+	}
+
+	params := map[string]interface{}{}
+
+	if err := yaml.Unmarshal(b, &params); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal params")
+	}
+
+	return params, nil
+}
+
+// walkPlan calls fn for the plan node and all its descendants.
+func walkPlan(plan, parent *Plan, fn func(plan, parent *Plan)) {
+	fn(plan, parent)
+
+	for index := range plan.Plans {
+		walkPlan(&plan.Plans[index], plan, fn)
+	}
+}
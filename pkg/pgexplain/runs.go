@@ -0,0 +1,74 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"gitlab.com/postgres-ai/joe/pkg/util"
+)
+
+// RenderRuns renders execution time and shared buffers of repeated runs of a query with their min, median and max values.
+// The first run is marked as cold, its data is less likely to be cached.
+func RenderRuns(runs []*Explain) string {
+	buf := new(bytes.Buffer)
+	writeRunsText(buf, runs)
+
+	return buf.String()
+}
+
+func writeRunsText(writer io.Writer, runs []*Explain) {
+	if len(runs) == 0 {
+		return
+	}
+
+	times := make([]float64, 0, len(runs))
+	hits := make([]float64, 0, len(runs))
+	reads := make([]float64, 0, len(runs))
+
+	fmt.Fprintf(writer, "%-4s %16s %12s %12s\n", "Run", "Execution time", "Shared hit", "Shared read")
+
+	for i, run := range runs {
+		mark := ""
+		if i == 0 {
+			mark = "  (cold)"
+		}
+
+		fmt.Fprintf(writer, "%-4d %16s %12d %12d%s\n", i+1, util.MillisecondsToString(run.ExecutionTime),
+			run.SharedHitBlocks, run.SharedReadBlocks, mark)
+
+		times = append(times, run.ExecutionTime)
+		hits = append(hits, float64(run.SharedHitBlocks))
+		reads = append(reads, float64(run.SharedReadBlocks))
+	}
+
+	minTime, medianTime, maxTime := minMedianMax(times)
+	minHit, medianHit, maxHit := minMedianMax(hits)
+	minRead, medianRead, maxRead := minMedianMax(reads)
+
+	fmt.Fprintf(writer, "\n%-14s %12s %12s %12s\n", "", "min", "median", "max")
+	fmt.Fprintf(writer, "%-14s %12s %12s %12s\n", "Execution time", util.MillisecondsToString(minTime),
+		util.MillisecondsToString(medianTime), util.MillisecondsToString(maxTime))
+	fmt.Fprintf(writer, "%-14s %12.0f %12.1f %12.0f\n", "Shared hit", minHit, medianHit, maxHit)
+	fmt.Fprintf(writer, "%-14s %12.0f %12.1f %12.0f\n", "Shared read", minRead, medianRead, maxRead)
+}
+
+// minMedianMax returns the minimum, median and maximum of values.
+func minMedianMax(values []float64) (float64, float64, float64) {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	median := sorted[middle]
+
+	if len(sorted)%2 == 0 {
+		median = (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[0], median, sorted[len(sorted)-1]
+}
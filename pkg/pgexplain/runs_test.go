@@ -0,0 +1,55 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderRuns(t *testing.T) {
+	runs := []*Explain{
+		{ExecutionTime: 120.5, SharedHitBlocks: 10, SharedReadBlocks: 990},
+		{ExecutionTime: 4.25, SharedHitBlocks: 1000},
+		{ExecutionTime: 3.5, SharedHitBlocks: 1000},
+		{ExecutionTime: 4.75, SharedHitBlocks: 1000},
+	}
+
+	expected := `Run    Execution time   Shared hit  Shared read
+1          120.500 ms           10          990  (cold)
+2            4.250 ms         1000            0
+3            3.500 ms         1000            0
+4            4.750 ms         1000            0
+
+                        min       median          max
+Execution time     3.500 ms     4.500 ms   120.500 ms
+Shared hit               10       1000.0         1000
+Shared read               0          0.0          990
+`
+
+	assert.Equal(t, expected, RenderRuns(runs))
+	assert.Equal(t, "", RenderRuns(nil))
+}
+
+func TestMinMedianMax(t *testing.T) {
+	testCases := []struct {
+		values []float64
+		min    float64
+		median float64
+		max    float64
+	}{
+		{values: []float64{5}, min: 5, median: 5, max: 5},
+		{values: []float64{3, 1, 2}, min: 1, median: 2, max: 3},
+		{values: []float64{4, 1, 3, 2}, min: 1, median: 2.5, max: 4},
+	}
+
+	for _, tc := range testCases {
+		min, median, max := minMedianMax(tc.values)
+		assert.Equal(t, tc.min, min)
+		assert.Equal(t, tc.median, median)
+		assert.Equal(t, tc.max, max)
+	}
+}
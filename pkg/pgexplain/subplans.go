@@ -0,0 +1,178 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	initPlanParamsRe = regexp.MustCompile(`\(returns (\$\d+(?:,\$\d+)*)\)`)
+	initPlanNameRe   = regexp.MustCompile(`^InitPlan \d+`)
+)
+
+// subplanShare defines a part of the subplan attributed to a node.
+type subplanShare struct {
+	plan  *Plan
+	share float64
+}
+
+// subplanOwners defines nodes executing subplans attached to other nodes.
+// CTEs are executed by CTE Scan nodes reading them, and InitPlans by nodes using their params,
+// so time and buffers of such subplans are included into these nodes, not into their parents.
+type subplanOwners struct {
+	owners map[*Plan][]subplanShare
+	moved  map[*Plan]bool
+}
+
+func newSubplanOwners(root *Plan) *subplanOwners {
+	s := &subplanOwners{
+		owners: make(map[*Plan][]subplanShare),
+		moved:  make(map[*Plan]bool),
+	}
+
+	walkPlan(root, nil, func(plan, _ *Plan) {
+		for index := range plan.Plans {
+			child := &plan.Plans[index]
+
+			if child.ParentRelationship != "InitPlan" {
+				continue
+			}
+
+			if strings.HasPrefix(child.SubplanName, "CTE ") {
+				s.addCTE(root, child)
+				continue
+			}
+
+			s.addInitPlan(plan, child)
+		}
+	})
+
+	return s
+}
+
+// addCTE distributes the CTE between CTE Scan nodes by the number of rows they read.
+func (s *subplanOwners) addCTE(root, cte *Plan) {
+	name := strings.TrimPrefix(cte.SubplanName, "CTE ")
+
+	scans := []*Plan{}
+	totalRows := 0.0
+
+	walkPlan(root, nil, func(plan, _ *Plan) {
+		if plan.NodeType == CTEScan && plan.CteName == name {
+			scans = append(scans, plan)
+			totalRows += float64(plan.ActualRows * plan.ActualLoops)
+		}
+	})
+
+	if len(scans) == 0 {
+		return
+	}
+
+	s.moved[cte] = true
+
+	for _, scan := range scans {
+		share := 1 / float64(len(scans))
+		if totalRows > 0 {
+			share = float64(scan.ActualRows*scan.ActualLoops) / totalRows
+		}
+
+		s.owners[scan] = append(s.owners[scan], subplanShare{plan: cte, share: share})
+	}
+}
+
+// addInitPlan attributes the InitPlan to the first descendant of its parent using its params.
+func (s *subplanOwners) addInitPlan(parent, initPlan *Plan) {
+	params := initPlanParams(initPlan.SubplanName)
+	if len(params) == 0 || usesParams(parent, params) {
+		return
+	}
+
+	var owner *Plan
+
+	walkPlan(parent, nil, func(plan, _ *Plan) {
+		if owner == nil && plan != parent && !isDescendant(initPlan, plan) && usesParams(plan, params) {
+			owner = plan
+		}
+	})
+
+	if owner == nil {
+		return
+	}
+
+	s.moved[initPlan] = true
+	s.owners[owner] = append(s.owners[owner], subplanShare{plan: initPlan, share: 1})
+}
+
+func (s *subplanOwners) isMoved(plan *Plan) bool {
+	return s.moved[plan]
+}
+
+func (s *subplanOwners) owned(plan *Plan) []subplanShare {
+	return s.owners[plan]
+}
+
+// initPlanParams returns references to InitPlan results,
+// e.g. "$0" for "InitPlan 1 (returns $0)" or "(InitPlan 1)" for "InitPlan 1" since PG16.
+func initPlanParams(name string) []string {
+	if match := initPlanParamsRe.FindStringSubmatch(name); match != nil {
+		return strings.Split(match[1], ",")
+	}
+
+	if match := initPlanNameRe.FindString(name); match != "" {
+		return []string{"(" + match + ")"}
+	}
+
+	return nil
+}
+
+// usesParams checks if expressions of the node reference any of the params.
+func usesParams(plan *Plan, params []string) bool {
+	expressions := []string{plan.Filter, plan.JoinFilter, plan.OneTimeFilter, plan.IndexCondition,
+		plan.HashCondition, plan.MergeCondition, plan.TidCondition}
+	expressions = append(expressions, plan.Output...)
+
+	for _, expression := range expressions {
+		for _, param := range params {
+			if containsParam(expression, param) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// containsParam checks if the expression contains the param, e.g. "$1" but not "$10".
+func containsParam(expression, param string) bool {
+	for offset := 0; ; {
+		index := strings.Index(expression[offset:], param)
+		if index < 0 {
+			return false
+		}
+
+		end := offset + index + len(param)
+		if end == len(expression) || !isDigit(expression[end]) || !strings.HasPrefix(param, "$") {
+			return true
+		}
+
+		offset = end
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isDescendant(root, plan *Plan) bool {
+	found := false
+
+	walkPlan(root, nil, func(node, _ *Plan) {
+		found = found || node == plan
+	})
+
+	return found
+}
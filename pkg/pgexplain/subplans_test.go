@@ -0,0 +1,251 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgexplain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelActuals(t *testing.T) {
+	testCases := []struct {
+		name              string
+		input             string
+		gatherDuration    float64
+		scanDuration      float64
+		scanInclusiveTime float64
+	}{
+		{
+			name:              "average per process",
+			input:             InputJSONParallel,
+			gatherDuration:    10,
+			scanDuration:      90,
+			scanInclusiveTime: 90,
+		},
+		{
+			name:              "per-worker stats",
+			input:             InputJSONParallelWorkers,
+			gatherDuration:    5,
+			scanDuration:      100,
+			scanInclusiveTime: 100,
+		},
+	}
+
+	for _, tc := range testCases {
+		explain, err := NewExplain(tc.input, ExplainConfig{})
+		require.Nil(t, err, tc.name)
+
+		gather, scan := &explain.Plan, &explain.Plan.Plans[0]
+
+		assert.InDelta(t, tc.gatherDuration, gather.ActualDuration, 0.001, tc.name)
+		assert.InDelta(t, tc.scanDuration, scan.ActualDuration, 0.001, tc.name)
+		assert.InDelta(t, tc.scanInclusiveTime, scan.InclusiveDuration, 0.001, tc.name)
+		assert.Equal(t, uint64(0), gather.ExclusiveSharedHitBlocks, tc.name)
+		assert.Equal(t, uint64(3000), scan.ExclusiveSharedHitBlocks, tc.name)
+		assert.True(t, scan.Slowest, tc.name)
+		assert.False(t, gather.Slowest, tc.name)
+	}
+}
+
+func TestParallelWorkersText(t *testing.T) {
+	explain, err := NewExplain(InputJSONParallelWorkers, ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.Equal(t, ExpectedTextParallelWorkers, explain.RenderPlanText())
+
+	parsed, err := ParseExplain(ExpectedTextParallelWorkers, ExplainConfig{})
+	require.Nil(t, err)
+
+	assert.Equal(t, explain.Plan.Plans[0].Workers, parsed.Plan.Plans[0].Workers)
+	assert.Equal(t, explain.Plan.Plans[0].SharedHitBlocks, parsed.Plan.Plans[0].SharedHitBlocks)
+	assert.Equal(t, ExpectedTextParallelWorkers, parsed.RenderPlanText())
+}
+
+func TestInitPlanActuals(t *testing.T) {
+	explain, err := NewExplain(InputJSONInitPlan, ExplainConfig{})
+	require.Nil(t, err)
+
+	limit := &explain.Plan
+	initPlan, scan := &limit.Plans[0], &limit.Plans[1]
+
+	// The InitPlan is executed by Seq Scan filtering rows by its result.
+	assert.InDelta(t, 5, limit.ActualDuration, 0.001)
+	assert.InDelta(t, 30, initPlan.ActualDuration, 0.001)
+	assert.InDelta(t, 25, scan.ActualDuration, 0.001)
+
+	assert.Equal(t, uint64(10), limit.ExclusiveSharedHitBlocks)
+	assert.Equal(t, uint64(50), scan.ExclusiveSharedHitBlocks)
+	assert.Equal(t, uint64(100), initPlan.ExclusiveSharedHitBlocks)
+
+	// Costs of InitPlans are charged to the node they are attached to.
+	assert.InDelta(t, 1, limit.ActualCost, 0.001)
+}
+
+func TestCTEActuals(t *testing.T) {
+	explain, err := NewExplain(InputJSONCTE, ExplainConfig{})
+	require.Nil(t, err)
+
+	join := &explain.Plan
+	cte, scanA, scanB := &join.Plans[0], &join.Plans[1], &join.Plans[2]
+
+	// The CTE is executed by CTE Scan nodes and is split between them by rows read.
+	assert.InDelta(t, 35, join.ActualDuration, 0.001)
+	assert.InDelta(t, 40, cte.ActualDuration, 0.001)
+	assert.InDelta(t, 20, scanA.ActualDuration, 0.001)
+	assert.InDelta(t, 5, scanB.ActualDuration, 0.001)
+
+	assert.Equal(t, uint64(0), join.ExclusiveSharedReadBlocks)
+	assert.Equal(t, uint64(0), scanA.ExclusiveSharedReadBlocks)
+	assert.Equal(t, uint64(0), scanB.ExclusiveSharedReadBlocks)
+	assert.Equal(t, uint64(400), cte.ExclusiveSharedReadBlocks)
+
+	assert.True(t, cte.Slowest)
+}
+
+func TestInitPlanParams(t *testing.T) {
+	assert.Equal(t, []string{"$0"}, initPlanParams("InitPlan 1 (returns $0)"))
+	assert.Equal(t, []string{"$1", "$2"}, initPlanParams("InitPlan 2 (returns $1,$2)"))
+	assert.Equal(t, []string{"(InitPlan 1)"}, initPlanParams("InitPlan 1"))
+	assert.Nil(t, initPlanParams("SubPlan 1"))
+
+	assert.True(t, containsParam("(a > $1)", "$1"))
+	assert.False(t, containsParam("(a > $10)", "$1"))
+	assert.True(t, containsParam("(a > $10) AND (b = $1)", "$1"))
+	assert.True(t, containsParam("(a > (InitPlan 1).col1)", "(InitPlan 1)"))
+}
+
+const InputJSONParallel = `[{
+  "Plan": {
+    "Node Type": "Gather",
+    "Startup Cost": 1000.00, "Total Cost": 11000.00, "Plan Rows": 100, "Plan Width": 4,
+    "Actual Startup Time": 0.5, "Actual Total Time": 100, "Actual Rows": 100, "Actual Loops": 1,
+    "Workers Planned": 2, "Workers Launched": 2, "Single Copy": false,
+    "Shared Hit Blocks": 3000,
+    "Plans": [
+      {
+        "Node Type": "Seq Scan", "Parent Relationship": "Outer", "Parallel Aware": true,
+        "Relation Name": "t", "Alias": "t",
+        "Startup Cost": 0.00, "Total Cost": 10000.00, "Plan Rows": 42, "Plan Width": 4,
+        "Actual Startup Time": 0.1, "Actual Total Time": 90, "Actual Rows": 33, "Actual Loops": 3,
+        "Filter": "(a = 1)", "Rows Removed by Filter": 333300,
+        "Shared Hit Blocks": 3000
+      }
+    ]
+  },
+  "Planning Time": 0.1,
+  "Execution Time": 100.5
+}]`
+
+const InputJSONParallelWorkers = `[{
+  "Plan": {
+    "Node Type": "Gather",
+    "Startup Cost": 1000.00, "Total Cost": 11000.00, "Plan Rows": 100, "Plan Width": 4,
+    "Actual Startup Time": 0.5, "Actual Total Time": 105, "Actual Rows": 100, "Actual Loops": 1,
+    "Workers Planned": 2, "Workers Launched": 2, "Single Copy": false,
+    "Shared Hit Blocks": 3000,
+    "Plans": [
+      {
+        "Node Type": "Seq Scan", "Parent Relationship": "Outer", "Parallel Aware": true,
+        "Relation Name": "t", "Alias": "t",
+        "Startup Cost": 0.00, "Total Cost": 10000.00, "Plan Rows": 42, "Plan Width": 4,
+        "Actual Startup Time": 0.1, "Actual Total Time": 80, "Actual Rows": 33, "Actual Loops": 3,
+        "Filter": "(a = 1)", "Rows Removed by Filter": 333300,
+        "Shared Hit Blocks": 3000,
+        "Workers": [
+          {
+            "Worker Number": 0,
+            "Actual Startup Time": 0.2, "Actual Total Time": 100, "Actual Rows": 40, "Actual Loops": 1,
+            "Shared Hit Blocks": 1200, "Shared Read Blocks": 0, "Shared Dirtied Blocks": 0, "Shared Written Blocks": 0
+          },
+          {
+            "Worker Number": 1,
+            "Actual Startup Time": 0.3, "Actual Total Time": 90, "Actual Rows": 35, "Actual Loops": 1,
+            "Shared Hit Blocks": 1100, "Shared Read Blocks": 0, "Shared Dirtied Blocks": 0, "Shared Written Blocks": 0
+          }
+        ]
+      }
+    ]
+  },
+  "Planning Time": 0.1,
+  "Execution Time": 105.5
+}]`
+
+const ExpectedTextParallelWorkers = ` Gather  (cost=1000.00..11000.00 rows=100 width=4) (actual time=0.500..105.000 rows=100 loops=1)
+   Workers Planned: 2
+   Workers Launched: 2
+   Buffers: shared hit=3000
+   ->  Parallel Seq Scan on t  (cost=0.00..10000.00 rows=42 width=4) (actual time=0.100..80.000 rows=33 loops=3)
+         Filter: (a = 1)
+         Rows Removed by Filter: 333300
+         Buffers: shared hit=3000
+         Worker 0:  actual time=0.200..100.000 rows=40 loops=1
+           Buffers: shared hit=1200
+         Worker 1:  actual time=0.300..90.000 rows=35 loops=1
+           Buffers: shared hit=1100
+`
+
+const InputJSONInitPlan = `[{
+  "Plan": {
+    "Node Type": "Limit",
+    "Startup Cost": 25.00, "Total Cost": 46.00, "Plan Rows": 10, "Plan Width": 4,
+    "Actual Startup Time": 30.5, "Actual Total Time": 60, "Actual Rows": 10, "Actual Loops": 1,
+    "Shared Hit Blocks": 160,
+    "Plans": [
+      {
+        "Node Type": "Aggregate", "Strategy": "Plain", "Parent Relationship": "InitPlan",
+        "Subplan Name": "InitPlan 1 (returns $0)",
+        "Startup Cost": 25.00, "Total Cost": 25.00, "Plan Rows": 1, "Plan Width": 4,
+        "Actual Startup Time": 30, "Actual Total Time": 30, "Actual Rows": 1, "Actual Loops": 1,
+        "Shared Hit Blocks": 100
+      },
+      {
+        "Node Type": "Seq Scan", "Parent Relationship": "Outer",
+        "Relation Name": "t", "Alias": "t",
+        "Startup Cost": 0.00, "Total Cost": 20.00, "Plan Rows": 10, "Plan Width": 4,
+        "Actual Startup Time": 30.2, "Actual Total Time": 55, "Actual Rows": 10, "Actual Loops": 1,
+        "Filter": "(a > $0)", "Rows Removed by Filter": 1000,
+        "Shared Hit Blocks": 150
+      }
+    ]
+  },
+  "Planning Time": 0.1,
+  "Execution Time": 60.5
+}]`
+
+const InputJSONCTE = `[{
+  "Plan": {
+    "Node Type": "Nested Loop", "Join Type": "Inner",
+    "Startup Cost": 10.00, "Total Cost": 100.00, "Plan Rows": 400, "Plan Width": 8,
+    "Actual Startup Time": 1, "Actual Total Time": 100, "Actual Rows": 400, "Actual Loops": 1,
+    "Shared Read Blocks": 400,
+    "Plans": [
+      {
+        "Node Type": "Seq Scan", "Parent Relationship": "InitPlan", "Subplan Name": "CTE x",
+        "Relation Name": "t", "Alias": "t",
+        "Startup Cost": 0.00, "Total Cost": 10.00, "Plan Rows": 300, "Plan Width": 4,
+        "Actual Startup Time": 0.1, "Actual Total Time": 40, "Actual Rows": 300, "Actual Loops": 1,
+        "Shared Read Blocks": 400
+      },
+      {
+        "Node Type": "CTE Scan", "Parent Relationship": "Outer",
+        "CTE Name": "x", "Alias": "a",
+        "Startup Cost": 0.00, "Total Cost": 6.00, "Plan Rows": 300, "Plan Width": 4,
+        "Actual Startup Time": 0.2, "Actual Total Time": 50, "Actual Rows": 300, "Actual Loops": 1,
+        "Shared Read Blocks": 300
+      },
+      {
+        "Node Type": "CTE Scan", "Parent Relationship": "Inner",
+        "CTE Name": "x", "Alias": "b",
+        "Startup Cost": 0.00, "Total Cost": 6.00, "Plan Rows": 300, "Plan Width": 4,
+        "Actual Startup Time": 0.3, "Actual Total Time": 15, "Actual Rows": 100, "Actual Loops": 1,
+        "Shared Read Blocks": 100
+      }
+    ]
+  },
+  "Planning Time": 0.1,
+  "Execution Time": 100.5
+}]`
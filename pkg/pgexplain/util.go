@@ -103,3 +103,21 @@ func blocksToBytes(blocks uint64) string {
 	bytes := blocks * 1024 * 8
 	return IBytes(bytes, "%.02f %s")
 }
+
+// formatMetric produces a compact representation of a metric value.
+// formatMetric(1234567) -> 1.2M
+func formatMetric(value float64) string {
+	sizes := []string{"", "k", "M", "G", "T"}
+
+	e := 0
+	for math.Abs(value) >= 1000 && e < len(sizes)-1 {
+		value /= 1000
+		e++
+	}
+
+	if e == 0 {
+		return fmt.Sprintf("%.0f", value)
+	}
+
+	return fmt.Sprintf("%.1f%s", value, sizes[e])
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/hako/durafmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 	"github.com/rs/xid"
@@ -21,20 +22,42 @@ import (
 	"gitlab.com/postgres-ai/database-lab/pkg/log"
 	dblabmodels "gitlab.com/postgres-ai/database-lab/pkg/models"
 
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
+	"gitlab.com/postgres-ai/joe/pkg/config"
 	"gitlab.com/postgres-ai/joe/pkg/models"
 	"gitlab.com/postgres-ai/joe/pkg/services/platform"
 	"gitlab.com/postgres-ai/joe/pkg/services/usermanager"
 )
 
 // HelpMessage defines available commands provided with the help message.
-const HelpMessage = "• `explain` — analyze your query (SELECT, INSERT, DELETE, UPDATE or WITH) and generate recommendations\n" +
-	"• `plan` — analyze your query (SELECT, INSERT, DELETE, UPDATE or WITH) without execution\n" +
-	"• `exec` — execute any query (for example, CREATE INDEX)\n" +
+const HelpMessage = "• `explain` — analyze your query (SELECT, INSERT, DELETE, UPDATE or WITH) and generate recommendations, " +
+	"EXPLAIN options can be added before the query, e.g. `explain (timing off, settings, wal) select ...`, " +
+	"use `explain --dry-run` to run DML in a transaction which is rolled back, " +
+	"use `explain --repeat 5` to run the query several times in one session and compare cold and warm cache runs " +
+	"(repeated DML runs are rolled back)\n" +
+	"• `plan` — analyze your query (SELECT, INSERT, DELETE, UPDATE or WITH) without execution, " +
+	"both commands support queries with parameters, add their values in the trailing comment, " +
+	"e.g. `explain select * from t where id = $1 and name = $2 -- params: 42, 'abc'` or `-- params: [42, \"abc\"]`, " +
+	"both custom and generic plans are shown\n" +
+	"• `stability` — check if the plan of a parameterized query depends on the value of a parameter: values are sampled from `pg_stats`, " +
+	"e.g. `stability select * from orders where tenant_id = $1`, use `stability --param 2 ... -- params: 1, 0` to sample another parameter\n" +
+	"• `compare` — compare the last two execution plans of the session node by node\n" +
+	"• `visualize` — analyze a plan captured elsewhere (e.g., on production): paste it after the command or attach as a snippet, no session needed\n" +
+	"• `exec` — execute any query (for example, CREATE INDEX), use `exec --dry-run` to roll back its changes, " +
+	"rows returned by the query (for example, `exec show work_mem`) are shown and uploaded as a CSV file, " +
+	"`exec set work_mem = '100MB'` and `exec reset work_mem` change settings of all queries of the session\n" +
+	"• `settings` — show settings changed in the session and effective non-default values\n" +
+	"• `stop` — stop your running commands, their queries are canceled\n" +
+	"• `begin`, `commit`, `rollback` — run commands in a transaction on one connection, " +
+	"e.g. `begin`, `exec create index ...`, `explain select ...`, `rollback` to try an index without `reset`\n" +
 	"• `activity` — show currently running sessions in Postgres (states: `active`, `idle in transaction`, `disabled`)\n" +
 	"• `terminate [pid]` — terminate Postgres backend that has the specified PID.\n" +
 	"• `reset` — revert the database to the initial state (usually takes less than a minute, :warning: all changes will be lost)\n" +
-	"• `\\d`, `\\d+`, `\\dt`, `\\dt+`, `\\di`, `\\di+`, `\\l`, `\\l+`, `\\dv`, `\\dv+`, `\\dm`, `\\dm+` — psql meta information commands\n" +
-	"• `hypo` — create hypothetical indexes using the HypoPG extension\n" +
+	"• `\\d`, `\\dt`, `\\di`, `\\dv`, `\\dm`, `\\ds`, `\\dp`, `\\df`, `\\dn`, `\\du`, `\\dx`, `\\dT`, `\\dconfig`, `\\l` — psql meta information commands, " +
+	"most of them have `+` variants and accept psql patterns, e.g. `\\dt+ public.order*`\n" +
+	"• `\\sf`, `\\sv` — show sources of functions and views, e.g. `\\sf+ sum_prices(integer)`\n" +
+	"• `hypo` — create hypothetical indexes using the HypoPG extension, " +
+	"`hypo suggest` finds indexes reducing the cost of a query, e.g. `hypo suggest select * from orders where customer_id = 42`\n" +
 	"• `help` — this message\n"
 
 // MsgSessionStarting provides a message for a session start.
@@ -44,6 +67,7 @@ const MsgSessionStarting = "Starting new session...\n"
 const MsgSessionForewordTpl = "• Say 'help' to see the full list of commands.\n" +
 	"• Sessions are fully independent. Feel free to do anything.\n" +
 	"• The session will be destroyed after %s of inactivity.\n" +
+	"%s" +
 	"• EXPLAIN plans here are expected to be identical to production plans.\n" +
 	"• The actual timing values may differ from production because actual caches in DB Lab are smaller. " +
 	"However, the number of bytes and pages/buffers in plans are identical to production.\n" +
@@ -112,6 +136,11 @@ func (s *ProcessingService) runSession(ctx context.Context, user *usermanager.Us
 		}
 	}()
 
+	limits, err := querier.NewSessionLimits(settingLimits(s.config.Limits))
+	if err != nil {
+		return errors.Wrap(err, "invalid limits of the channel")
+	}
+
 	clone, err := s.createDBLabClone(ctx, user, sessionID)
 	if err != nil {
 		return errors.Wrap(err, "failed to create a Database Lab clone")
@@ -119,6 +148,7 @@ func (s *ProcessingService) runSession(ctx context.Context, user *usermanager.Us
 
 	sMsg.AppendText(
 		getForeword(time.Duration(clone.Metadata.MaxIdleMinutes)*time.Minute,
+			limits.String(),
 			s.config.App.Version,
 			s.featurePack.Entertainer().GetEdition(),
 			clone.Snapshot.DataStateAt,
@@ -131,7 +161,9 @@ func (s *ProcessingService) runSession(ctx context.Context, user *usermanager.Us
 
 	dblabClone := s.buildDBLabCloneConn(clone.DB)
 
-	db, err := initConn(dblabClone)
+	settings := querier.NewSessionSettings()
+
+	db, err := initConn(dblabClone, settings, limits)
 	if err != nil {
 		return errors.Wrap(err, "failed to init database connection")
 	}
@@ -139,6 +171,8 @@ func (s *ProcessingService) runSession(ctx context.Context, user *usermanager.Us
 	user.Session.ConnParams = dblabClone
 	user.Session.Clone = clone
 	user.Session.CloneConnection = db
+	user.Session.Settings = settings
+	user.Session.Limits = limits
 	user.Session.LastActionTs = time.Now()
 	user.Session.ChannelID = incomingMessage.ChannelID
 
@@ -172,8 +206,30 @@ func (s *ProcessingService) buildDBLabCloneConn(dbParams dblabmodels.Database) m
 	}
 }
 
-func initConn(dblabClone models.Clone) (*pgxpool.Pool, error) {
-	conn, err := pgxpool.Connect(context.Background(), dblabClone.ConnectionString())
+// initConn creates a connection pool to the clone, session settings are applied to acquired connections.
+// Limits are applied to connections when they are established and checked when they are acquired.
+// Backends of acquired connections are registered in commands acquiring them, so queries of the commands can be canceled.
+func initConn(dblabClone models.Clone, settings *querier.SessionSettings, limits *querier.SessionLimits) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dblabClone.ConnectionString())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse connection params")
+	}
+
+	for name, value := range limits.RuntimeParams() {
+		poolConfig.ConnConfig.RuntimeParams[name] = value
+	}
+
+	backendTracker := querier.NewBackendTracker()
+
+	poolConfig.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+		backendTracker.BeforeAcquire(ctx, conn)
+		settings.BeforeAcquire(ctx, conn)
+
+		return limits.BeforeAcquire(ctx, conn)
+	}
+	poolConfig.AfterRelease = backendTracker.AfterRelease
+
+	conn, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
 	if err != nil {
 		log.Err("DB connection:", err)
 		return nil, err
@@ -248,7 +304,23 @@ func generateSessionID() string {
 	return joeSessionPrefix + xid.New().String()
 }
 
-func getForeword(idleDuration time.Duration, version, edition, dataStateAt, dbname string) string {
+func getForeword(idleDuration time.Duration, limits, version, edition, dataStateAt, dbname string) string {
 	duration := durafmt.Parse(idleDuration.Round(time.Minute))
-	return fmt.Sprintf(MsgSessionForewordTpl, duration, version, edition, dbname, dataStateAt)
+
+	if limits != "" {
+		limits = fmt.Sprintf("• Queries are limited: %s. Use `exec set` to change the limits within the maximums.\n", limits)
+	}
+
+	return fmt.Sprintf(MsgSessionForewordTpl, duration, limits, version, edition, dbname, dataStateAt)
+}
+
+// settingLimits lists limits of Postgres settings configured for the channel.
+func settingLimits(limits config.Limits) []querier.SettingLimit {
+	return []querier.SettingLimit{
+		{Name: "statement_timeout", Value: limits.StatementTimeout.Value, Max: limits.StatementTimeout.Max},
+		{Name: "temp_file_limit", Value: limits.TempFileLimit.Value, Max: limits.TempFileLimit.Max},
+		{Name: "idle_in_transaction_session_timeout", Value: limits.IdleInTransactionSessionTimeout.Value,
+			Max: limits.IdleInTransactionSessionTimeout.Max},
+		{Name: "lock_timeout", Value: limits.LockTimeout.Value, Max: limits.LockTimeout.Max},
+	}
 }
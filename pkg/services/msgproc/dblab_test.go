@@ -27,7 +27,15 @@ Joe version: v1.0.0 (CE).
 Database: testdb. Snapshot data state at: 2020-04-06 11:30:00 UTC.`
 	)
 
-	foreword := getForeword(idleDuration, version, edition, dataStateAt, dbName)
+	foreword := getForeword(idleDuration, "", version, edition, dataStateAt, dbName)
 
 	assert.Equal(t, expectedForeword, foreword)
 }
+
+func TestForewordWithLimits(t *testing.T) {
+	foreword := getForeword(20*time.Minute, "`statement_timeout` 30min (up to 2h)", "v1.0.0", "CE", "2020-04-06 11:30:00 UTC", "testdb")
+
+	assert.Contains(t, foreword, "• The session will be destroyed after 20 minutes of inactivity.\n"+
+		"• Queries are limited: `statement_timeout` 30min (up to 2h). Use `exec set` to change the limits within the maximums.\n"+
+		"• EXPLAIN plans")
+}
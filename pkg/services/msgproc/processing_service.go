@@ -22,13 +22,13 @@ import (
 	"gitlab.com/postgres-ai/joe/features"
 	"gitlab.com/postgres-ai/joe/features/definition"
 	"gitlab.com/postgres-ai/joe/pkg/bot/command"
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
 	"gitlab.com/postgres-ai/joe/pkg/config"
 	"gitlab.com/postgres-ai/joe/pkg/connection"
 	"gitlab.com/postgres-ai/joe/pkg/models"
 	"gitlab.com/postgres-ai/joe/pkg/pgexplain"
 	"gitlab.com/postgres-ai/joe/pkg/services/platform"
 	"gitlab.com/postgres-ai/joe/pkg/services/usermanager"
-	"gitlab.com/postgres-ai/joe/pkg/transmission/pgtransmission"
 	"gitlab.com/postgres-ai/joe/pkg/util/text"
 )
 
@@ -42,6 +42,14 @@ const (
 	CommandActivity  = "activity"
 	CommandTerminate = "terminate"
 	CommandPlan      = "plan"
+	CommandCompare   = "compare"
+	CommandVisualize = "visualize"
+	CommandStability = "stability"
+	CommandSettings  = "settings"
+	CommandBegin     = "begin"
+	CommandCommit    = "commit"
+	CommandRollback  = "rollback"
+	CommandStop      = "stop"
 
 	CommandPsqlD   = `\d`
 	CommandPsqlDP  = `\d+`
@@ -55,16 +63,44 @@ const (
 	CommandPsqlDVP = `\dv+`
 	CommandPsqlDM  = `\dm`
 	CommandPsqlDMP = `\dm+`
+	CommandPsqlDS  = `\ds`
+	CommandPsqlDSP = `\ds+`
+	CommandPsqlDF  = `\df`
+	CommandPsqlDFP = `\df+`
+	CommandPsqlDN  = `\dn`
+	CommandPsqlDNP = `\dn+`
+	CommandPsqlDU  = `\du`
+	CommandPsqlDUP = `\du+`
+	CommandPsqlDX  = `\dx`
+	CommandPsqlDXP = `\dx+`
+
+	CommandPsqlDPrivileges = `\dp`
+	CommandPsqlDType       = `\dT`
+	CommandPsqlDTypeP      = `\dT+`
+	CommandPsqlDConfig     = `\dconfig`
+	CommandPsqlDConfigP    = `\dconfig+`
+	CommandPsqlSF          = `\sf`
+	CommandPsqlSFP         = `\sf+`
+	CommandPsqlSV          = `\sv`
+	CommandPsqlSVP         = `\sv+`
 )
 
 var supportedCommands = []string{
 	CommandExplain,
 	CommandPlan,
+	CommandStability,
+	CommandCompare,
+	CommandVisualize,
 	CommandHypo,
 	CommandExec,
 	CommandReset,
 	CommandActivity,
 	CommandTerminate,
+	CommandSettings,
+	CommandBegin,
+	CommandCommit,
+	CommandRollback,
+	CommandStop,
 	CommandHelp,
 
 	CommandPsqlD,
@@ -79,6 +115,25 @@ var supportedCommands = []string{
 	CommandPsqlDVP,
 	CommandPsqlDM,
 	CommandPsqlDMP,
+	CommandPsqlDS,
+	CommandPsqlDSP,
+	CommandPsqlDPrivileges,
+	CommandPsqlDF,
+	CommandPsqlDFP,
+	CommandPsqlDN,
+	CommandPsqlDNP,
+	CommandPsqlDU,
+	CommandPsqlDUP,
+	CommandPsqlDX,
+	CommandPsqlDXP,
+	CommandPsqlDType,
+	CommandPsqlDTypeP,
+	CommandPsqlDConfig,
+	CommandPsqlDConfigP,
+	CommandPsqlSF,
+	CommandPsqlSFP,
+	CommandPsqlSV,
+	CommandPsqlSVP,
 }
 
 var allowedPsqlCommands = []string{
@@ -94,8 +149,38 @@ var allowedPsqlCommands = []string{
 	CommandPsqlDVP,
 	CommandPsqlDM,
 	CommandPsqlDMP,
+	CommandPsqlDS,
+	CommandPsqlDSP,
+	CommandPsqlDPrivileges,
+	CommandPsqlDF,
+	CommandPsqlDFP,
+	CommandPsqlDN,
+	CommandPsqlDNP,
+	CommandPsqlDU,
+	CommandPsqlDUP,
+	CommandPsqlDX,
+	CommandPsqlDXP,
+	CommandPsqlDType,
+	CommandPsqlDTypeP,
+	CommandPsqlDConfig,
+	CommandPsqlDConfigP,
+	CommandPsqlSF,
+	CommandPsqlSFP,
+	CommandPsqlSV,
+	CommandPsqlSVP,
 }
 
+// transactionCommands defines commands which run in the transaction begun by the user.
+// Other commands, e.g. terminate, do not wait for running commands of the transaction.
+var transactionCommands = append([]string{
+	CommandExplain,
+	CommandPlan,
+	CommandStability,
+	CommandExec,
+	CommandHypo,
+	CommandSettings,
+}, allowedPsqlCommands...)
+
 type ProcessingService struct {
 	featurePack      *features.Pack
 	messageValidator connection.MessageValidator
@@ -118,6 +203,14 @@ type ProcessingConfig struct {
 	DBLab    config.DBLabParams
 	EntOpts  definition.EnterpriseOptions
 	Project  string
+	Privacy  config.Privacy
+	DryRun   bool
+
+	// CommandTimeout defines the maximum duration of commands, queries of commands are canceled when it expires.
+	CommandTimeout time.Duration
+
+	// Limits defines limits of queries applied to clone connections.
+	Limits config.Limits
 }
 
 // NewProcessingService creates a new processing service.
@@ -182,7 +275,12 @@ func (s *ProcessingService) ProcessMessageEvent(ctx context.Context, incomingMes
 			return
 		}
 
-		message = string(snippet)
+		// A command can be sent as a comment of the snippet, e.g. `visualize` with an attached plan.
+		if util.Contains(supportedCommands, strings.ToLower(message)) {
+			message += "\n" + string(snippet)
+		} else {
+			message = string(snippet)
+		}
 	}
 
 	if len(message) == 0 {
@@ -211,7 +309,12 @@ func (s *ProcessingService) ProcessMessageEvent(ctx context.Context, incomingMes
 	}
 
 	// We want to save message height space for more valuable info.
-	queryPreview := strings.ReplaceAll(query, "\n", " ")
+	queryPreview := query
+	if receivedCommand != CommandVisualize {
+		queryPreview = s.anonymizer().Query(query)
+	}
+
+	queryPreview = strings.ReplaceAll(queryPreview, "\n", " ")
 	queryPreview = strings.ReplaceAll(queryPreview, "\t", " ")
 	queryPreview, _ = text.CutText(queryPreview, QueryPreviewSize, SeparatorEllipsis)
 
@@ -254,6 +357,18 @@ func (s *ProcessingService) ProcessMessageEvent(ctx context.Context, incomingMes
 		return
 	}
 
+	// Stop running commands without initializing of a session.
+	if receivedCommand == CommandStop {
+		s.stopCommands(incomingMessage, user, msgText)
+		return
+	}
+
+	// Visualize external plans without initializing of a session.
+	if receivedCommand == CommandVisualize {
+		s.visualizePlan(incomingMessage, user, msgText, query)
+		return
+	}
+
 	if err := s.runSession(ctx, user, incomingMessage); err != nil {
 		log.Err(err)
 		return
@@ -287,27 +402,68 @@ func (s *ProcessingService) ProcessMessageEvent(ctx context.Context, incomingMes
 		Timestamp: incomingMessage.Timestamp,
 	}
 
+	// Commands run in the transaction begun by the user if there is one, one at a time.
+	db := sessionDB(user)
+	finishTxCommand := func() {}
+
+	if tx := user.Session.Transaction; tx != nil && util.Contains(transactionCommands, receivedCommand) {
+		if finishTxCommand, err = tx.Use(ctx); err != nil {
+			log.Err(err)
+
+			if err := s.messenger.Fail(msg, err.Error()); err != nil {
+				log.Err(err)
+			}
+
+			return
+		}
+	}
+
+	// Commands are stopped by the user or when the command timeout expires.
+	runningCmd := s.startCommand(ctx, user)
+	cmdCtx := runningCmd.ctx
+
 	switch {
 	case receivedCommand == CommandExplain:
-		err = command.Explain(s.messenger, platformCmd, msg, s.config.Explain, user.Session.CloneConnection)
+		var explain *pgexplain.Explain
+
+		explain, err = command.Explain(cmdCtx, s.messenger, platformCmd, msg, s.config.Explain, db, s.anonymizer(), s.config.DryRun)
+		if err == nil {
+			user.Session.AddExplain(explain)
+		}
+
+	case receivedCommand == CommandCompare:
+		err = command.Compare(s.messenger, platformCmd, msg, user.Session.ExplainHistory)
 
 	case receivedCommand == CommandPlan:
-		planCmd := command.NewPlan(platformCmd, msg, user.Session.CloneConnection, s.messenger)
-		err = planCmd.Execute(ctx)
+		planCmd := command.NewPlan(platformCmd, msg, db, s.messenger, s.anonymizer())
+		err = planCmd.Execute(cmdCtx)
+
+	case receivedCommand == CommandStability:
+		stabilityCmd := command.NewStability(platformCmd, msg, db, s.messenger,
+			s.config.Explain, s.anonymizer())
+		err = stabilityCmd.Execute(cmdCtx)
 
 	case receivedCommand == CommandExec:
-		execCmd := command.NewExec(platformCmd, msg, user.Session.CloneConnection, s.messenger)
-		err = execCmd.Execute()
+		execCmd := command.NewExec(platformCmd, msg, db, s.messenger, querier.TableLimits{
+			MaxRows:  s.config.App.ExecMaxRows,
+			MaxWidth: s.config.App.ExecMaxWidth,
+		}, user.Session.Settings, user.Session.Limits)
+		err = execCmd.Execute(cmdCtx)
 
 	case receivedCommand == CommandReset:
-		err = command.ResetSession(ctx, platformCmd, msg, s.DBLab, user.Session.Clone.ID, s.messenger, user.Session.CloneConnection)
+		// Reset closes connections of the session, so the transaction cannot be kept.
+		s.rollbackTransaction(user)
+
+		err = command.ResetSession(cmdCtx, platformCmd, msg, s.DBLab, user.Session.Clone.ID, s.messenger, user.Session.CloneConnection)
 		// TODO(akartasov): Find permanent solution,
 		//  it's a temporary fix for https://gitlab.com/postgres-ai/joe/-/issues/132.
 		if err != nil {
 			log.Err(fmt.Sprintf("Failed to reset session: %v. Trying to reboot session.", err))
 
+			runningCmd.release()
+
 			// Try to reboot the session.
-			if err := s.rebootSession(msg, user); err != nil {
+			if err := s.rebootSession(ctx, msg, user); err != nil {
 				log.Err(err)
 			}
 
@@ -315,20 +471,62 @@ func (s *ProcessingService) ProcessMessageEvent(ctx context.Context, incomingMes
 		}
 
 	case receivedCommand == CommandHypo:
-		hypoCmd := command.NewHypo(platformCmd, msg, user.Session.CloneConnection, s.messenger)
-		err = hypoCmd.Execute()
+		hypoCmd := command.NewHypo(platformCmd, msg, db, s.messenger)
+		err = hypoCmd.Execute(cmdCtx)
 
 	case receivedCommand == CommandActivity:
 		activityCmd := command.NewActivityCmd(platformCmd, msg, user.Session.CloneConnection, s.messenger)
-		err = activityCmd.Execute()
+		err = activityCmd.Execute(cmdCtx)
+
+	case receivedCommand == CommandSettings:
+		settingsCmd := command.NewSettings(platformCmd, msg, db, s.messenger, user.Session.Settings)
+		err = settingsCmd.Execute(cmdCtx)
 
 	case receivedCommand == CommandTerminate:
 		terminateCmd := command.NewTerminateCmd(platformCmd, msg, user.Session.CloneConnection, s.messenger)
-		err = terminateCmd.Execute()
+		err = terminateCmd.Execute(cmdCtx)
+
+	case receivedCommand == CommandBegin:
+		if user.Session.Transaction != nil {
+			err = errors.New(command.MsgTransactionInProgress)
+			break
+		}
+
+		user.Session.Transaction, err = command.Begin(cmdCtx, platformCmd, msg, s.messenger, user.Session.CloneConnection,
+			s.config.App.TxIdleTimeout, user.Session.Limits)
+
+	case receivedCommand == CommandCommit || receivedCommand == CommandRollback:
+		tx := user.Session.Transaction
+		if tx == nil {
+			err = errors.New(command.MsgNoTransaction)
+			break
+		}
+
+		s.unpinTransaction(user)
+
+		if receivedCommand == CommandCommit {
+			err = command.Commit(cmdCtx, platformCmd, msg, s.messenger, tx)
+		} else {
+			err = command.Rollback(cmdCtx, platformCmd, msg, s.messenger, tx)
+		}
 
 	case util.Contains(allowedPsqlCommands, receivedCommand):
-		runner := pgtransmission.NewPgTransmitter(user.Session.ConnParams, pgtransmission.LogsEnabledDefault)
-		err = command.Transmit(platformCmd, msg, s.messenger, runner)
+		err = command.Transmit(cmdCtx, platformCmd, msg, s.messenger, db)
+	}
+
+	finishTxCommand()
+
+	err = runningCmd.finish(err)
+
+	if err == nil && platformCmd.PlanFingerprint != "" {
+		s.checkPlanShape(msg, user, platformCmd)
+	}
+
+	if err != nil && user.Session.Transaction != nil && user.Session.Transaction.Conn().IsClosed() {
+		// Postgres terminates connections of transactions which are idle for too long.
+		s.rollbackTransaction(user)
+
+		err = errors.Wrap(err, "the transaction has been terminated and rolled back")
 	}
 
 	if err != nil {
@@ -376,12 +574,86 @@ func (s *ProcessingService) ProcessMessageEvent(ctx context.Context, incomingMes
 	}
 }
 
+// sessionDB returns the database which commands of the user run on: the begun transaction or the session pool.
+func sessionDB(user *usermanager.User) querier.DB {
+	if user.Session.Transaction != nil {
+		return user.Session.Transaction
+	}
+
+	return querier.Pool{Pool: user.Session.CloneConnection}
+}
+
+// anonymizer returns an anonymizer of queries and plans if the privacy mode is enabled for the channel.
+func (s *ProcessingService) anonymizer() *pgexplain.Anonymizer {
+	if !s.config.Privacy.Enabled {
+		return nil
+	}
+
+	return pgexplain.NewAnonymizer(s.config.Privacy.HashIdentifiers)
+}
+
+// checkPlanShape notes if the same normalized query has got a plan of another shape earlier in the session.
+func (s *ProcessingService) checkPlanShape(msg *models.Message, user *usermanager.User, platformCmd *platform.Command) {
+	previous := user.Session.AddPlanFingerprint(querier.NormalizeQuery(platformCmd.Query), platformCmd.PlanFingerprint)
+	if previous == "" {
+		return
+	}
+
+	msg.AppendText(fmt.Sprintf(":warning: The plan shape has changed since the previous run of this query in the session "+
+		"(fingerprint `%s` → `%s`)", previous, platformCmd.PlanFingerprint))
+
+	if err := s.messenger.UpdateText(msg); err != nil {
+		log.Err("Show the plan shape change: ", err)
+	}
+}
+
+// visualizePlan analyzes an externally captured plan. It does not need a clone.
+func (s *ProcessingService) visualizePlan(incomingMessage models.IncomingMessage, user *usermanager.User, msgText, plan string) {
+	msg := models.NewMessage(incomingMessage)
+
+	msg.SetText(appendSessionID(msgText, user))
+
+	if err := s.messenger.Publish(msg); err != nil {
+		log.Err("Bot: Cannot publish a message", err)
+		return
+	}
+
+	msg.SetUserID(user.UserInfo.ID)
+
+	if err := s.messenger.UpdateStatus(msg, models.StatusRunning); err != nil {
+		log.Err(err)
+	}
+
+	platformCmd := &platform.Command{
+		SessionID: user.Session.PlatformSessionID,
+		Command:   CommandVisualize,
+		Query:     plan,
+		Timestamp: incomingMessage.Timestamp,
+	}
+
+	if err := command.Visualize(s.messenger, platformCmd, msg, s.config.Explain, s.anonymizer()); err != nil {
+		if err := s.messenger.Fail(msg, err.Error()); err != nil {
+			log.Err(err)
+		}
+
+		return
+	}
+
+	user.Session.LastActionTs = time.Now()
+
+	if err := s.messenger.OK(msg); err != nil {
+		log.Err(err)
+	}
+}
+
 // saveHistory posts a command to Platform and add the response link to the message.
 func (s *ProcessingService) saveHistory(ctx context.Context, msg *models.Message, platformCmd *platform.Command) error {
 	if !s.config.Platform.HistoryEnabled {
 		return nil
 	}
 
+	platformCmd.Query = s.anonymizer().Query(platformCmd.Query)
+
 	commandResponse, err := s.platformManager.PostCommand(ctx, platformCmd)
 	if err != nil {
 		return errors.Wrap(err, "failed to post a command")
@@ -419,7 +691,7 @@ func (s *ProcessingService) prepareUserSession(user *usermanager.User, incomingM
 }
 
 // rebootSession stops a Joe session and creates a new one.
-func (s *ProcessingService) rebootSession(msg *models.Message, user *usermanager.User) error {
+func (s *ProcessingService) rebootSession(ctx context.Context, msg *models.Message, user *usermanager.User) error {
 	msg.AppendText("Session was closed by Database Lab.\n")
 
 	if err := s.messenger.UpdateText(msg); err != nil {
@@ -428,7 +700,7 @@ func (s *ProcessingService) rebootSession(msg *models.Message, user *usermanager
 
 	s.stopSession(user)
 
-	if err := s.runSession(context.TODO(), user, models.IncomingMessage{ChannelID: msg.ChannelID}); err != nil {
+	if err := s.runSession(ctx, user, models.IncomingMessage{ChannelID: msg.ChannelID}); err != nil {
 		return errors.Wrap(err, "failed to run session")
 	}
 
@@ -530,6 +802,11 @@ func parseIncomingMessage(message string) (string, string) {
 		receivedCommand = message
 	}
 
+	// Meta-commands are case-sensitive, e.g. `\dt` and `\dT`.
+	if strings.HasPrefix(receivedCommand, `\`) {
+		return receivedCommand, query
+	}
+
 	return strings.ToLower(receivedCommand), query
 }
 
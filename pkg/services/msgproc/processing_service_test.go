@@ -47,6 +47,18 @@ func TestParsingMessage(t *testing.T) {
 			expectedCommand: "\\d+",
 			expectedQuery:   "",
 		},
+		{
+			caseName:        "case-sensitive psql with a pattern",
+			incomingMessage: "\\dT+ public.order*",
+			expectedCommand: "\\dT+",
+			expectedQuery:   "public.order*",
+		},
+		{
+			caseName:        "case-insensitive command",
+			incomingMessage: "EXPLAIN select 1",
+			expectedCommand: "explain",
+			expectedQuery:   "select 1",
+		},
 		{
 			caseName: "multiline explain", incomingMessage: `explain 
 select 1`,
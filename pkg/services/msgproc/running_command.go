@@ -0,0 +1,150 @@
+/*
+2020 © Postgres.ai
+*/
+
+package msgproc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hako/durafmt"
+	"github.com/pkg/errors"
+
+	"gitlab.com/postgres-ai/database-lab/pkg/log"
+
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
+	"gitlab.com/postgres-ai/joe/pkg/models"
+	"gitlab.com/postgres-ai/joe/pkg/services/usermanager"
+)
+
+const (
+	// commandCancelTimeout defines the timeout of canceling queries of a stopped command.
+	commandCancelTimeout = 10 * time.Second
+
+	// commandStopGracePeriod defines how long a stopped command may take to finish after its queries are canceled.
+	commandStopGracePeriod = 5 * time.Second
+)
+
+// msgStoppedByUser describes a command stopped by the user.
+const msgStoppedByUser = "the command has been stopped"
+
+// runningCommand defines a command which is stopped when the user sends `stop` or the command timeout expires.
+type runningCommand struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	db         querier.DB
+	backends   *querier.CommandBackends
+	timer      *time.Timer
+	unregister func()
+
+	mu         sync.Mutex
+	stopReason string
+}
+
+// startCommand registers a command of the user and creates the context of the command.
+func (s *ProcessingService) startCommand(ctx context.Context, user *usermanager.User) *runningCommand {
+	backends := querier.NewCommandBackends()
+
+	// The transaction connection has been acquired by another command, so it is registered explicitly.
+	if tx := user.Session.Transaction; tx != nil {
+		backends.Add(tx.Conn())
+	}
+
+	cmdCtx, cancel := context.WithCancel(querier.ContextWithBackends(ctx, backends))
+
+	cmd := &runningCommand{
+		ctx:      cmdCtx,
+		cancel:   cancel,
+		db:       querier.Pool{Pool: user.Session.CloneConnection},
+		backends: backends,
+	}
+
+	cmd.unregister = user.Session.Commands.Add(func() {
+		cmd.stop(msgStoppedByUser)
+	})
+
+	if timeout := s.config.CommandTimeout; timeout > 0 {
+		cmd.timer = time.AfterFunc(timeout, func() {
+			cmd.stop(fmt.Sprintf("the command has been stopped after the timeout of %s", durafmt.Parse(timeout)))
+		})
+	}
+
+	return cmd
+}
+
+// stop cancels queries of the command with pg_cancel_backend, so connections are kept.
+// The context of the command is canceled if queries cannot be canceled or the command does not finish in the grace period.
+func (c *runningCommand) stop(reason string) {
+	c.mu.Lock()
+	if c.stopReason != "" {
+		c.mu.Unlock()
+		return
+	}
+
+	c.stopReason = reason
+	c.mu.Unlock()
+
+	log.Dbg("Stopping a command:", reason)
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandCancelTimeout)
+	defer cancel()
+
+	if err := querier.CancelBackends(ctx, c.db, c.backends.PIDs()); err != nil {
+		log.Err("Failed to cancel queries of the command:", err)
+		c.cancel()
+
+		return
+	}
+
+	time.AfterFunc(commandStopGracePeriod, c.cancel)
+}
+
+// finish releases the command and explains the error of a stopped command.
+func (c *runningCommand) finish(err error) error {
+	c.release()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil || c.stopReason == "" {
+		return err
+	}
+
+	return errors.Wrap(err, c.stopReason)
+}
+
+// release unregisters the command and cancels its context.
+func (c *runningCommand) release() {
+	c.unregister()
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	c.cancel()
+}
+
+// stopCommands stops running commands of the user.
+func (s *ProcessingService) stopCommands(incomingMessage models.IncomingMessage, user *usermanager.User, msgText string) {
+	msg := models.NewMessage(incomingMessage)
+
+	stopped := user.Session.Commands.StopAll()
+
+	switch stopped {
+	case 0:
+		msgText += "There are no running commands.\n"
+	case 1:
+		msgText += "The running command is being stopped.\n"
+	default:
+		msgText += fmt.Sprintf("%d running commands are being stopped.\n", stopped)
+	}
+
+	msg.SetText(appendSessionID(msgText, user))
+
+	if err := s.messenger.Publish(msg); err != nil {
+		log.Err("Bot: Cannot publish a message", err)
+	}
+}
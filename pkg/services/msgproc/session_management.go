@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/hako/durafmt"
 	"github.com/pkg/errors"
 
 	"gitlab.com/postgres-ai/database-lab/pkg/log"
@@ -39,6 +40,8 @@ func (s *ProcessingService) CheckIdleSessions(ctx context.Context) {
 			continue
 		}
 
+		s.rollbackIdleTransaction(user)
+
 		minutesAgoSinceLastAction := util.MinutesAgo(user.Session.LastActionTs)
 
 		if minutesAgoSinceLastAction < user.Session.Clone.Metadata.MaxIdleMinutes {
@@ -131,9 +134,16 @@ func (s *ProcessingService) isActiveSession(ctx context.Context, cloneID string)
 }
 
 func (s *ProcessingService) stopSession(user *usermanager.User) {
+	// The pinned connection has to be returned before the pool is closed.
+	s.rollbackTransaction(user)
+
 	user.Session.Clone = nil
 	user.Session.ConnParams = models.Clone{}
 	user.Session.PlatformSessionID = ""
+	user.Session.ExplainHistory = nil
+	user.Session.PlanFingerprints = nil
+	user.Session.Settings = nil
+	user.Session.Limits = nil
 
 	if user.Session.CloneConnection != nil {
 		user.Session.CloneConnection.Close()
@@ -141,6 +151,60 @@ func (s *ProcessingService) stopSession(user *usermanager.User) {
 	}
 }
 
+// rollbackIdleTransaction rolls back the transaction of the user if it has been idle longer than the timeout.
+func (s *ProcessingService) rollbackIdleTransaction(user *usermanager.User) {
+	tx := user.Session.Transaction
+	if tx == nil || s.config.App.TxIdleTimeout <= 0 || tx.IdleFor() < s.config.App.TxIdleTimeout {
+		return
+	}
+
+	log.Dbg("Transaction idle: %v", user.UserInfo.ID)
+
+	s.rollbackTransaction(user)
+
+	msgText := fmt.Sprintf("The transaction has been rolled back after %s of inactivity",
+		durafmt.Parse(s.config.App.TxIdleTimeout))
+
+	msg := models.NewMessage(models.IncomingMessage{})
+
+	if user.Session.Direct {
+		msg.SessionID = getSessionID(user)
+	} else {
+		msg = models.NewMessage(models.IncomingMessage{ChannelID: user.Session.ChannelID})
+		msgText = fmt.Sprintf("<@%s> %s", user.UserInfo.ID, msgText)
+	}
+
+	msg.SetText(msgText)
+
+	if err := s.messenger.Publish(msg); err != nil {
+		log.Err("Bot: Cannot publish a message", err)
+	}
+}
+
+// rollbackTransaction rolls back the transaction of the user if there is one.
+func (s *ProcessingService) rollbackTransaction(user *usermanager.User) {
+	tx := user.Session.Transaction
+	if tx == nil {
+		return
+	}
+
+	s.unpinTransaction(user)
+
+	if err := tx.Rollback(context.TODO()); err != nil {
+		log.Err("Failed to roll back the user transaction:", err)
+	}
+}
+
+// unpinTransaction detaches the transaction from the user session before it ends.
+// Settings changed in the transaction may be rolled back, so they are applied to the connection again.
+func (s *ProcessingService) unpinTransaction(user *usermanager.User) {
+	if user.Session.Settings != nil {
+		user.Session.Settings.Forget(user.Session.Transaction.Conn())
+	}
+
+	user.Session.Transaction = nil
+}
+
 // destroySession destroys a DatabaseLab session.
 func (s *ProcessingService) destroySession(u *usermanager.User) error {
 	log.Dbg("Destroying session...")
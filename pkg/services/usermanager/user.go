@@ -6,6 +6,7 @@
 package usermanager
 
 import (
+	"sync"
 	"time"
 
 	"github.com/dustin/go-humanize/english"
@@ -14,10 +15,15 @@ import (
 
 	dblabmodels "gitlab.com/postgres-ai/database-lab/pkg/models"
 
+	"gitlab.com/postgres-ai/joe/pkg/bot/querier"
 	"gitlab.com/postgres-ai/joe/pkg/models"
+	"gitlab.com/postgres-ai/joe/pkg/pgexplain"
 	"gitlab.com/postgres-ai/joe/pkg/util"
 )
 
+// ExplainHistorySize defines the number of the latest explains kept in a user session.
+const ExplainHistorySize = 2
+
 // User defines user info and session.
 type User struct {
 	UserInfo models.UserInfo
@@ -38,6 +44,30 @@ type UserSession struct {
 	Clone           *dblabmodels.Clone
 	ConnParams      models.Clone
 	CloneConnection *pgxpool.Pool
+
+	// Settings contains settings applied to every connection of the clone pool.
+	Settings *querier.SessionSettings
+
+	// Limits contains limits of settings applied to connections of the clone pool.
+	Limits *querier.SessionLimits
+
+	// Transaction contains the transaction begun by the user, commands run on its pinned connection until it ends.
+	Transaction *querier.Transaction
+
+	ExplainHistory []*pgexplain.Explain
+
+	// PlanFingerprints contains the latest plan fingerprints by normalized queries.
+	PlanFingerprints map[string]string
+
+	// Commands contains commands running in the session.
+	Commands *CommandRegistry
+}
+
+// CommandRegistry contains commands running in a user session, so they can be stopped.
+type CommandRegistry struct {
+	mu    sync.Mutex
+	seq   int
+	stops map[int]func()
 }
 
 // Quota defines a user quota for requests.
@@ -57,6 +87,7 @@ func NewUser(userInfo models.UserInfo, quota Quota) *User {
 		Session: UserSession{
 			Quota:        quota,
 			LastActionTs: ts,
+			Commands:     &CommandRegistry{},
 		},
 	}
 
@@ -84,3 +115,67 @@ func (u *User) RequestQuota() error {
 
 	return nil
 }
+
+// AddExplain saves an explain result to the session history keeping only the latest ones.
+func (s *UserSession) AddExplain(explain *pgexplain.Explain) {
+	s.ExplainHistory = append(s.ExplainHistory, explain)
+
+	if len(s.ExplainHistory) > ExplainHistorySize {
+		s.ExplainHistory = s.ExplainHistory[len(s.ExplainHistory)-ExplainHistorySize:]
+	}
+}
+
+// AddPlanFingerprint saves the plan fingerprint of a normalized query
+// and returns the previous fingerprint if the plan shape has changed during the session.
+func (s *UserSession) AddPlanFingerprint(normalizedQuery, fingerprint string) string {
+	if s.PlanFingerprints == nil {
+		s.PlanFingerprints = make(map[string]string)
+	}
+
+	previous, ok := s.PlanFingerprints[normalizedQuery]
+	s.PlanFingerprints[normalizedQuery] = fingerprint
+
+	if !ok || previous == fingerprint {
+		return ""
+	}
+
+	return previous
+}
+
+// Add registers a running command with the function stopping it, the returned function unregisters the command.
+func (r *CommandRegistry) Add(stop func()) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stops == nil {
+		r.stops = make(map[int]func())
+	}
+
+	r.seq++
+	id := r.seq
+	r.stops[id] = stop
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.stops, id)
+	}
+}
+
+// StopAll stops all running commands and returns their number.
+func (r *CommandRegistry) StopAll() int {
+	r.mu.Lock()
+	stops := make([]func(), 0, len(r.stops))
+
+	for _, stop := range r.stops {
+		stops = append(stops, stop)
+	}
+	r.mu.Unlock()
+
+	for _, stop := range stops {
+		stop()
+	}
+
+	return len(stops)
+}
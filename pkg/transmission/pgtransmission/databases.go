@@ -0,0 +1,51 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// listDatabases lists databases like `\l` does.
+func (tr Transmitter) listDatabases(ctx context.Context, command metaCommand) (string, error) {
+	pattern := command.pattern()
+	query := &queryBuilder{}
+
+	columns := []string{
+		`d.datname AS "Name"`,
+		`pg_catalog.pg_get_userbyid(d.datdba) AS "Owner"`,
+		`pg_catalog.pg_encoding_to_char(d.encoding) AS "Encoding"`,
+		`d.datcollate AS "Collate"`,
+		`d.datctype AS "Ctype"`,
+		`pg_catalog.array_to_string(d.datacl, E'\n') AS "Access privileges"`,
+	}
+
+	joins := []string{}
+
+	if command.verbose {
+		columns = append(columns,
+			`CASE WHEN pg_catalog.has_database_privilege(d.datname, 'CONNECT')
+    THEN pg_catalog.pg_size_pretty(pg_catalog.pg_database_size(d.datname))
+    ELSE 'No Access'
+  END AS "Size"`,
+			`t.spcname AS "Tablespace"`,
+			`pg_catalog.shobj_description(d.oid, 'pg_database') AS "Description"`)
+		joins = append(joins, "JOIN pg_catalog.pg_tablespace t ON d.dattablespace = t.oid")
+	}
+
+	query.matchNames(pattern, "", "d.datname", "")
+
+	sql := fmt.Sprintf("SELECT %s\nFROM pg_catalog.pg_database d\n  %s\n%s\nORDER BY 1",
+		strings.Join(columns, ",\n  "), strings.Join(joins, "\n  "), query.whereClause())
+
+	table, err := queryTable(ctx, tr.db, "List of databases", sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	return table.render(), nil
+}
@@ -0,0 +1,226 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// numericTypes defines OIDs of types which values are aligned to the right like psql does.
+var numericTypes = map[uint32]struct{}{
+	20:   {}, // int8
+	21:   {}, // int2
+	23:   {}, // int4
+	26:   {}, // oid
+	700:  {}, // float4
+	701:  {}, // float8
+	1700: {}, // numeric
+}
+
+// resultTable defines a result of a meta-command rendered in the aligned format of psql.
+type resultTable struct {
+	title        string
+	columns      []string
+	rightAligned []bool
+	rows         [][]string
+	footers      []string
+	rowCount     bool
+}
+
+// queryTable runs the query and collects rows as text.
+func queryTable(ctx context.Context, db queryRunner, title, query string, args ...interface{}) (*resultTable, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	table := &resultTable{title: title, rowCount: true}
+
+	for _, field := range rows.FieldDescriptions() {
+		_, numeric := numericTypes[field.DataTypeOID]
+
+		table.columns = append(table.columns, string(field.Name))
+		table.rightAligned = append(table.rightAligned, numeric)
+	}
+
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+
+		table.rows = append(table.rows, textValues(values))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+// queryRows runs the query and returns rows as text.
+func queryRows(ctx context.Context, db queryRunner, query string, args ...interface{}) ([][]string, error) {
+	table, err := queryTable(ctx, db, "", query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return table.rows, nil
+}
+
+// textValues converts row values to text, NULLs are shown as empty strings.
+func textValues(values []interface{}) []string {
+	row := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if value == nil {
+			row = append(row, "")
+			continue
+		}
+
+		row = append(row, fmt.Sprint(value))
+	}
+
+	return row
+}
+
+// render renders the table in the aligned format of psql.
+func (t *resultTable) render() string {
+	widths := make([]int, len(t.columns))
+
+	for i, column := range t.columns {
+		widths[i] = utf8.RuneCountInString(column)
+	}
+
+	for _, row := range t.rows {
+		for i, value := range row {
+			for _, line := range strings.Split(value, "\n") {
+				if width := utf8.RuneCountInString(line); width > widths[i] {
+					widths[i] = width
+				}
+			}
+		}
+	}
+
+	sb := &strings.Builder{}
+
+	if t.title != "" {
+		totalWidth := len(widths) - 1
+		for _, width := range widths {
+			totalWidth += width + 2
+		}
+
+		if titleWidth := utf8.RuneCountInString(t.title); titleWidth < totalWidth {
+			sb.WriteString(strings.Repeat(" ", (totalWidth-titleWidth)/2))
+		}
+
+		sb.WriteString(t.title + "\n")
+	}
+
+	for i, column := range t.columns {
+		if i > 0 {
+			sb.WriteString("|")
+		}
+
+		padding := widths[i] - utf8.RuneCountInString(column)
+		sb.WriteString(" " + strings.Repeat(" ", padding/2) + column + strings.Repeat(" ", padding-padding/2) + " ")
+	}
+
+	sb.WriteString("\n")
+
+	for i, width := range widths {
+		if i > 0 {
+			sb.WriteString("+")
+		}
+
+		sb.WriteString(strings.Repeat("-", width+2))
+	}
+
+	sb.WriteString("\n")
+
+	for _, row := range t.rows {
+		t.renderRow(sb, row, widths)
+	}
+
+	if t.rowCount {
+		if len(t.rows) == 1 {
+			sb.WriteString("(1 row)\n")
+		} else {
+			sb.WriteString(fmt.Sprintf("(%d rows)\n", len(t.rows)))
+		}
+	}
+
+	for _, footer := range t.footers {
+		sb.WriteString(footer + "\n")
+	}
+
+	return sb.String()
+}
+
+// renderRow renders a row, multiline values are continued on next lines with "+" at the end of continued lines.
+func (t *resultTable) renderRow(sb *strings.Builder, row []string, widths []int) {
+	lines := make([][]string, len(row))
+	height := 1
+
+	for i, value := range row {
+		lines[i] = strings.Split(value, "\n")
+
+		if len(lines[i]) > height {
+			height = len(lines[i])
+		}
+	}
+
+	for lineNum := 0; lineNum < height; lineNum++ {
+		for i := range row {
+			if i > 0 {
+				sb.WriteString("|")
+			}
+
+			line := ""
+			if lineNum < len(lines[i]) {
+				line = lines[i][lineNum]
+			}
+
+			continued := lineNum < len(lines[i])-1
+			padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(line))
+
+			sb.WriteString(" ")
+
+			switch {
+			case t.rightAligned[i]:
+				sb.WriteString(padding + line)
+
+			case i < len(row)-1 || continued:
+				sb.WriteString(line + padding)
+
+			default:
+				// psql does not pad values of the last column.
+				sb.WriteString(line)
+			}
+
+			switch {
+			case continued:
+				sb.WriteString("+")
+
+			case i < len(row)-1:
+				sb.WriteString(" ")
+			}
+		}
+
+		sb.WriteString("\n")
+	}
+}
+
+// queryRunner defines the interface of databases running queries.
+type queryRunner interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
@@ -0,0 +1,59 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTable(t *testing.T) {
+	table := &resultTable{
+		title:        "List of relations",
+		columns:      []string{"Schema", "Name", "Type", "Owner"},
+		rightAligned: []bool{false, false, false, false},
+		rows: [][]string{
+			{"public", "orders", "table", "postgres"},
+			{"public", "order_items", "table", "postgres"},
+		},
+		rowCount: true,
+	}
+
+	expected := `            List of relations
+ Schema |    Name     | Type  |  Owner   
+--------+-------------+-------+----------
+ public | orders      | table | postgres
+ public | order_items | table | postgres
+(2 rows)
+`
+
+	assert.Equal(t, expected, table.render())
+}
+
+func TestRenderTableWithMultilineValuesAndFooters(t *testing.T) {
+	table := &resultTable{
+		title:        `Table "public.orders"`,
+		columns:      []string{"Column", "Stats target", "Description"},
+		rightAligned: []bool{false, true, false},
+		rows: [][]string{
+			{"id", "1000", "first\nsecond"},
+			{"total", "", ""},
+		},
+		footers: []string{"Indexes:", `    "orders_pkey" PRIMARY KEY, btree (id)`},
+	}
+
+	expected := `        Table "public.orders"
+ Column | Stats target | Description 
+--------+--------------+-------------
+ id     |         1000 | first      +
+        |              | second
+ total  |              | 
+Indexes:
+    "orders_pkey" PRIMARY KEY, btree (id)
+`
+
+	assert.Equal(t, expected, table.render())
+}
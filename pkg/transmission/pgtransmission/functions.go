@@ -0,0 +1,140 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// listFunctions lists functions like `\df` does.
+func (tr Transmitter) listFunctions(ctx context.Context, command metaCommand) (string, error) {
+	version, err := tr.serverVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	functionType := `CASE
+    WHEN p.proisagg THEN 'agg'
+    WHEN p.proiswindow THEN 'window'
+    WHEN p.prorettype = 'pg_catalog.trigger'::pg_catalog.regtype THEN 'trigger'
+    ELSE 'func'
+  END`
+
+	if version >= version11 {
+		functionType = `CASE p.prokind
+    WHEN 'a' THEN 'agg'
+    WHEN 'w' THEN 'window'
+    WHEN 'p' THEN 'proc'
+    ELSE CASE WHEN p.prorettype = 'pg_catalog.trigger'::pg_catalog.regtype THEN 'trigger' ELSE 'func' END
+  END`
+	}
+
+	pattern := command.pattern()
+	query := &queryBuilder{}
+
+	columns := []string{
+		`n.nspname AS "Schema"`,
+		`p.proname AS "Name"`,
+		`pg_catalog.pg_get_function_result(p.oid) AS "Result data type"`,
+		`pg_catalog.pg_get_function_arguments(p.oid) AS "Argument data types"`,
+		functionType + ` AS "Type"`,
+	}
+
+	joins := []string{"LEFT JOIN pg_catalog.pg_namespace n ON n.oid = p.pronamespace"}
+
+	if command.verbose {
+		columns = append(columns,
+			`CASE p.provolatile WHEN 'i' THEN 'immutable' WHEN 's' THEN 'stable' WHEN 'v' THEN 'volatile' END AS "Volatility"`)
+
+		if version >= version96 {
+			columns = append(columns,
+				`CASE p.proparallel WHEN 'r' THEN 'restricted' WHEN 's' THEN 'safe' WHEN 'u' THEN 'unsafe' END AS "Parallel"`)
+		}
+
+		columns = append(columns,
+			`pg_catalog.pg_get_userbyid(p.proowner) AS "Owner"`,
+			`CASE WHEN p.prosecdef THEN 'definer' ELSE 'invoker' END AS "Security"`,
+			`pg_catalog.array_to_string(p.proacl, E'\n') AS "Access privileges"`,
+			`l.lanname AS "Language"`,
+			`pg_catalog.obj_description(p.oid, 'pg_proc') AS "Description"`)
+		joins = append(joins, "LEFT JOIN pg_catalog.pg_language l ON l.oid = p.prolang")
+	}
+
+	if pattern == "" {
+		query.where(`n.nspname <> 'pg_catalog' AND n.nspname <> 'information_schema'`)
+	}
+
+	query.matchNames(pattern, "n.nspname", "p.proname", "pg_catalog.pg_function_is_visible(p.oid)")
+
+	sql := fmt.Sprintf("SELECT %s\nFROM pg_catalog.pg_proc p\n  %s\n%s\nORDER BY 1, 2, 4",
+		strings.Join(columns, ",\n  "), strings.Join(joins, "\n  "), query.whereClause())
+
+	table, err := queryTable(ctx, tr.db, "List of functions", sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	return table.render(), nil
+}
+
+// showFunctionSource shows the definition of a function like `\sf` does.
+// The function is given by its name or by its signature if the name is overloaded, e.g. "sum_prices(integer)".
+func (tr Transmitter) showFunctionSource(ctx context.Context, command metaCommand) (string, error) {
+	function := command.object()
+	if function == "" {
+		return "", errors.New("function name is required")
+	}
+
+	functionType := "pg_catalog.regproc"
+	if strings.Contains(function, "(") {
+		functionType = "pg_catalog.regprocedure"
+	}
+
+	rows, err := queryRows(ctx, tr.db,
+		fmt.Sprintf("SELECT pg_catalog.pg_get_functiondef($1::pg_catalog.text::%s::pg_catalog.oid)", functionType), function)
+	if err != nil {
+		return "", err
+	}
+
+	if len(rows) == 0 {
+		return "", errors.Errorf("function %q does not exist", function)
+	}
+
+	source := strings.TrimRight(rows[0][0], "\n")
+
+	if !command.verbose {
+		return source, nil
+	}
+
+	// Lines of the function header are not numbered like psql does.
+	inBody := false
+
+	return numberLines(source, func(line string) bool {
+		inBody = inBody || strings.HasPrefix(line, "AS ")
+		return inBody
+	}), nil
+}
+
+// numberLines prefixes lines with line numbers, lines which should not be numbered are indented.
+func numberLines(source string, numbered func(line string) bool) string {
+	lines := strings.Split(source, "\n")
+	lineNum := 0
+
+	for i, line := range lines {
+		if !numbered(line) {
+			lines[i] = strings.Repeat(" ", 8) + line
+			continue
+		}
+
+		lineNum++
+		lines[i] = fmt.Sprintf("%-7d %s", lineNum, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
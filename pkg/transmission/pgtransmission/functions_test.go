@@ -0,0 +1,35 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNumberLines(t *testing.T) {
+	source := `CREATE OR REPLACE FUNCTION public.add(integer, integer)
+ RETURNS integer
+ LANGUAGE sql
+AS $function$
+  select $1 + $2
+$function$`
+
+	expected := `        CREATE OR REPLACE FUNCTION public.add(integer, integer)
+         RETURNS integer
+         LANGUAGE sql
+1       AS $function$
+2         select $1 + $2
+3       $function$`
+
+	inBody := false
+
+	assert.Equal(t, expected, numberLines(source, func(line string) bool {
+		inBody = inBody || strings.HasPrefix(line, "AS ")
+		return inBody
+	}))
+}
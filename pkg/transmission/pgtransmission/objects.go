@@ -0,0 +1,251 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// listSchemas lists schemas like `\dn` does.
+func (tr Transmitter) listSchemas(ctx context.Context, command metaCommand) (string, error) {
+	pattern := command.pattern()
+	query := &queryBuilder{}
+
+	columns := []string{
+		`n.nspname AS "Name"`,
+		`pg_catalog.pg_get_userbyid(n.nspowner) AS "Owner"`,
+	}
+
+	if command.verbose {
+		columns = append(columns,
+			`pg_catalog.array_to_string(n.nspacl, E'\n') AS "Access privileges"`,
+			`pg_catalog.obj_description(n.oid, 'pg_namespace') AS "Description"`)
+	}
+
+	if pattern == "" {
+		query.where(`n.nspname !~ '^pg_' AND n.nspname <> 'information_schema'`)
+	}
+
+	query.matchNames(pattern, "", "n.nspname", "")
+
+	sql := fmt.Sprintf("SELECT %s\nFROM pg_catalog.pg_namespace n\n%s\nORDER BY 1",
+		strings.Join(columns, ",\n  "), query.whereClause())
+
+	table, err := queryTable(ctx, tr.db, "List of schemas", sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	return table.render(), nil
+}
+
+// listRoles lists roles like `\du` does.
+func (tr Transmitter) listRoles(ctx context.Context, command metaCommand) (string, error) {
+	version, err := tr.serverVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	attributes := []string{
+		`CASE WHEN r.rolsuper THEN 'Superuser' END`,
+		`CASE WHEN NOT r.rolinherit THEN 'No inheritance' END`,
+		`CASE WHEN r.rolcreaterole THEN 'Create role' END`,
+		`CASE WHEN r.rolcreatedb THEN 'Create DB' END`,
+		`CASE WHEN NOT r.rolcanlogin THEN 'Cannot login' END`,
+		`CASE WHEN r.rolreplication THEN 'Replication' END`,
+	}
+
+	if version >= version95 {
+		attributes = append(attributes, `CASE WHEN r.rolbypassrls THEN 'Bypass RLS' END`)
+	}
+
+	pattern := command.pattern()
+	query := &queryBuilder{}
+
+	columns := []string{
+		`r.rolname AS "Role name"`,
+		fmt.Sprintf(`pg_catalog.concat_ws(E'\n',
+    pg_catalog.nullif(pg_catalog.array_to_string(ARRAY[
+      %s
+    ], ', '), ''),
+    CASE WHEN r.rolconnlimit = 1 THEN '1 connection' WHEN r.rolconnlimit >= 0 THEN r.rolconnlimit || ' connections' END,
+    'Password valid until ' || r.rolvaliduntil
+  ) AS "Attributes"`, strings.Join(attributes, ",\n      ")),
+		`'{' || pg_catalog.array_to_string(ARRAY(
+    SELECT b.rolname FROM pg_catalog.pg_auth_members m JOIN pg_catalog.pg_roles b ON m.roleid = b.oid
+    WHERE m.member = r.oid ORDER BY 1
+  ), ',') || '}' AS "Member of"`,
+	}
+
+	if command.verbose {
+		columns = append(columns, `pg_catalog.shobj_description(r.oid, 'pg_authid') AS "Description"`)
+	}
+
+	if pattern == "" {
+		query.where(`r.rolname !~ '^pg_'`)
+	}
+
+	query.matchNames(pattern, "", "r.rolname", "")
+
+	sql := fmt.Sprintf("SELECT %s\nFROM pg_catalog.pg_roles r\n%s\nORDER BY 1",
+		strings.Join(columns, ",\n  "), query.whereClause())
+
+	table, err := queryTable(ctx, tr.db, "List of roles", sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	return table.render(), nil
+}
+
+// listExtensions lists installed extensions like `\dx` does, `\dx+` lists objects of extensions.
+func (tr Transmitter) listExtensions(ctx context.Context, command metaCommand) (string, error) {
+	pattern := command.pattern()
+	query := &queryBuilder{}
+	query.matchNames(pattern, "", "e.extname", "")
+
+	if command.verbose {
+		return tr.listExtensionObjects(ctx, pattern, query)
+	}
+
+	sql := fmt.Sprintf(`SELECT e.extname AS "Name",
+  e.extversion AS "Version",
+  n.nspname AS "Schema",
+  c.description AS "Description"
+FROM pg_catalog.pg_extension e
+  LEFT JOIN pg_catalog.pg_namespace n ON n.oid = e.extnamespace
+  LEFT JOIN pg_catalog.pg_description c
+    ON c.objoid = e.oid AND c.classoid = 'pg_catalog.pg_extension'::pg_catalog.regclass
+%s
+ORDER BY 1`, query.whereClause())
+
+	table, err := queryTable(ctx, tr.db, "List of installed extensions", sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	return table.render(), nil
+}
+
+// listExtensionObjects lists objects of extensions matching the pattern.
+func (tr Transmitter) listExtensionObjects(ctx context.Context, pattern string, query *queryBuilder) (string, error) {
+	rows, err := queryRows(ctx, tr.db,
+		fmt.Sprintf("SELECT e.oid, e.extname FROM pg_catalog.pg_extension e\n%s\nORDER BY 2", query.whereClause()),
+		query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(rows) == 0 {
+		return notFoundMessage("extension", pattern), nil
+	}
+
+	descriptions := make([]string, 0, len(rows))
+
+	for _, row := range rows {
+		oid, err := strconv.ParseUint(row[0], 10, 32)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid OID of extension %q", row[1])
+		}
+
+		table, err := queryTable(ctx, tr.db, fmt.Sprintf(`Objects in extension "%s"`, row[1]),
+			`SELECT pg_catalog.pg_describe_object(classid, objid, 0) AS "Object description"
+FROM pg_catalog.pg_depend
+WHERE refclassid = 'pg_catalog.pg_extension'::pg_catalog.regclass AND refobjid = $1 AND deptype = 'e'
+ORDER BY 1`, uint32(oid))
+		if err != nil {
+			return "", err
+		}
+
+		descriptions = append(descriptions, table.render())
+	}
+
+	return strings.Join(descriptions, "\n"), nil
+}
+
+// listTypes lists data types like `\dT` does.
+func (tr Transmitter) listTypes(ctx context.Context, command metaCommand) (string, error) {
+	pattern := command.pattern()
+	query := &queryBuilder{}
+
+	columns := []string{
+		`n.nspname AS "Schema"`,
+		`pg_catalog.format_type(t.oid, NULL) AS "Name"`,
+	}
+
+	if command.verbose {
+		columns = append(columns,
+			`t.typname AS "Internal name"`,
+			`CASE WHEN t.typrelid <> 0 THEN 'tuple' WHEN t.typlen < 0 THEN 'var' ELSE t.typlen::pg_catalog.text END AS "Size"`,
+			`pg_catalog.array_to_string(ARRAY(
+    SELECT e.enumlabel FROM pg_catalog.pg_enum e WHERE e.enumtypid = t.oid ORDER BY e.enumsortorder
+  ), E'\n') AS "Elements"`,
+			`pg_catalog.pg_get_userbyid(t.typowner) AS "Owner"`,
+			`pg_catalog.array_to_string(t.typacl, E'\n') AS "Access privileges"`)
+	}
+
+	columns = append(columns, `pg_catalog.obj_description(t.oid, 'pg_type') AS "Description"`)
+
+	// Types of table rows and array types are not listed like psql does.
+	query.where(`(t.typrelid = 0 OR (SELECT c.relkind = 'c' FROM pg_catalog.pg_class c WHERE c.oid = t.typrelid))`)
+	query.where(`NOT EXISTS (SELECT 1 FROM pg_catalog.pg_type el WHERE el.oid = t.typelem AND el.typarray = t.oid)`)
+
+	if pattern == "" {
+		query.where(`n.nspname <> 'pg_catalog' AND n.nspname <> 'information_schema'`)
+	}
+
+	query.matchNames(pattern, "n.nspname", "t.typname", "pg_catalog.pg_type_is_visible(t.oid)")
+
+	sql := fmt.Sprintf(`SELECT %s
+FROM pg_catalog.pg_type t
+  LEFT JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+%s
+ORDER BY 1, 2`, strings.Join(columns, ",\n  "), query.whereClause())
+
+	table, err := queryTable(ctx, tr.db, "List of data types", sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	return table.render(), nil
+}
+
+// listSettings lists configuration parameters like `\dconfig` does, only non-default parameters are listed without a pattern.
+func (tr Transmitter) listSettings(ctx context.Context, command metaCommand) (string, error) {
+	pattern := command.pattern()
+	query := &queryBuilder{}
+	title := "List of configuration parameters"
+
+	columns := []string{
+		`s.name AS "Parameter"`,
+		`pg_catalog.current_setting(s.name) AS "Value"`,
+	}
+
+	if command.verbose {
+		columns = append(columns, `s.vartype AS "Type"`, `s.context AS "Context"`)
+	}
+
+	if pattern == "" {
+		query.where(`s.source <> 'default' AND s.source <> 'override'`)
+		title = "List of non-default configuration parameters"
+	}
+
+	query.matchNames(pattern, "", "s.name", "")
+
+	sql := fmt.Sprintf("SELECT %s\nFROM pg_catalog.pg_settings s\n%s\nORDER BY 1",
+		strings.Join(columns, ",\n  "), query.whereClause())
+
+	table, err := queryTable(ctx, tr.db, title, sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	return table.render(), nil
+}
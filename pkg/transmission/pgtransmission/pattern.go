@@ -0,0 +1,134 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// regexpSpecialChars defines characters which are escaped in quoted parts of patterns.
+const regexpSpecialChars = `|*+?()[]{}.^$\`
+
+// namePattern defines regular expressions converted from a psql pattern of object names, e.g. "public.order*".
+// Empty expressions match any names.
+type namePattern struct {
+	schema string
+	name   string
+}
+
+// parsePattern converts a psql pattern to regular expressions like psql does:
+// unquoted names are folded to lower case, "*" matches any sequence of characters, "?" matches any character,
+// "." separates the schema name and special characters of double-quoted names are matched literally.
+func parsePattern(pattern string) namePattern {
+	parts := []string{}
+	current := &strings.Builder{}
+	inQuotes := false
+	runes := []rune(pattern)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '"':
+			if inQuotes && i+1 < len(runes) && runes[i+1] == '"' {
+				current.WriteRune('"')
+				i++
+
+				continue
+			}
+
+			inQuotes = !inQuotes
+
+		case inQuotes:
+			if strings.ContainsRune(regexpSpecialChars, r) {
+				current.WriteRune('\\')
+			}
+
+			current.WriteRune(r)
+
+		case r == '.':
+			parts = append(parts, current.String())
+			current.Reset()
+
+		case r == '*':
+			current.WriteString(".*")
+
+		case r == '?':
+			current.WriteRune('.')
+
+		case r == '$':
+			current.WriteString(`\$`)
+
+		default:
+			current.WriteRune(unicode.ToLower(r))
+		}
+	}
+
+	parts = append(parts, current.String())
+
+	result := namePattern{name: anchorPattern(parts[len(parts)-1])}
+
+	// The database name is ignored in patterns like "db.schema.name".
+	if len(parts) > 1 {
+		result.schema = anchorPattern(parts[len(parts)-2])
+	}
+
+	return result
+}
+
+func anchorPattern(pattern string) string {
+	if pattern == "" || pattern == ".*" {
+		return ""
+	}
+
+	return "^(" + pattern + ")$"
+}
+
+// queryBuilder collects conditions of a catalog query and their arguments.
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds an argument and returns its placeholder.
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// where adds a condition.
+func (b *queryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// matchNames adds conditions matching the pattern. Objects are checked with the visibility condition
+// if the schema is not specified, e.g. "pg_catalog.pg_table_is_visible(c.oid)".
+func (b *queryBuilder) matchNames(pattern, schemaColumn, nameColumn, visibility string) {
+	names := parsePattern(pattern)
+
+	if names.name != "" {
+		b.where(fmt.Sprintf("%s OPERATOR(pg_catalog.~) %s COLLATE pg_catalog.default", nameColumn, b.arg(names.name)))
+	}
+
+	if names.schema != "" && schemaColumn != "" {
+		b.where(fmt.Sprintf("%s OPERATOR(pg_catalog.~) %s COLLATE pg_catalog.default", schemaColumn, b.arg(names.schema)))
+		return
+	}
+
+	if visibility != "" {
+		b.where(visibility)
+	}
+}
+
+// whereClause returns the WHERE clause of collected conditions.
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+
+	return "WHERE " + strings.Join(b.conditions, "\n  AND ")
+}
@@ -0,0 +1,59 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePattern(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		expected namePattern
+	}{
+		{pattern: "", expected: namePattern{}},
+		{pattern: "*", expected: namePattern{}},
+		{pattern: "Orders", expected: namePattern{name: "^(orders)$"}},
+		{pattern: "order*", expected: namePattern{name: "^(order.*)$"}},
+		{pattern: "order?", expected: namePattern{name: "^(order.)$"}},
+		{pattern: "public.order*", expected: namePattern{schema: "^(public)$", name: "^(order.*)$"}},
+		{pattern: "public.*", expected: namePattern{schema: "^(public)$"}},
+		{pattern: "*.orders", expected: namePattern{name: "^(orders)$"}},
+		{pattern: "db.public.orders", expected: namePattern{schema: "^(public)$", name: "^(orders)$"}},
+		{pattern: `"Order.Items"`, expected: namePattern{name: `^(Order\.Items)$`}},
+		{pattern: `"My ""Table"""*`, expected: namePattern{name: `^(My "Table".*)$`}},
+		{pattern: `price$`, expected: namePattern{name: `^(price\$)$`}},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, parsePattern(tc.pattern), tc.pattern)
+	}
+}
+
+func TestQueryBuilderMatchNames(t *testing.T) {
+	query := &queryBuilder{}
+	query.where("c.relkind IN ('r')")
+	query.matchNames("order*", "n.nspname", "c.relname", "pg_catalog.pg_table_is_visible(c.oid)")
+
+	assert.Equal(t, "WHERE c.relkind IN ('r')\n"+
+		"  AND c.relname OPERATOR(pg_catalog.~) $1 COLLATE pg_catalog.default\n"+
+		"  AND pg_catalog.pg_table_is_visible(c.oid)", query.whereClause())
+	assert.Equal(t, []interface{}{"^(order.*)$"}, query.args)
+
+	query = &queryBuilder{}
+	query.matchNames("public.orders", "n.nspname", "c.relname", "pg_catalog.pg_table_is_visible(c.oid)")
+
+	assert.Equal(t, "WHERE c.relname OPERATOR(pg_catalog.~) $1 COLLATE pg_catalog.default\n"+
+		"  AND n.nspname OPERATOR(pg_catalog.~) $2 COLLATE pg_catalog.default", query.whereClause())
+	assert.Equal(t, []interface{}{"^(orders)$", "^(public)$"}, query.args)
+
+	query = &queryBuilder{}
+	query.matchNames("", "", "d.datname", "")
+
+	assert.Equal(t, "", query.whereClause())
+	assert.Empty(t, query.args)
+}
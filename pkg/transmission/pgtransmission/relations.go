@@ -0,0 +1,611 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of relations.
+const (
+	relkindTable            = "r"
+	relkindPartitionedTable = "p"
+	relkindView             = "v"
+	relkindMatView          = "m"
+	relkindIndex            = "i"
+	relkindPartitionedIndex = "I"
+	relkindSequence         = "S"
+	relkindForeignTable     = "f"
+	relkindCompositeType    = "c"
+	relkindToastTable       = "t"
+)
+
+// Versions of Postgres which have changed catalogs used by meta-commands.
+const (
+	version95 = 90500
+	version96 = 90600
+	version10 = 100000
+	version11 = 110000
+	version12 = 120000
+)
+
+// relationTypes defines names of relation kinds shown in lists of relations.
+const relationTypes = `CASE c.relkind
+    WHEN 'r' THEN 'table' WHEN 'v' THEN 'view' WHEN 'm' THEN 'materialized view' WHEN 'i' THEN 'index'
+    WHEN 'S' THEN 'sequence' WHEN 's' THEN 'special' WHEN 'f' THEN 'foreign table' WHEN 'p' THEN 'partitioned table'
+    WHEN 'I' THEN 'partitioned index'
+  END`
+
+// relationTitles defines titles of relation descriptions.
+var relationTitles = map[string]string{
+	relkindTable:            "Table",
+	relkindPartitionedTable: "Partitioned table",
+	relkindView:             "View",
+	relkindMatView:          "Materialized view",
+	relkindIndex:            "Index",
+	relkindPartitionedIndex: "Partitioned index",
+	relkindSequence:         "Sequence",
+	relkindForeignTable:     "Foreign table",
+	relkindCompositeType:    "Composite type",
+	relkindToastTable:       "TOAST table",
+}
+
+// relationStorage defines names of column storage types.
+const relationStorage = `CASE a.attstorage WHEN 'p' THEN 'plain' WHEN 'm' THEN 'main' WHEN 'x' THEN 'extended' WHEN 'e' THEN 'external' END`
+
+// relationStatsTarget defines the statistics target of a column, which is empty if it is default.
+const relationStatsTarget = `CASE WHEN pg_catalog.coalesce(a.attstattarget, -1) >= 0 THEN a.attstattarget END`
+
+// relation defines a relation found by a pattern.
+type relation struct {
+	oid    uint32
+	schema string
+	name   string
+	kind   string
+}
+
+// listRelations lists relations of the kinds like `\dt` and other psql commands do.
+func (tr Transmitter) listRelations(ctx context.Context, command metaCommand, kinds ...string) (string, error) {
+	pattern := command.pattern()
+	query := &queryBuilder{}
+
+	columns := []string{
+		`n.nspname AS "Schema"`,
+		`c.relname AS "Name"`,
+		relationTypes + ` AS "Type"`,
+		`pg_catalog.pg_get_userbyid(c.relowner) AS "Owner"`,
+	}
+
+	joins := []string{"LEFT JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace"}
+
+	if len(kinds) == 2 && kinds[0] == relkindIndex {
+		columns = append(columns, `c2.relname AS "Table"`)
+		joins = append(joins,
+			"LEFT JOIN pg_catalog.pg_index i ON i.indexrelid = c.oid",
+			"LEFT JOIN pg_catalog.pg_class c2 ON i.indrelid = c2.oid")
+	}
+
+	if command.verbose {
+		columns = append(columns,
+			`pg_catalog.pg_size_pretty(pg_catalog.pg_table_size(c.oid)) AS "Size"`,
+			`pg_catalog.obj_description(c.oid, 'pg_class') AS "Description"`)
+	}
+
+	query.where(fmt.Sprintf("c.relkind IN ('%s')", strings.Join(kinds, "', '")))
+
+	if pattern == "" {
+		query.where(`n.nspname <> 'pg_catalog' AND n.nspname <> 'information_schema' AND n.nspname !~ '^pg_toast'`)
+	}
+
+	query.matchNames(pattern, "n.nspname", "c.relname", "pg_catalog.pg_table_is_visible(c.oid)")
+
+	sql := fmt.Sprintf("SELECT %s\nFROM pg_catalog.pg_class c\n  %s\n%s\nORDER BY 1, 2",
+		strings.Join(columns, ",\n  "), strings.Join(joins, "\n  "), query.whereClause())
+
+	table, err := queryTable(ctx, tr.db, "List of relations", sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(table.rows) == 0 {
+		return notFoundMessage("relation", pattern), nil
+	}
+
+	return table.render(), nil
+}
+
+// describeRelations describes relations matching the pattern like `\d pattern` does.
+func (tr Transmitter) describeRelations(ctx context.Context, command metaCommand) (string, error) {
+	pattern := command.pattern()
+	query := &queryBuilder{}
+	query.matchNames(pattern, "n.nspname", "c.relname", "pg_catalog.pg_table_is_visible(c.oid)")
+
+	sql := fmt.Sprintf(`SELECT c.oid, n.nspname, c.relname, c.relkind::text
+FROM pg_catalog.pg_class c
+  LEFT JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+%s
+ORDER BY 2, 3`, query.whereClause())
+
+	rows, err := queryRows(ctx, tr.db, sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(rows) == 0 {
+		return notFoundMessage("relation", pattern), nil
+	}
+
+	version, err := tr.serverVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	descriptions := make([]string, 0, len(rows))
+
+	for _, row := range rows {
+		oid, err := strconv.ParseUint(row[0], 10, 32)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid OID of relation %q", row[2])
+		}
+
+		rel := relation{oid: uint32(oid), schema: row[1], name: row[2], kind: row[3]}
+
+		description, err := tr.describeRelation(ctx, rel, command.verbose, version)
+		if err != nil {
+			return "", err
+		}
+
+		descriptions = append(descriptions, description)
+	}
+
+	return strings.Join(descriptions, "\n"), nil
+}
+
+// describeRelation describes columns of the relation and lists its indexes, constraints and other properties.
+func (tr Transmitter) describeRelation(ctx context.Context, rel relation, verbose bool, version int) (string, error) {
+	var (
+		table *resultTable
+		err   error
+	)
+
+	title := fmt.Sprintf(`%s "%s.%s"`, relationTitles[rel.kind], rel.schema, rel.name)
+
+	switch {
+	case rel.kind == relkindIndex || rel.kind == relkindPartitionedIndex:
+		table, err = tr.describeIndex(ctx, rel, title, verbose, version)
+
+	case rel.kind == relkindSequence && version >= version10:
+		table, err = tr.describeSequence(ctx, rel, title)
+
+	default:
+		table, err = tr.describeColumns(ctx, rel, title, verbose, version)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	table.rowCount = false
+
+	return table.render(), nil
+}
+
+// describeColumns describes columns of tables, views and other relations with columns.
+func (tr Transmitter) describeColumns(ctx context.Context, rel relation, title string, verbose bool,
+	version int) (*resultTable, error) {
+	defaultValue := "pg_catalog.pg_get_expr(d.adbin, d.adrelid)"
+
+	if version >= version10 {
+		defaultValue = `CASE a.attidentity
+      WHEN 'a' THEN 'generated always as identity'
+      WHEN 'd' THEN 'generated by default as identity'
+      ELSE ` + defaultValue + `
+    END`
+	}
+
+	if version >= version12 {
+		defaultValue = `CASE WHEN a.attgenerated = 's'
+      THEN 'generated always as (' || pg_catalog.pg_get_expr(d.adbin, d.adrelid) || ') stored'
+      ELSE ` + defaultValue + `
+    END`
+	}
+
+	columns := []string{
+		`a.attname AS "Column"`,
+		`pg_catalog.format_type(a.atttypid, a.atttypmod) AS "Type"`,
+		`(SELECT co.collname FROM pg_catalog.pg_collation co, pg_catalog.pg_type t
+    WHERE co.oid = a.attcollation AND t.oid = a.atttypid AND a.attcollation <> t.typcollation) AS "Collation"`,
+		`CASE WHEN a.attnotnull THEN 'not null' ELSE '' END AS "Nullable"`,
+		defaultValue + ` AS "Default"`,
+	}
+
+	if verbose {
+		columns = append(columns, relationStorage+` AS "Storage"`)
+
+		if rel.kind != relkindView {
+			columns = append(columns, relationStatsTarget+` AS "Stats target"`)
+		}
+
+		columns = append(columns, `pg_catalog.col_description(a.attrelid, a.attnum) AS "Description"`)
+	}
+
+	sql := fmt.Sprintf(`SELECT %s
+FROM pg_catalog.pg_attribute a
+  LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum AND a.atthasdef
+WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`, strings.Join(columns, ",\n  "))
+
+	table, err := queryTable(ctx, tr.db, title, sql, rel.oid)
+	if err != nil {
+		return nil, err
+	}
+
+	footers, err := tr.relationFooters(ctx, rel, verbose, version)
+	if err != nil {
+		return nil, err
+	}
+
+	table.footers = footers
+
+	return table, nil
+}
+
+// relationFooters lists properties of the relation shown after its columns.
+func (tr Transmitter) relationFooters(ctx context.Context, rel relation, verbose bool, version int) ([]string, error) {
+	footers := []string{}
+
+	isTable := rel.kind == relkindTable || rel.kind == relkindPartitionedTable
+
+	if rel.kind == relkindPartitionedTable && version >= version10 {
+		rows, err := queryRows(ctx, tr.db, "SELECT pg_catalog.pg_get_partkeydef($1)", rel.oid)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the partition key")
+		}
+
+		for _, row := range rows {
+			footers = append(footers, "Partition key: "+row[0])
+		}
+	}
+
+	if isTable || rel.kind == relkindMatView {
+		indexes, err := tr.indexFooters(ctx, rel)
+		if err != nil {
+			return nil, err
+		}
+
+		footers = append(footers, indexes...)
+	}
+
+	if isTable || rel.kind == relkindForeignTable {
+		constraints, err := tr.constraintFooters(ctx, "Check constraints:", `SELECT '"' || conname || '" ' || pg_catalog.pg_get_constraintdef(oid, true)
+FROM pg_catalog.pg_constraint WHERE conrelid = $1 AND contype = 'c' ORDER BY conname`, rel.oid)
+		if err != nil {
+			return nil, err
+		}
+
+		footers = append(footers, constraints...)
+	}
+
+	if isTable {
+		foreignKeys, err := tr.constraintFooters(ctx, "Foreign-key constraints:", `SELECT '"' || conname || '" ' || pg_catalog.pg_get_constraintdef(oid, true)
+FROM pg_catalog.pg_constraint WHERE conrelid = $1 AND contype = 'f' ORDER BY conname`, rel.oid)
+		if err != nil {
+			return nil, err
+		}
+
+		referencedBy, err := tr.constraintFooters(ctx, "Referenced by:", `SELECT 'TABLE "' || conrelid::pg_catalog.regclass::text || '" CONSTRAINT "' || conname || '" '
+    || pg_catalog.pg_get_constraintdef(oid, true)
+FROM pg_catalog.pg_constraint WHERE confrelid = $1 AND contype = 'f' ORDER BY conname`, rel.oid)
+		if err != nil {
+			return nil, err
+		}
+
+		footers = append(footers, foreignKeys...)
+		footers = append(footers, referencedBy...)
+	}
+
+	if verbose && (rel.kind == relkindView || rel.kind == relkindMatView) {
+		rows, err := queryRows(ctx, tr.db, "SELECT pg_catalog.pg_get_viewdef($1, true)", rel.oid)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the view definition")
+		}
+
+		for _, row := range rows {
+			footers = append(footers, "View definition:", strings.TrimRight(row[0], "\n"))
+		}
+	}
+
+	return footers, nil
+}
+
+// indexFooters lists indexes of the table, e.g. `"orders_pkey" PRIMARY KEY, btree (id)`.
+func (tr Transmitter) indexFooters(ctx context.Context, rel relation) ([]string, error) {
+	rows, err := queryRows(ctx, tr.db, `SELECT c2.relname, i.indisprimary, i.indisunique, i.indisclustered, i.indisvalid,
+  pg_catalog.pg_get_indexdef(i.indexrelid, 0, true), pg_catalog.pg_get_constraintdef(con.oid, true), con.contype::text
+FROM pg_catalog.pg_class c2
+  JOIN pg_catalog.pg_index i ON i.indexrelid = c2.oid
+  LEFT JOIN pg_catalog.pg_constraint con
+    ON con.conrelid = i.indrelid AND con.conindid = i.indexrelid AND con.contype IN ('p', 'u', 'x')
+WHERE i.indrelid = $1
+ORDER BY i.indisprimary DESC, c2.relname`, rel.oid)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list indexes")
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	footers := []string{"Indexes:"}
+
+	for _, row := range rows {
+		name, primary, unique, clustered, valid, indexDef, constraintDef, constraintType :=
+			row[0], row[1], row[2], row[3], row[4], row[5], row[6], row[7]
+
+		footer := fmt.Sprintf(`    "%s"`, name)
+
+		switch {
+		case constraintType == "x":
+			footer += " " + constraintDef
+
+		case primary == "true":
+			footer += " PRIMARY KEY,"
+
+		case unique == "true" && constraintType == "u":
+			footer += " UNIQUE CONSTRAINT,"
+
+		case unique == "true":
+			footer += " UNIQUE,"
+		}
+
+		if usingPos := strings.Index(indexDef, " USING "); constraintType != "x" && usingPos >= 0 {
+			footer += " " + indexDef[usingPos+len(" USING "):]
+		}
+
+		if clustered == "true" {
+			footer += " CLUSTER"
+		}
+
+		if valid != "true" {
+			footer += " INVALID"
+		}
+
+		footers = append(footers, footer)
+	}
+
+	return footers, nil
+}
+
+// constraintFooters lists constraints returned by the query under the title.
+func (tr Transmitter) constraintFooters(ctx context.Context, title, query string, args ...interface{}) ([]string, error) {
+	rows, err := queryRows(ctx, tr.db, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list constraints")
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	footers := []string{title}
+
+	for _, row := range rows {
+		footers = append(footers, "    "+row[0])
+	}
+
+	return footers, nil
+}
+
+// describeIndex describes columns of the index and the table it belongs to.
+func (tr Transmitter) describeIndex(ctx context.Context, rel relation, title string, verbose bool,
+	version int) (*resultTable, error) {
+	keyColumns := "i.indnatts"
+	if version >= version11 {
+		keyColumns = "i.indnkeyatts"
+	}
+
+	columns := []string{
+		`a.attname AS "Column"`,
+		`pg_catalog.format_type(a.atttypid, a.atttypmod) AS "Type"`,
+		`CASE WHEN a.attnum <= ` + keyColumns + ` THEN 'yes' ELSE 'no' END AS "Key?"`,
+		`pg_catalog.pg_get_indexdef(a.attrelid, a.attnum, true) AS "Definition"`,
+	}
+
+	if verbose {
+		columns = append(columns, relationStorage+` AS "Storage"`, relationStatsTarget+` AS "Stats target"`)
+	}
+
+	sql := fmt.Sprintf(`SELECT %s
+FROM pg_catalog.pg_attribute a
+  JOIN pg_catalog.pg_index i ON i.indexrelid = a.attrelid
+WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`, strings.Join(columns, ",\n  "))
+
+	table, err := queryTable(ctx, tr.db, title, sql, rel.oid)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queryRows(ctx, tr.db, `SELECT CASE WHEN i.indisprimary THEN 'primary key, ' WHEN i.indisunique THEN 'unique, ' ELSE '' END
+    || am.amname || ', for table "' || n.nspname || '.' || c.relname || '"'
+    || pg_catalog.coalesce(', predicate (' || pg_catalog.pg_get_expr(i.indpred, i.indrelid, true) || ')', '')
+    || CASE WHEN i.indisvalid THEN '' ELSE ', invalid' END
+FROM pg_catalog.pg_index i
+  JOIN pg_catalog.pg_class ic ON ic.oid = i.indexrelid
+  JOIN pg_catalog.pg_am am ON am.oid = ic.relam
+  JOIN pg_catalog.pg_class c ON c.oid = i.indrelid
+  JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE i.indexrelid = $1`, rel.oid)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe the index")
+	}
+
+	for _, row := range rows {
+		table.footers = append(table.footers, row[0])
+	}
+
+	return table, nil
+}
+
+// describeSequence describes parameters of the sequence and the column owning it.
+func (tr Transmitter) describeSequence(ctx context.Context, rel relation, title string) (*resultTable, error) {
+	table, err := queryTable(ctx, tr.db, title, `SELECT pg_catalog.format_type(s.seqtypid, NULL) AS "Type",
+  s.seqstart AS "Start",
+  s.seqmin AS "Minimum",
+  s.seqmax AS "Maximum",
+  s.seqincrement AS "Increment",
+  CASE WHEN s.seqcycle THEN 'yes' ELSE 'no' END AS "Cycles?",
+  s.seqcache AS "Cache"
+FROM pg_catalog.pg_sequence s
+WHERE s.seqrelid = $1`, rel.oid)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queryRows(ctx, tr.db, `SELECT CASE WHEN d.deptype = 'i' THEN 'Sequence for identity column: ' ELSE 'Owned by: ' END
+    || pg_catalog.quote_ident(n.nspname) || '.' || pg_catalog.quote_ident(c.relname) || '.' || pg_catalog.quote_ident(a.attname)
+FROM pg_catalog.pg_depend d
+  JOIN pg_catalog.pg_class c ON c.oid = d.refobjid
+  JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+  JOIN pg_catalog.pg_attribute a ON a.attrelid = c.oid AND a.attnum = d.refobjsubid
+WHERE d.classid = 'pg_catalog.pg_class'::pg_catalog.regclass
+  AND d.refclassid = 'pg_catalog.pg_class'::pg_catalog.regclass
+  AND d.objid = $1 AND d.deptype IN ('a', 'i')`, rel.oid)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the owner of the sequence")
+	}
+
+	for _, row := range rows {
+		table.footers = append(table.footers, row[0])
+	}
+
+	return table, nil
+}
+
+// notFoundMessage returns the message of psql shown if there are no objects matching the pattern.
+func notFoundMessage(object, pattern string) string {
+	if pattern == "" {
+		return fmt.Sprintf("Did not find any %ss.", object)
+	}
+
+	return fmt.Sprintf("Did not find any %s named %q.", object, pattern)
+}
+
+// listPrivileges lists access privileges of relations like `\dp` does.
+func (tr Transmitter) listPrivileges(ctx context.Context, command metaCommand) (string, error) {
+	version, err := tr.serverVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	pattern := command.pattern()
+	query := &queryBuilder{}
+
+	columns := []string{
+		`n.nspname AS "Schema"`,
+		`c.relname AS "Name"`,
+		relationTypes + ` AS "Type"`,
+		`pg_catalog.array_to_string(c.relacl, E'\n') AS "Access privileges"`,
+		`pg_catalog.array_to_string(ARRAY(
+    SELECT a.attname || E':\n  ' || pg_catalog.array_to_string(a.attacl, E'\n  ')
+    FROM pg_catalog.pg_attribute a
+    WHERE a.attrelid = c.oid AND NOT a.attisdropped AND a.attacl IS NOT NULL
+  ), E'\n') AS "Column privileges"`,
+	}
+
+	if version >= version95 {
+		columns = append(columns, `pg_catalog.array_to_string(ARRAY(
+    SELECT pol.polname || CASE WHEN pol.polcmd <> '*' THEN ' (' || pol.polcmd::pg_catalog.text || '):' ELSE ':' END
+      || CASE WHEN pol.polqual IS NOT NULL
+        THEN E'\n  (u): ' || pg_catalog.pg_get_expr(pol.polqual, pol.polrelid) ELSE '' END
+      || CASE WHEN pol.polwithcheck IS NOT NULL
+        THEN E'\n  (c): ' || pg_catalog.pg_get_expr(pol.polwithcheck, pol.polrelid) ELSE '' END
+      || CASE WHEN pol.polroles <> '{0}' THEN E'\n  to: ' || pg_catalog.array_to_string(ARRAY(
+        SELECT rolname FROM pg_catalog.pg_roles WHERE oid = ANY (pol.polroles) ORDER BY 1
+      ), ', ') ELSE '' END
+    FROM pg_catalog.pg_policy pol
+    WHERE pol.polrelid = c.oid
+  ), E'\n') AS "Policies"`)
+	}
+
+	query.where(fmt.Sprintf("c.relkind IN ('%s')", strings.Join([]string{relkindTable, relkindView, relkindMatView,
+		relkindSequence, relkindForeignTable, relkindPartitionedTable}, "', '")))
+
+	if pattern == "" {
+		query.where(`n.nspname !~ '^pg_' AND n.nspname <> 'information_schema'`)
+	}
+
+	query.matchNames(pattern, "n.nspname", "c.relname", "pg_catalog.pg_table_is_visible(c.oid)")
+
+	sql := fmt.Sprintf(`SELECT %s
+FROM pg_catalog.pg_class c
+  LEFT JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+%s
+ORDER BY 1, 2`, strings.Join(columns, ",\n  "), query.whereClause())
+
+	table, err := queryTable(ctx, tr.db, "Access privileges", sql, query.args...)
+	if err != nil {
+		return "", err
+	}
+
+	return table.render(), nil
+}
+
+// showViewSource shows the definition of a view like `\sv` does.
+func (tr Transmitter) showViewSource(ctx context.Context, command metaCommand) (string, error) {
+	view := command.object()
+	if view == "" {
+		return "", errors.New("view name is required")
+	}
+
+	rows, err := queryRows(ctx, tr.db, `SELECT pg_catalog.quote_ident(n.nspname) || '.' || pg_catalog.quote_ident(c.relname),
+  c.relkind::pg_catalog.text,
+  pg_catalog.array_to_string(ARRAY(
+    SELECT o FROM pg_catalog.unnest(c.reloptions) o WHERE o NOT LIKE 'check_option=%'
+  ), ', '),
+  (SELECT pg_catalog.upper(pg_catalog.substr(o, 14)) FROM pg_catalog.unnest(c.reloptions) o WHERE o LIKE 'check_option=%'),
+  pg_catalog.pg_get_viewdef(c.oid, true)
+FROM pg_catalog.pg_class c
+  JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE c.oid = $1::pg_catalog.text::pg_catalog.regclass::pg_catalog.oid`, view)
+	if err != nil {
+		return "", err
+	}
+
+	if len(rows) == 0 {
+		return "", errors.Errorf("relation %q does not exist", view)
+	}
+
+	name, kind, options, checkOption, definition := rows[0][0], rows[0][1], rows[0][2], rows[0][3], rows[0][4]
+
+	if kind != relkindView {
+		return "", errors.Errorf("%q is not a view", view)
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteString("CREATE OR REPLACE VIEW " + name)
+
+	if options != "" {
+		sb.WriteString(" WITH (" + options + ")")
+	}
+
+	sb.WriteString(" AS\n")
+	sb.WriteString(strings.TrimRight(strings.TrimRight(definition, "\n"), ";"))
+
+	if checkOption != "" {
+		sb.WriteString(fmt.Sprintf("\n  WITH %s CHECK OPTION", checkOption))
+	}
+
+	if !command.verbose {
+		return sb.String(), nil
+	}
+
+	return numberLines(sb.String(), func(string) bool { return true }), nil
+}
@@ -2,164 +2,191 @@
 2019 © Postgres.ai
 */
 
-// Package pgtransmission provides psql-commands transmission to retrieve meta information from a PostgreSQL clone.
+// Package pgtransmission provides psql meta-commands retrieving meta information from a PostgreSQL clone.
+// Meta-commands are implemented as catalog queries, their output is compatible with psql.
 package pgtransmission
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"os/exec"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/pkg/errors"
 
 	"gitlab.com/postgres-ai/database-lab/pkg/log"
-	"gitlab.com/postgres-ai/database-lab/pkg/services/provision/runners"
-
-	"gitlab.com/postgres-ai/joe/pkg/models"
-)
-
-const (
-	LogsEnabledDefault = true
-	Hidden             = "HIDDEN"
 )
 
+// Transmitter runs psql meta-commands using catalog queries.
 type Transmitter struct {
-	clone      models.Clone
-	logEnabled bool
+	db queryRunner
+}
+
+// NewPgTransmitter creates a new transmitter running meta-commands in the database.
+func NewPgTransmitter(db queryRunner) *Transmitter {
+	return &Transmitter{db: db}
 }
 
-func NewPgTransmitter(clone models.Clone, logEnabled bool) *Transmitter {
-	return &Transmitter{
-		clone:      clone,
-		logEnabled: logEnabled,
+// metaCommand defines a parsed meta-command, e.g. `\dt+ public.order*`.
+type metaCommand struct {
+	name    string
+	verbose bool
+	args    []string
+}
+
+// pattern returns the pattern of objects given to the meta-command.
+func (c metaCommand) pattern() string {
+	if len(c.args) == 0 {
+		return ""
 	}
+
+	return c.args[0]
 }
 
-func (tr Transmitter) Run(commandParam string) (string, error) {
-	cmdStr, err := prepareCommandParam(commandParam)
-	if err != nil {
-		return "", errors.Wrapf(err, "failed to prepare command")
+// object returns the name of the object given to the meta-command, which may contain spaces, e.g. "sum_prices(integer, text)".
+func (c metaCommand) object() string {
+	return strings.Join(c.args, " ")
+}
+
+// parseMetaCommand parses a meta-command and its arguments.
+func parseMetaCommand(command string) (metaCommand, error) {
+	fields := splitArgs(command)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], `\`) {
+		return metaCommand{}, errors.Errorf("invalid meta-command %q", command)
 	}
 
-	out, err := tr.runPsql(cmdStr)
-	if err != nil {
-		if runnerError, ok := err.(runners.RunnerError); ok {
-			return "", fmt.Errorf("psql error: %s", runnerError.Stderr)
+	name := strings.TrimPrefix(fields[0], `\`)
+
+	return metaCommand{
+		name:    strings.TrimSuffix(name, "+"),
+		verbose: strings.HasSuffix(name, "+"),
+		args:    fields[1:],
+	}, nil
+}
+
+// splitArgs splits a meta-command by spaces which are not enclosed in double quotes.
+func splitArgs(command string) []string {
+	args := []string{}
+	current := &strings.Builder{}
+	inQuotes := false
+
+	for _, r := range command {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+
+		case unicode.IsSpace(r) && !inQuotes:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+
+			continue
 		}
 
-		return "", errors.Wrapf(err, "failed to execute command")
+		current.WriteRune(r)
 	}
 
-	outFormatted := tr.format(out)
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
 
-	return outFormatted, nil
+	return args
 }
 
-func (tr Transmitter) runPsql(command string) ([]byte, error) {
-	tempFile, err := ioutil.TempFile("", "psql-query-*")
+// Run runs the meta-command and returns its output.
+func (tr Transmitter) Run(ctx context.Context, command string) (string, error) {
+	metaCmd, err := parseMetaCommand(command)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return "", err
 	}
 
-	defer func() {
-		err := os.Remove(tempFile.Name())
-		if err != nil {
-			log.Err(err)
-		}
-	}()
+	log.Dbg(fmt.Sprintf("Running meta-command: %q", command))
 
-	if _, err := tempFile.WriteString(command); err != nil {
-		return nil, errors.WithStack(err)
-	}
+	var output string
 
-	if err := tempFile.Close(); err != nil {
-		return nil, errors.WithStack(err)
-	}
+	switch metaCmd.name {
+	case "d":
+		if metaCmd.pattern() != "" {
+			output, err = tr.describeRelations(ctx, metaCmd)
+			break
+		}
 
-	cmdStr := fmt.Sprintf("%s psql %s -X -f %s",
-		commandEnvString(tr.clone), commandConnString(tr.clone), tempFile.Name())
+		output, err = tr.listRelations(ctx, metaCmd, relkindTable, relkindPartitionedTable, relkindView, relkindMatView,
+			relkindSequence, relkindForeignTable)
 
-	return executeCommand(cmdStr)
-}
+	case "dt":
+		output, err = tr.listRelations(ctx, metaCmd, relkindTable, relkindPartitionedTable)
 
-// format formats output.
-func (tr Transmitter) format(out []byte) string {
-	outFormatted := bytes.Trim(out, " \n")
+	case "di":
+		output, err = tr.listRelations(ctx, metaCmd, relkindIndex, relkindPartitionedIndex)
 
-	logOut := []byte(Hidden)
-	if tr.logEnabled {
-		logOut = outFormatted
-	}
+	case "dv":
+		output, err = tr.listRelations(ctx, metaCmd, relkindView)
 
-	log.Dbg(fmt.Sprintf(`SQLRun: output "%s"`, string(logOut)))
+	case "dm":
+		output, err = tr.listRelations(ctx, metaCmd, relkindMatView)
 
-	return string(outFormatted)
-}
+	case "ds":
+		output, err = tr.listRelations(ctx, metaCmd, relkindSequence)
 
-// Use for user defined commands to DB. Currently we only need
-// to support limited number of PSQL meta information commands.
-// That's why it's ok to restrict usage of some symbols.
-func prepareCommandParam(command string) (string, error) {
-	command = strings.Trim(command, " \n")
-	if len(command) == 0 {
-		return "", errors.New("empty command")
-	}
+	case "dp":
+		output, err = tr.listPrivileges(ctx, metaCmd)
 
-	// Psql file option (-f) allows to run any number of commands.
-	// We need to take measures to restrict multiple commands support,
-	// as we only check the first command.
+	case "df":
+		output, err = tr.listFunctions(ctx, metaCmd)
 
-	// User can run backslash commands on the same line with the first
-	// backslash command (even without space separator),
-	// e.g. `\d table1\d table2`.
+	case "dn":
+		output, err = tr.listSchemas(ctx, metaCmd)
 
-	// Remove all backslashes except the one in the beginning.
-	command = string(command[0]) + strings.ReplaceAll(command[1:], "\\", "")
+	case "du":
+		output, err = tr.listRoles(ctx, metaCmd)
 
-	// Semicolon creates possibility to run consequent command.
-	command = strings.ReplaceAll(command, ";", "")
+	case "dx":
+		output, err = tr.listExtensions(ctx, metaCmd)
 
-	// User can run any command (including DML queries) on other lines.
-	// Restricting usage of multiline commands.
-	command = strings.ReplaceAll(command, "\n", "")
+	case "dT":
+		output, err = tr.listTypes(ctx, metaCmd)
 
-	return command, nil
-}
+	case "dconfig":
+		output, err = tr.listSettings(ctx, metaCmd)
 
-// commandEnvString returns a string of environment variables to use.
-func commandEnvString(clone models.Clone) string {
-	return fmt.Sprintf("PGPASSWORD=%s PGSSLMODE=%s", clone.Password, clone.SSLMode)
-}
+	case "l":
+		output, err = tr.listDatabases(ctx, metaCmd)
 
-func commandConnString(clone models.Clone) string {
-	return fmt.Sprintf("--host=%s --port=%s --user=%q --dbname=%q",
-		clone.Host, clone.Port, clone.Username, clone.Name)
-}
+	case "sf":
+		output, err = tr.showFunctionSource(ctx, metaCmd)
 
-func executeCommand(cmdStr string) ([]byte, error) {
-	log.Dbg(fmt.Sprintf(`SQLRun: "%s"`, cmdStr))
+	case "sv":
+		output, err = tr.showViewSource(ctx, metaCmd)
 
-	var out bytes.Buffer
-	var stderr bytes.Buffer
+	default:
+		return "", errors.Errorf(`unsupported meta-command "\%s"`, metaCmd.name)
+	}
 
-	cmd := exec.Command("/bin/bash", "-c", cmdStr)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to run %q", command)
+	}
 
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
+	return strings.TrimRight(output, "\n"), nil
+}
 
-	// Psql with the file option returns error response to stderr with
-	// success exit code. In that case err will be nil, but we need
-	// to treat the case as error and read proper output.
-	err := cmd.Run()
-	if err != nil || stderr.String() != "" {
-		runnerError := runners.NewRunnerError(cmdStr, stderr.String(), err)
+// serverVersion returns the version of Postgres as a number, e.g. 120003.
+func (tr Transmitter) serverVersion(ctx context.Context) (int, error) {
+	rows, err := queryRows(ctx, tr.db, "SELECT pg_catalog.current_setting('server_version_num')")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get the server version")
+	}
+
+	if len(rows) == 0 {
+		return 0, errors.New("failed to get the server version")
+	}
 
-		log.Err(runnerError)
-		return nil, runnerError
+	version, err := strconv.Atoi(rows[0][0])
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid server version")
 	}
 
-	return out.Bytes(), nil
+	return version, nil
 }
@@ -0,0 +1,42 @@
+/*
+2020 © Postgres.ai
+*/
+
+package pgtransmission
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMetaCommand(t *testing.T) {
+	testCases := []struct {
+		command  string
+		expected metaCommand
+	}{
+		{command: `\d`, expected: metaCommand{name: "d", args: []string{}}},
+		{command: `\dt+ public.order*`, expected: metaCommand{name: "dt", verbose: true, args: []string{"public.order*"}}},
+		{command: " \\l+  postgres\n", expected: metaCommand{name: "l", verbose: true, args: []string{"postgres"}}},
+		{command: `\dT "My Types".*`, expected: metaCommand{name: "dT", args: []string{`"My Types".*`}}},
+		{command: `\sf+ sum_prices(integer, text)`, expected: metaCommand{name: "sf", verbose: true, args: []string{"sum_prices(integer,", "text)"}}},
+	}
+
+	for _, tc := range testCases {
+		command, err := parseMetaCommand(tc.command)
+		require.NoError(t, err, tc.command)
+		assert.Equal(t, tc.expected, command, tc.command)
+	}
+
+	for _, command := range []string{"", "select 1", "dt"} {
+		_, err := parseMetaCommand(command)
+		assert.Error(t, err, command)
+	}
+}
+
+func TestMetaCommandObject(t *testing.T) {
+	command, err := parseMetaCommand(`\sf sum_prices(integer,   text)`)
+	require.NoError(t, err)
+	assert.Equal(t, "sum_prices(integer, text)", command.object())
+}
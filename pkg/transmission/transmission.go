@@ -5,6 +5,11 @@
 // Package transmission contains runners to translate user commands to retrieve meta information from storage.
 package transmission
 
+import (
+	"context"
+)
+
+// Runner runs commands retrieving meta information.
 type Runner interface {
-	Run(command string) (output string, err error)
+	Run(ctx context.Context, command string) (output string, err error)
 }